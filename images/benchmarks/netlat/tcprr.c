@@ -0,0 +1,162 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// tcprr measures the round-trip time of request-response transactions over
+// TCP, as netperf's TCP_RR does: the client sends a byte over a single
+// connection and waits for the server to echo it, count times. It prints the
+// round-trip times in the format of ping's summary.
+//
+// Usage:
+//   tcprr server PORT
+//   tcprr client HOST PORT COUNT
+
+#include <err.h>
+#include <math.h>
+#include <netdb.h>
+#include <netinet/in.h>
+#include <netinet/tcp.h>
+#include <signal.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <sys/socket.h>
+#include <time.h>
+#include <unistd.h>
+
+// Echoes bytes on fd until the peer closes it.
+static void echo(int fd) {
+  char buf[64];
+  for (;;) {
+    ssize_t n = read(fd, buf, sizeof(buf));
+    if (n <= 0) {
+      return;
+    }
+    if (write(fd, buf, n) != n) {
+      return;
+    }
+  }
+}
+
+static int server(const char* port) {
+  int fd = socket(AF_INET, SOCK_STREAM, 0);
+  if (fd < 0) {
+    err(1, "socket");
+  }
+  int one = 1;
+  setsockopt(fd, SOL_SOCKET, SO_REUSEADDR, &one, sizeof(one));
+  struct sockaddr_in addr = {
+      .sin_family = AF_INET,
+      .sin_port = htons(atoi(port)),
+      .sin_addr.s_addr = htonl(INADDR_ANY),
+  };
+  if (bind(fd, (struct sockaddr*)&addr, sizeof(addr)) < 0) {
+    err(1, "bind");
+  }
+  if (listen(fd, 128) < 0) {
+    err(1, "listen");
+  }
+  // Children are not waited for.
+  signal(SIGCHLD, SIG_IGN);
+  for (;;) {
+    int conn = accept(fd, NULL, NULL);
+    if (conn < 0) {
+      err(1, "accept");
+    }
+    setsockopt(conn, IPPROTO_TCP, TCP_NODELAY, &one, sizeof(one));
+    pid_t pid = fork();
+    if (pid < 0) {
+      err(1, "fork");
+    }
+    if (pid == 0) {
+      close(fd);
+      echo(conn);
+      _exit(0);
+    }
+    close(conn);
+  }
+}
+
+static double now_ms(void) {
+  struct timespec ts;
+  clock_gettime(CLOCK_MONOTONIC, &ts);
+  return ts.tv_sec * 1e3 + ts.tv_nsec / 1e6;
+}
+
+static int client(const char* host, const char* port, long count) {
+  struct addrinfo hints = {
+      .ai_family = AF_UNSPEC,
+      .ai_socktype = SOCK_STREAM,
+  };
+  struct addrinfo* res;
+  int rc = getaddrinfo(host, port, &hints, &res);
+  if (rc != 0) {
+    errx(1, "getaddrinfo: %s", gai_strerror(rc));
+  }
+  int fd = socket(res->ai_family, res->ai_socktype, res->ai_protocol);
+  if (fd < 0) {
+    err(1, "socket");
+  }
+  if (connect(fd, res->ai_addr, res->ai_addrlen) < 0) {
+    err(1, "connect");
+  }
+  freeaddrinfo(res);
+  int one = 1;
+  setsockopt(fd, IPPROTO_TCP, TCP_NODELAY, &one, sizeof(one));
+
+  double min = 0, max = 0, sum = 0, sumsq = 0;
+  double start = now_ms();
+  for (long i = 0; i < count; i++) {
+    char c = 'x';
+    double before = now_ms();
+    if (write(fd, &c, 1) != 1) {
+      err(1, "write");
+    }
+    if (read(fd, &c, 1) != 1) {
+      errx(1, "read: connection closed after %ld transactions", i);
+    }
+    double rtt = now_ms() - before;
+    if (i == 0 || rtt < min) {
+      min = rtt;
+    }
+    if (rtt > max) {
+      max = rtt;
+    }
+    sum += rtt;
+    sumsq += rtt * rtt;
+  }
+  double elapsed = now_ms() - start;
+  close(fd);
+
+  double avg = sum / count;
+  // As ping computes mdev.
+  double mdev = sqrt(fabs(sumsq / count - avg * avg));
+  printf("%ld transactions in %.3f s\n", count, elapsed / 1e3);
+  printf("rtt min/avg/max/mdev = %.3f/%.3f/%.3f/%.3f ms\n", min, avg, max,
+         mdev);
+  return 0;
+}
+
+int main(int argc, char** argv) {
+  if (argc == 3 && strcmp(argv[1], "server") == 0) {
+    return server(argv[2]);
+  }
+  if (argc == 5 && strcmp(argv[1], "client") == 0) {
+    long count = atol(argv[4]);
+    if (count <= 0) {
+      errx(1, "invalid count %s", argv[4]);
+    }
+    return client(argv[2], argv[3], count);
+  }
+  errx(1, "usage: tcprr server PORT | tcprr client HOST PORT COUNT");
+}
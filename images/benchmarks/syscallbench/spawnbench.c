@@ -0,0 +1,101 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// spawnbench creates count processes, one after the other, waiting for each
+// to exit. Once all exited successfully, it prints "completed <count>".
+//
+// Modes:
+//   spawn     posix_spawn /bin/true.
+//   forkexec  fork, then exec /bin/true in the child.
+//   fork      fork, with the child exiting immediately.
+//
+// Usage:
+//   spawnbench MODE COUNT
+
+#define _GNU_SOURCE
+#include <spawn.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+extern char** environ;
+
+static char* const true_argv[] = {"/bin/true", NULL};
+
+static pid_t start_spawn(void) {
+  pid_t pid;
+  int err = posix_spawn(&pid, true_argv[0], NULL, NULL, true_argv, environ);
+  if (err != 0) {
+    fprintf(stderr, "posix_spawn: %s\n", strerror(err));
+    exit(1);
+  }
+  return pid;
+}
+
+static pid_t start_forkexec(void) {
+  pid_t pid = fork();
+  if (pid == 0) {
+    execve(true_argv[0], true_argv, environ);
+    _exit(127);
+  }
+  return pid;
+}
+
+static pid_t start_fork(void) {
+  pid_t pid = fork();
+  if (pid == 0) {
+    _exit(0);
+  }
+  return pid;
+}
+
+int main(int argc, char** argv) {
+  long count;
+  if (argc != 3 || (count = atol(argv[2])) <= 0) {
+    fprintf(stderr, "usage: %s spawn|forkexec|fork COUNT\n", argv[0]);
+    return 2;
+  }
+  pid_t (*start)(void);
+  if (strcmp(argv[1], "spawn") == 0) {
+    start = start_spawn;
+  } else if (strcmp(argv[1], "forkexec") == 0) {
+    start = start_forkexec;
+  } else if (strcmp(argv[1], "fork") == 0) {
+    start = start_fork;
+  } else {
+    fprintf(stderr, "unknown mode %s\n", argv[1]);
+    return 2;
+  }
+
+  for (long i = 0; i < count; i++) {
+    pid_t pid = start();
+    if (pid < 0) {
+      perror("fork");
+      return 1;
+    }
+    int status;
+    if (waitpid(pid, &status, 0) != pid) {
+      perror("waitpid");
+      return 1;
+    }
+    if (!WIFEXITED(status) || WEXITSTATUS(status) != 0) {
+      fprintf(stderr, "child %d failed with status %d\n", pid, status);
+      return 1;
+    }
+  }
+  printf("completed %ld\n", count);
+  return 0;
+}
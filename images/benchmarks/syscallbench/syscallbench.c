@@ -0,0 +1,155 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// syscallbench measures the cost of system calls by issuing each one
+// iterations times in a loop. For each, it prints a line:
+//
+//   <name> <nanoseconds per call> ns/op
+//
+// clock_gettime is measured both through the vDSO, which doesn't enter the
+// kernel when the vDSO is usable, and as a direct system call.
+//
+// Usage:
+//   syscallbench ITERATIONS
+
+#define _GNU_SOURCE
+#include <fcntl.h>
+#include <linux/futex.h>
+#include <pthread.h>
+#include <sched.h>
+#include <stdatomic.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <sys/syscall.h>
+#include <time.h>
+#include <unistd.h>
+
+static long iterations;
+
+static double now_ns(void) {
+  struct timespec ts;
+  clock_gettime(CLOCK_MONOTONIC, &ts);
+  return ts.tv_sec * 1e9 + ts.tv_nsec;
+}
+
+static void report(const char* name, double start) {
+  printf("%s %.1f ns/op\n", name, (now_ns() - start) / iterations);
+  fflush(stdout);
+}
+
+static void die(const char* msg) {
+  perror(msg);
+  exit(1);
+}
+
+static void bench_getpid(void) {
+  double start = now_ns();
+  for (long i = 0; i < iterations; i++) {
+    // glibc may cache getpid, so always make the system call.
+    syscall(SYS_getpid);
+  }
+  report("getpid", start);
+}
+
+static void bench_sched_yield(void) {
+  double start = now_ns();
+  for (long i = 0; i < iterations; i++) {
+    sched_yield();
+  }
+  report("sched_yield", start);
+}
+
+static void bench_read(void) {
+  int fd = open("/dev/zero", O_RDONLY);
+  if (fd < 0) {
+    die("open /dev/zero");
+  }
+  char c;
+  double start = now_ns();
+  for (long i = 0; i < iterations; i++) {
+    if (read(fd, &c, 1) != 1) {
+      die("read /dev/zero");
+    }
+  }
+  report("read_dev_zero", start);
+  close(fd);
+}
+
+static void bench_clock_gettime(void) {
+  struct timespec ts;
+  double start = now_ns();
+  for (long i = 0; i < iterations; i++) {
+    clock_gettime(CLOCK_MONOTONIC, &ts);
+  }
+  report("clock_gettime_vdso", start);
+
+  start = now_ns();
+  for (long i = 0; i < iterations; i++) {
+    syscall(SYS_clock_gettime, CLOCK_MONOTONIC, &ts);
+  }
+  report("clock_gettime_syscall", start);
+}
+
+// turn is the futex the futex benchmark's threads pass control through: the
+// main thread runs while it is even, the other while it is odd.
+static atomic_int turn;
+
+static void futex_wait(int val) {
+  while (atomic_load(&turn) == val) {
+    syscall(SYS_futex, &turn, FUTEX_WAIT_PRIVATE, val, NULL, NULL, 0);
+  }
+}
+
+static void futex_pass(void) {
+  atomic_fetch_add(&turn, 1);
+  syscall(SYS_futex, &turn, FUTEX_WAKE_PRIVATE, 1, NULL, NULL, 0);
+}
+
+static void* futex_partner(void* arg) {
+  (void)arg;
+  for (long i = 0; i < iterations; i++) {
+    futex_wait(2 * i);
+    futex_pass();
+  }
+  return NULL;
+}
+
+// bench_futex measures wake/wait pairs: each iteration, the main thread
+// wakes the other and waits for it to wake it back.
+static void bench_futex(void) {
+  pthread_t partner;
+  if (pthread_create(&partner, NULL, futex_partner, NULL) != 0) {
+    die("pthread_create");
+  }
+  double start = now_ns();
+  for (long i = 0; i < iterations; i++) {
+    futex_pass();
+    futex_wait(2 * i + 1);
+  }
+  report("futex_wake_wait", start);
+  pthread_join(partner, NULL);
+}
+
+int main(int argc, char** argv) {
+  if (argc != 2 || (iterations = atol(argv[1])) <= 0) {
+    fprintf(stderr, "usage: %s ITERATIONS\n", argv[0]);
+    return 2;
+  }
+  bench_getpid();
+  bench_sched_yield();
+  bench_read();
+  bench_clock_gettime();
+  bench_futex();
+  return 0;
+}
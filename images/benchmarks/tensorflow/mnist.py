@@ -0,0 +1,66 @@
+# python3
+# Copyright 2020 The gVisor Authors.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""Trains a small convolutional network on MNIST, for benchmarking.
+
+The number of threads is taken from OMP_NUM_THREADS, and the number of training
+steps from the first argument. The result is printed as a single line:
+
+  RESULT steps=<steps> seconds=<seconds> examples_per_sec=<examples/sec>
+"""
+
+import os
+import sys
+import time
+
+import tensorflow as tf
+
+BATCH_SIZE = 64
+
+threads = int(os.environ.get("OMP_NUM_THREADS", "0"))
+tf.config.threading.set_intra_op_parallelism_threads(threads)
+tf.config.threading.set_inter_op_parallelism_threads(threads)
+
+steps = int(sys.argv[1]) if len(sys.argv) > 1 else 100
+
+(x_train, y_train), _ = tf.keras.datasets.mnist.load_data()
+x_train = x_train[..., tf.newaxis].astype("float32") / 255.0
+dataset = (
+    tf.data.Dataset.from_tensor_slices((x_train, y_train))
+    .shuffle(10000, seed=1)
+    .batch(BATCH_SIZE)
+    .repeat()
+)
+
+tf.random.set_seed(1)
+model = tf.keras.Sequential([
+    tf.keras.layers.Conv2D(32, 3, activation="relu", input_shape=(28, 28, 1)),
+    tf.keras.layers.MaxPooling2D(),
+    tf.keras.layers.Flatten(),
+    tf.keras.layers.Dense(128, activation="relu"),
+    tf.keras.layers.Dense(10),
+])
+model.compile(
+    optimizer="adam",
+    loss=tf.keras.losses.SparseCategoricalCrossentropy(from_logits=True),
+)
+
+# Build the model and warm up outside of the measurement.
+model.fit(dataset, steps_per_epoch=1, epochs=1, verbose=0)
+
+start = time.time()
+model.fit(dataset, steps_per_epoch=steps, epochs=1, verbose=0)
+seconds = time.time() - start
+
+print("RESULT steps=%d seconds=%f examples_per_sec=%f" %
+      (steps, seconds, steps * BATCH_SIZE / seconds))
@@ -0,0 +1,139 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary client is the load generator for the WebSocket benchmark.
+//
+// It opens a number of connections to an echo server, sends a fixed number
+// of messages on each, and waits for every echo before sending the next.
+// Results are printed as "<name> <value>" lines, one per metric.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"golang.org/x/net/websocket"
+	"gvisor.dev/images/benchmarks/websocket/histogram"
+)
+
+var (
+	url         = flag.String("url", "ws://localhost:8080/echo", "URL of the echo server")
+	connections = flag.Int("connections", 10, "number of concurrent connections")
+	messages    = flag.Int("messages", 1000, "number of messages sent on each connection")
+	size        = flag.Int("size", 64, "size of each message in bytes")
+)
+
+// result is the outcome of a load run.
+type result struct {
+	connections int
+	elapsed     time.Duration
+	latency     histogram.Histogram
+}
+
+// run opens connections to url, sends messages of size bytes on each and
+// records the round-trip time of every message.
+//
+// All connections are established before the first message is sent, so
+// connection setup is not part of the measured interval.
+func run(url string, connections, messages, size int) (*result, error) {
+	conns := make([]*websocket.Conn, 0, connections)
+	defer func() {
+		for _, ws := range conns {
+			ws.Close()
+		}
+	}()
+	for i := 0; i < connections; i++ {
+		ws, err := websocket.Dial(url, "", "http://localhost/")
+		if err != nil {
+			return nil, fmt.Errorf("dial %d failed: %v", i, err)
+		}
+		conns = append(conns, ws)
+	}
+
+	payload := bytes.Repeat([]byte{'x'}, size)
+	hists := make([]histogram.Histogram, connections)
+	errs := make(chan error, connections)
+	start := time.Now()
+	for i, ws := range conns {
+		go func(ws *websocket.Conn, h *histogram.Histogram) {
+			errs <- exchange(ws, h, payload, messages)
+		}(ws, &hists[i])
+	}
+	var firstErr error
+	for range conns {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	r := &result{
+		connections: connections,
+		elapsed:     time.Since(start),
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	for i := range hists {
+		r.latency.Merge(&hists[i])
+	}
+	return r, nil
+}
+
+// exchange sends payload on ws messages times, waiting for each echo and
+// recording its round-trip time in h.
+func exchange(ws *websocket.Conn, h *histogram.Histogram, payload []byte, messages int) error {
+	var reply []byte
+	for i := 0; i < messages; i++ {
+		sent := time.Now()
+		if err := websocket.Message.Send(ws, payload); err != nil {
+			return fmt.Errorf("send failed: %v", err)
+		}
+		if err := websocket.Message.Receive(ws, &reply); err != nil {
+			return fmt.Errorf("receive failed: %v", err)
+		}
+		h.Record(time.Since(sent))
+		if len(reply) != len(payload) {
+			return fmt.Errorf("echo got %d bytes, want %d", len(reply), len(payload))
+		}
+	}
+	return nil
+}
+
+// write prints r in the format parsed by the benchmark.
+func (r *result) write(w io.Writer) {
+	us := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Microsecond)
+	}
+	fmt.Fprintf(w, "connections %d\n", r.connections)
+	fmt.Fprintf(w, "messages %d\n", r.latency.Count())
+	fmt.Fprintf(w, "elapsed_seconds %.3f\n", r.elapsed.Seconds())
+	fmt.Fprintf(w, "messages_per_second %.1f\n", float64(r.latency.Count())/r.elapsed.Seconds())
+	fmt.Fprintf(w, "mean_latency_us %.1f\n", us(r.latency.Mean()))
+	fmt.Fprintf(w, "p50_latency_us %.1f\n", us(r.latency.Percentile(50)))
+	fmt.Fprintf(w, "p99_latency_us %.1f\n", us(r.latency.Percentile(99)))
+	fmt.Fprintf(w, "max_latency_us %.1f\n", us(r.latency.Max()))
+}
+
+func main() {
+	flag.Parse()
+	r, err := run(*url, *connections, *messages, *size)
+	if err != nil {
+		log.Fatalf("run failed: %v", err)
+	}
+	r.write(os.Stdout)
+}
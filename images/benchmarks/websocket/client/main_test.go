@@ -0,0 +1,109 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func echoServer(t *testing.T, delay time.Duration) string {
+	t.Helper()
+	s := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		defer ws.Close()
+		for {
+			var msg []byte
+			if err := websocket.Message.Receive(ws, &msg); err != nil {
+				return
+			}
+			time.Sleep(delay)
+			if err := websocket.Message.Send(ws, msg); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(s.Close)
+	return "ws" + strings.TrimPrefix(s.URL, "http") + "/echo"
+}
+
+func TestRun(t *testing.T) {
+	const (
+		connections = 4
+		messages    = 25
+		delay       = 2 * time.Millisecond
+	)
+	r, err := run(echoServer(t, delay), connections, messages, 128)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if got, want := r.latency.Count(), uint64(connections*messages); got != want {
+		t.Errorf("recorded %d round trips, want %d", got, want)
+	}
+	// Every round trip includes the server-side delay.
+	if got := r.latency.Percentile(1); got < delay {
+		t.Errorf("p1 latency got: %v, want: >= %v", got, delay)
+	}
+	if p99, max := r.latency.Percentile(99), r.latency.Max(); p99 > max {
+		t.Errorf("p99 latency %v exceeds max latency %v", p99, max)
+	}
+}
+
+func TestRunDialError(t *testing.T) {
+	if _, err := run("ws://127.0.0.1:1/echo", 1, 1, 1); err == nil {
+		t.Errorf("run against a closed port succeeded, want error")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	r := &result{
+		connections: 2,
+		elapsed:     2 * time.Second,
+	}
+	// Microsecond values are bucketed, so the percentiles are not printed
+	// exactly; mean and max are.
+	for i := 1; i <= 100; i++ {
+		r.latency.Record(time.Duration(i) * time.Microsecond)
+	}
+	var buf bytes.Buffer
+	r.write(&buf)
+
+	want := map[string]string{
+		"connections":         "2",
+		"messages":            "100",
+		"messages_per_second": "50.0",
+		"mean_latency_us":     "50.5",
+		"max_latency_us":      "100.0",
+	}
+	line := regexp.MustCompile(`^(\w+) (\S+)$`)
+	got := make(map[string]string)
+	for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		m := line.FindStringSubmatch(l)
+		if m == nil {
+			t.Fatalf("unparseable line %q", l)
+		}
+		got[m[1]] = m[2]
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s got: %q, want: %q", k, got[k], v)
+		}
+	}
+}
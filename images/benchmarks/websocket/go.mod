@@ -0,0 +1,5 @@
+module gvisor.dev/images/benchmarks/websocket
+
+go 1.14
+
+require golang.org/x/net v0.0.0-20190620200207-3b0461eec859
@@ -0,0 +1,139 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package histogram records round-trip latencies for the WebSocket benchmark.
+package histogram
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// subBucketBits is the number of significant bits kept for each recorded
+// value. Values are exact below 1<<subBucketBits nanoseconds, and are
+// otherwise bucketed with a relative error of less than 1/(1<<(subBucketBits-1)).
+const subBucketBits = 7
+
+// halfSubBuckets is the number of sub-buckets per power of two above the
+// exact range.
+const halfSubBuckets = 1 << (subBucketBits - 1)
+
+// Histogram is a log-linear histogram of durations.
+//
+// The zero value is an empty histogram ready to use. A Histogram is not safe
+// for concurrent use; record into one per goroutine and Merge the results.
+type Histogram struct {
+	counts []uint64
+	total  uint64
+	sum    time.Duration
+	max    time.Duration
+}
+
+// bucket returns the index of the bucket holding v.
+func bucket(v uint64) int {
+	shift := bits.Len64(v) - subBucketBits
+	if shift <= 0 {
+		return int(v)
+	}
+	return shift*halfSubBuckets + int(v>>uint(shift))
+}
+
+// upperBound returns the largest value held by bucket i.
+func upperBound(i int) uint64 {
+	if i < 2*halfSubBuckets {
+		return uint64(i)
+	}
+	shift := i/halfSubBuckets - 1
+	top := uint64(i - shift*halfSubBuckets)
+	return (top+1)<<uint(shift) - 1
+}
+
+// Record adds d to the histogram. Negative durations are recorded as zero.
+func (h *Histogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	i := bucket(uint64(d))
+	if i >= len(h.counts) {
+		counts := make([]uint64, i+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[i]++
+	h.total++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// Merge adds all values recorded in o to h.
+func (h *Histogram) Merge(o *Histogram) {
+	if len(o.counts) > len(h.counts) {
+		counts := make([]uint64, len(o.counts))
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	h.total += o.total
+	h.sum += o.sum
+	if o.max > h.max {
+		h.max = o.max
+	}
+}
+
+// Count returns the number of recorded values.
+func (h *Histogram) Count() uint64 {
+	return h.total
+}
+
+// Mean returns the exact mean of the recorded values.
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.total)
+}
+
+// Max returns the exact largest recorded value.
+func (h *Histogram) Max() time.Duration {
+	return h.max
+}
+
+// Percentile returns the nearest-rank p-th percentile (0 < p <= 100) of the
+// recorded values, rounded up to the bucket boundary. The result never
+// exceeds Max.
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(h.total)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			if v := time.Duration(upperBound(i)); v < h.max {
+				return v
+			}
+			break
+		}
+	}
+	return h.max
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package histogram
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestEmpty(t *testing.T) {
+	var h Histogram
+	if got := h.Count(); got != 0 {
+		t.Errorf("Count got: %d, want: 0", got)
+	}
+	if got := h.Mean(); got != 0 {
+		t.Errorf("Mean got: %v, want: 0", got)
+	}
+	if got := h.Percentile(99); got != 0 {
+		t.Errorf("Percentile(99) got: %v, want: 0", got)
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	for i := 0; i < 64*halfSubBuckets; i++ {
+		if got := bucket(upperBound(i)); got != i {
+			t.Fatalf("bucket(upperBound(%d)) got: %d, want: %d", i, got, i)
+		}
+		if got := bucket(upperBound(i) + 1); got != i+1 {
+			t.Fatalf("bucket(upperBound(%d)+1) got: %d, want: %d", i, got, i+1)
+		}
+		if upperBound(i) == 1<<63-1 {
+			break
+		}
+	}
+}
+
+func TestExact(t *testing.T) {
+	var h Histogram
+	for i := 1; i <= 100; i++ {
+		h.Record(time.Duration(i))
+	}
+	for _, tc := range []struct {
+		p    float64
+		want time.Duration
+	}{
+		{p: 1, want: 1},
+		{p: 50, want: 50},
+		{p: 99, want: 99},
+		{p: 99.5, want: 100},
+		{p: 100, want: 100},
+	} {
+		if got := h.Percentile(tc.p); got != tc.want {
+			t.Errorf("Percentile(%v) got: %v, want: %v", tc.p, got, tc.want)
+		}
+	}
+	if got, want := h.Mean(), time.Duration(50); got != want {
+		t.Errorf("Mean got: %v, want: %v", got, want)
+	}
+	if got, want := h.Max(), time.Duration(100); got != want {
+		t.Errorf("Max got: %v, want: %v", got, want)
+	}
+}
+
+func TestRelativeError(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var h Histogram
+	values := make([]time.Duration, 10000)
+	for i := range values {
+		// Spread values from microseconds to seconds.
+		values[i] = time.Duration(r.ExpFloat64() * float64(5*time.Millisecond))
+		h.Record(values[i])
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	for _, p := range []float64{50, 90, 99, 99.9} {
+		want := values[int(p/100*float64(len(values)))-1]
+		got := h.Percentile(p)
+		if got < want || float64(got-want) > float64(want)/halfSubBuckets {
+			t.Errorf("Percentile(%v) got: %v, want: %v within %.1f%%", p, got, want, 100.0/halfSubBuckets)
+		}
+	}
+	if got, want := h.Max(), values[len(values)-1]; got != want {
+		t.Errorf("Max got: %v, want: %v", got, want)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	var a, b, all Histogram
+	for i := 0; i < 1000; i++ {
+		d := time.Duration(i) * time.Microsecond
+		all.Record(d)
+		if i%3 == 0 {
+			a.Record(d)
+		} else {
+			b.Record(d)
+		}
+	}
+	a.Merge(&b)
+	if a.Count() != all.Count() || a.Mean() != all.Mean() || a.Max() != all.Max() {
+		t.Errorf("merged got: count %d mean %v max %v, want: count %d mean %v max %v",
+			a.Count(), a.Mean(), a.Max(), all.Count(), all.Mean(), all.Max())
+	}
+	for _, p := range []float64{50, 99, 100} {
+		if got, want := a.Percentile(p), all.Percentile(p); got != want {
+			t.Errorf("merged Percentile(%v) got: %v, want: %v", p, got, want)
+		}
+	}
+}
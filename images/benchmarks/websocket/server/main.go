@@ -0,0 +1,58 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary server is a WebSocket echo server for the WebSocket benchmark.
+//
+// Every message received on /echo is sent back unchanged on the same
+// connection.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"golang.org/x/net/websocket"
+)
+
+var port = flag.Int("port", 8080, "port to listen on")
+
+// echo sends every message received on ws back to the peer, preserving
+// message boundaries.
+func echo(ws *websocket.Conn) {
+	defer ws.Close()
+	for {
+		var msg []byte
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			if err != io.EOF {
+				log.Printf("receive failed: %v", err)
+			}
+			return
+		}
+		if err := websocket.Message.Send(ws, msg); err != nil {
+			log.Printf("send failed: %v", err)
+			return
+		}
+	}
+}
+
+func main() {
+	flag.Parse()
+	http.Handle("/echo", websocket.Handler(echo))
+	addr := fmt.Sprintf(":%d", *port)
+	log.Printf("listening on %s", addr)
+	log.Fatal(http.ListenAndServe(addr, nil))
+}
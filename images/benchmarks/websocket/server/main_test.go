@@ -0,0 +1,50 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestEcho(t *testing.T) {
+	s := httptest.NewServer(websocket.Handler(echo))
+	defer s.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(s.URL, "http"), "", s.URL)
+	if err != nil {
+		t.Fatalf("websocket.Dial failed: %v", err)
+	}
+	defer ws.Close()
+
+	// Messages larger than a single read buffer must come back whole.
+	for _, size := range []int{1, 64, 1 << 16} {
+		want := bytes.Repeat([]byte{'x'}, size)
+		if err := websocket.Message.Send(ws, want); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+		var got []byte
+		if err := websocket.Message.Receive(ws, &got); err != nil {
+			t.Fatalf("receive failed: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("echo of %d bytes got %d bytes back", size, len(got))
+		}
+	}
+}
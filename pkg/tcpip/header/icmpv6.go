@@ -108,6 +108,13 @@ const (
 	ICMPv6NeighborSolicit ICMPv6Type = 135
 	ICMPv6NeighborAdvert  ICMPv6Type = 136
 	ICMPv6RedirectMsg     ICMPv6Type = 137
+
+	// Multicast Listener Discovery (MLD) messages, see RFC 2710 and RFC 3810.
+
+	ICMPv6MulticastListenerQuery    ICMPv6Type = 130
+	ICMPv6MulticastListenerReport   ICMPv6Type = 131
+	ICMPv6MulticastListenerDone     ICMPv6Type = 132
+	ICMPv6MulticastListenerV2Report ICMPv6Type = 143
 )
 
 // Values for ICMP code as defined in RFC 4443.
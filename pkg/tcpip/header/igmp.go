@@ -0,0 +1,38 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import "gvisor.dev/gvisor/pkg/tcpip"
+
+const (
+	// IGMPProtocolNumber is the IGMP transport protocol number.
+	IGMPProtocolNumber tcpip.TransportProtocolNumber = 2
+
+	// IGMPMinimumSize is the size of an IGMPv1 or IGMPv2 message, and the
+	// minimum size of an IGMP message.
+	IGMPMinimumSize = 8
+)
+
+// IGMPType is the IGMP type field.
+type IGMPType byte
+
+// Values of IGMPType defined in RFC 2236 and RFC 3376.
+const (
+	IGMPMembershipQuery    IGMPType = 0x11
+	IGMPv1MembershipReport IGMPType = 0x12
+	IGMPv2MembershipReport IGMPType = 0x16
+	IGMPLeaveGroup         IGMPType = 0x17
+	IGMPv3MembershipReport IGMPType = 0x22
+)
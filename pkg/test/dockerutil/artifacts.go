@@ -0,0 +1,98 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// EnableFailureArtifacts makes CleanUp save diagnostics about the container
+// before removing it, if t has failed by then: its logs, its 'docker inspect'
+// output and the runsc debug logs written while it ran. They are
+// written to dir, or to the test's undeclared outputs directory if dir is
+// empty. Failures to save them are only logged.
+func (c *Container) EnableFailureArtifacts(t testing.TB, dir string) {
+	c.artifactsTest = t
+	c.artifactsDir = dir
+}
+
+// saveFailureArtifacts saves the diagnostics enabled by
+// EnableFailureArtifacts, if the test has failed.
+func (c *Container) saveFailureArtifacts(ctx context.Context) {
+	if c.artifactsTest == nil || !c.artifactsTest.Failed() || c.id == "" {
+		return
+	}
+	dir := c.artifactsDir
+	if dir == "" {
+		dir = os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR")
+	}
+	if dir == "" {
+		c.logger.Logf("not saving artifacts of container %s: no output directory", c.Name)
+		return
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		c.logger.Logf("not saving artifacts of container %s: %v", c.Name, err)
+		return
+	}
+	save := func(suffix string, data []byte) {
+		path := filepath.Join(dir, c.Name+suffix)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			c.logger.Logf("failed to save artifact of container %s: %v", c.Name, err)
+			return
+		}
+		c.logger.Logf("saved artifact of container %s to %s", c.Name, path)
+	}
+
+	if logs, err := c.Logs(ctx); err != nil {
+		c.logger.Logf("failed to get logs of container %s: %v", c.Name, err)
+	} else {
+		save(".log", []byte(logs))
+	}
+
+	_, raw, err := c.client.ContainerInspectWithRaw(ctx, c.id, false)
+	if err != nil {
+		c.logger.Logf("failed to inspect container %s: %v", c.Name, err)
+		return
+	}
+	var inspect bytes.Buffer
+	if err := json.Indent(&inspect, raw, "", "  "); err != nil {
+		inspect.Reset()
+		inspect.Write(raw)
+	}
+	save(".inspect.json", inspect.Bytes())
+
+	paths, err := c.RunscLogPaths(ctx)
+	if err != nil {
+		if !errors.Is(err, ErrNotRunsc) && !errors.Is(err, ErrNoDebugLog) {
+			c.logger.Logf("failed to find runsc logs of container %s: %v", c.Name, err)
+		}
+		return
+	}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			c.logger.Logf("failed to read runsc log of container %s: %v", c.Name, err)
+			continue
+		}
+		save(".runsc."+filepath.Base(path), data)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+// BuildOpts are options for building an image.
+type BuildOpts struct {
+	// ContextDir is the build context directory on the host.
+	ContextDir string
+
+	// Dockerfile is the path of the Dockerfile relative to ContextDir. If
+	// empty, "Dockerfile" is used.
+	Dockerfile string
+
+	// BuildArgs are the build-time variables, as for '--build-arg'.
+	BuildArgs map[string]string
+
+	// Target is the build stage to build, as for '--target'.
+	Target string
+}
+
+// invalidTagChars matches characters that can't appear in an image tag.
+var invalidTagChars = regexp.MustCompile("[^a-z0-9._-]+")
+
+// BuildImage is analogous to 'docker build'. It returns the name of the built
+// image, relative to images/ as for RunOpts.Image. Build output is logged.
+//
+// If logger is a *testing.T or *testing.B, the image is removed when the test
+// completes. Otherwise the caller must remove it.
+func BuildImage(ctx context.Context, logger testutil.Logger, opts BuildOpts) (string, error) {
+	client, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		return "", err
+	}
+	client.NegotiateAPIVersion(ctx)
+
+	name := "build/" + invalidTagChars.ReplaceAllString(strings.ToLower(testutil.RandomID(logger.Name())), "-")
+	tag := testutil.ImageByName(name)
+
+	buildContext, err := tarDirectory(opts.ContextDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to archive build context %q: %v", opts.ContextDir, err)
+	}
+	defer buildContext.Close()
+
+	buildArgs := make(map[string]*string, len(opts.BuildArgs))
+	for k, v := range opts.BuildArgs {
+		v := v
+		buildArgs[k] = &v
+	}
+	resp, err := client.ImageBuild(ctx, buildContext, types.ImageBuildOptions{
+		Tags:        []string{tag},
+		Dockerfile:  opts.Dockerfile,
+		BuildArgs:   buildArgs,
+		Target:      opts.Target,
+		Remove:      true,
+		ForceRemove: true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("docker build failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if c, ok := logger.(interface{ Cleanup(func()) }); ok {
+		c.Cleanup(func() {
+			if _, err := client.ImageRemove(context.Background(), tag, types.ImageRemoveOptions{Force: true, PruneChildren: true}); err != nil {
+				logger.Logf("error removing image %q: %v", tag, err)
+			}
+		})
+	}
+
+	// The build completes once its output stream is drained. Each message
+	// carries either build output or a build error.
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			Stream string `json:"stream"`
+			Error  string `json:"error"`
+		}
+		if err := dec.Decode(&msg); err == io.EOF {
+			break
+		} else if err != nil {
+			return "", fmt.Errorf("failed to read build output: %v", err)
+		}
+		if msg.Error != "" {
+			return "", fmt.Errorf("docker build failed: %s", msg.Error)
+		}
+		if out := strings.TrimRight(msg.Stream, "\n"); out != "" {
+			logger.Logf("build: %s", out)
+		}
+	}
+	return name, nil
+}
+
+// tarDirectory returns a tar stream of the contents of dir.
+func tarDirectory(dir string) (io.ReadCloser, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(writeTar(w, dir, ""))
+	}()
+	return r, nil
+}
+
+// writeTar writes the tree rooted at src to w, with paths inside the archive
+// rooted at dst. Mode bits are preserved.
+func writeTar(w io.Writer, src, dst string) error {
+	tw := tar.NewWriter(w)
+	if err := filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(filepath.Join(dst, rel))
+		if name == "." {
+			return nil
+		}
+
+		var link string
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	}); err != nil {
+		return err
+	}
+	return tw.Close()
+}
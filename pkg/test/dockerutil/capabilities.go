@@ -0,0 +1,88 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+)
+
+// EffectiveCapabilities returns the effective capabilities of the container's
+// root process, as a bitmask with bit i set for capability i. The container
+// must be running.
+func (c *Container) EffectiveCapabilities(ctx context.Context) (uint64, error) {
+	out, err := c.Exec(ctx, ExecOpts{}, "grep", "CapEff:", "/proc/1/status")
+	if err != nil {
+		return 0, fmt.Errorf("reading capabilities of container %s: %v: %s", c.Name, err, out)
+	}
+	return parseCapEff(out)
+}
+
+// parseCapEff parses the CapEff line of /proc/[pid]/status.
+func parseCapEff(line string) (uint64, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 || fields[0] != "CapEff:" {
+		return 0, fmt.Errorf("unexpected capabilities line %q", line)
+	}
+	caps, err := strconv.ParseUint(fields[1], 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected capabilities line %q: %v", line, err)
+	}
+	return caps, nil
+}
+
+// CapabilityNames returns the names of the capabilities in the bitmask caps,
+// e.g. "CAP_NET_ADMIN", in increasing order.
+func CapabilityNames(caps uint64) []string {
+	var names []string
+	for cp := linux.Capability(0); cp.Ok(); cp++ {
+		if caps&(1<<uint(cp)) != 0 {
+			names = append(names, cp.String())
+		}
+	}
+	return names
+}
+
+// capabilityByName returns the capability with the given name.
+func capabilityByName(name string) (linux.Capability, bool) {
+	for cp := linux.Capability(0); cp.Ok(); cp++ {
+		if cp.String() == name {
+			return cp, true
+		}
+	}
+	return 0, false
+}
+
+// AssertHasCapability fails the test if the container's root process doesn't
+// have the named capability, e.g. "CAP_NET_ADMIN", in its effective set.
+func AssertHasCapability(t testing.TB, c *Container, name string) {
+	t.Helper()
+	cp, ok := capabilityByName(name)
+	if !ok {
+		t.Fatalf("unknown capability %q", name)
+	}
+	caps, err := c.EffectiveCapabilities(context.Background())
+	if err != nil {
+		t.Fatalf("EffectiveCapabilities() failed: %v", err)
+	}
+	if caps&(1<<uint(cp)) == 0 {
+		t.Errorf("container %s doesn't have %s, got capabilities %v", c.Name, name, CapabilityNames(caps))
+	}
+}
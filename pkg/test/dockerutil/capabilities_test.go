@@ -0,0 +1,60 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCapEff(t *testing.T) {
+	for _, tc := range []struct {
+		line    string
+		want    uint64
+		wantErr bool
+	}{
+		{line: "CapEff:\t00000000a80425fb\n", want: 0xa80425fb},
+		{line: "CapEff:\t0000000000000000\n", want: 0},
+		{line: "CapPrm:\t00000000a80425fb\n", wantErr: true},
+		{line: "CapEff:\tnotahex\n", wantErr: true},
+		{line: "", wantErr: true},
+	} {
+		got, err := parseCapEff(tc.line)
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Errorf("parseCapEff(%q) got err %v, want error: %t", tc.line, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("parseCapEff(%q) got %#x, want %#x", tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestCapabilityNames(t *testing.T) {
+	// CAP_CHOWN, CAP_KILL and CAP_NET_ADMIN.
+	got := CapabilityNames(1<<0 | 1<<5 | 1<<12)
+	want := []string{"CAP_CHOWN", "CAP_KILL", "CAP_NET_ADMIN"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CapabilityNames() got %v, want %v", got, want)
+	}
+	for _, name := range want {
+		if _, ok := capabilityByName(name); !ok {
+			t.Errorf("capabilityByName(%q) failed", name)
+		}
+	}
+	if cp, ok := capabilityByName("CAP_BOGUS"); ok {
+		t.Errorf("capabilityByName(%q) got %v, want none", "CAP_BOGUS", cp)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+// ErrCheckpointUnsupported is returned by CheckpointRestoreRoundTrip when the
+// docker daemon rejects checkpoints, e.g. because its experimental features
+// are disabled.
+var ErrCheckpointUnsupported = errors.New("docker daemon does not support checkpoints")
+
+// roundTripTimeout bounds each of the waits of CheckpointRestoreRoundTrip.
+const roundTripTimeout = 30 * time.Second
+
+// CheckpointRestoreRoundTrip checkpoints the running container c under the
+// given checkpoint name, restores it, and waits for it to produce new output.
+// It then calls verify with the container's output up to the checkpoint and
+// the output produced since the restore, e.g. to check that a counter
+// continued rather than restarted.
+//
+// The output is read from the container's logs, so the container must log
+// its progress to stdout or stderr.
+func CheckpointRestoreRoundTrip(ctx context.Context, c *Container, name string, verify func(before, after string) error) error {
+	if err := c.Checkpoint(ctx, name); err != nil {
+		if isCheckpointUnsupported(err) {
+			return fmt.Errorf("%w: %v", ErrCheckpointUnsupported, err)
+		}
+		return fmt.Errorf("docker checkpoint failed: %v", err)
+	}
+	// The container exits once checkpointed, after which its output no
+	// longer changes.
+	if err := c.WaitTimeout(ctx, roundTripTimeout); err != nil {
+		return fmt.Errorf("waiting for checkpointed container %s to exit: %v", c.Name, err)
+	}
+	before, err := c.Logs(ctx)
+	if err != nil {
+		return err
+	}
+
+	// TODO(b/143498576): Remove Poll after github.com/moby/moby/issues/38963 is fixed.
+	if err := testutil.Poll(func() error { return c.Restore(ctx, name) }, 15*time.Second); err != nil {
+		return fmt.Errorf("docker restore failed: %v", err)
+	}
+
+	// The logs of the restored container follow those of the checkpointed
+	// one.
+	var after string
+	if err := testutil.Poll(func() error {
+		logs, err := c.Logs(ctx)
+		if err != nil {
+			return err
+		}
+		if after = strings.TrimPrefix(logs, before); after == "" {
+			return fmt.Errorf("no output from restored container %s", c.Name)
+		}
+		return nil
+	}, roundTripTimeout); err != nil {
+		return err
+	}
+	return verify(before, after)
+}
+
+// isCheckpointUnsupported returns true if err is the daemon's answer to a
+// checkpoint request when checkpoints aren't enabled.
+func isCheckpointUnsupported(err error) bool {
+	msg := err.Error()
+	// Without experimental features, older daemons don't route the request
+	// at all and newer ones reject it.
+	return strings.Contains(msg, "page not found") || strings.Contains(msg, "experimental")
+}
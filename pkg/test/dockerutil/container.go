@@ -17,6 +17,7 @@ package dockerutil
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -25,6 +26,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"testing"
 	"time"
 
 	"github.com/docker/docker/api/types"
@@ -32,8 +34,10 @@ import (
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
+	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/test/testutil"
 )
 
@@ -41,23 +45,53 @@ import (
 // user to configure and control as one would with the 'docker'
 // client. Container is backed by the offical golang docker API.
 // See: https://pkg.go.dev/github.com/docker/docker.
+//
+// Once the container is started, methods that only query or act on the
+// running container (WaitForOutput, WaitForOutputSubmatch, Logs, Status,
+// Exec, Kill, ...) and CleanUp may be called concurrently. Methods that
+// change its lifecycle (Create, Start, Spawn, Run, Rename, ...) must not be
+// called concurrently with any other method.
 type Container struct {
 	Name    string
 	Runtime string
 
-	logger   testutil.Logger
-	client   *client.Client
-	id       string
-	mounts   []mount.Mount
-	links    []string
-	cleanups []func()
-	copyErr  error
+	// Labels are set on the container when it is created, e.g. to find it
+	// with RemoveContainers.
+	Labels map[string]string
+
+	logger  testutil.Logger
+	client  *client.Client
+	id      string
+	mounts  []mount.Mount
+	links   []string
+	copyErr error
+
+	// artifactsTest and artifactsDir are set by EnableFailureArtifacts.
+	artifactsTest testing.TB
+	artifactsDir  string
+
+	// cleanUpMu serializes calls to CleanUp.
+	cleanUpMu sync.Mutex
 
-	// Stores streams attached to the container. Used by WaitForOutputSubmatch.
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// Stores streams attached to the container.
 	streams types.HijackedResponse
 
-	// stores previously read data from the attached streams.
-	streamBuf bytes.Buffer
+	// output captures the output read from the attached streams in the
+	// background. Used by WaitForOutputSubmatch. It is nil if the streams
+	// are read by a Process instead.
+	output *output
+
+	// cleanups are run by CleanUp.
+	cleanups []func() error
+
+	// startHooks are called once the container is started.
+	startHooks []func()
+
+	// cleanedUp is set once CleanUp has succeeded.
+	cleanedUp bool
 }
 
 // RunOpts are options for running a container.
@@ -69,24 +103,47 @@ type RunOpts struct {
 	// Memory is the memory limit in bytes.
 	Memory int
 
+	// MemorySwap is the limit in bytes of memory plus swap, so setting it to
+	// Memory disables swap. Zero uses the daemon's default and -1 allows
+	// unlimited swap.
+	MemorySwap int64
+
+	// MemorySwappiness is the swappiness of the container's memory, from 0
+	// to 100. Nil uses the daemon's default.
+	MemorySwappiness *int64
+
 	// Cpus in which to allow execution. ("0", "1", "0-2").
 	CpusetCpus string
 
+	// CPUQuota is the CPU time, in microseconds, that the container may use
+	// per 100ms period, e.g. 200000 for two cores. Zero means no limit.
+	CPUQuota int64
+
 	// Ports are the ports to be allocated.
 	Ports []int
 
 	// WorkDir sets the working directory.
 	WorkDir string
 
-	// ReadOnly sets the read-only flag.
+	// ReadOnly sets the read-only flag. Unless they are mounted over, tmpfs
+	// mounts are added at /tmp, /run and /var/run so that the usual scratch
+	// paths stay writable.
 	ReadOnly bool
 
+	// WritablePaths are paths at which tmpfs mounts are added, e.g. for the
+	// directories an application writes to when ReadOnly is set.
+	WritablePaths []string
+
 	// Env are additional environment variables.
 	Env []string
 
 	// User is the user to use.
 	User string
 
+	// GroupAdd are additional groups, by name or ID, that the user is a
+	// member of. These are added on top of the groups of User.
+	GroupAdd []string
+
 	// Privileged enables privileged mode.
 	Privileged bool
 
@@ -101,26 +158,141 @@ type RunOpts struct {
 
 	// Links is the list of containers to be connected to the container.
 	Links []string
+
+	// IpcMode is the IPC namespace to use for the container: "host",
+	// "container:<name>" or empty for a private namespace. A container that
+	// others join must itself use "shareable".
+	IpcMode string
+
+	// Init runs an init process (docker-init) as PID 1 in the container,
+	// which forwards signals and reaps zombies. Nil uses the daemon's default.
+	Init *bool
+
+	// StopSignal is the signal sent to stop the container, e.g. "SIGUSR1".
+	// Empty uses the image's configured stop signal.
+	StopSignal string
+
+	// OomScoreAdj is the OOM score adjustment of the container's processes.
+	// Nil leaves the default.
+	OomScoreAdj *int
+
+	// OomKillDisable disables the OOM killer for the container. Nil leaves
+	// the default.
+	OomKillDisable *bool
+
+	// PidMode is the PID namespace to use for the container: "host",
+	// "container:<name>" or empty for a private namespace.
+	PidMode string
+
+	// NetworkMode is the network namespace to use for the container:
+	// "host", "none", "container:<name>" or empty for the default network.
+	// Ports of a container that joins another's namespace are published by
+	// that container.
+	NetworkMode string
+
+	// CgroupParent is the cgroup under which the container's cgroup is
+	// created. Empty uses the daemon's default. See CgroupPath.
+	CgroupParent string
+
+	// GPUs are the GPUs to expose to the container, as for 'docker run
+	// --gpus': "all", a number of GPUs or "device=<id>[,<id>...]". Creating
+	// the container fails with ErrNoGPU if the daemon has no GPU support.
+	// It is not applied by ConfigsFrom.
+	GPUs string
+
+	// SkipAttach makes Spawn start the container without attaching to its
+	// streams, which saves a connection and a goroutine for the lifetime of
+	// the container. WaitForOutput then polls the container's logs instead.
+	SkipAttach bool
+
+	// HealthCheck is the health check of the container, which overrides the
+	// image's. See WaitHealthy.
+	HealthCheck *container.HealthConfig
+
+	// AutoRemove makes the daemon remove the container once it exits. Its
+	// logs are gone with it, so its output must be read with WaitForOutput
+	// while it runs: Run and Logs fail with ErrContainerRemoved.
+	AutoRemove bool
+
+	// ShmSize is the size of /dev/shm in bytes. Zero uses the daemon's
+	// default.
+	ShmSize int64
+
+	// DNS are the addresses of the name servers the container resolves
+	// names with, as for 'docker run --dns'. Empty uses the daemon's
+	// default.
+	DNS []string
+}
+
+// ErrContainerRemoved is returned when the container no longer exists, e.g.
+// because it was created with RunOpts.AutoRemove and exited.
+var ErrContainerRemoved = errors.New("container was removed")
+
+var (
+	// sharedClientOnce initializes sharedClientValue and sharedClientErr.
+	sharedClientOnce sync.Once
+
+	// sharedClientValue is the client shared by all containers.
+	sharedClientValue *client.Client
+
+	// sharedClientErr is the error creating sharedClientValue.
+	sharedClientErr error
+)
+
+// sharedClient returns the client shared by all containers. Sharing it means
+// that idle connections to the daemon are shared too, rather than kept open
+// for every container.
+func sharedClient(ctx context.Context) (*client.Client, error) {
+	sharedClientOnce.Do(func() {
+		sharedClientValue, sharedClientErr = client.NewClientWithOpts(client.FromEnv)
+		if sharedClientErr == nil {
+			sharedClientValue.NegotiateAPIVersion(ctx)
+		}
+	})
+	return sharedClientValue, sharedClientErr
 }
 
 // MakeContainer sets up the struct for a Docker container.
 //
 // Names of containers will be unique.
 func MakeContainer(ctx context.Context, logger testutil.Logger) *Container {
-	// Slashes are not allowed in container names.
-	name := testutil.RandomID(logger.Name())
-	name = strings.ReplaceAll(name, "/", "-")
-	client, err := client.NewClientWithOpts(client.FromEnv)
+	return MakeContainerWithRuntime(ctx, logger, *runtime)
+}
+
+// MakeContainerWithRuntime is like MakeContainer, but the container runs
+// under the given runtime instead of the one from the --runtime flag. An
+// empty runtime uses the daemon's default.
+func MakeContainerWithRuntime(ctx context.Context, logger testutil.Logger, runtime string) *Container {
+	client, err := sharedClient(ctx)
 	if err != nil {
 		return nil
 	}
+	return makeContainer(logger, client, runtime)
+}
 
+// MakeContainerOnHost is like MakeContainerWithRuntime, but the container is
+// run by the docker daemon at host, e.g. "unix:///path/to/docker.sock",
+// rather than the one from the environment. The helpers that look at the
+// daemon's host directly, such as SandboxProcesses or RunscLogPaths, only
+// work if the daemon runs locally.
+func MakeContainerOnHost(ctx context.Context, logger testutil.Logger, host, runtime string) *Container {
+	client, err := client.NewClientWithOpts(client.FromEnv, client.WithHost(host))
+	if err != nil {
+		logger.Logf("create client for %s failed with: %v", host, err)
+		return nil
+	}
 	client.NegotiateAPIVersion(ctx)
+	return makeContainer(logger, client, runtime)
+}
 
+func makeContainer(logger testutil.Logger, client *client.Client, runtime string) *Container {
+	// Slashes are not allowed in container names.
+	name := testutil.RandomID(logger.Name())
+	name = strings.ReplaceAll(name, "/", "-")
 	return &Container{
 		logger:  logger,
 		Name:    name,
-		Runtime: *runtime,
+		Runtime: runtime,
 		client:  client,
 	}
 }
@@ -130,6 +302,9 @@ func (c *Container) Spawn(ctx context.Context, r RunOpts, args ...string) error
 	if err := c.create(ctx, r, args); err != nil {
 		return err
 	}
+	if r.SkipAttach {
+		return c.startDetached(ctx)
+	}
 	return c.Start(ctx)
 }
 
@@ -144,11 +319,14 @@ func (c *Container) SpawnProcess(ctx context.Context, r RunOpts, args ...string)
 		return Process{}, err
 	}
 
-	if err := c.Start(ctx); err != nil {
+	// The process reads the streams itself.
+	if err := c.start(ctx, false /* capture */); err != nil {
 		return Process{}, err
 	}
 
-	return Process{container: c, conn: c.streams}, nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Process{container: c, conn: c.streams, tty: true}, nil
 }
 
 // Run is analogous to 'docker run'.
@@ -157,11 +335,12 @@ func (c *Container) Run(ctx context.Context, r RunOpts, args ...string) (string,
 		return "", err
 	}
 
-	if err := c.Start(ctx); err != nil {
+	// The output is read from the logs once the container exits.
+	if err := c.startDetached(ctx); err != nil {
 		return "", err
 	}
 
-	if err := c.Wait(ctx); err != nil {
+	if _, err := c.Wait(ctx); err != nil {
 		return "", err
 	}
 
@@ -180,15 +359,57 @@ func (c *Container) MakeLink(target string) string {
 }
 
 // CreateFrom creates a container from the given configs.
-func (c *Container) CreateFrom(ctx context.Context, conf *container.Config, hostconf *container.HostConfig, netconf *network.NetworkingConfig) error {
-	cont, err := c.client.ContainerCreate(ctx, conf, hostconf, netconf, c.Name)
+func (c *Container) CreateFrom(ctx context.Context, conf *container.Config, hostconf *container.HostConfig, netconf *network.NetworkingConfig) (err error) {
+	defer c.logOp("create", time.Now(), &err)
+	if err := EnsureImage(ctx, c.client, conf.Image); err != nil {
+		return err
+	}
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	if err := c.resolveNamespaceModes(ctx, hostconf); err != nil {
+		return err
+	}
+	id, err := c.createWithRetries(ctx, conf, hostconf, netconf)
 	if err != nil {
 		return err
 	}
-	c.id = cont.ID
+	c.id = id
 	return nil
 }
 
+// createWithRetries is ContainerCreate for this container, with retries, and
+// returns the ID of the created container.
+//
+// Creating is not idempotent: an attempt that fails transiently, e.g. with
+// a connection reset, may still have created the container. Retries then
+// fail with a name conflict. Container names are unique, so the container
+// with this name is then adopted.
+func (c *Container) createWithRetries(ctx context.Context, conf *container.Config, hostconf *container.HostConfig, netconf *network.NetworkingConfig) (string, error) {
+	var (
+		id       string
+		attempts int
+	)
+	err := c.retry(ctx, "create", func() error {
+		attempts++
+		cont, err := c.client.ContainerCreate(ctx, conf, hostconf, netconf, c.Name)
+		if err == nil {
+			id = cont.ID
+			return nil
+		}
+		if attempts == 1 || !errdefs.IsConflict(err) {
+			return err
+		}
+		resp, inspectErr := c.client.ContainerInspect(ctx, c.Name)
+		if inspectErr != nil {
+			return fmt.Errorf("%v, and looking up the container created by a previous attempt failed: %v", err, inspectErr)
+		}
+		c.logger.Logf("container %s was created by a previous attempt, using it", c.Name)
+		id = resp.ID
+		return nil
+	})
+	return id, err
+}
+
 // Create is analogous to 'docker create'.
 func (c *Container) Create(ctx context.Context, r RunOpts, args ...string) error {
 	return c.create(ctx, r, args)
@@ -197,14 +418,59 @@ func (c *Container) Create(ctx context.Context, r RunOpts, args ...string) error
 func (c *Container) create(ctx context.Context, r RunOpts, args []string) error {
 	conf := c.config(r, args)
 	hostconf := c.hostConfig(r)
-	cont, err := c.client.ContainerCreate(ctx, conf, hostconf, nil, c.Name)
-	if err != nil {
-		return err
+	if r.GPUs != "" {
+		if err := c.addGPUs(ctx, r.GPUs, conf, hostconf); err != nil {
+			return err
+		}
+	}
+	return c.CreateFrom(ctx, conf, hostconf, nil)
+}
+
+// resolveNamespaceModes replaces the container names referenced by the IPC,
+// PID and network namespace modes in hostconf with the IDs of those
+// containers.
+func (c *Container) resolveNamespaceModes(ctx context.Context, hostconf *container.HostConfig) error {
+	if hostconf.IpcMode.IsContainer() {
+		id, err := c.containerID(ctx, hostconf.IpcMode.Container())
+		if err != nil {
+			return err
+		}
+		hostconf.IpcMode = container.IpcMode("container:" + id)
+	}
+	if hostconf.PidMode.IsContainer() {
+		id, err := c.containerID(ctx, hostconf.PidMode.Container())
+		if err != nil {
+			return err
+		}
+		hostconf.PidMode = container.PidMode("container:" + id)
+	}
+	if hostconf.NetworkMode.IsContainer() {
+		id, err := c.containerID(ctx, hostconf.NetworkMode.ConnectedContainer())
+		if err != nil {
+			return err
+		}
+		hostconf.NetworkMode = container.NetworkMode("container:" + id)
 	}
-	c.id = cont.ID
 	return nil
 }
 
+// containerID returns the ID of the container with the given name or ID.
+func (c *Container) containerID(ctx context.Context, name string) (_ string, err error) {
+	defer c.logOp("inspect", time.Now(), &err)
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	var resp types.ContainerJSON
+	err = c.retry(ctx, "inspect", func() error {
+		var err error
+		resp, err = c.client.ContainerInspect(ctx, name)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve container %q: %v", name, err)
+	}
+	return resp.ID, nil
+}
+
 func (c *Container) config(r RunOpts, args []string) *container.Config {
 	ports := nat.PortSet{}
 	for _, p := range r.Ports {
@@ -220,73 +486,234 @@ func (c *Container) config(r RunOpts, args []string) *container.Config {
 		Env:          env,
 		WorkingDir:   r.WorkDir,
 		User:         r.User,
+		StopSignal:   r.StopSignal,
+		Healthcheck:  r.HealthCheck,
+		Labels:       c.Labels,
 	}
 }
 
 func (c *Container) hostConfig(r RunOpts) *container.HostConfig {
 	c.mounts = append(c.mounts, r.Mounts...)
+	c.mounts = append(c.mounts, writableMounts(r, c.mounts)...)
+
+	var oomScoreAdj int
+	if r.OomScoreAdj != nil {
+		oomScoreAdj = *r.OomScoreAdj
+	}
 
 	return &container.HostConfig{
 		Runtime:         c.Runtime,
 		Mounts:          c.mounts,
-		PublishAllPorts: true,
+		PublishAllPorts: !container.NetworkMode(r.NetworkMode).IsContainer(),
 		Links:           r.Links,
+		NetworkMode:     container.NetworkMode(r.NetworkMode),
 		CapAdd:          r.CapAdd,
 		CapDrop:         r.CapDrop,
+		GroupAdd:        r.GroupAdd,
 		Privileged:      r.Privileged,
 		ReadonlyRootfs:  r.ReadOnly,
+		IpcMode:         container.IpcMode(r.IpcMode),
+		PidMode:         container.PidMode(r.PidMode),
+		OomScoreAdj:     oomScoreAdj,
+		Init:            r.Init,
+		AutoRemove:      r.AutoRemove,
+		ShmSize:         r.ShmSize,
+		DNS:             r.DNS,
 		Resources: container.Resources{
-			Memory:     int64(r.Memory), // In bytes.
-			CpusetCpus: r.CpusetCpus,
+			Memory:           int64(r.Memory), // In bytes.
+			MemorySwap:       r.MemorySwap,
+			MemorySwappiness: r.MemorySwappiness,
+			CpusetCpus:       r.CpusetCpus,
+			CPUQuota:         r.CPUQuota,
+			OomKillDisable:   r.OomKillDisable,
+			CgroupParent:     r.CgroupParent,
 		},
 	}
 }
 
+// readOnlyWritablePaths are the paths kept writable when RunOpts.ReadOnly is
+// set.
+var readOnlyWritablePaths = []string{"/tmp", "/run", "/var/run"}
+
+// writableMounts returns the tmpfs mounts for r's writable paths, skipping
+// those that are already mounted over by mounts.
+func writableMounts(r RunOpts, mounts []mount.Mount) []mount.Mount {
+	paths := r.WritablePaths
+	if r.ReadOnly {
+		paths = append(readOnlyWritablePaths, paths...)
+	}
+	mounted := make(map[string]bool)
+	for _, m := range mounts {
+		mounted[path.Clean(m.Target)] = true
+	}
+	var tmpfs []mount.Mount
+	for _, p := range paths {
+		p = path.Clean(p)
+		if mounted[p] {
+			continue
+		}
+		mounted[p] = true
+		tmpfs = append(tmpfs, mount.Mount{
+			Type:   mount.TypeTmpfs,
+			Target: p,
+		})
+	}
+	return tmpfs
+}
+
 // Start is analogous to 'docker start'.
 func (c *Container) Start(ctx context.Context) error {
+	return c.start(ctx, true /* capture */)
+}
 
-	// Open a connection to the container for parsing logs and for TTY.
-	streams, err := c.client.ContainerAttach(ctx, c.id,
-		types.ContainerAttachOptions{
-			Stream: true,
-			Stdin:  true,
-			Stdout: true,
-			Stderr: true,
-		})
+// start starts the container. If capture is set, the output of the container
+// is read in the background for WaitForOutput.
+func (c *Container) start(ctx context.Context, capture bool) error {
+	streams, err := c.attach(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to connect to container: %v", err)
 	}
 
+	c.setStreams(streams, capture)
+	return c.startDetached(ctx)
+}
+
+// setStreams records the streams attached to the container, to be closed by
+// CleanUp. If capture is set, their output is read in the background.
+func (c *Container) setStreams(streams types.HijackedResponse, capture bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.streams = streams
-	c.cleanups = append(c.cleanups, func() {
-		c.streams.Close()
+	c.cleanups = append(c.cleanups, func() error {
+		streams.Close()
+		return nil
 	})
+	if capture {
+		out := newOutput()
+		c.output = out
+		go func() {
+			// The streams are closed when the container exits. Any other
+			// error ends the output early, which waiters treat the same.
+			stdcopy.StdCopy(out, out, streams.Reader)
+			out.close()
+		}()
+	}
+}
+
+// addCleanup registers a function to be run by CleanUp.
+func (c *Container) addCleanup(cleanup func() error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cleanups = append(c.cleanups, cleanup)
+}
+
+// startDetached starts the container without attaching to it.
+func (c *Container) startDetached(ctx context.Context) (err error) {
+	defer c.logOp("start", time.Now(), &err)
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	if err := c.retry(ctx, "start", func() error {
+		return c.client.ContainerStart(ctx, c.id, types.ContainerStartOptions{})
+	}); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	hooks := c.startHooks
+	c.mu.Unlock()
+	for _, hook := range hooks {
+		hook()
+	}
+	return nil
+}
 
-	return c.client.ContainerStart(ctx, c.id, types.ContainerStartOptions{})
+// onStart registers a function to be called whenever the container has been
+// started. It must not block.
+func (c *Container) onStart(hook func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.startHooks = append(c.startHooks, hook)
+}
+
+// attach opens a connection to the container for parsing logs and for TTY.
+func (c *Container) attach(ctx context.Context) (_ types.HijackedResponse, err error) {
+	defer c.logOp("attach", time.Now(), &err)
+	return c.client.ContainerAttach(ctx, c.id,
+		types.ContainerAttachOptions{
+			Stream: true,
+			Stdin:  true,
+			Stdout: true,
+			Stderr: true,
+		})
 }
 
 // Stop is analogous to 'docker stop'.
-func (c *Container) Stop(ctx context.Context) error {
+func (c *Container) Stop(ctx context.Context) (err error) {
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
 	return c.client.ContainerStop(ctx, c.id, nil)
 }
 
 // Pause is analogous to'docker pause'.
-func (c *Container) Pause(ctx context.Context) error {
+func (c *Container) Pause(ctx context.Context) (err error) {
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
 	return c.client.ContainerPause(ctx, c.id)
 }
 
 // Unpause is analogous to 'docker unpause'.
-func (c *Container) Unpause(ctx context.Context) error {
+func (c *Container) Unpause(ctx context.Context) (err error) {
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
 	return c.client.ContainerUnpause(ctx, c.id)
 }
 
 // Checkpoint is analogous to 'docker checkpoint'.
-func (c *Container) Checkpoint(ctx context.Context, name string) error {
-	return c.client.CheckpointCreate(ctx, c.Name, types.CheckpointCreateOptions{CheckpointID: name, Exit: true})
+func (c *Container) Checkpoint(ctx context.Context, name string) (err error) {
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	return c.client.CheckpointCreate(ctx, c.id, types.CheckpointCreateOptions{CheckpointID: name, Exit: true})
+}
+
+// Rename is analogous to 'docker rename'. The container keeps its ID.
+func (c *Container) Rename(ctx context.Context, newName string) (err error) {
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	if err := c.client.ContainerRename(ctx, c.id, newName); err != nil {
+		return err
+	}
+	c.Name = newName
+	return nil
+}
+
+// Commit is analogous to 'docker commit'. The image is tagged with reference,
+// relative to images/ as for RunOpts.Image. Changes are Dockerfile
+// instructions applied to the image, as for '--change', e.g. "CMD ls".
+//
+// It returns the image ID and a function that removes the image, which the
+// caller is responsible for calling.
+func (c *Container) Commit(ctx context.Context, reference string, changes ...string) (_ string, _ func(), err error) {
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	tag := testutil.ImageByName(reference)
+	resp, err := c.client.ContainerCommit(ctx, c.id, types.ContainerCommitOptions{
+		Reference: tag,
+		Changes:   changes,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() {
+		if _, err := c.client.ImageRemove(context.Background(), resp.ID, types.ImageRemoveOptions{Force: true, PruneChildren: true}); err != nil {
+			c.logger.Logf("error removing image %q: %v", tag, err)
+		}
+	}
+	return resp.ID, cleanup, nil
 }
 
 // Restore is analogous to 'docker start --checkname [name]'.
-func (c *Container) Restore(ctx context.Context, name string) error {
+func (c *Container) Restore(ctx context.Context, name string) (err error) {
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
 	return c.client.ContainerStart(ctx, c.id, types.ContainerStartOptions{CheckpointID: name})
 }
 
@@ -297,11 +724,13 @@ func (c *Container) Logs(ctx context.Context) (string, error) {
 	return out.String(), err
 }
 
-func (c *Container) logs(ctx context.Context, stdout, stderr *bytes.Buffer) error {
+func (c *Container) logs(ctx context.Context, stdout, stderr *bytes.Buffer) (err error) {
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
 	opts := types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true}
 	writer, err := c.client.ContainerLogs(ctx, c.id, opts)
 	if err != nil {
-		return err
+		return c.removedErr(err)
 	}
 	defer writer.Close()
 	_, err = stdcopy.StdCopy(stdout, stderr, writer)
@@ -309,23 +738,97 @@ func (c *Container) logs(ctx context.Context, stdout, stderr *bytes.Buffer) erro
 	return err
 }
 
+// removedErr returns an error wrapping ErrContainerRemoved if err is the
+// daemon's answer about a container that doesn't exist, and err otherwise.
+func (c *Container) removedErr(err error) error {
+	if client.IsErrNotFound(err) {
+		return fmt.Errorf("%w: %s: %v", ErrContainerRemoved, c.Name, err)
+	}
+	return err
+}
+
 // ID returns the container id.
 func (c *Container) ID() string {
 	return c.id
 }
 
+// DaemonHost returns the address of the docker daemon running the container,
+// e.g. "unix:///var/run/docker.sock".
+func (c *Container) DaemonHost() string {
+	return c.client.DaemonHost()
+}
+
 // SandboxPid returns the container's pid.
 func (c *Container) SandboxPid(ctx context.Context) (int, error) {
-	resp, err := c.client.ContainerInspect(ctx, c.id)
+	resp, err := c.inspect(ctx)
 	if err != nil {
 		return -1, err
 	}
 	return resp.ContainerJSONBase.State.Pid, nil
 }
 
+// CgroupPath returns the path of the container's cgroup, relative to the root
+// of the host's cgroup hierarchy (or of each controller's hierarchy, for
+// cgroup v1). It is derived from the container's cgroup parent and the
+// daemon's cgroup driver. A relative cgroup parent with the cgroupfs driver
+// is resolved by the runtime against its own cgroup, so it is not supported.
+func (c *Container) CgroupPath(ctx context.Context) (_ string, err error) {
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	resp, err := c.inspect(ctx)
+	if err != nil {
+		return "", err
+	}
+	info, err := c.client.Info(ctx)
+	if err != nil {
+		return "", err
+	}
+	parent := resp.HostConfig.CgroupParent
+
+	if info.CgroupDriver == "systemd" {
+		// A slice "a-b.slice" is nested as "a.slice/a-b.slice".
+		if parent == "" {
+			parent = "system.slice"
+		}
+		p := "/"
+		name := strings.TrimSuffix(parent, ".slice")
+		if name != "-" {
+			parts := strings.Split(name, "-")
+			for i := range parts {
+				p = path.Join(p, strings.Join(parts[:i+1], "-")+".slice")
+			}
+		}
+		return path.Join(p, "docker-"+c.id+".scope"), nil
+	}
+
+	if parent == "" {
+		parent = "/docker"
+	}
+	if !path.IsAbs(parent) {
+		return "", fmt.Errorf("relative cgroup parent %q of container %s is not supported", parent, c.Name)
+	}
+	return path.Join(parent, c.id), nil
+}
+
+// CgroupDriver returns the cgroup driver of the local Docker daemon, either
+// "cgroupfs" or "systemd". It determines the form of RunOpts.CgroupParent.
+func CgroupDriver(ctx context.Context) (_ string, err error) {
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	client, err := sharedClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	info, err := client.Info(ctx)
+	if err != nil {
+		return "", err
+	}
+	return info.CgroupDriver, nil
+}
+
 // FindIP returns the IP address of the container.
 func (c *Container) FindIP(ctx context.Context) (net.IP, error) {
-	resp, err := c.client.ContainerInspect(ctx, c.id)
+	resp, err := c.inspect(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -339,7 +842,7 @@ func (c *Container) FindIP(ctx context.Context) (net.IP, error) {
 
 // FindPort returns the host port that is mapped to 'sandboxPort'.
 func (c *Container) FindPort(ctx context.Context, sandboxPort int) (int, error) {
-	desc, err := c.client.ContainerInspect(ctx, c.id)
+	desc, err := c.inspect(ctx)
 	if err != nil {
 		return -1, fmt.Errorf("error retrieving port: %v", err)
 	}
@@ -365,7 +868,7 @@ func (c *Container) CopyFiles(opts *RunOpts, target string, sources ...string) {
 		c.copyErr = fmt.Errorf("ioutil.TempDir failed: %v", err)
 		return
 	}
-	c.cleanups = append(c.cleanups, func() { os.RemoveAll(dir) })
+	c.addCleanup(func() error { return os.RemoveAll(dir) })
 	if err := os.Chmod(dir, 0755); err != nil {
 		c.copyErr = fmt.Errorf("os.Chmod(%q, 0755) failed: %v", dir, err)
 		return
@@ -391,28 +894,105 @@ func (c *Container) CopyFiles(opts *RunOpts, target string, sources ...string) {
 	})
 }
 
+// EffectiveRuntime returns the runtime the container was created with. Unlike
+// Runtime, it reflects the daemon's default if no runtime was requested.
+func (c *Container) EffectiveRuntime(ctx context.Context) (string, error) {
+	resp, err := c.inspect(ctx)
+	if err != nil {
+		return "", err
+	}
+	return resp.HostConfig.Runtime, nil
+}
+
 // Status inspects the container returns its status.
 func (c *Container) Status(ctx context.Context) (types.ContainerState, error) {
-	resp, err := c.client.ContainerInspect(ctx, c.id)
+	resp, err := c.inspect(ctx)
 	if err != nil {
 		return types.ContainerState{}, err
 	}
 	return *resp.State, err
 }
 
-// Wait waits for the container to exit.
-func (c *Container) Wait(ctx context.Context) error {
+// containerStatuses are the values of State.Status, by docker's definition.
+var containerStatuses = map[string]struct{}{
+	"created":    {},
+	"running":    {},
+	"paused":     {},
+	"restarting": {},
+	"removing":   {},
+	"exited":     {},
+	"dead":       {},
+}
+
+// WaitForStatus waits for the container's status to become want, e.g.
+// "running" or "paused". If it doesn't within timeout, the returned error
+// includes the last status observed.
+func (c *Container) WaitForStatus(ctx context.Context, want string, timeout time.Duration) error {
+	if _, ok := containerStatuses[want]; !ok {
+		return fmt.Errorf("invalid container status %q", want)
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		state, err := c.Status(ctx)
+		if err != nil {
+			return err
+		}
+		if state.Status == want {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for container %s to be %s: %v: last status: %s", c.Name, want, ctx.Err(), state.Status)
+		case <-timer.C:
+			return fmt.Errorf("timeout waiting for container %s to be %s: last status: %s", c.Name, want, state.Status)
+		}
+	}
+}
+
+// ExitStatus describes how a container exited.
+type ExitStatus struct {
+	// Code is the exit code of the container's root process.
+	Code int
+
+	// OOMKilled is set if the container was killed for running out of
+	// memory.
+	OOMKilled bool
+}
+
+// Wait waits for the container to exit and returns how it exited. If the
+// container was removed before it could be waited for, the returned error
+// wraps ErrContainerRemoved.
+func (c *Container) Wait(ctx context.Context) (_ ExitStatus, err error) {
+	defer c.logOp("wait", time.Now(), &err)
 	statusChan, errChan := c.client.ContainerWait(ctx, c.id, container.WaitConditionNotRunning)
 	select {
 	case err := <-errChan:
-		return err
-	case <-statusChan:
-		return nil
+		return ExitStatus{}, c.removedErr(err)
+	case status := <-statusChan:
+		// The wait response doesn't say why the container exited. The
+		// container may be gone by now if it is removed automatically, in
+		// which case it is unknown.
+		resp, err := c.inspect(ctx)
+		if client.IsErrNotFound(err) {
+			return ExitStatus{Code: int(status.StatusCode)}, nil
+		}
+		if err != nil {
+			return ExitStatus{}, err
+		}
+		return ExitStatus{
+			Code:      int(status.StatusCode),
+			OOMKilled: resp.State.OOMKilled,
+		}, nil
 	}
 }
 
 // WaitTimeout waits for the container to exit with a timeout.
-func (c *Container) WaitTimeout(ctx context.Context, timeout time.Duration) error {
+func (c *Container) WaitTimeout(ctx context.Context, timeout time.Duration) (err error) {
+	defer c.logOp("wait", time.Now(), &err)
 	timeoutChan := time.After(timeout)
 	statusChan, errChan := c.client.ContainerWait(ctx, c.id, container.WaitConditionNotRunning)
 	select {
@@ -425,6 +1005,50 @@ func (c *Container) WaitTimeout(ctx context.Context, timeout time.Duration) erro
 	}
 }
 
+// ErrNoHealthCheck is returned by WaitHealthy if the container has no health
+// check.
+var ErrNoHealthCheck = errors.New("container has no health check")
+
+// WaitHealthy waits for the container's health check to pass. If it doesn't
+// within timeout, the returned error includes the output of the last failed
+// probe.
+func (c *Container) WaitHealthy(ctx context.Context, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	var lastOutput string
+	for {
+		resp, err := c.inspect(ctx)
+		if err != nil {
+			return err
+		}
+		health := resp.State.Health
+		if health == nil {
+			return fmt.Errorf("%w: %s", ErrNoHealthCheck, c.Name)
+		}
+		if health.Status == types.Healthy {
+			return nil
+		}
+		if !resp.State.Running {
+			return fmt.Errorf("container %s exited before becoming healthy", c.Name)
+		}
+		for _, probe := range health.Log {
+			if probe.ExitCode != 0 {
+				lastOutput = probe.Output
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for container %s to become healthy: %v: last probe output: %s", c.Name, ctx.Err(), lastOutput)
+		case <-timer.C:
+			return fmt.Errorf("timeout waiting for container %s to become healthy: last probe output: %s", c.Name, lastOutput)
+		}
+	}
+}
+
 // WaitForOutput searches container logs for pattern and returns or timesout.
 func (c *Container) WaitForOutput(ctx context.Context, pattern string, timeout time.Duration) (string, error) {
 	matches, err := c.WaitForOutputSubmatch(ctx, pattern, timeout)
@@ -437,65 +1061,182 @@ func (c *Container) WaitForOutput(ctx context.Context, pattern string, timeout t
 	return matches[0], nil
 }
 
-// WaitForOutputSubmatch searches container logs for the given
-// pattern or times out. It returns any regexp submatches as well.
+// WaitForOutputSubmatch searches container output for the given pattern or
+// times out. It returns any regexp submatches as well. If the container exits
+// before the pattern appears, the returned error includes all of its output.
+//
+// If the container was started without attaching to it, its logs are polled
+// instead.
 func (c *Container) WaitForOutputSubmatch(ctx context.Context, pattern string, timeout time.Duration) ([]string, error) {
 	re := regexp.MustCompile(pattern)
-	if matches := re.FindStringSubmatch(c.streamBuf.String()); matches != nil {
-		return matches, nil
+	c.mu.Lock()
+	output := c.output
+	c.mu.Unlock()
+	if output == nil {
+		return c.waitForLogsSubmatch(ctx, re, timeout)
 	}
 
-	for exp := time.Now().Add(timeout); time.Now().Before(exp); {
-		c.streams.Conn.SetDeadline(time.Now().Add(50 * time.Millisecond))
-		_, err := stdcopy.StdCopy(&c.streamBuf, &c.streamBuf, c.streams.Reader)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		out, exited, changed := output.snapshot()
+		if matches := re.FindStringSubmatch(out); matches != nil {
+			return matches, nil
+		}
+		if exited {
+			return nil, fmt.Errorf("container %s exited before output %q: out: %s", c.Name, re.String(), out)
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for output %q: %v: out: %s", re.String(), ctx.Err(), out)
+		case <-timer.C:
+			return nil, fmt.Errorf("timeout waiting for output %q: out: %s", re.String(), out)
+		}
+	}
+}
 
+// waitForLogsSubmatch is WaitForOutputSubmatch for a container that isn't
+// attached, polling its logs.
+func (c *Container) waitForLogsSubmatch(ctx context.Context, re *regexp.Regexp, timeout time.Duration) ([]string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		// Check the state first, so that the logs are complete if the
+		// container has exited.
+		state, err := c.Status(ctx)
 		if err != nil {
-			// check that it wasn't a timeout
-			if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
-				return nil, err
-			}
+			return nil, err
 		}
-
-		if matches := re.FindStringSubmatch(c.streamBuf.String()); matches != nil {
+		out, err := c.Logs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if matches := re.FindStringSubmatch(out); matches != nil {
 			return matches, nil
 		}
+		if !state.Running {
+			return nil, fmt.Errorf("container %s exited before output %q: out: %s", c.Name, re.String(), out)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for output %q: %v: out: %s", re.String(), ctx.Err(), out)
+		case <-timer.C:
+			return nil, fmt.Errorf("timeout waiting for output %q: out: %s", re.String(), out)
+		}
 	}
-
-	return nil, fmt.Errorf("timeout waiting for output %q: out: %s", re.String(), c.streamBuf.String())
 }
 
-// Kill kills the container.
-func (c *Container) Kill(ctx context.Context) error {
-	return c.client.ContainerKill(ctx, c.id, "")
+// Kill is analogous to 'docker kill --signal [signal]'. An empty signal sends
+// SIGKILL.
+func (c *Container) Kill(ctx context.Context, signal string) (err error) {
+	defer c.logOp("kill", time.Now(), &err)
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	return c.client.ContainerKill(ctx, c.id, signal)
 }
 
-// Remove is analogous to 'docker rm'.
-func (c *Container) Remove(ctx context.Context) error {
-	// Remove the image.
+// Remove is analogous to 'docker rm'. Removing a container that is already
+// gone, e.g. because of RunOpts.AutoRemove, succeeds.
+func (c *Container) Remove(ctx context.Context) (err error) {
+	defer c.logOp("remove", time.Now(), &err)
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	// Remove the image. Only anonymous volumes are removed with it; named
+	// volumes are owned by their Volume.
 	remove := types.ContainerRemoveOptions{
 		RemoveVolumes: c.mounts != nil,
 		RemoveLinks:   c.links != nil,
 		Force:         true,
 	}
-	return c.client.ContainerRemove(ctx, c.Name, remove)
+	err = c.client.ContainerRemove(ctx, c.id, remove)
+	if client.IsErrNotFound(err) || (err != nil && strings.Contains(err.Error(), "is already in progress")) {
+		return nil
+	}
+	return err
+}
+
+// cleanUpTimeout bounds CleanUp if its context has no deadline.
+const cleanUpTimeout = time.Minute
+
+// CleanUpError is the error returned by CleanUp. It holds every failure, in
+// the order they happened.
+type CleanUpError []error
+
+// Error implements error.Error.
+func (e CleanUpError) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
 }
 
-// CleanUp kills and deletes the container (best effort).
-func (c *Container) CleanUp(ctx context.Context) {
-	// Kill the container.
-	if err := c.Kill(ctx); err != nil && !strings.Contains(err.Error(), "is not running") {
-		// Just log; can't do anything here.
-		c.logger.Logf("error killing container %q: %v", c.Name, err)
+// CleanUp kills and deletes the container, and runs the cleanups registered
+// with it. It is best effort: every step is attempted even if the previous
+// ones failed, and the failures are returned together as a CleanUpError.
+//
+// The calls to the daemon are abandoned if ctx is cancelled, or after
+// cleanUpTimeout if ctx has no deadline, so that a hung daemon can't block
+// teardown. The local cleanups are run regardless.
+//
+// CleanUp may be called more than once, e.g. explicitly and deferred, and
+// concurrently with the methods that query the container. Once it has
+// succeeded, further calls do nothing. The local cleanups are only ever run
+// once.
+func (c *Container) CleanUp(ctx context.Context) error {
+	c.cleanUpMu.Lock()
+	defer c.cleanUpMu.Unlock()
+	c.mu.Lock()
+	if c.cleanedUp {
+		c.mu.Unlock()
+		return nil
+	}
+	cleanups := c.cleanups
+	c.cleanups = nil
+	c.mu.Unlock()
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cleanUpTimeout)
+		defer cancel()
 	}
-	// Remove the image.
-	if err := c.Remove(ctx); err != nil {
-		c.logger.Logf("error removing container %q: %v", c.Name, err)
+
+	c.saveFailureArtifacts(ctx)
+
+	var errs CleanUpError
+	// A container that was never created has nothing to kill or remove.
+	if c.id != "" {
+		// Kill the container.
+		if err := c.Kill(ctx, "SIGKILL"); err != nil && !strings.Contains(err.Error(), "is not running") && !client.IsErrNotFound(err) {
+			errs = append(errs, fmt.Errorf("error killing container %q: %v", c.Name, err))
+		}
+		// Remove the image.
+		if err := c.Remove(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("error removing container %q: %v", c.Name, err))
+		}
 	}
 	// Forget all mounts.
 	c.mounts = nil
 	// Execute all cleanups.
-	for _, c := range c.cleanups {
-		c()
+	for _, cleanup := range cleanups {
+		if err := cleanup(); err != nil {
+			errs = append(errs, fmt.Errorf("error cleaning up container %q: %v", c.Name, err))
+		}
 	}
-	c.cleanups = nil
+
+	if len(errs) == 0 {
+		c.mu.Lock()
+		c.cleanedUp = true
+		c.mu.Unlock()
+		return nil
+	}
+	// Most callers ignore the error, so log it too.
+	for _, err := range errs {
+		c.logger.Logf("%v", err)
+	}
+	return errs
 }
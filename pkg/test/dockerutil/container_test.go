@@ -0,0 +1,173 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// daemonTransport is a fake daemon that can be called concurrently. It
+// answers logs with the given output, and counts kill requests.
+type daemonTransport struct {
+	logs []byte
+
+	mu    sync.Mutex
+	kills int
+}
+
+// RoundTrip implements http.RoundTripper.RoundTrip.
+func (d *daemonTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/logs"):
+		resp := response(http.StatusOK, "")
+		resp.Body = ioutil.NopCloser(bytes.NewReader(d.logs))
+		return resp, nil
+	case strings.HasSuffix(req.URL.Path, "/kill"):
+		d.mu.Lock()
+		d.kills++
+		d.mu.Unlock()
+		return response(http.StatusNoContent, ""), nil
+	case req.Method == http.MethodDelete:
+		return response(http.StatusNoContent, ""), nil
+	default:
+		return response(http.StatusOK, `{"Id": "stub", "State": {"Status": "running", "Running": true}}`), nil
+	}
+}
+
+// stdout returns s framed as the container's stdout.
+func stdout(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	if _, err := stdcopy.NewStdWriter(&buf, stdcopy.Stdout).Write([]byte(s)); err != nil {
+		t.Fatalf("failed to frame output: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestConcurrentUse is meant to be run with -race.
+func TestConcurrentUse(t *testing.T) {
+	d := &daemonTransport{logs: stdout(t, "ready\n")}
+	c := stubContainerWithTransport(t, d)
+
+	// Attach fake streams, fed by the container's end of a pipe.
+	conn, container := net.Pipe()
+	c.setStreams(types.HijackedResponse{Conn: conn, Reader: bufio.NewReader(conn)}, true /* capture */)
+	go func() {
+		container.Write(stdout(t, "ready\n"))
+		// Keep the streams open until CleanUp closes them.
+		ioutil.ReadAll(container)
+	}()
+
+	ctx := context.Background()
+	if _, err := c.WaitForOutput(ctx, "ready", 5*time.Second); err != nil {
+		t.Fatalf("WaitForOutput() failed: %v", err)
+	}
+
+	// The output read so far is kept once CleanUp closes the streams.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			if _, err := c.WaitForOutput(ctx, "ready", 5*time.Second); err != nil {
+				t.Errorf("WaitForOutput() failed: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := c.Logs(ctx); err != nil {
+				t.Errorf("Logs() failed: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := c.CleanUp(ctx); err != nil {
+				t.Errorf("CleanUp() failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// CleanUp is idempotent.
+	if err := c.CleanUp(ctx); err != nil {
+		t.Errorf("CleanUp() failed: %v", err)
+	}
+	if d.kills != 1 {
+		t.Errorf("got %d kills, want 1", d.kills)
+	}
+}
+
+// routeTransport is a fake daemon that answers requests whose path ends with
+// one of its keys with the corresponding response, and any other request
+// with a not found error.
+type routeTransport map[string]func() *http.Response
+
+// RoundTrip implements http.RoundTripper.RoundTrip.
+func (r routeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for suffix, resp := range r {
+		if strings.HasSuffix(req.URL.Path, suffix) {
+			return resp(), nil
+		}
+	}
+	return notFound(), nil
+}
+
+func notFound() *http.Response {
+	return response(http.StatusNotFound, `{"message": "No such container: stub"}`)
+}
+
+func TestAutoRemoved(t *testing.T) {
+	setRetryPolicy(t, 0)
+	ctx := context.Background()
+
+	// The container exits and is removed as soon as the wait returns.
+	c := stubContainerWithTransport(t, routeTransport{
+		"/wait": func() *http.Response { return response(http.StatusOK, `{"StatusCode": 3}`) },
+	})
+	status, err := c.Wait(ctx)
+	if err != nil {
+		t.Fatalf("Wait() failed: %v", err)
+	}
+	if status.Code != 3 {
+		t.Errorf("Wait() got exit code %d, want 3", status.Code)
+	}
+	if _, err := c.Logs(ctx); !errors.Is(err, ErrContainerRemoved) {
+		t.Errorf("Logs() got err %v, want %v", err, ErrContainerRemoved)
+	}
+	if err := c.Remove(ctx); err != nil {
+		t.Errorf("Remove() failed: %v", err)
+	}
+	if err := c.CleanUp(ctx); err != nil {
+		t.Errorf("CleanUp() failed: %v", err)
+	}
+
+	// The container is removed before it is waited for.
+	c = stubContainerWithTransport(t, routeTransport{})
+	if _, err := c.Wait(ctx); !errors.Is(err, ErrContainerRemoved) {
+		t.Errorf("Wait() got err %v, want %v", err, ErrContainerRemoved)
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// ErrNotExist is returned by CopyTo and CopyFrom when the path in the
+// container does not exist.
+var ErrNotExist = errors.New("path does not exist in container")
+
+// Export is analogous to 'docker export'. The container's filesystem is
+// streamed to w as a tar archive, so large filesystems are never held in
+// memory. Since the export may take arbitrarily long, ctx is not bounded by
+// the default timeout.
+func (c *Container) Export(ctx context.Context, w io.Writer) error {
+	r, err := c.client.ContainerExport(ctx, c.id)
+	if err != nil {
+		return fmt.Errorf("failed to export container %s: %v", c.Name, err)
+	}
+	defer r.Close()
+	if _, err := io.Copy(w, r); err != nil {
+		return fmt.Errorf("failed to export container %s: %v", c.Name, err)
+	}
+	return nil
+}
+
+// CopyTo is analogous to 'docker cp hostPath container:containerPath'. The file
+// or directory tree at hostPath is copied, with its mode bits, into the
+// directory containerPath, keeping its base name. Unlike CopyFiles, it can be
+// used while the container is running.
+func (c *Container) CopyTo(ctx context.Context, hostPath, containerPath string) (err error) {
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	stat, err := c.client.ContainerStatPath(ctx, c.id, containerPath)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return fmt.Errorf("%w: %q in %s", ErrNotExist, containerPath, c.Name)
+		}
+		return fmt.Errorf("failed to stat %q in container %s: %v", containerPath, c.Name, err)
+	}
+	if !stat.Mode.IsDir() {
+		return fmt.Errorf("path %q in container %s is not a directory", containerPath, c.Name)
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(writeTar(w, hostPath, filepath.Base(hostPath)))
+	}()
+	defer r.Close()
+	return c.client.CopyToContainer(ctx, c.id, containerPath, r, types.CopyToContainerOptions{})
+}
+
+// CopyFrom is analogous to 'docker cp container:containerPath hostDir'. The
+// file or directory tree at containerPath is copied, with its mode bits and
+// symlinks, into the existing directory hostDir, keeping its base name. If
+// containerPath doesn't exist, the returned error wraps ErrNotExist.
+func (c *Container) CopyFrom(ctx context.Context, containerPath, hostDir string) (err error) {
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	r, _, err := c.client.CopyFromContainer(ctx, c.id, containerPath)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return fmt.Errorf("%w: %q in %s", ErrNotExist, containerPath, c.Name)
+		}
+		return fmt.Errorf("failed to copy %q from container %s: %v", containerPath, c.Name, err)
+	}
+	defer r.Close()
+	if err := readTar(r, hostDir); err != nil {
+		return fmt.Errorf("failed to copy %q from container %s: %v", containerPath, c.Name, err)
+	}
+	return nil
+}
+
+// readTar extracts the tar stream r into dir. Entries that would be written
+// outside of dir, or links that would point outside of it, are rejected.
+func readTar(r io.Reader, dir string) error {
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	// The modes of directories are applied once their entries are written,
+	// since they may not allow writing them.
+	dirModes := make(map[string]os.FileMode)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return chmodDirs(dirModes)
+		}
+		if err != nil {
+			return err
+		}
+
+		// The entry replaces whatever is at its path, without following it
+		// if it is a symlink.
+		path, err := resolve(dir, dir, hdr.Name, false)
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeDir {
+			if fi, err := os.Lstat(path); err == nil && !fi.IsDir() {
+				if err := os.Remove(path); err != nil {
+					return err
+				}
+			}
+		}
+		mode := os.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+			dirModes[path] = mode
+		case tar.TypeReg, tar.TypeRegA:
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+			if err := os.Chmod(path, mode); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			// Absolute targets are relative to the container's root, not
+			// dir.
+			if filepath.IsAbs(hdr.Linkname) {
+				return fmt.Errorf("invalid symlink %q to %q in archive: absolute target", hdr.Name, hdr.Linkname)
+			}
+			if _, err := resolve(dir, filepath.Dir(path), hdr.Linkname, true); err != nil {
+				return fmt.Errorf("invalid symlink %q in archive: %v", hdr.Name, err)
+			}
+			if err := os.Symlink(hdr.Linkname, path); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			// Hard link targets are relative to the root of the archive.
+			target, err := resolve(dir, dir, hdr.Linkname, true)
+			if err != nil {
+				return fmt.Errorf("invalid hard link %q in archive: %v", hdr.Name, err)
+			}
+			if err := os.Link(target, path); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported file type %q for %q in archive", hdr.Typeflag, hdr.Name)
+		}
+	}
+}
+
+// resolve returns the path that name refers to from the directory base under
+// dir, following the symlinks extracted so far, and the last element of name
+// only if followLast. It fails if the path, or any path on the way to it, is
+// not under dir.
+//
+// A path that doesn't exist yet may later be replaced by a symlink, so ".."
+// is not allowed to follow it.
+func resolve(dir, base, name string, followLast bool) (string, error) {
+	path := base
+	exists := true
+	elems := strings.Split(name, "/")
+	for i, elem := range elems {
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if !exists {
+				return "", fmt.Errorf("invalid path %q in archive: \"..\" after a path that doesn't exist", name)
+			}
+			path = filepath.Dir(path)
+		default:
+			path = filepath.Join(path, elem)
+			if !exists || (i == len(elems)-1 && !followLast) {
+				break
+			}
+			real, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				// It is not extracted yet, or a symlink to a path that
+				// is not.
+				exists = false
+				break
+			}
+			path = real
+		}
+		if path != dir && !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return "", fmt.Errorf("invalid path %q in archive: outside of %s", name, dir)
+		}
+	}
+	return path, nil
+}
+
+// chmodDirs sets the modes of directories, deepest first, so that their
+// parents are still writable.
+func chmodDirs(modes map[string]os.FileMode) error {
+	paths := make([]string, 0, len(modes))
+	for path := range modes {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return strings.Count(paths[i], string(filepath.Separator)) > strings.Count(paths[j], string(filepath.Separator))
+	})
+	for _, path := range paths {
+		if err := os.Chmod(path, modes[path]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// makeTar returns a tar stream of hdrs, with "data" as the contents of
+// regular files.
+func makeTar(t *testing.T, hdrs []tar.Header) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range hdrs {
+		hdr := hdr
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = 4
+		}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatalf("WriteHeader failed: %v", err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte("data")); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	return &buf
+}
+
+func TestReadTarDirModes(t *testing.T) {
+	buf := makeTar(t, []tar.Header{
+		{Name: "d/", Typeflag: tar.TypeDir, Mode: 0555},
+		{Name: "d/sub/", Typeflag: tar.TypeDir, Mode: 0500},
+		{Name: "d/sub/f", Typeflag: tar.TypeReg, Mode: 0400},
+		{Name: "d/g", Typeflag: tar.TypeReg, Mode: 0644},
+	})
+
+	dir, err := ioutil.TempDir("", "readtar")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed: %v", err)
+	}
+	t.Cleanup(func() {
+		// Make the directories writable again to remove them.
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.IsDir() {
+				os.Chmod(path, 0755)
+			}
+			return nil
+		})
+		os.RemoveAll(dir)
+	})
+	// The read-only directories must not prevent writing their entries.
+	if err := readTar(buf, dir); err != nil {
+		t.Fatalf("readTar failed: %v", err)
+	}
+
+	for name, want := range map[string]os.FileMode{
+		"d":       os.ModeDir | 0555,
+		"d/sub":   os.ModeDir | 0500,
+		"d/sub/f": 0400,
+		"d/g":     0644,
+	} {
+		fi, err := os.Lstat(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("os.Lstat(%q) failed: %v", name, err)
+			continue
+		}
+		if got := fi.Mode(); got != want {
+			t.Errorf("%q has mode %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestReadTarEscapes(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		hdrs    []tar.Header
+		wantErr bool
+	}{
+		{
+			name: "inside",
+			hdrs: []tar.Header{
+				{Name: "d/", Typeflag: tar.TypeDir, Mode: 0755},
+				{Name: "d/f", Typeflag: tar.TypeReg, Mode: 0644},
+				{Name: "d/sub/", Typeflag: tar.TypeDir, Mode: 0755},
+				{Name: "d/sub/up", Typeflag: tar.TypeSymlink, Linkname: "../f"},
+				{Name: "d/later", Typeflag: tar.TypeSymlink, Linkname: "sub/g"},
+				{Name: "d/sub/g", Typeflag: tar.TypeReg, Mode: 0644},
+				{Name: "d/hard", Typeflag: tar.TypeLink, Linkname: "d/f"},
+				{Name: "d/up", Typeflag: tar.TypeSymlink, Linkname: "sub"},
+				{Name: "d/up/h", Typeflag: tar.TypeReg, Mode: 0644},
+			},
+		},
+		{
+			name: "entry",
+			hdrs: []tar.Header{
+				{Name: "../escaped", Typeflag: tar.TypeReg, Mode: 0644},
+			},
+			wantErr: true,
+		},
+		{
+			name: "absolute symlink",
+			hdrs: []tar.Header{
+				{Name: "l", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "relative symlink",
+			hdrs: []tar.Header{
+				{Name: "d/", Typeflag: tar.TypeDir, Mode: 0755},
+				{Name: "d/l", Typeflag: tar.TypeSymlink, Linkname: "../.."},
+			},
+			wantErr: true,
+		},
+		{
+			name: "hard link",
+			hdrs: []tar.Header{
+				{Name: "l", Typeflag: tar.TypeLink, Linkname: "../escaped"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "symlink through symlink",
+			hdrs: []tar.Header{
+				{Name: "d/", Typeflag: tar.TypeDir, Mode: 0755},
+				{Name: "d/up", Typeflag: tar.TypeSymlink, Linkname: ".."},
+				{Name: "d/l", Typeflag: tar.TypeSymlink, Linkname: "up/.."},
+			},
+			wantErr: true,
+		},
+		{
+			// The symlink would escape once x is replaced by a symlink to
+			// "..".
+			name: "up from missing path",
+			hdrs: []tar.Header{
+				{Name: "d/", Typeflag: tar.TypeDir, Mode: 0755},
+				{Name: "d/l", Typeflag: tar.TypeSymlink, Linkname: "x/../.."},
+			},
+			wantErr: true,
+		},
+		{
+			name: "entry through symlink",
+			hdrs: []tar.Header{
+				{Name: "d/", Typeflag: tar.TypeDir, Mode: 0755},
+				{Name: "d/up", Typeflag: tar.TypeSymlink, Linkname: ".."},
+				{Name: "d/up/up/escaped", Typeflag: tar.TypeReg, Mode: 0644},
+			},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			parent := tempDir(t)
+			dir := filepath.Join(parent, "dir")
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatalf("os.Mkdir failed: %v", err)
+			}
+			err := readTar(makeTar(t, tc.hdrs), dir)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("readTar got err %v, want error %t", err, tc.wantErr)
+			}
+			if _, err := os.Lstat(filepath.Join(parent, "escaped")); err == nil {
+				t.Errorf("readTar wrote outside of %s", dir)
+			}
+		})
+	}
+}
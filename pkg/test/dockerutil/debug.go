@@ -0,0 +1,63 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// debug is non-zero if docker operations are logged.
+var debug int32
+
+func init() {
+	if enabled, _ := strconv.ParseBool(os.Getenv("DOCKERUTIL_DEBUG")); enabled {
+		SetDebug(true)
+	}
+}
+
+// SetDebug sets whether every docker operation done by a Container is logged
+// to its logger, with its duration and result. It can also be enabled by
+// setting DOCKERUTIL_DEBUG=1 in the environment.
+//
+// Each operation is logged as a single line of the form:
+//
+//	dockerutil: op=<operation> container=<name> duration=<duration> err=<quoted error>
+//
+// where the duration is in the format of time.Duration.String and the error
+// is empty on success. The operations are create, attach, start, wait, kill,
+// remove, exec and inspect.
+func SetDebug(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&debug, v)
+}
+
+// logOp logs an operation on the container that started at start and
+// failed with *err, if debugging is enabled. It is meant to be deferred.
+func (c *Container) logOp(op string, start time.Time, err *error) {
+	if atomic.LoadInt32(&debug) == 0 {
+		return
+	}
+	var msg string
+	if *err != nil {
+		msg = (*err).Error()
+	}
+	c.logger.Logf("dockerutil: op=%s container=%s duration=%v err=%q", op, c.Name, time.Since(start), msg)
+}
@@ -0,0 +1,63 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+// recordingLogger records the lines logged through it.
+type recordingLogger struct {
+	*testing.T
+	lines []string
+}
+
+// Logf implements testutil.Logger.Logf.
+func (l *recordingLogger) Logf(format string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func TestDebugLog(t *testing.T) {
+	setRetryPolicy(t, 0)
+	SetDebug(true)
+	defer SetDebug(false)
+
+	s := &stubTransport{failures: 1, fail: serverError(http.StatusNotFound)}
+	c := stubContainer(t, s)
+	l := &recordingLogger{T: t}
+	c.logger = l
+
+	c.Status(context.Background())
+	c.Status(context.Background())
+	SetDebug(false)
+	c.Status(context.Background())
+
+	want := []*regexp.Regexp{
+		regexp.MustCompile(`^dockerutil: op=inspect container=stub duration=\S+ err=".+"$`),
+		regexp.MustCompile(`^dockerutil: op=inspect container=stub duration=\S+ err=""$`),
+	}
+	if len(l.lines) != len(want) {
+		t.Fatalf("got log lines %q, want %d lines", l.lines, len(want))
+	}
+	for i, re := range want {
+		if !re.MatchString(l.lines[i]) {
+			t.Errorf("got log line %q, want match for %q", l.lines[i], re)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// ChangeKind is the kind of a change to a container's filesystem.
+type ChangeKind int
+
+// Kinds of changes, with the values used by the docker API.
+const (
+	ChangeModified ChangeKind = iota
+	ChangeAdded
+	ChangeDeleted
+)
+
+// String implements fmt.Stringer.String.
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeModified:
+		return "changed"
+	case ChangeAdded:
+		return "added"
+	case ChangeDeleted:
+		return "deleted"
+	default:
+		return fmt.Sprintf("ChangeKind(%d)", int(k))
+	}
+}
+
+// ChangeItem is a path changed in a container's filesystem.
+type ChangeItem struct {
+	Path string
+	Kind ChangeKind
+}
+
+// String implements fmt.Stringer.String.
+func (c ChangeItem) String() string {
+	return fmt.Sprintf("%s %s", c.Kind, c.Path)
+}
+
+// Diff is analogous to 'docker diff'. It returns the paths changed in the
+// container's filesystem since it was created. Changes to the parent
+// directories of a changed path are reported as well.
+func (c *Container) Diff(ctx context.Context) (_ []ChangeItem, err error) {
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	resp, err := c.client.ContainerDiff(ctx, c.id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff container %s: %v", c.Name, err)
+	}
+	changes := make([]ChangeItem, 0, len(resp))
+	for _, item := range resp {
+		changes = append(changes, ChangeItem{
+			Path: item.Path,
+			Kind: ChangeKind(item.Kind),
+		})
+	}
+	return changes, nil
+}
+
+// AssertOnlyChanged fails the test if any of changes is outside of all of
+// allowedPrefixes. A prefix allows the path itself and everything below it;
+// the modification of a directory above it, which accompanies any change
+// below, is allowed too.
+func AssertOnlyChanged(t testing.TB, changes []ChangeItem, allowedPrefixes ...string) {
+	t.Helper()
+	for _, c := range changes {
+		if !changeAllowed(c, allowedPrefixes) {
+			t.Errorf("unexpected filesystem change: %s", c)
+		}
+	}
+}
+
+// changeAllowed returns true if c is allowed by any of prefixes, as described
+// by AssertOnlyChanged.
+func changeAllowed(c ChangeItem, prefixes []string) bool {
+	for _, p := range prefixes {
+		p = strings.TrimSuffix(p, "/")
+		if isUnder(c.Path, p) {
+			return true
+		}
+		if c.Kind == ChangeModified && isUnder(p, c.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnder returns true if path is dir or is below it.
+func isUnder(path, dir string) bool {
+	return path == dir || dir == "" || strings.HasPrefix(path, dir+"/")
+}
@@ -0,0 +1,97 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// Events streams the daemon's events for this container, as 'docker events
+// --filter container=<id>' does. Both channels are closed once ctx is
+// cancelled or the stream fails; in the latter case the error is sent on the
+// error channel first.
+func (c *Container) Events(ctx context.Context) (<-chan events.Message, <-chan error) {
+	return c.events(ctx, "")
+}
+
+// events streams the container's events, starting at since if it is set.
+func (c *Container) events(ctx context.Context, since string) (<-chan events.Message, <-chan error) {
+	// The client doesn't close its message channel, so forward messages
+	// until the stream ends and close ours.
+	ctx, cancel := context.WithCancel(ctx)
+	msgs, errs := c.client.Events(ctx, types.EventsOptions{
+		Since:   since,
+		Filters: filters.NewArgs(filters.Arg("container", c.id)),
+	})
+	out := make(chan events.Message)
+	outErr := make(chan error, 1)
+	go func() {
+		defer cancel()
+		defer close(outErr)
+		defer close(out)
+		for {
+			select {
+			case msg := <-msgs:
+				select {
+				case out <- msg:
+				case <-ctx.Done():
+					return
+				}
+			case err := <-errs:
+				if err != nil && ctx.Err() == nil {
+					outErr <- err
+				}
+				return
+			}
+		}
+	}()
+	return out, outErr
+}
+
+// WaitForEvent waits for the container to emit an event with the given
+// action, e.g. "die" or "oom", and returns it. Events are replayed from the
+// container's creation, so an event that happened before the call is
+// returned as well. Actions with a status, such as "health_status: healthy",
+// also match their bare name.
+func (c *Container) WaitForEvent(ctx context.Context, action string, timeout time.Duration) (events.Message, error) {
+	resp, err := c.inspect(ctx)
+	if err != nil {
+		return events.Message{}, err
+	}
+	created, err := time.Parse(time.RFC3339Nano, resp.Created)
+	if err != nil {
+		return events.Message{}, fmt.Errorf("parsing creation time of container %s: %v", c.Name, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	msgs, errs := c.events(ctx, fmt.Sprintf("%d.%09d", created.Unix(), created.Nanosecond()))
+	for msg := range msgs {
+		if msg.Action == action || strings.HasPrefix(msg.Action, action+":") {
+			return msg, nil
+		}
+	}
+	if err := <-errs; err != nil {
+		return events.Message{}, fmt.Errorf("waiting for event %q: %v", action, err)
+	}
+	return events.Message{}, fmt.Errorf("timeout waiting for event %q on container %s: %v", action, c.Name, ctx.Err())
+}
@@ -15,13 +15,22 @@
 package dockerutil
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/pkg/stdcopy"
+	"gvisor.dev/gvisor/pkg/test/testutil"
 )
 
 // ExecOpts holds arguments for Exec calls.
@@ -61,13 +70,28 @@ func (c *Container) Exec(ctx context.Context, opts ExecOpts, args ...string) (st
 
 // ExecProcess creates a process inside the container and returns a process struct
 // for the caller to use.
+//
+// The process is started by sh, which records its PID for Process.Signal
+// before executing args, so the container must provide sh.
 func (c *Container) ExecProcess(ctx context.Context, opts ExecOpts, args ...string) (Process, error) {
-	return c.doExec(ctx, opts, args)
+	pidFile := path.Join("/tmp", testutil.RandomID("dockerutil-exec")+".pid")
+	// The PID is kept by exec, and $0 is the first argument after the script.
+	p, err := c.doExec(ctx, opts, append([]string{"sh", "-c", `echo $$ > "$0" && exec "$@"`, pidFile}, args...))
+	if err != nil {
+		return Process{}, err
+	}
+	p.pidFile = pidFile
+	return p, nil
 }
 
-func (c *Container) doExec(ctx context.Context, r ExecOpts, args []string) (Process, error) {
+func (c *Container) doExec(ctx context.Context, r ExecOpts, args []string) (_ Process, err error) {
+	defer c.logOp("exec", time.Now(), &err)
 	config := c.execConfig(r, args)
-	resp, err := c.client.ContainerExecCreate(ctx, c.id, config)
+	// The attached stream outlives this call, so only creating and starting
+	// the exec are bounded by the default timeout.
+	opCtx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	resp, err := c.client.ContainerExecCreate(opCtx, c.id, config)
 	if err != nil {
 		return Process{}, fmt.Errorf("exec create failed with err: %v", err)
 	}
@@ -77,7 +101,7 @@ func (c *Container) doExec(ctx context.Context, r ExecOpts, args []string) (Proc
 		return Process{}, fmt.Errorf("exec attach failed with err: %v", err)
 	}
 
-	if err := c.client.ContainerExecStart(ctx, resp.ID, types.ExecStartCheck{}); err != nil {
+	if err := c.client.ContainerExecStart(opCtx, resp.ID, types.ExecStartCheck{}); err != nil {
 		hijack.Close()
 		return Process{}, fmt.Errorf("exec start failed with err: %v", err)
 	}
@@ -86,6 +110,7 @@ func (c *Container) doExec(ctx context.Context, r ExecOpts, args []string) (Proc
 		container: c,
 		execid:    resp.ID,
 		conn:      hijack,
+		tty:       r.UseTTY,
 	}, nil
 
 }
@@ -111,16 +136,68 @@ type Process struct {
 	container *Container
 	execid    string
 	conn      types.HijackedResponse
+	tty       bool
+
+	// pidFile is the file in the container holding the PID of a process
+	// started by ExecProcess, for Signal.
+	pidFile string
+
+	// out reads the process's output, demultiplexed if needed. It is
+	// created by the first call to Read or ReadLine.
+	out *bufio.Reader
+}
+
+// Write writes buf to the process's stdin. If the process has exited, the
+// returned error wraps io.ErrClosedPipe.
+func (p *Process) Write(buf []byte) (int, error) {
+	if running, err := p.IsRunning(context.Background()); err != nil {
+		return 0, err
+	} else if !running {
+		return 0, fmt.Errorf("process has exited: %w", io.ErrClosedPipe)
+	}
+	n, err := p.conn.Conn.Write(buf)
+	if err != nil {
+		if running, _ := p.IsRunning(context.Background()); !running {
+			return n, fmt.Errorf("process has exited: %v: %w", err, io.ErrClosedPipe)
+		}
+	}
+	return n, err
 }
 
-// Write writes buf to the process's stdin.
-func (p *Process) Write(timeout time.Duration, buf []byte) (int, error) {
-	p.conn.Conn.SetDeadline(time.Now().Add(timeout))
-	return p.conn.Conn.Write(buf)
+// Read reads the process's output, as for io.Reader. Without a TTY, stdout
+// and stderr are demultiplexed and interleaved in the order they arrive.
+func (p *Process) Read(buf []byte) (int, error) {
+	return p.output().Read(buf)
 }
 
-// Read returns process's stdout and stderr.
-func (p *Process) Read() (string, string, error) {
+// ReadLine reads a line of the process's output, without the trailing line
+// terminator. See Read.
+func (p *Process) ReadLine() (string, error) {
+	line, err := p.output().ReadString('\n')
+	if err != nil {
+		return line, err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (p *Process) output() *bufio.Reader {
+	if p.out == nil {
+		if p.tty {
+			p.out = bufio.NewReader(p.conn.Reader)
+		} else {
+			r, w := io.Pipe()
+			go func() {
+				_, err := stdcopy.StdCopy(w, w, p.conn.Reader)
+				w.CloseWithError(err)
+			}()
+			p.out = bufio.NewReader(r)
+		}
+	}
+	return p.out
+}
+
+// Output returns process's stdout and stderr.
+func (p *Process) Output() (string, string, error) {
 	var stdout, stderr bytes.Buffer
 	if err := p.read(&stdout, &stderr); err != nil {
 		return "", "", err
@@ -138,6 +215,11 @@ func (p *Process) Logs() (string, error) {
 }
 
 func (p *Process) read(stdout, stderr *bytes.Buffer) error {
+	if p.tty {
+		// With a TTY, output is not multiplexed.
+		_, err := io.Copy(stdout, p.conn.Reader)
+		return err
+	}
 	_, err := stdcopy.StdCopy(stdout, stderr, p.conn.Reader)
 	return err
 }
@@ -156,33 +238,97 @@ func (p *Process) IsRunning(ctx context.Context) (bool, error) {
 
 // WaitExitStatus until process completes and returns exit status.
 func (p *Process) WaitExitStatus(ctx context.Context) (int, error) {
-	waitChan := make(chan (int))
-	errChan := make(chan (error))
-
-	go func() {
-		for {
-			running, exitcode, err := p.runningExitCode(ctx)
-			if err != nil {
-				errChan <- fmt.Errorf("error waiting process %s: container %v", p.execid, p.container.Name)
-			}
-			if !running {
-				waitChan <- exitcode
-			}
-			time.Sleep(time.Millisecond * 500)
+	if p.execid == "" {
+		// This is the root process.
+		statusChan, errChan := p.container.client.ContainerWait(ctx, p.container.id, container.WaitConditionNotRunning)
+		select {
+		case err := <-errChan:
+			return -1, fmt.Errorf("error waiting for container %s: %v", p.container.Name, err)
+		case status := <-statusChan:
+			return int(status.StatusCode), nil
 		}
-	}()
+	}
 
-	select {
-	case ws := <-waitChan:
-		return ws, nil
-	case err := <-errChan:
-		return -1, err
+	// There is no wait API for execed processes.
+	for {
+		running, exitcode, err := p.runningExitCode(ctx)
+		if err != nil {
+			return -1, fmt.Errorf("error waiting process %s: container %v: %v", p.execid, p.container.Name, err)
+		}
+		if !running {
+			return exitcode, nil
+		}
+		select {
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// ErrProcessExited is returned when signaling a process that has already
+// exited.
+var ErrProcessExited = errors.New("process has exited")
+
+// Signal sends sig to the process. If the process has already exited, it
+// returns ErrProcessExited.
+//
+// Execed processes are signaled from inside the container, with kill(1) run
+// by another exec, since the host process backing them under runsc is the
+// 'runsc exec' proxy, which doesn't forward SIGKILL or SIGSTOP. The process
+// is found by the PID it recorded when it started, so the container must
+// provide sh and kill.
+func (p *Process) Signal(ctx context.Context, sig syscall.Signal) (err error) {
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	if p.execid == "" {
+		// This is the root process.
+		if running, err := p.IsRunning(ctx); err != nil {
+			return err
+		} else if !running {
+			return ErrProcessExited
+		}
+		return p.container.Kill(ctx, strconv.Itoa(int(sig)))
+	}
+
+	status, err := p.container.client.ContainerExecInspect(ctx, p.execid)
+	if err != nil {
+		return fmt.Errorf("error inspecting process %s: container %v: %v", p.execid, p.container.Name, err)
+	}
+	if !status.Running {
+		return ErrProcessExited
+	}
+	if p.pidFile == "" {
+		return fmt.Errorf("process %s of container %v was not started by ExecProcess", p.execid, p.container.Name)
+	}
+	// The process may not have recorded its PID yet.
+	script := `until [ -s "$0" ]; do sleep 0.01; done; kill -"$1" "$(cat "$0")"`
+	if _, err = p.container.Exec(ctx, ExecOpts{User: "0"}, "sh", "-c", script, p.pidFile, strconv.Itoa(int(sig))); err != nil {
+		// The process may have exited since it was inspected.
+		if running, rerr := p.IsRunning(ctx); rerr == nil && !running {
+			return ErrProcessExited
+		}
+		return fmt.Errorf("error signaling process %s: container %v: %v", p.execid, p.container.Name, err)
+	}
+	return nil
+}
+
+// ResizeTTY resizes the process's TTY to h rows and w columns.
+func (p *Process) ResizeTTY(ctx context.Context, h, w uint) (err error) {
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	opts := types.ResizeOptions{Height: h, Width: w}
+	if p.execid != "" {
+		return p.container.client.ContainerExecResize(ctx, p.execid, opts)
 	}
+	return p.container.client.ContainerResize(ctx, p.container.id, opts)
 }
 
 // runningExitCode collects if the process is running and the exit code.
 // The exit code is only valid if the process has exited.
-func (p *Process) runningExitCode(ctx context.Context) (bool, int, error) {
+func (p *Process) runningExitCode(ctx context.Context) (_ bool, _ int, err error) {
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
 	// If execid is not empty, this is a execed process.
 	if p.execid != "" {
 		status, err := p.container.client.ContainerExecInspect(ctx, p.execid)
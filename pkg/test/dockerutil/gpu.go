@@ -0,0 +1,82 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// ErrNoGPU is returned when creating a container with GPUs if the daemon has
+// no GPU support, so that tests can skip.
+var ErrNoGPU = errors.New("docker daemon has no GPU support")
+
+// addGPUs adds the GPUs described by gpus, as for RunOpts.GPUs, to the
+// container's configs.
+func (c *Container) addGPUs(ctx context.Context, gpus string, conf *container.Config, hostconf *container.HostConfig) (err error) {
+	req, err := gpuDeviceRequest(gpus)
+	if err != nil {
+		return err
+	}
+	// GPUs are passed through by the nvidia runtime's hook, which is only
+	// available if the runtime is configured.
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	info, err := c.client.Info(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := info.Runtimes["nvidia"]; !ok {
+		return ErrNoGPU
+	}
+	hostconf.DeviceRequests = append(hostconf.DeviceRequests, req)
+	if devices, ok := os.LookupEnv("NVIDIA_VISIBLE_DEVICES"); ok {
+		conf.Env = append(conf.Env, "NVIDIA_VISIBLE_DEVICES="+devices)
+	}
+	return nil
+}
+
+// gpuDeviceRequest returns the device request for gpus, as for RunOpts.GPUs.
+func gpuDeviceRequest(gpus string) (container.DeviceRequest, error) {
+	req := container.DeviceRequest{
+		Driver:       "nvidia",
+		Capabilities: [][]string{{"gpu"}},
+	}
+	switch {
+	case gpus == "all":
+		req.Count = -1
+	case strings.HasPrefix(gpus, "device="):
+		ids := strings.Split(strings.TrimPrefix(gpus, "device="), ",")
+		for _, id := range ids {
+			if id == "" {
+				return container.DeviceRequest{}, fmt.Errorf("invalid GPUs %q: empty device ID", gpus)
+			}
+		}
+		req.DeviceIDs = ids
+	default:
+		n, err := strconv.Atoi(gpus)
+		if err != nil || n <= 0 {
+			return container.DeviceRequest{}, fmt.Errorf("invalid GPUs %q: want \"all\", a number of GPUs or \"device=<id>[,<id>...]\"", gpus)
+		}
+		req.Count = n
+	}
+	return req, nil
+}
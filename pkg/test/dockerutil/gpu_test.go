@@ -0,0 +1,62 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestGPUDeviceRequest(t *testing.T) {
+	gpu := [][]string{{"gpu"}}
+	for _, tc := range []struct {
+		gpus    string
+		want    container.DeviceRequest
+		wantErr bool
+	}{
+		{
+			gpus: "all",
+			want: container.DeviceRequest{Driver: "nvidia", Count: -1, Capabilities: gpu},
+		},
+		{
+			gpus: "2",
+			want: container.DeviceRequest{Driver: "nvidia", Count: 2, Capabilities: gpu},
+		},
+		{
+			gpus: "device=0",
+			want: container.DeviceRequest{Driver: "nvidia", DeviceIDs: []string{"0"}, Capabilities: gpu},
+		},
+		{
+			gpus: "device=0,GPU-3a23c669",
+			want: container.DeviceRequest{Driver: "nvidia", DeviceIDs: []string{"0", "GPU-3a23c669"}, Capabilities: gpu},
+		},
+		{gpus: "device=", wantErr: true},
+		{gpus: "device=0,", wantErr: true},
+		{gpus: "0", wantErr: true},
+		{gpus: "some", wantErr: true},
+	} {
+		t.Run(tc.gpus, func(t *testing.T) {
+			got, err := gpuDeviceRequest(tc.gpus)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("gpuDeviceRequest(%q) got err %v, want error: %t", tc.gpus, err, tc.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("gpuDeviceRequest(%q) = %+v, want %+v", tc.gpus, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+// imagePull is a pull of an image, possibly still in progress.
+type imagePull struct {
+	done chan struct{}
+	err  error
+}
+
+var (
+	// imagePullsMu protects imagePulls.
+	imagePullsMu sync.Mutex
+
+	// imagePulls holds the pulls in progress, by image name. Concurrent
+	// callers of EnsureImage for the same image share a single pull.
+	imagePulls = make(map[string]*imagePull)
+)
+
+// EnsureImage makes sure that the image called name is present on the
+// daemon, pulling it if it isn't. Credentials for the pull are taken from
+// the DOCKER_AUTH_CONFIG environment variable, which holds a docker
+// config.json, if it is set.
+func EnsureImage(ctx context.Context, client *client.Client, name string) error {
+	imagePullsMu.Lock()
+	p, ok := imagePulls[name]
+	if !ok {
+		p = &imagePull{done: make(chan struct{})}
+		imagePulls[name] = p
+	}
+	imagePullsMu.Unlock()
+
+	if ok {
+		// Another caller is already ensuring the image.
+		select {
+		case <-p.done:
+			return p.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	p.err = ensureImage(ctx, client, name)
+	imagePullsMu.Lock()
+	delete(imagePulls, name)
+	imagePullsMu.Unlock()
+	close(p.done)
+	return p.err
+}
+
+func ensureImage(ctx context.Context, client *client.Client, name string) error {
+	images, err := client.ImageList(ctx, types.ImageListOptions{
+		Filters: filters.NewArgs(filters.Arg("reference", name)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list images: %v", err)
+	}
+	if len(images) > 0 {
+		return nil
+	}
+
+	auth, err := registryAuth(name)
+	if err != nil {
+		return err
+	}
+	r, err := client.ImagePull(ctx, name, types.ImagePullOptions{RegistryAuth: auth})
+	if err != nil {
+		return fmt.Errorf("image %q is not present and could not be pulled: %v", name, err)
+	}
+	defer r.Close()
+	if err := readProgress(r); err != nil {
+		return fmt.Errorf("failed to pull image %q: %v", name, err)
+	}
+	return nil
+}
+
+// readProgress drains the progress stream of a pull or import, which
+// completes once the stream is drained. Failures are reported in the stream,
+// so it returns the first error message found there.
+func readProgress(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	for {
+		var msg struct {
+			Error       string `json:"error"`
+			ErrorDetail struct {
+				Message string `json:"message"`
+			} `json:"errorDetail"`
+		}
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read progress: %v", err)
+		}
+		if msg.ErrorDetail.Message != "" {
+			return errors.New(msg.ErrorDetail.Message)
+		}
+		if msg.Error != "" {
+			return errors.New(msg.Error)
+		}
+	}
+}
+
+// ImportImage is analogous to 'docker import'. It creates an image from the
+// filesystem tar archive read from r, such as one written by Export, and
+// tags it with tag, relative to images/ as for RunOpts.Image.
+func ImportImage(ctx context.Context, r io.Reader, tag string) error {
+	client, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		return err
+	}
+	client.NegotiateAPIVersion(ctx)
+
+	resp, err := client.ImageImport(ctx, types.ImageImportSource{
+		Source:     r,
+		SourceName: "-",
+	}, testutil.ImageByName(tag), types.ImageImportOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to import image %q: %v", tag, err)
+	}
+	defer resp.Close()
+	if err := readProgress(resp); err != nil {
+		return fmt.Errorf("failed to import image %q: %v", tag, err)
+	}
+	return nil
+}
+
+// registryAuth returns the encoded credentials for pulling the image called
+// name, from the docker config.json held by DOCKER_AUTH_CONFIG. It returns
+// the empty string if there are no credentials for the image's registry.
+func registryAuth(name string) (string, error) {
+	authConfig := os.Getenv("DOCKER_AUTH_CONFIG")
+	if authConfig == "" {
+		return "", nil
+	}
+	var config struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal([]byte(authConfig), &config); err != nil {
+		return "", fmt.Errorf("invalid DOCKER_AUTH_CONFIG: %v", err)
+	}
+
+	registry := imageRegistry(name)
+	for server, entry := range config.Auths {
+		host := strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+		host = strings.SplitN(host, "/", 2)[0]
+		if host != registry && !(registry == "docker.io" && host == "index.docker.io") {
+			continue
+		}
+		creds, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return "", fmt.Errorf("invalid DOCKER_AUTH_CONFIG credentials for %q: %v", server, err)
+		}
+		userPass := strings.SplitN(string(creds), ":", 2)
+		if len(userPass) != 2 {
+			return "", fmt.Errorf("invalid DOCKER_AUTH_CONFIG credentials for %q: want user:password", server)
+		}
+		encoded, err := json.Marshal(types.AuthConfig{
+			Username:      userPass[0],
+			Password:      userPass[1],
+			ServerAddress: server,
+		})
+		if err != nil {
+			return "", err
+		}
+		return base64.URLEncoding.EncodeToString(encoded), nil
+	}
+	return "", nil
+}
+
+// imageRegistry returns the registry host of the image called name.
+func imageRegistry(name string) string {
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+	return "docker.io"
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadProgress(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		stream  string
+		wantErr string
+	}{
+		{
+			name: "success",
+			stream: `{"status":"Pulling from library/alpine","id":"latest"}
+{"status":"Download complete","progressDetail":{},"id":"abc"}
+{"status":"Status: Downloaded newer image for alpine:latest"}`,
+		},
+		{
+			name:   "empty",
+			stream: "",
+		},
+		{
+			name: "error",
+			stream: `{"status":"Pulling from library/alpine","id":"latest"}
+{"errorDetail":{"message":"manifest unknown"},"error":"manifest unknown"}`,
+			wantErr: "manifest unknown",
+		},
+		{
+			name:    "error without detail",
+			stream:  `{"error":"pull access denied"}`,
+			wantErr: "pull access denied",
+		},
+		{
+			name:    "truncated",
+			stream:  `{"status":"Pulling`,
+			wantErr: "failed to read progress",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := readProgress(strings.NewReader(tc.stream))
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("readProgress() failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("readProgress() got err %v, want one containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
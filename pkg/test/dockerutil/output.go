@@ -0,0 +1,73 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"bytes"
+
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// output accumulates the output of a container as it is read from the
+// container's streams, and lets readers wait for it to change.
+type output struct {
+	mu sync.Mutex
+
+	// buf holds all output read so far.
+	buf bytes.Buffer
+
+	// closed is set once the streams have ended.
+	closed bool
+
+	// changed is closed, and replaced, whenever buf grows or closed is set.
+	changed chan struct{}
+}
+
+func newOutput() *output {
+	return &output{changed: make(chan struct{})}
+}
+
+// Write implements io.Writer.Write.
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n, err := o.buf.Write(p)
+	o.notifyLocked()
+	return n, err
+}
+
+// close marks the end of the output.
+func (o *output) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.closed = true
+	o.notifyLocked()
+}
+
+// notifyLocked wakes up all waiters.
+//
+// Preconditions: o.mu must be locked.
+func (o *output) notifyLocked() {
+	close(o.changed)
+	o.changed = make(chan struct{})
+}
+
+// snapshot returns the output so far, whether it has ended, and a channel
+// that is closed on the next change.
+func (o *output) snapshot() (string, bool, <-chan struct{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String(), o.closed, o.changed
+}
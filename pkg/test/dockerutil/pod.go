@@ -0,0 +1,81 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"context"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+// Pod is a group of containers that share network and IPC namespaces, like a
+// Kubernetes pod. The namespaces are held by a pause container, which the
+// members join.
+type Pod struct {
+	logger  testutil.Logger
+	pause   *Container
+	members []*Container
+}
+
+// NewPod starts the pause container of a new pod. The caller must call
+// CleanUp.
+func NewPod(ctx context.Context, logger testutil.Logger) (*Pod, error) {
+	pause := MakeContainer(ctx, logger)
+	if err := pause.Spawn(ctx, RunOpts{
+		Image:   "basic/alpine",
+		IpcMode: "shareable",
+	}, "sleep", "1000000"); err != nil {
+		pause.CleanUp(ctx)
+		return nil, fmt.Errorf("failed to start pause container: %v", err)
+	}
+	return &Pod{
+		logger: logger,
+		pause:  pause,
+	}, nil
+}
+
+// Add starts a container in the pod, as Spawn does. Its network and IPC
+// namespaces are those of the pod, so members can reach each other on
+// localhost.
+func (p *Pod) Add(ctx context.Context, r RunOpts, args ...string) (*Container, error) {
+	r.NetworkMode = "container:" + p.pause.Name
+	r.IpcMode = "container:" + p.pause.Name
+	c := MakeContainer(ctx, p.logger)
+	p.members = append(p.members, c)
+	if err := c.Spawn(ctx, r, args...); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// CleanUp cleans up the pod's members, most recently added first, and then
+// its pause container. The failures are returned together as a CleanUpError.
+func (p *Pod) CleanUp(ctx context.Context) error {
+	var errs CleanUpError
+	for i := len(p.members) - 1; i >= 0; i-- {
+		if err := p.members[i].CleanUp(ctx); err != nil {
+			errs = append(errs, err.(CleanUpError)...)
+		}
+	}
+	p.members = nil
+	if err := p.pause.CleanUp(ctx); err != nil {
+		errs = append(errs, err.(CleanUpError)...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+// ErrPoolClosed is returned by ContainerPool.Get once the pool is closed.
+var ErrPoolClosed = errors.New("container pool is closed")
+
+// ErrPoolShrunk is returned by ContainerPool.Get when no container is free and
+// the pool has failed to replace a container, so one may never be.
+var ErrPoolShrunk = errors.New("container pool failed to replace a container")
+
+// resetScript kills every process in a container except its root process
+// and empties /tmp. Processes may exit while it runs, so errors are ignored.
+const resetScript = `for p in /proc/[0-9]*; do
+	p=${p#/proc/}
+	if [ "$p" != 1 ] && [ "$p" != $$ ]; then kill -9 "$p"; fi
+done 2>/dev/null
+rm -rf /tmp/* /tmp/.[!.]* 2>/dev/null
+true`
+
+// ContainerPool is a set of identical running containers that can be reused,
+// saving the cost of starting a container for every use.
+//
+// The containers are started from a template and must keep running between
+// uses, so the template's command is typically a long sleep; the work is
+// done with Exec.
+type ContainerPool struct {
+	logger       testutil.Logger
+	newContainer func(context.Context, testutil.Logger) *Container
+	opts         RunOpts
+	args         []string
+
+	// free holds the containers that are not checked out. Its capacity is
+	// the size of the pool, so returning a container never blocks.
+	free chan *Container
+
+	// done is closed when the pool is closed.
+	done chan struct{}
+
+	// shrunk is closed when a container could not be replaced, after
+	// shrunkErr is set.
+	shrunk chan struct{}
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// all holds all of the pool's containers, checked out or not.
+	all map[*Container]struct{}
+
+	// out holds the containers that are checked out.
+	out map[*Container]struct{}
+
+	// shrunkErr is the error with which a container could not be replaced.
+	shrunkErr error
+
+	// closed is set once the pool is closed.
+	closed bool
+}
+
+// NewContainerPool starts n containers with the given options and arguments,
+// as Spawn does, and returns a pool of them. The caller must call Close.
+func NewContainerPool(ctx context.Context, logger testutil.Logger, n int, opts RunOpts, args ...string) (*ContainerPool, error) {
+	return NewContainerPoolWith(ctx, logger, n, MakeContainer, opts, args...)
+}
+
+// NewContainerPoolWith is like NewContainerPool, but the containers are made
+// with newContainer rather than MakeContainer, e.g. to run them on another
+// docker host or under another runtime.
+func NewContainerPoolWith(ctx context.Context, logger testutil.Logger, n int, newContainer func(context.Context, testutil.Logger) *Container, opts RunOpts, args ...string) (*ContainerPool, error) {
+	p := &ContainerPool{
+		logger:       logger,
+		newContainer: newContainer,
+		opts:         opts,
+		args:         args,
+		free:         make(chan *Container, n),
+		done:         make(chan struct{}),
+		shrunk:       make(chan struct{}),
+		all:          make(map[*Container]struct{}),
+		out:          make(map[*Container]struct{}),
+	}
+	for i := 0; i < n; i++ {
+		c, err := p.spawn(ctx)
+		if err != nil {
+			p.Close(ctx)
+			return nil, err
+		}
+		p.free <- c
+	}
+	return p, nil
+}
+
+// spawn starts a new container for the pool.
+func (p *ContainerPool) spawn(ctx context.Context) (*Container, error) {
+	c := p.newContainer(ctx, p.logger)
+	if c == nil {
+		return nil, fmt.Errorf("failed to make pool container")
+	}
+	p.mu.Lock()
+	p.all[c] = struct{}{}
+	p.mu.Unlock()
+	if err := c.Spawn(ctx, p.opts, p.args...); err != nil {
+		p.remove(ctx, c)
+		return nil, fmt.Errorf("failed to start pool container: %v", err)
+	}
+	return c, nil
+}
+
+// Get checks out a container, waiting for one to be returned if all of them
+// are checked out. It fails with ErrPoolClosed if the pool is closed, and
+// with ErrPoolShrunk if no container is free after the pool failed to
+// replace one.
+func (p *ContainerPool) Get(ctx context.Context) (*Container, error) {
+	select {
+	case <-p.done:
+		return nil, ErrPoolClosed
+	default:
+	}
+	select {
+	case c := <-p.free:
+		return p.checkOut(c), nil
+	default:
+	}
+	select {
+	case c := <-p.free:
+		return p.checkOut(c), nil
+	case <-p.shrunk:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return nil, fmt.Errorf("%w: %v", ErrPoolShrunk, p.shrunkErr)
+	case <-p.done:
+		return nil, ErrPoolClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// checkOut records that c is checked out and returns it.
+func (p *ContainerPool) checkOut(c *Container) *Container {
+	p.mu.Lock()
+	p.out[c] = struct{}{}
+	p.mu.Unlock()
+	return c
+}
+
+// Put resets a container checked out with Get and returns it to the pool:
+// all processes but the container's root process are killed and /tmp is
+// emptied. If the reset fails, the container is replaced with a new one.
+//
+// Containers returned after the pool is closed have already been cleaned up,
+// so Put does nothing for them. Put fails for a container that is not checked
+// out, e.g. one that was already returned.
+func (p *ContainerPool) Put(ctx context.Context, c *Container) error {
+	p.mu.Lock()
+	_, ok := p.all[c]
+	_, out := p.out[c]
+	delete(p.out, c)
+	closed := p.closed
+	p.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("container %s is not from this pool", c.Name)
+	}
+	if !out {
+		return fmt.Errorf("container %s is not checked out", c.Name)
+	}
+	if closed {
+		return nil
+	}
+
+	if _, err := c.Exec(ctx, ExecOpts{}, "sh", "-c", resetScript); err != nil {
+		p.logger.Logf("failed to reset container %s, replacing it: %v", c.Name, err)
+		p.remove(ctx, c)
+		if c, err = p.spawn(ctx); err != nil {
+			p.shrink(err)
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		// The container may have been added after Close cleaned up.
+		c.CleanUp(ctx)
+		return nil
+	}
+	p.free <- c
+	return nil
+}
+
+// shrink records that a container could not be replaced, so that Gets that
+// would wait for it fail instead.
+func (p *ContainerPool) shrink(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.shrunkErr == nil {
+		p.shrunkErr = err
+		close(p.shrunk)
+	}
+}
+
+// remove cleans up a container and forgets it.
+func (p *ContainerPool) remove(ctx context.Context, c *Container) {
+	c.CleanUp(ctx)
+	p.mu.Lock()
+	delete(p.all, c)
+	p.mu.Unlock()
+}
+
+// Close cleans up all of the pool's containers, including those that are
+// checked out.
+func (p *ContainerPool) Close(ctx context.Context) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.done)
+	all := make([]*Container, 0, len(p.all))
+	for c := range p.all {
+		all = append(all, c)
+	}
+	p.mu.Unlock()
+
+	for _, c := range all {
+		c.CleanUp(ctx)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SandboxProcs are the processes that run a container.
+type SandboxProcs struct {
+	// Sandbox is the host PID of the runsc sandbox process, which runs the
+	// sentry. It is zero if the container is not sandboxed, e.g. under runc.
+	Sandbox int
+
+	// Gofers are the host PIDs of the container's gofer processes. It is
+	// empty if the container is not sandboxed.
+	Gofers []int
+
+	// Init is the PID of the container's init process. If the container is
+	// sandboxed, this is a PID inside the sandbox; otherwise it is a host
+	// PID.
+	Init int
+}
+
+// SandboxProcesses returns the processes that run the container, which must
+// be running. Gofers are found by scanning the host's /proc.
+func (c *Container) SandboxProcesses(ctx context.Context) (SandboxProcs, error) {
+	resp, err := c.inspect(ctx)
+	if err != nil {
+		return SandboxProcs{}, err
+	}
+	if !resp.State.Running {
+		return SandboxProcs{}, fmt.Errorf("container %s is not running", c.Name)
+	}
+	pid := resp.State.Pid
+
+	procs, err := hostProcesses()
+	if err != nil {
+		return SandboxProcs{}, err
+	}
+	if argv := procs[pid]; len(argv) == 0 || argv[0] != "runsc-sandbox" {
+		// Not sandboxed: the PID is the init process.
+		return SandboxProcs{Init: pid}, nil
+	}
+
+	sp := SandboxProcs{Sandbox: pid}
+	for p, argv := range procs {
+		if len(argv) > 0 && argv[0] == "runsc-gofer" && bundleID(argv) == c.id {
+			sp.Gofers = append(sp.Gofers, p)
+		}
+	}
+	if resp.HostConfig.PidMode.IsContainer() {
+		// The init process is not PID 1 when the PID namespace is shared.
+		// Look for it by its command line.
+		cmdline := append([]string{resp.Path}, resp.Args...)
+		if sp.Init, err = c.findProcess(ctx, strings.Join(cmdline, " ")); err != nil {
+			return SandboxProcs{}, err
+		}
+	} else {
+		sp.Init = 1
+	}
+	return sp, nil
+}
+
+// bundleID returns the base name of the --bundle argument in argv, which is
+// the container ID for bundles created by docker.
+func bundleID(argv []string) string {
+	for i, arg := range argv {
+		if arg == "--bundle" && i+1 < len(argv) {
+			return filepath.Base(argv[i+1])
+		}
+		if strings.HasPrefix(arg, "--bundle=") {
+			return filepath.Base(strings.TrimPrefix(arg, "--bundle="))
+		}
+	}
+	return ""
+}
+
+// hostProcesses returns the command lines of all processes on the host, by
+// PID.
+func hostProcesses() (map[int][]string, error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	procs := make(map[int][]string)
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		cmdline, err := ioutil.ReadFile(filepath.Join("/proc", e.Name(), "cmdline"))
+		if err != nil {
+			// The process may have exited.
+			continue
+		}
+		procs[pid] = strings.Split(string(bytes.TrimRight(cmdline, "\x00")), "\x00")
+	}
+	return procs, nil
+}
+
+// findProcess returns the lowest PID in the container of a process with the
+// given command line, with arguments separated by spaces.
+func (c *Container) findProcess(ctx context.Context, cmdline string) (int, error) {
+	out, err := c.Exec(ctx, ExecOpts{}, "sh", "-c",
+		`for p in /proc/[0-9]*; do echo "${p#/proc/} $(tr '\0' ' ' < $p/cmdline)"; done 2>/dev/null`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list processes in container %s: %v", c.Name, err)
+	}
+	found := 0
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		if len(fields) != 2 || fields[1] != cmdline {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		if found == 0 || pid < found {
+			found = pid
+		}
+	}
+	if found == 0 {
+		return 0, fmt.Errorf("no process %q in container %s", cmdline, c.Name)
+	}
+	return found, nil
+}
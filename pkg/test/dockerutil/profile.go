@@ -0,0 +1,232 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// profileFlags maps the profile types supported by Profile to the flags of
+// 'runsc debug' that collect them.
+var profileFlags = map[string]string{
+	"cpu":       "--profile-cpu",
+	"heap":      "--profile-heap",
+	"block":     "--profile-block",
+	"mutex":     "--profile-mutex",
+	"goroutine": "--profile-goroutine",
+}
+
+// Profile collects pprof profiles of the sandbox of a container, with
+// 'runsc debug', every time the container starts. Each profile is written to
+// <outDir>/<container name>.<type>.pprof.
+//
+// Collecting profiles requires access to the runtime's state, so the caller
+// must be root.
+type Profile struct {
+	container *Container
+	types     []string
+	duration  time.Duration
+	outDir    string
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// cancel stops the collection in progress.
+	cancel context.CancelFunc
+
+	// done is closed when the collection in progress ends. It is nil if the
+	// container hasn't started yet.
+	done chan struct{}
+
+	// err is the error of the last collection.
+	err error
+}
+
+// NewProfile returns a Profile that collects the given types of profiles,
+// among cpu, heap, block, mutex and goroutine, once c starts. The CPU profile
+// is collected for the given duration. The collection is stopped by
+// c.CleanUp, and ends early without error if the container exits.
+func NewProfile(c *Container, types []string, duration time.Duration, outDir string) *Profile {
+	p := &Profile{
+		container: c,
+		types:     types,
+		duration:  duration,
+		outDir:    outDir,
+	}
+	c.onStart(p.start)
+	c.addCleanup(func() error {
+		p.stop()
+		return nil
+	})
+	return p
+}
+
+// StartProfile is like NewProfile, but starts collecting now, from a running
+// container, rather than once it starts. Stop ends the collection early, e.g.
+// at the end of a measurement.
+func StartProfile(c *Container, types []string, duration time.Duration, outDir string) *Profile {
+	p := &Profile{
+		container: c,
+		types:     types,
+		duration:  duration,
+		outDir:    outDir,
+	}
+	p.start()
+	c.addCleanup(func() error {
+		p.stop()
+		return nil
+	})
+	return p
+}
+
+// Stop ends the collection in progress, if any, and returns the error
+// collecting it. The profiles are written nonetheless, covering the time
+// collected so far.
+func (p *Profile) Stop() error {
+	p.stop()
+	return p.Wait()
+}
+
+// Wait waits for the profiles of the last start of the container to be
+// collected, and returns the error collecting them.
+func (p *Profile) Wait() error {
+	p.mu.Lock()
+	done := p.done
+	p.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+	<-done
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// start starts collecting profiles in the background.
+func (p *Profile) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	p.mu.Lock()
+	p.cancel = cancel
+	p.done = done
+	p.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		err := p.collect(ctx)
+		p.mu.Lock()
+		p.err = err
+		p.mu.Unlock()
+	}()
+}
+
+// stop stops the collection in progress, if any, and waits for it to end.
+func (p *Profile) stop() {
+	p.mu.Lock()
+	cancel := p.cancel
+	p.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	p.Wait()
+}
+
+// collect runs 'runsc debug' against the container's sandbox.
+func (p *Profile) collect(ctx context.Context) error {
+	c := p.container
+	args := []string{"debug", fmt.Sprintf("--duration=%v", p.duration)}
+	for _, typ := range p.types {
+		flag, ok := profileFlags[typ]
+		if !ok {
+			return fmt.Errorf("unknown profile type %q", typ)
+		}
+		path := filepath.Join(p.outDir, fmt.Sprintf("%s.%s.pprof", c.Name, typ))
+		args = append(args, fmt.Sprintf("%s=%s", flag, path))
+	}
+	if err := os.MkdirAll(p.outDir, 0755); err != nil {
+		return err
+	}
+
+	resp, err := c.inspect(ctx)
+	if err != nil {
+		return err
+	}
+	rs, err := runtimeConfig(resp.HostConfig.Runtime)
+	if err != nil {
+		return err
+	}
+	path, ok := rs["path"].(string)
+	if !ok {
+		return fmt.Errorf("unexpected format: %v", rs)
+	}
+	args = append([]string{"--root", runtimeRoot(resp.HostConfig.Runtime, rs)}, args...)
+	args = append(args, resp.ID)
+
+	// Rather than being killed, 'runsc debug' is interrupted when ctx is
+	// done, so that it still writes the profiles.
+	var out bytes.Buffer
+	cmd := exec.Command(path, args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- cmd.Wait() }()
+	select {
+	case err = <-waitErr:
+	case <-ctx.Done():
+		cmd.Process.Signal(syscall.SIGTERM)
+		err = <-waitErr
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		// The sandbox going away ends the collection early.
+		if state, serr := c.Status(context.Background()); serr == nil && !state.Running {
+			return nil
+		}
+		return fmt.Errorf("runsc %s failed: %v: %s", strings.Join(args, " "), err, out.String())
+	}
+	return nil
+}
+
+// runtimeRoot returns the root directory of the state of the given runtime,
+// with configuration rs: the one from its --root flag, or the one the daemon
+// passes to it otherwise.
+func runtimeRoot(name string, rs map[string]interface{}) string {
+	args, _ := rs["runtimeArgs"].([]interface{})
+	for i, arg := range args {
+		s, _ := arg.(string)
+		if strings.HasPrefix(s, "--root=") {
+			return strings.TrimPrefix(s, "--root=")
+		} else if s == "--root" && i+1 < len(args) {
+			root, _ := args[i+1].(string)
+			return root
+		}
+	}
+	return filepath.Join("/var/run/docker", "runtime-"+name, "moby")
+}
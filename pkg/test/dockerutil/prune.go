@@ -0,0 +1,73 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// RemoveContainers force-removes the containers matching label, e.g. "key"
+// or "key=value", from the daemon at host, or the one from the environment
+// if host is empty. Containers for which keep returns true, given their
+// labels, are spared. It returns the number of containers removed.
+//
+// It cleans up after runs that didn't get to, e.g. because they were
+// killed; see Container.Labels.
+func RemoveContainers(ctx context.Context, host, label string, keep func(labels map[string]string) bool) (int, error) {
+	var (
+		cli *client.Client
+		err error
+	)
+	if host == "" {
+		cli, err = sharedClient(ctx)
+	} else {
+		cli, err = client.NewClientWithOpts(client.FromEnv, client.WithHost(host))
+		if err == nil {
+			defer cli.Close()
+			cli.NegotiateAPIVersion(ctx)
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to create client: %v", err)
+	}
+
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", label)),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list containers: %v", err)
+	}
+	removed := 0
+	for _, c := range containers {
+		if keep != nil && keep(c.Labels) {
+			continue
+		}
+		err := cli.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{
+			RemoveVolumes: true,
+			Force:         true,
+		})
+		if err != nil && !client.IsErrNotFound(err) {
+			return removed, fmt.Errorf("failed to remove container %s: %v", c.ID, err)
+		}
+		removed++
+	}
+	return removed, nil
+}
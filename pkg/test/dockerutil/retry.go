@@ -0,0 +1,113 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+// RetryPolicy controls how calls to the docker daemon that fail transiently
+// are retried.
+type RetryPolicy struct {
+	// Retries is the number of times a failed call is retried. Zero disables
+	// retries.
+	Retries int
+
+	// Backoff is the delay before the first retry. It doubles with every
+	// retry, up to MaxBackoff.
+	Backoff time.Duration
+
+	// MaxBackoff bounds the delay between retries.
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is the policy for the calls that Container retries:
+// creating and starting the container and inspecting it.
+var DefaultRetryPolicy = RetryPolicy{
+	Retries:    4,
+	Backoff:    100 * time.Millisecond,
+	MaxBackoff: 2 * time.Second,
+}
+
+// retry calls fn until it succeeds, fails with an error that isn't
+// transient or runs out of retries, and returns its last error. The op is
+// used for logging.
+func (c *Container) retry(ctx context.Context, op string, fn func() error) error {
+	policy := DefaultRetryPolicy
+	backoff := policy.Backoff
+	for retries := 0; ; retries++ {
+		err := fn()
+		if err == nil || retries >= policy.Retries || !isTransient(err) {
+			return err
+		}
+		c.logger.Logf("%s of container %s failed, retrying in %v: %v", op, c.Name, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		if backoff *= 2; backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+// isTransient returns true if err may go away when the call is retried: the
+// connection to the daemon failed or was reset, or the daemon returned a
+// server error. Client errors (4xx) are never transient.
+func isTransient(err error) bool {
+	if client.IsErrConnectionFailed(err) || causedBy(err, syscall.ECONNRESET) {
+		return true
+	}
+	// The client types any other 5xx as a system error.
+	return errdefs.IsSystem(err) || errdefs.IsUnavailable(err)
+}
+
+// causedBy returns true if err was caused by target. The client wraps errors
+// with Cause rather than Unwrap, so both chains are followed.
+func causedBy(err, target error) bool {
+	for err != nil {
+		if errors.Is(err, target) {
+			return true
+		}
+		causer, ok := err.(interface{ Cause() error })
+		if !ok {
+			return false
+		}
+		err = causer.Cause()
+	}
+	return false
+}
+
+// inspect is ContainerInspect for this container, with retries.
+func (c *Container) inspect(ctx context.Context) (_ types.ContainerJSON, err error) {
+	defer c.logOp("inspect", time.Now(), &err)
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	var resp types.ContainerJSON
+	err = c.retry(ctx, "inspect", func() error {
+		var err error
+		resp, err = c.client.ContainerInspect(ctx, c.id)
+		return err
+	})
+	return resp, err
+}
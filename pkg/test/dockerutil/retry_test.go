@@ -0,0 +1,237 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// stubTransport fails the first failures requests and answers the rest
+// with an empty inspect response.
+type stubTransport struct {
+	failures int
+	fail     func() (*http.Response, error)
+	requests int
+}
+
+// RoundTrip implements http.RoundTripper.RoundTrip.
+func (s *stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.requests++
+	if s.requests <= s.failures {
+		return s.fail()
+	}
+	return response(http.StatusOK, `{"Id": "stub", "State": {"Status": "running"}}`), nil
+}
+
+func response(code int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: code,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func serverError(code int) func() (*http.Response, error) {
+	return func() (*http.Response, error) {
+		return response(code, `{"message": "stub failure"}`), nil
+	}
+}
+
+func connectionReset() (*http.Response, error) {
+	return nil, &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+}
+
+// stubContainer returns a container whose daemon is stubbed by s.
+func stubContainer(t *testing.T, s *stubTransport) *Container {
+	return stubContainerWithTransport(t, s)
+}
+
+// stubContainerWithTransport returns a container whose daemon is stubbed by
+// rt.
+func stubContainerWithTransport(t *testing.T, rt http.RoundTripper) *Container {
+	c, err := client.NewClientWithOpts(
+		client.WithHost("tcp://stub:2375"),
+		client.WithVersion("1.40"),
+		client.WithHTTPClient(&http.Client{Transport: rt}))
+	if err != nil {
+		t.Fatalf("client.NewClientWithOpts failed: %v", err)
+	}
+	return &Container{
+		Name:   "stub",
+		logger: t,
+		client: c,
+		id:     "stub",
+	}
+}
+
+// setRetryPolicy sets DefaultRetryPolicy for the duration of the test.
+func setRetryPolicy(t *testing.T, retries int) {
+	old := DefaultRetryPolicy
+	DefaultRetryPolicy = RetryPolicy{Retries: retries}
+	t.Cleanup(func() { DefaultRetryPolicy = old })
+}
+
+func TestRetry(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		retries  int
+		failures int
+		fail     func() (*http.Response, error)
+		wantErr  bool
+		requests int
+	}{
+		{
+			name:     "internal server error",
+			retries:  3,
+			failures: 2,
+			fail:     serverError(http.StatusInternalServerError),
+			requests: 3,
+		},
+		{
+			name:     "service unavailable",
+			retries:  3,
+			failures: 2,
+			fail:     serverError(http.StatusServiceUnavailable),
+			requests: 3,
+		},
+		{
+			name:     "connection reset",
+			retries:  3,
+			failures: 2,
+			fail:     connectionReset,
+			requests: 3,
+		},
+		{
+			name:     "retries exhausted",
+			retries:  1,
+			failures: 2,
+			fail:     serverError(http.StatusInternalServerError),
+			wantErr:  true,
+			requests: 2,
+		},
+		{
+			name:     "retries disabled",
+			retries:  0,
+			failures: 2,
+			fail:     serverError(http.StatusInternalServerError),
+			wantErr:  true,
+			requests: 1,
+		},
+		{
+			name:     "client error",
+			retries:  3,
+			failures: 2,
+			fail:     serverError(http.StatusNotFound),
+			wantErr:  true,
+			requests: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setRetryPolicy(t, tc.retries)
+			s := &stubTransport{failures: tc.failures, fail: tc.fail}
+			c := stubContainer(t, s)
+
+			state, err := c.Status(context.Background())
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("Status() got err %v, want error: %t", err, tc.wantErr)
+			}
+			if err == nil && state.Status != "running" {
+				t.Errorf("Status() got status %q, want %q", state.Status, "running")
+			}
+			if s.requests != tc.requests {
+				t.Errorf("got %d requests, want %d", s.requests, tc.requests)
+			}
+		})
+	}
+}
+
+// createTransport stubs a daemon whose creates fail with the responses in
+// creates, in turn, and then succeed. The container is created by the first
+// create that fails with a connection reset, as if the connection was lost
+// after the daemon handled the request.
+type createTransport struct {
+	creates  []func() (*http.Response, error)
+	created  bool
+	requests int
+}
+
+// RoundTrip implements http.RoundTripper.RoundTrip.
+func (s *createTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.requests++
+	if strings.HasSuffix(req.URL.Path, "/containers/create") {
+		if len(s.creates) == 0 {
+			s.created = true
+			return response(http.StatusCreated, `{"Id": "new"}`), nil
+		}
+		fail := s.creates[0]
+		s.creates = s.creates[1:]
+		resp, err := fail()
+		if err != nil {
+			s.created = true
+		}
+		return resp, err
+	}
+	if !s.created {
+		return response(http.StatusNotFound, `{"message": "no such container"}`), nil
+	}
+	return response(http.StatusOK, `{"Id": "earlier", "State": {"Status": "created"}}`), nil
+}
+
+func TestCreateRetry(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		creates []func() (*http.Response, error)
+		wantID  string
+		wantErr bool
+	}{
+		{
+			name:    "server error",
+			creates: []func() (*http.Response, error){serverError(http.StatusInternalServerError)},
+			wantID:  "new",
+		},
+		{
+			name:    "created before connection reset",
+			creates: []func() (*http.Response, error){connectionReset, serverError(http.StatusConflict)},
+			wantID:  "earlier",
+		},
+		{
+			// A conflict on the first attempt is another container's.
+			name:    "conflict",
+			creates: []func() (*http.Response, error){serverError(http.StatusConflict)},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setRetryPolicy(t, 3)
+			c := stubContainerWithTransport(t, &createTransport{creates: tc.creates})
+			id, err := c.createWithRetries(context.Background(), &container.Config{}, &container.HostConfig{}, nil)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("createWithRetries() got err %v, want error: %t", err, tc.wantErr)
+			}
+			if id != tc.wantID {
+				t.Errorf("createWithRetries() got ID %q, want %q", id, tc.wantID)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotRunsc is returned by RunscLogPaths if the container's runtime
+	// isn't runsc.
+	ErrNotRunsc = errors.New("runtime is not runsc")
+
+	// ErrNoDebugLog is returned by RunscLogPaths if the container's runtime
+	// doesn't write debug logs.
+	ErrNoDebugLog = errors.New("runsc debug logging is disabled")
+)
+
+// RunscLogPaths returns the paths of the runsc debug logs of the container
+// that were written since it was created.
+//
+// The debug log pattern is taken from the DOCKERUTIL_RUNSC_DEBUG_LOG
+// environment variable if it is set, and otherwise from the --debug-log flag
+// of the container's runtime in the daemon configuration. See
+// specutils.DebugLogFile for the pattern's format; %ID% is expanded to the
+// container's ID and %TEST% to its name.
+func (c *Container) RunscLogPaths(ctx context.Context) ([]string, error) {
+	resp, err := c.inspect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := runscDebugLogPattern(resp.HostConfig.Runtime)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "runsc.log.%TIMESTAMP%.%COMMAND%"
+	}
+	pattern = strings.NewReplacer(
+		"%ID%", resp.ID,
+		"%TIMESTAMP%", "*",
+		"%COMMAND%", "*",
+		"%TEST%", c.Name,
+	).Replace(pattern)
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("bad debug log pattern %q: %v", pattern, err)
+	}
+
+	// Unless the pattern contains %ID%, the logs of other containers match
+	// too. Those written before this one was created are left out.
+	created, _ := time.Parse(time.RFC3339Nano, resp.Created)
+	var paths []string
+	for _, m := range matches {
+		if fi, err := os.Stat(m); err == nil && !fi.ModTime().Before(created) {
+			paths = append(paths, m)
+		}
+	}
+	return paths, nil
+}
+
+// runscDebugLogPattern returns the debug log pattern of the given runtime.
+func runscDebugLogPattern(runtime string) (string, error) {
+	if pattern := os.Getenv("DOCKERUTIL_RUNSC_DEBUG_LOG"); pattern != "" {
+		return pattern, nil
+	}
+	rs, err := runtimeConfig(runtime)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNotRunsc, err)
+	}
+	if path, _ := rs["path"].(string); !strings.HasPrefix(filepath.Base(path), "runsc") {
+		return "", fmt.Errorf("%w: runtime %q is %q", ErrNotRunsc, runtime, path)
+	}
+	args, _ := rs["runtimeArgs"].([]interface{})
+	var pattern string
+	for i, arg := range args {
+		s, _ := arg.(string)
+		if strings.HasPrefix(s, "--debug-log=") {
+			pattern = strings.TrimPrefix(s, "--debug-log=")
+		} else if s == "--debug-log" && i+1 < len(args) {
+			pattern, _ = args[i+1].(string)
+		}
+	}
+	if pattern == "" {
+		return "", fmt.Errorf("%w: runtime %q has no --debug-log flag", ErrNoDebugLog, runtime)
+	}
+	return pattern, nil
+}
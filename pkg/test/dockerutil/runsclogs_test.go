@@ -0,0 +1,143 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// inspectTransport answers every request with the given inspect response.
+type inspectTransport string
+
+// RoundTrip implements http.RoundTripper.RoundTrip.
+func (b inspectTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return response(http.StatusOK, string(b)), nil
+}
+
+// tempDir returns a directory that is removed at the end of the test.
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "dockerutil")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// setDaemonConfig sets the daemon configuration for the duration of the
+// test.
+func setDaemonConfig(t *testing.T, data string) {
+	path := filepath.Join(tempDir(t), "daemon.json")
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile failed: %v", err)
+	}
+	old := *config
+	*config = path
+	t.Cleanup(func() { *config = old })
+}
+
+func TestRunscLogPaths(t *testing.T) {
+	dir := tempDir(t)
+	created := time.Now().Add(-time.Minute)
+	c := stubContainerWithTransport(t, inspectTransport(fmt.Sprintf(
+		`{"Id": "stub", "Created": %q, "HostConfig": {"Runtime": "runsc"}}`,
+		created.Format(time.RFC3339Nano))))
+
+	// The logs of the container, and one that matches the pattern too but
+	// was written before it was created.
+	logs := filepath.Join(dir, "stub")
+	if err := os.Mkdir(logs, 0755); err != nil {
+		t.Fatalf("os.Mkdir failed: %v", err)
+	}
+	var want []string
+	for _, log := range []struct {
+		name  string
+		stale bool
+	}{
+		{name: "runsc.log.20191231-000000.000000.boot", stale: true},
+		{name: "runsc.log.20200101-000000.000000.boot"},
+		{name: "runsc.log.20200101-000000.000000.gofer"},
+	} {
+		path := filepath.Join(logs, log.name)
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile failed: %v", err)
+		}
+		if log.stale {
+			old := created.Add(-time.Hour)
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatalf("os.Chtimes failed: %v", err)
+			}
+			continue
+		}
+		want = append(want, path)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		config  string
+		wantErr error
+	}{
+		{
+			name:    "not runsc",
+			config:  `{"runtimes": {"runsc": {"path": "/usr/bin/runc"}}}`,
+			wantErr: ErrNotRunsc,
+		},
+		{
+			name:    "runtime not declared",
+			config:  `{"runtimes": {}}`,
+			wantErr: ErrNotRunsc,
+		},
+		{
+			name:    "no debug log",
+			config:  `{"runtimes": {"runsc": {"path": "/usr/bin/runsc", "runtimeArgs": ["--debug"]}}}`,
+			wantErr: ErrNoDebugLog,
+		},
+		{
+			name:   "debug log",
+			config: fmt.Sprintf(`{"runtimes": {"runsc": {"path": "/usr/bin/runsc", "runtimeArgs": ["--debug", "--debug-log=%s/%%ID%%/"]}}}`, dir),
+		},
+		{
+			name:   "separate flag value",
+			config: fmt.Sprintf(`{"runtimes": {"runsc": {"path": "/usr/bin/runsc", "runtimeArgs": ["--debug-log", "%s/%%ID%%/runsc.log.%%TIMESTAMP%%.%%COMMAND%%"]}}}`, dir),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setDaemonConfig(t, tc.config)
+			got, err := c.RunscLogPaths(context.Background())
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Errorf("RunscLogPaths() got err %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RunscLogPaths() failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("RunscLogPaths() got %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// Stats is analogous to 'docker stats --no-stream': it returns a single
+// sample of the container's resource usage.
+func (c *Container) Stats(ctx context.Context) (_ types.StatsJSON, err error) {
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	resp, err := c.client.ContainerStats(ctx, c.id, false /* stream */)
+	if err != nil {
+		return types.StatsJSON{}, c.removedErr(err)
+	}
+	defer resp.Body.Close()
+	var stats types.StatsJSON
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return types.StatsJSON{}, err
+	}
+	return stats, nil
+}
+
+// SampleStats samples the container's resource usage until the container
+// exits or the returned function is called, after which the channel is
+// closed. Samples are sent at most every interval; the daemon produces one
+// about every second, so shorter intervals have no effect.
+//
+// The caller must either drain the channel or call the returned function.
+func (c *Container) SampleStats(ctx context.Context, interval time.Duration) (<-chan types.StatsJSON, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	samples := make(chan types.StatsJSON)
+	go func() {
+		defer close(samples)
+		resp, err := c.client.ContainerStats(ctx, c.id, true /* stream */)
+		if err != nil {
+			if ctx.Err() == nil {
+				c.logger.Logf("sampling stats of container %s failed: %v", c.Name, err)
+			}
+			return
+		}
+		defer resp.Body.Close()
+
+		// The stream ends when the container exits, or when ctx is
+		// cancelled. Depending on its version, the daemon may instead send
+		// empty samples once the container has exited.
+		dec := json.NewDecoder(resp.Body)
+		var last time.Time
+		for {
+			var stats types.StatsJSON
+			if err := dec.Decode(&stats); err != nil || stats.Read.IsZero() {
+				return
+			}
+			if !last.IsZero() && stats.Read.Sub(last) < interval {
+				continue
+			}
+			last = stats.Read
+			select {
+			case samples <- stats:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return samples, cancel
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// statsStream returns a stats response with a sample read at every offset
+// from start, each with its offset in seconds as memory usage.
+func statsStream(start time.Time, offsets ...time.Duration) func() *http.Response {
+	return func() *http.Response {
+		var samples []string
+		for _, off := range offsets {
+			samples = append(samples, fmt.Sprintf(`{"read": %q, "memory_stats": {"usage": %d}}`,
+				start.Add(off).Format(time.RFC3339Nano), int(off.Seconds())))
+		}
+		return response(http.StatusOK, strings.Join(samples, "\n"))
+	}
+}
+
+func TestStats(t *testing.T) {
+	start := time.Now()
+	c := stubContainerWithTransport(t, routeTransport{
+		"/stats": statsStream(start, 3*time.Second),
+	})
+	stats, err := c.Stats(context.Background())
+	if err != nil {
+		t.Fatalf("Stats() failed: %v", err)
+	}
+	if stats.MemoryStats.Usage != 3 {
+		t.Errorf("Stats() got memory usage %d, want 3", stats.MemoryStats.Usage)
+	}
+}
+
+func TestSampleStats(t *testing.T) {
+	start := time.Now()
+	c := stubContainerWithTransport(t, routeTransport{
+		"/stats": statsStream(start, 0, time.Second, 2*time.Second, 3*time.Second, 4*time.Second),
+	})
+
+	// The channel is closed at the end of the stream, when the container
+	// exits.
+	samples, cancel := c.SampleStats(context.Background(), 2*time.Second)
+	defer cancel()
+	var got []uint64
+	for stats := range samples {
+		got = append(got, stats.MemoryStats.Usage)
+	}
+	if want := []uint64{0, 2, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SampleStats() got samples %v, want %v", got, want)
+	}
+
+	// The channel is closed when sampling is cancelled.
+	samples, cancel = c.SampleStats(context.Background(), time.Second)
+	<-samples
+	cancel()
+	for range samples {
+	}
+}
+
+func TestSampleStatsExited(t *testing.T) {
+	// Some daemons send empty samples once the container has exited.
+	c := stubContainerWithTransport(t, routeTransport{
+		"/stats": func() *http.Response {
+			return response(http.StatusOK, `{"read": "0001-01-01T00:00:00Z"} {"read": "0001-01-01T00:00:00Z"}`)
+		},
+	})
+	samples, cancel := c.SampleStats(context.Background(), time.Second)
+	defer cancel()
+	var got []types.StatsJSON
+	for stats := range samples {
+		got = append(got, stats)
+	}
+	if len(got) != 0 {
+		t.Errorf("SampleStats() got samples %v after the container exited, want none", got)
+	}
+}
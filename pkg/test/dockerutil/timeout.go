@@ -0,0 +1,61 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// defaultTimeout is the timeout in nanoseconds of docker operations done
+// with a context that has no deadline.
+var defaultTimeout = int64(2 * time.Minute)
+
+// SetDefaultTimeout sets the timeout that Container applies to a docker
+// operation when the context passed to it has no deadline, so that a hung
+// daemon fails the test instead of blocking it forever. The default is 2
+// minutes.
+//
+// Operations that are meant to block, such as Wait, WaitTimeout, Events and
+// the streams returned by attaching to the container or to an exec, are
+// exempt.
+func SetDefaultTimeout(d time.Duration) {
+	atomic.StoreInt64(&defaultTimeout, int64(d))
+}
+
+// withDefaultTimeout returns ctx with the default timeout applied if ctx has
+// no deadline, and a function that releases it. The function takes the error
+// of the operation, which it wraps with the context's error if the context is
+// done: the client reports a timeout as a failure to connect to the daemon.
+//
+// It is meant to be used as:
+//
+//	ctx, done := withDefaultTimeout(ctx)
+//	defer done(&err)
+func withDefaultTimeout(ctx context.Context) (context.Context, func(*error)) {
+	cancel := func() {}
+	if _, ok := ctx.Deadline(); !ok {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(atomic.LoadInt64(&defaultTimeout)))
+	}
+	return ctx, func(err *error) {
+		if *err != nil && ctx.Err() != nil && !errors.Is(*err, ctx.Err()) {
+			*err = fmt.Errorf("%w: %v", ctx.Err(), *err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// hangTransport never answers, like a hung daemon. Requests only return when
+// their context is done.
+type hangTransport struct{}
+
+// RoundTrip implements http.RoundTripper.RoundTrip.
+func (hangTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+// setDefaultTimeout sets the default timeout for the duration of the test.
+func setDefaultTimeout(t *testing.T, d time.Duration) {
+	SetDefaultTimeout(d)
+	t.Cleanup(func() { SetDefaultTimeout(2 * time.Minute) })
+}
+
+func TestDefaultTimeout(t *testing.T) {
+	setRetryPolicy(t, 0)
+	setDefaultTimeout(t, 50*time.Millisecond)
+
+	for _, tc := range []struct {
+		name string
+		op   func(ctx context.Context, c *Container) error
+	}{
+		{
+			name: "status",
+			op: func(ctx context.Context, c *Container) error {
+				_, err := c.Status(ctx)
+				return err
+			},
+		},
+		{
+			name: "stop",
+			op:   func(ctx context.Context, c *Container) error { return c.Stop(ctx) },
+		},
+		{
+			name: "pause",
+			op:   func(ctx context.Context, c *Container) error { return c.Pause(ctx) },
+		},
+		{
+			name: "kill",
+			op:   func(ctx context.Context, c *Container) error { return c.Kill(ctx, "") },
+		},
+		{
+			name: "remove",
+			op:   func(ctx context.Context, c *Container) error { return c.Remove(ctx) },
+		},
+		{
+			name: "logs",
+			op: func(ctx context.Context, c *Container) error {
+				_, err := c.Logs(ctx)
+				return err
+			},
+		},
+		{
+			name: "exec",
+			op: func(ctx context.Context, c *Container) error {
+				_, err := c.Exec(ctx, ExecOpts{}, "true")
+				return err
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := stubContainerWithTransport(t, hangTransport{})
+			done := make(chan error, 1)
+			go func() { done <- tc.op(context.Background(), c) }()
+			select {
+			case err := <-done:
+				if !causedBy(err, context.DeadlineExceeded) {
+					t.Errorf("got err %v, want %v", err, context.DeadlineExceeded)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("operation hung despite the default timeout")
+			}
+		})
+	}
+}
+
+func TestDefaultTimeoutCallerDeadline(t *testing.T) {
+	setRetryPolicy(t, 0)
+	// The caller's deadline takes precedence over the default timeout, even
+	// if it is longer.
+	setDefaultTimeout(t, time.Millisecond)
+
+	c := stubContainerWithTransport(t, hangTransport{})
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.Status(ctx); !causedBy(err, context.DeadlineExceeded) {
+		t.Errorf("Status() got err %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Status() returned after %v, before the caller's deadline", elapsed)
+	}
+}
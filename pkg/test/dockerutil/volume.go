@@ -0,0 +1,76 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"context"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+// Volume is a named docker volume. Unlike the anonymous volumes of a
+// container, it outlives the containers that mount it: Container.CleanUp
+// leaves it alone, and the caller is responsible for removing it.
+type Volume struct {
+	Name string
+
+	client *client.Client
+	logger testutil.Logger
+}
+
+// NewVolume sets up the struct for a docker volume. Names of volumes will be
+// unique.
+func NewVolume(ctx context.Context, logger testutil.Logger) *Volume {
+	client, err := sharedClient(ctx)
+	if err != nil {
+		logger.Logf("create client failed with: %v", err)
+		return nil
+	}
+	return &Volume{
+		// Slashes are not allowed in volume names.
+		Name:   strings.ReplaceAll(testutil.RandomID(logger.Name()), "/", "-"),
+		client: client,
+		logger: logger,
+	}
+}
+
+// Create is analogous to 'docker volume create'.
+func (v *Volume) Create(ctx context.Context) (err error) {
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	_, err = v.client.VolumeCreate(ctx, volume.VolumeCreateBody{Name: v.Name})
+	return err
+}
+
+// Remove is analogous to 'docker volume rm'. It fails if the volume is still
+// used by a container.
+func (v *Volume) Remove(ctx context.Context) (err error) {
+	ctx, done := withDefaultTimeout(ctx)
+	defer done(&err)
+	return v.client.VolumeRemove(ctx, v.Name, false /* force */)
+}
+
+// AddNamedVolume mounts the named volume at target in the container.
+func (r *RunOpts) AddNamedVolume(name, target string) {
+	r.Mounts = append(r.Mounts, mount.Mount{
+		Type:   mount.TypeVolume,
+		Source: name,
+		Target: target,
+	})
+}
@@ -50,6 +50,9 @@ import (
 
 var (
 	checkpoint = flag.Bool("checkpoint", true, "control checkpoint/restore support")
+
+	// imagePrefix is prepended to image names by ImageByName.
+	imagePrefix = "gvisor.dev/images"
 )
 
 // IsCheckpointSupported returns the relevant command line flag.
@@ -60,7 +63,19 @@ func IsCheckpointSupported() bool {
 // ImageByName mangles the image name used locally. This depends on the image
 // build infrastructure in images/ and tools/vm.
 func ImageByName(name string) string {
-	return fmt.Sprintf("gvisor.dev/images/%s", name)
+	return fmt.Sprintf("%s/%s", imagePrefix, name)
+}
+
+// ImagePrefix returns the prefix that ImageByName prepends to image names.
+func ImagePrefix() string {
+	return imagePrefix
+}
+
+// SetImagePrefix sets the prefix that ImageByName prepends to image names,
+// e.g. to use images from a private registry. It must not be called
+// concurrently with ImageByName.
+func SetImagePrefix(prefix string) {
+	imagePrefix = prefix
 }
 
 // ConfigureExePath configures the executable for runsc in the test environment.
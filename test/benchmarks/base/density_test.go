@@ -0,0 +1,153 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package base
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+// h is the harness of the benchmarks.
+var h harness.Harness
+
+var (
+	maxContainers = flag.Int("density-max-containers", 100, "maximum number of containers spawned by BenchmarkDensity, which caps b.N")
+	parallelism   = flag.Int("density-parallelism", 8, "number of containers BenchmarkDensity spawns or cleans up at a time, to avoid overloading the docker daemon")
+)
+
+// densityTimeout bounds the time for each container to start.
+const densityTimeout = 2 * time.Minute
+
+// BenchmarkDensity spawns b.N idle containers, up to --density-max-containers,
+// and measures the memory they use on the host once all are running. ns/op
+// is the time to spawn a container.
+//
+// It must run on the host of the docker daemon.
+func BenchmarkDensity(b *testing.B) {
+	// The containers must fit in memory for their usage to be measured.
+	harness.Requires(b, harness.NeedsRoot(), harness.MinMemoryGB(8))
+	machine, err := h.GetMachine()
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer machine.CleanUp()
+
+	n := b.N
+	if n > *maxContainers {
+		n = *maxContainers
+	}
+	ctx := h.Context()
+	containers := make([]*dockerutil.Container, n)
+	for i := range containers {
+		containers[i] = machine.GetContainer(ctx, b)
+	}
+	// Containers left behind, e.g. because the daemon didn't answer in
+	// time, are removed by the next run.
+	defer forEach(containers, func(c *dockerutil.Container) error {
+		if err := c.CleanUp(ctx); err != nil {
+			b.Logf("failed to clean up container %s: %v", c.Name, err)
+		}
+		return nil
+	})
+
+	before, err := harness.MeasureMemAvailable()
+	if err != nil {
+		b.Fatalf("failed to measure available memory: %v", err)
+	}
+	b.ResetTimer()
+	start := time.Now()
+	if err := forEach(containers, func(c *dockerutil.Container) error {
+		return c.Spawn(ctx, dockerutil.RunOpts{
+			Image: "basic/alpine",
+		}, "sleep", "infinity")
+	}); err != nil {
+		b.Fatalf("failed to spawn containers: %v", err)
+	}
+	elapsed := time.Since(start)
+	b.StopTimer()
+
+	// Spawning returns once the daemon started the container, so make
+	// sure none of them exited since.
+	var rss int64
+	for _, c := range containers {
+		if err := c.WaitForStatus(ctx, "running", densityTimeout); err != nil {
+			b.Fatalf("container did not run: %v", err)
+		}
+		m, err := harness.MeasureSandboxMemory(ctx, c)
+		if err != nil {
+			b.Fatalf("failed to measure container memory: %v", err)
+		}
+		rss += m
+	}
+	after, err := harness.MeasureMemAvailable()
+	if err != nil {
+		b.Fatalf("failed to measure available memory: %v", err)
+	}
+
+	r := h.Reporter(b)
+	r.ReportMetric(float64(n), "containers")
+	r.ReportMetric(float64(before-after)/float64(n)/(1<<20), "memPerContainer[MB]")
+	r.ReportMetric(float64(rss)/float64(n)/(1<<20), "rssPerContainer[MB]")
+	r.ReportMetric(float64(elapsed.Nanoseconds())/float64(n), "ns/op")
+	r.Finish()
+}
+
+// forEach calls fn on each of containers, --density-parallelism at a time,
+// and returns the first error.
+func forEach(containers []*dockerutil.Container, fn func(c *dockerutil.Container) error) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, *parallelism)
+	for _, c := range containers {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(c *dockerutil.Container) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(c); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("container %s: %v", c.Name, err)
+				}
+				mu.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// TestMain initializes the harness before running the benchmarks.
+func TestMain(m *testing.M) {
+	if err := h.Init(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize harness: %v\n", err)
+		os.Exit(1)
+	}
+	if *parallelism < 1 {
+		fmt.Fprintf(os.Stderr, "--density-parallelism must be positive\n")
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package base
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+// probeTimeout bounds the time for each probe of BenchmarkWaitUntilServing.
+const probeTimeout = time.Minute
+
+// BenchmarkWaitUntilServing measures the setup time that benchmarks spend
+// waiting for a server that is already up, with probes run from the
+// machine's shared utility container (Shared) and, as before it was shared,
+// from a utility container spawned for each wait (PerWait). ns/op is the
+// time of a wait.
+func BenchmarkWaitUntilServing(b *testing.B) {
+	machine, err := h.GetMachine()
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer machine.CleanUp()
+
+	ctx := h.Context()
+	server := machine.GetContainer(ctx, b)
+	defer server.CleanUp(ctx)
+	const port = 8080
+	if err := server.Spawn(ctx, dockerutil.RunOpts{
+		Image: "benchmarks/util",
+	}, "nc", "-lk", strconv.Itoa(port)); err != nil {
+		b.Fatalf("failed to start server: %v", err)
+	}
+	ip, err := server.FindIP(ctx)
+	if err != nil {
+		b.Fatalf("failed to find server IP: %v", err)
+	}
+
+	b.Run("Shared", func(b *testing.B) {
+		// The utility container is spawned once per machine, so its
+		// creation is not part of a wait.
+		utility, err := machine.UtilityContainer(ctx)
+		if err != nil {
+			b.Fatalf("failed to get utility container: %v", err)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := harness.WaitUntilServing(ctx, utility, server, ip, port, probeTimeout); err != nil {
+				b.Fatalf("failed to wait for server: %v", err)
+			}
+		}
+	})
+	b.Run("PerWait", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			utility := machine.GetClientContainer(ctx, b)
+			if err := utility.Spawn(ctx, dockerutil.RunOpts{
+				Image:      "benchmarks/util",
+				SkipAttach: true,
+			}, "sleep", "infinity"); err != nil {
+				b.Fatalf("failed to start utility container: %v", err)
+			}
+			err := harness.WaitUntilServing(ctx, utility, server, ip, port, probeTimeout)
+			utility.CleanUp(ctx)
+			if err != nil {
+				b.Fatalf("failed to wait for server: %v", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package base
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+// TestVerifyRuntime checks that harness.VerifyRuntime accepts a container
+// running under the requested runtime, and rejects one that actually runs
+// under runc, as if the daemon had fallen back to it.
+func TestVerifyRuntime(t *testing.T) {
+	harness.Requires(t)
+	ctx := h.Context()
+
+	t.Run("Match", func(t *testing.T) {
+		container := dockerutil.MakeContainer(ctx, t)
+		defer container.CleanUp(ctx)
+		if err := container.Spawn(ctx, dockerutil.RunOpts{
+			Image: "basic/alpine",
+		}, "sleep", "infinity"); err != nil {
+			t.Fatalf("failed to start container: %v", err)
+		}
+		if err := harness.VerifyRuntime(ctx, container); err != nil {
+			t.Errorf("VerifyRuntime failed: %v", err)
+		}
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		if dockerutil.Runtime() == "runc" {
+			t.Skip("runc is the runtime under test")
+		}
+		container := dockerutil.MakeContainerWithRuntime(ctx, t, "runc")
+		defer container.CleanUp(ctx)
+		if err := container.Spawn(ctx, dockerutil.RunOpts{
+			Image: "basic/alpine",
+		}, "sleep", "infinity"); err != nil {
+			t.Fatalf("failed to start container: %v", err)
+		}
+		container.Runtime = dockerutil.Runtime()
+		if err := harness.VerifyRuntime(ctx, container); err == nil {
+			t.Errorf("VerifyRuntime succeeded for a runc container requested with runtime %q, want error", container.Runtime)
+		}
+	})
+}
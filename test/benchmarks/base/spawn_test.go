@@ -0,0 +1,157 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package base
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+var spawnCPUs = flag.String("spawn-cpuset", "0", "CPUs the container of BenchmarkSpawn is pinned to, as for 'docker run --cpuset-cpus', so that host scheduling doesn't dominate")
+
+// spawnVariant is a way of creating processes benchmarked by BenchmarkSpawn.
+type spawnVariant struct {
+	name string
+
+	// metric is the name of the rate of process creation reported.
+	metric string
+
+	// cmd returns the command creating n processes, one after the other,
+	// which prints "completed <n>" once all of them succeeded.
+	cmd func(n int) []string
+}
+
+// spawnbench returns the cmd of a variant running spawnbench in mode.
+func spawnbench(mode string) func(n int) []string {
+	return func(n int) []string {
+		return []string{"spawnbench", mode, strconv.Itoa(n)}
+	}
+}
+
+var spawnVariants = []spawnVariant{
+	{
+		name:   "Shell",
+		metric: "execs_per_second",
+		cmd: func(n int) []string {
+			return []string{"sh", "-c", fmt.Sprintf(`n=0; for i in $(seq %d); do /bin/true && n=$((n+1)); done; echo "completed $n"`, n)}
+		},
+	},
+	{name: "Spawn", metric: "execs_per_second", cmd: spawnbench("spawn")},
+	{name: "ForkExec", metric: "execs_per_second", cmd: spawnbench("forkexec")},
+	{name: "Fork", metric: "forks_per_second", cmd: spawnbench("fork")},
+}
+
+// BenchmarkSpawn measures the rate at which processes are created in a
+// container: by a shell loop running /bin/true, by posix_spawn, and by fork
+// and exec, as well as by fork alone, with children exiting immediately.
+// ns/op is the time to create a process and wait for it to exit.
+func BenchmarkSpawn(b *testing.B) {
+	machine, err := h.GetMachine()
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer machine.CleanUp()
+
+	ctx := h.Context()
+	container := machine.GetContainer(ctx, b)
+	defer container.CleanUp(ctx)
+	if err := container.Spawn(ctx, dockerutil.RunOpts{
+		Image:      "benchmarks/syscallbench",
+		CpusetCpus: *spawnCPUs,
+	}, "sleep", "infinity"); err != nil {
+		b.Fatalf("failed to start container: %v", err)
+	}
+	if err := harness.VerifyRuntime(ctx, container); err != nil {
+		b.Fatalf("container runs under the wrong runtime: %v", err)
+	}
+
+	for _, variant := range spawnVariants {
+		b.Run(variant.name, func(b *testing.B) {
+			runSpawn(b, container, variant)
+		})
+	}
+}
+
+// runSpawn runs a single benchmark: the creation of b.N processes with
+// variant.
+func runSpawn(b *testing.B, container *dockerutil.Container, variant spawnVariant) {
+	b.StopTimer()
+	b.ResetTimer()
+	start := time.Now()
+	b.StartTimer()
+	out, err := container.Exec(h.Context(), dockerutil.ExecOpts{}, variant.cmd(b.N)...)
+	b.StopTimer()
+	elapsed := time.Since(start)
+	if err != nil {
+		b.Fatalf("%s failed with: %v: %s", variant.name, err, out)
+	}
+
+	// Check all processes were created, so that a loop cut short is never
+	// reported.
+	completed, err := parseCompleted(out)
+	if err != nil {
+		b.Fatalf("failed to parse output: %v", err)
+	}
+	if completed != b.N {
+		b.Fatalf("created %d processes, want: %d", completed, b.N)
+	}
+	r := h.Reporter(b)
+	r.ReportMetric(float64(b.N)/elapsed.Seconds(), variant.metric)
+	r.Finish()
+}
+
+var completedRE = regexp.MustCompile(`(?m)^completed (\d+)$`)
+
+// parseCompleted parses the number of processes created from the output of
+// a spawnVariant.
+func parseCompleted(data string) (int, error) {
+	match := completedRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, fmt.Errorf("failed to get completed processes: %s", data)
+	}
+	return strconv.Atoi(match[1])
+}
+
+// TestParseCompleted checks the parser of spawnVariant output works.
+func TestParseCompleted(t *testing.T) {
+	for _, tc := range []struct {
+		data    string
+		want    int
+		wantErr bool
+	}{
+		{data: "completed 1000\n", want: 1000},
+		{data: "completed 0\n", want: 0},
+		{data: "sh: 1: /bin/true: not found\n", wantErr: true},
+		{data: "", wantErr: true},
+	} {
+		got, err := parseCompleted(tc.data)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseCompleted(%q) got: %d, want error", tc.data, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("parseCompleted(%q) got: %d, %v, want: %d", tc.data, got, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package base
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+// syscallBenchCalls are the system calls syscallbench measures, in the order
+// it prints them. clock_gettime is measured both through the vDSO and as a
+// direct system call, as the vDSO is not always usable.
+var syscallBenchCalls = []string{
+	"getpid",
+	"sched_yield",
+	"read_dev_zero",
+	"clock_gettime_vdso",
+	"clock_gettime_syscall",
+	"futex_wake_wait",
+}
+
+// BenchmarkSyscalls measures the cost of common system calls, each issued b.N
+// times in a loop by syscallbench. Each is reported as a metric, in ns per
+// call; ns/op is the time of an iteration of all of them, including the
+// container's startup.
+func BenchmarkSyscalls(b *testing.B) {
+	machine, err := h.GetMachine()
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer machine.CleanUp()
+
+	ctx := h.Context()
+	container := machine.GetContainer(ctx, b)
+	defer container.CleanUp(ctx)
+
+	b.ResetTimer()
+	out, err := container.Run(ctx, dockerutil.RunOpts{
+		Image: "benchmarks/syscallbench",
+	}, "syscallbench", strconv.Itoa(b.N))
+	b.StopTimer()
+	if err != nil {
+		b.Fatalf("syscallbench failed with: %v: %s", err, out)
+	}
+
+	results, err := parseSyscallBench(out)
+	if err != nil {
+		b.Fatalf("failed to parse syscallbench output: %v", err)
+	}
+	r := h.Reporter(b)
+	for _, res := range results {
+		r.ReportMetric(res.nanos, res.name+"[ns]")
+	}
+	r.Finish()
+}
+
+// syscallResult is the cost of a system call measured by syscallbench.
+type syscallResult struct {
+	name  string
+	nanos float64
+}
+
+var syscallBenchRE = regexp.MustCompile(`(?m)^(\w+) (\d+(?:\.\d+)?) ns/op$`)
+
+// parseSyscallBench parses the cost of each system call from syscallbench
+// output, checking that all of syscallBenchCalls were measured.
+func parseSyscallBench(data string) ([]syscallResult, error) {
+	var results []syscallResult
+	seen := make(map[string]bool)
+	for _, match := range syscallBenchRE.FindAllStringSubmatch(data, -1) {
+		nanos, err := strconv.ParseFloat(match[2], 64)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, syscallResult{name: match[1], nanos: nanos})
+		seen[match[1]] = true
+	}
+	for _, name := range syscallBenchCalls {
+		if !seen[name] {
+			return nil, fmt.Errorf("no result for %s: %s", name, data)
+		}
+	}
+	return results, nil
+}
+
+// syscallBenchSampleData is sample output from syscallbench.
+const syscallBenchSampleData = `getpid 162.3 ns/op
+sched_yield 309.0 ns/op
+read_dev_zero 215.2 ns/op
+clock_gettime_vdso 40.6 ns/op
+clock_gettime_syscall 229.6 ns/op
+futex_wake_wait 3213.9 ns/op
+`
+
+// TestSyscallBenchParser checks the syscallbench parser works.
+func TestSyscallBenchParser(t *testing.T) {
+	results, err := parseSyscallBench(syscallBenchSampleData)
+	if err != nil {
+		t.Fatalf("failed to parse syscallbench output with error: %v", err)
+	}
+	want := []syscallResult{
+		{name: "getpid", nanos: 162.3},
+		{name: "sched_yield", nanos: 309.0},
+		{name: "read_dev_zero", nanos: 215.2},
+		{name: "clock_gettime_vdso", nanos: 40.6},
+		{name: "clock_gettime_syscall", nanos: 229.6},
+		{name: "futex_wake_wait", nanos: 3213.9},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("parseSyscallBench got: %+v, want: %+v", results, want)
+	}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("parseSyscallBench got: %+v, want: %+v", results[i], want[i])
+		}
+	}
+
+	// Output cut short, e.g. by a crash, is an error.
+	if _, err := parseSyscallBench("getpid 162.3 ns/op\n"); err == nil {
+		t.Errorf("parseSyscallBench got no error for partial output")
+	}
+}
+
+// TestSyscallBenchRunc runs syscallbench under runc, checking it works end to
+// end outside of the sandbox, where its numbers are the baseline.
+func TestSyscallBenchRunc(t *testing.T) {
+	harness.Requires(t)
+	ctx := h.Context()
+	container := dockerutil.MakeContainerWithRuntime(ctx, t, "runc")
+	defer container.CleanUp(ctx)
+	out, err := container.Run(ctx, dockerutil.RunOpts{
+		Image: "benchmarks/syscallbench",
+	}, "syscallbench", "1000")
+	if err != nil {
+		t.Fatalf("syscallbench failed with: %v: %s", err, out)
+	}
+	results, err := parseSyscallBench(out)
+	if err != nil {
+		t.Fatalf("failed to parse syscallbench output: %v", err)
+	}
+	for _, res := range results {
+		if res.nanos <= 0 {
+			t.Errorf("got %f ns/op for %s, want a positive cost", res.nanos, res.name)
+		}
+	}
+}
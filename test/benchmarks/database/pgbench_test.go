@@ -0,0 +1,206 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+// h is the harness of the benchmarks.
+var h harness.Harness
+
+var pgbenchScale = flag.Int("pgbench-scale", 10, "scale factor pgbench initializes the database with")
+
+// postgresPort is the port postgres listens on.
+const postgresPort = 5432
+
+// postgresShmSize is the size of the server's /dev/shm. The docker default of
+// 64MB is too small for postgres' shared memory with many clients.
+const postgresShmSize = 256 << 20
+
+// postgresReady matches the log lines of a freshly initialized server
+// accepting connections. The entrypoint runs a temporary server while
+// initializing the database, which is ready before the real one starts.
+const postgresReady = `(?s)init process complete.*database system is ready to accept connections`
+
+// BenchmarkPgbench runs the TPC-B like pgbench workload against a postgres
+// server, with an increasing number of clients. ns/op is the time to run one
+// transaction per client.
+func BenchmarkPgbench(b *testing.B) {
+	clientMachine, err := h.GetClientMachine()
+	if err != nil {
+		b.Fatalf("failed to get client machine: %v", err)
+	}
+	defer clientMachine.CleanUp()
+	serverMachine, err := h.GetMachine()
+	if err != nil {
+		b.Fatalf("failed to get server machine: %v", err)
+	}
+	defer serverMachine.CleanUp()
+	cpus, err := h.CPUPartition(clientMachine, serverMachine)
+	if err != nil {
+		b.Fatalf("failed to partition CPUs: %v", err)
+	}
+
+	ctx := h.Context()
+	server := serverMachine.GetContainer(ctx, b)
+	defer server.CleanUp(ctx)
+	serverOpts := dockerutil.RunOpts{
+		Image:   "benchmarks/postgres",
+		Ports:   []int{postgresPort},
+		Env:     []string{"POSTGRES_HOST_AUTH_METHOD=trust"},
+		ShmSize: postgresShmSize,
+	}
+	cpus.ApplyServer(&serverOpts)
+	if err := server.Spawn(ctx, serverOpts); err != nil {
+		b.Fatalf("failed to start server: %v", err)
+	}
+	if err := harness.VerifyRuntime(ctx, server); err != nil {
+		b.Fatalf("server runs under the wrong runtime: %v", err)
+	}
+	if _, err := server.WaitForOutput(ctx, postgresReady, 2*time.Minute); err != nil {
+		b.Fatalf("server did not start: %v", err)
+	}
+	ip, port, err := serverMachine.PublishedAddr(ctx, server, postgresPort)
+	if err != nil {
+		b.Fatalf("failed to find server address: %v", err)
+	}
+
+	client := clientMachine.GetClientContainer(ctx, b)
+	defer client.CleanUp(ctx)
+	clientOpts := dockerutil.RunOpts{
+		Image: "benchmarks/postgres",
+	}
+	cpus.ApplyClient(&clientOpts)
+	if err := client.Spawn(ctx, clientOpts, "sleep", "infinity"); err != nil {
+		b.Fatalf("failed to start client: %v", err)
+	}
+	conn := []string{"-h", ip.String(), "-p", strconv.Itoa(port), "-U", "postgres", "postgres"}
+	initArgs := append([]string{"pgbench", "-i", "-s", strconv.Itoa(*pgbenchScale)}, conn...)
+	if out, err := client.Exec(ctx, dockerutil.ExecOpts{}, initArgs...); err != nil {
+		b.Fatalf("failed to initialize database: %v: %s", err, out)
+	}
+
+	for _, clients := range []int{1, 8, 32} {
+		b.Run(fmt.Sprintf("%dClients", clients), func(b *testing.B) {
+			args := append([]string{
+				"pgbench",
+				"-c", strconv.Itoa(clients),
+				"-j", strconv.Itoa(clients),
+				"-t", strconv.Itoa(b.N),
+			}, conn...)
+
+			b.ResetTimer()
+			out, err := client.Exec(ctx, dockerutil.ExecOpts{}, args...)
+			b.StopTimer()
+			if err != nil {
+				b.Fatalf("pgbench failed: %v: %s", err, out)
+			}
+
+			tps, err := parseTPS(out)
+			if err != nil {
+				b.Fatalf("failed to parse tps: %v", err)
+			}
+			r := h.Reporter(b)
+			r.ReportMetric(tps, "tps")
+			latency, err := parseLatency(out)
+			if err != nil {
+				b.Fatalf("failed to parse latency: %v", err)
+			}
+			r.ReportMetric(latency, "mean_latency[ms]")
+			cpus.Report(r)
+			r.Finish()
+		})
+	}
+}
+
+var tpsRE = regexp.MustCompile(`tps = (\d+(?:\.\d+)?) \(excluding connections establishing\)`)
+
+// parseTPS parses the transactions per second, excluding the time to
+// establish connections, from pgbench output.
+func parseTPS(data string) (float64, error) {
+	match := tpsRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, fmt.Errorf("failed get tps: %s", data)
+	}
+	return strconv.ParseFloat(match[1], 64)
+}
+
+var latencyRE = regexp.MustCompile(`latency average = (\d+(?:\.\d+)?) ms`)
+
+// parseLatency parses the average transaction latency, in milliseconds, from
+// pgbench output.
+func parseLatency(data string) (float64, error) {
+	match := latencyRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, fmt.Errorf("failed get latency: %s", data)
+	}
+	return strconv.ParseFloat(match[1], 64)
+}
+
+// sampleData is sample output from pgbench.
+const sampleData = `starting vacuum...end.
+transaction type: <builtin: TPC-B (sort of)>
+scaling factor: 10
+query mode: simple
+number of clients: 8
+number of threads: 8
+number of transactions per client: 1000
+number of transactions actually processed: 8000/8000
+latency average = 5.873 ms
+tps = 1362.138457 (including connections establishing)
+tps = 1363.422690 (excluding connections establishing)
+`
+
+// TestParsers checks the parsers work.
+func TestParsers(t *testing.T) {
+	want := 1363.422690
+	got, err := parseTPS(sampleData)
+	if err != nil {
+		t.Fatalf("failed to parse tps with error: %v", err)
+	} else if got != want {
+		t.Fatalf("parseTPS got: %f, want: %f", got, want)
+	}
+
+	want = 5.873
+	got, err = parseLatency(sampleData)
+	if err != nil {
+		t.Fatalf("failed to parse latency with error: %v", err)
+	} else if got != want {
+		t.Fatalf("parseLatency got: %f, want: %f", got, want)
+	}
+
+	if got, err := parseTPS("garbage"); err == nil {
+		t.Errorf("parseTPS got: %f for garbage, want error", got)
+	}
+}
+
+// TestMain initializes the harness before running the benchmarks.
+func TestMain(m *testing.M) {
+	if err := h.Init(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize harness: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
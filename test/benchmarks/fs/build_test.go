@@ -0,0 +1,138 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+// buildSource is the source tree built, baked into the image.
+const buildSource = "/abseil-cpp"
+
+// buildArtifact is a library the build produces, relative to the build
+// directory. Its presence is checked so that a build that silently failed is
+// never reported.
+const buildArtifact = "absl/base/libabsl_base.a"
+
+// buildTargets are the directories the source is built in, by name: one in
+// the container's root filesystem and one bind mounted from the host.
+var buildTargets = []struct {
+	name string
+	dir  string
+}{
+	{name: "rootfs", dir: "/rootfs"},
+	{name: "bind", dir: "/bind"},
+}
+
+// BenchmarkBuild configures and builds abseil-cpp with cmake and make, in
+// each target, with one job and with as many jobs as the machine has CPUs.
+// ns/op is the time of a whole build.
+func BenchmarkBuild(b *testing.B) {
+	ctx := h.Context()
+	machine, err := h.GetMachine()
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer machine.CleanUp()
+	info, err := machine.Info()
+	if err != nil {
+		b.Fatalf("failed to get machine info: %v", err)
+	}
+
+	// The bind mount is a directory on the container's machine.
+	out, err := machine.RunCommand("mktemp", "-d")
+	if err != nil {
+		b.Fatalf("failed to create bind mount source: %v: %s", err, out)
+	}
+	bindSource := strings.TrimSpace(out)
+	defer machine.RunCommand("rm", "-rf", bindSource)
+
+	container := machine.GetContainer(ctx, b)
+	defer container.CleanUp(ctx)
+	if err := container.Spawn(ctx, dockerutil.RunOpts{
+		Image: "benchmarks/absl",
+		Mounts: []mount.Mount{
+			{
+				Type:   mount.TypeBind,
+				Source: bindSource,
+				Target: "/bind",
+			},
+		},
+	}, "sh", "-c", "mkdir -p /rootfs && sleep infinity"); err != nil {
+		b.Fatalf("failed to start container: %v", err)
+	}
+	if err := harness.VerifyRuntime(ctx, container); err != nil {
+		b.Fatalf("container runs under the wrong runtime: %v", err)
+	}
+
+	jobs := []int{1}
+	if info.CPUs > 1 {
+		jobs = append(jobs, info.CPUs)
+	}
+	for _, target := range buildTargets {
+		b.Run(target.name, func(b *testing.B) {
+			for _, j := range jobs {
+				b.Run(fmt.Sprintf("%dJobs", j), func(b *testing.B) {
+					runBuild(b, container, target.dir, j)
+				})
+			}
+		})
+	}
+}
+
+// runBuild runs a single benchmark: b.N builds of a fresh copy of the source
+// in dir, with the given number of make jobs.
+func runBuild(b *testing.B, container *dockerutil.Container, dir string, jobs int) {
+	b.StopTimer()
+	ctx := h.Context()
+	src := fmt.Sprintf("%s/src", dir)
+	build := fmt.Sprintf("%s/build", dir)
+	defer container.Exec(ctx, dockerutil.ExecOpts{}, "rm", "-rf", src, build)
+	cmd := fmt.Sprintf("mkdir %s && cd %s && cmake -DBUILD_TESTING=OFF %s && make -j %d", build, build, src, jobs)
+
+	var elapsed time.Duration
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Start from a fresh copy of the source, so that the build is
+		// never incremental.
+		prepare := fmt.Sprintf("rm -rf %s %s && cp -r %s %s", src, build, buildSource, src)
+		if out, err := container.Exec(ctx, dockerutil.ExecOpts{}, "sh", "-c", prepare); err != nil {
+			b.Fatalf("failed to copy source to %s: %v: %s", dir, err, out)
+		}
+
+		start := time.Now()
+		b.StartTimer()
+		out, err := container.Exec(ctx, dockerutil.ExecOpts{}, "sh", "-c", cmd)
+		b.StopTimer()
+		elapsed += time.Since(start)
+		if err != nil {
+			b.Fatalf("build failed with: %v: %s", err, out)
+		}
+		artifact := fmt.Sprintf("%s/%s", build, buildArtifact)
+		if out, err := container.Exec(ctx, dockerutil.ExecOpts{}, "test", "-f", artifact); err != nil {
+			b.Fatalf("build did not produce %s: %v: %s", artifact, err, out)
+		}
+	}
+	r := h.Reporter(b)
+	r.ReportMetric(elapsed.Seconds()/float64(b.N), "wall[s]")
+	r.Finish()
+}
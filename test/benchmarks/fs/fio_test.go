@@ -0,0 +1,272 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/mount"
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+// h is the harness of the benchmarks.
+var h harness.Harness
+
+// fioBytesPerOp is the size of the file accessed, per iteration.
+const fioBytesPerOp = 1 << 20
+
+// fioTargets are the directories fio runs in, by name: one in the
+// container's root filesystem, one bind mounted from the host, and one on a
+// tmpfs.
+var fioTargets = []struct {
+	name string
+	dir  string
+}{
+	{name: "rootfs", dir: "/rootfs"},
+	{name: "bind", dir: "/bind"},
+	{name: "tmpfs", dir: "/tmpfs"},
+}
+
+// fioJobs are the I/O patterns benchmarked, as for the rw fio option.
+var fioJobs = []string{"read", "write", "randread", "randwrite"}
+
+// fioBlockSizes are the block sizes benchmarked, as for the bs fio option.
+var fioBlockSizes = []string{"4k", "1m"}
+
+// BenchmarkFio runs fio against each target, for each job and block size.
+// ns/op is the time to access fioBytesPerOp bytes.
+func BenchmarkFio(b *testing.B) {
+	ctx := h.Context()
+	machine, err := h.GetMachine()
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer machine.CleanUp()
+
+	// The bind mount is a directory on the container's machine.
+	out, err := machine.RunCommand("mktemp", "-d")
+	if err != nil {
+		b.Fatalf("failed to create bind mount source: %v: %s", err, out)
+	}
+	bindSource := strings.TrimSpace(out)
+	defer machine.RunCommand("rm", "-rf", bindSource)
+
+	container := machine.GetContainer(ctx, b)
+	defer container.CleanUp(ctx)
+	if err := container.Spawn(ctx, dockerutil.RunOpts{
+		Image: "benchmarks/fio",
+		Mounts: []mount.Mount{
+			{
+				Type:   mount.TypeBind,
+				Source: bindSource,
+				Target: "/bind",
+			},
+		},
+		WritablePaths: []string{"/tmpfs"},
+	}, "sh", "-c", "mkdir -p /rootfs && sleep infinity"); err != nil {
+		b.Fatalf("failed to start container: %v", err)
+	}
+	if err := harness.VerifyRuntime(ctx, container); err != nil {
+		b.Fatalf("container runs under the wrong runtime: %v", err)
+	}
+
+	for _, target := range fioTargets {
+		b.Run(target.name, func(b *testing.B) {
+			for _, job := range fioJobs {
+				for _, bs := range fioBlockSizes {
+					b.Run(fmt.Sprintf("%s_%s", job, bs), func(b *testing.B) {
+						runFio(b, container, target.dir, job, bs)
+					})
+				}
+			}
+		})
+	}
+}
+
+// fioJobFile is a fio job file, taking the file name, its size, the block
+// size and the I/O pattern.
+const fioJobFile = `[global]
+filename=%s
+size=%d
+bs=%s
+ioengine=sync
+end_fsync=1
+
+[job]
+rw=%s
+`
+
+// runFio runs a single benchmark: job on a file of b.N*fioBytesPerOp bytes
+// in dir, with blocks of bs.
+func runFio(b *testing.B, container *dockerutil.Container, dir, job, bs string) {
+	b.StopTimer()
+	ctx := h.Context()
+	file := fmt.Sprintf("%s/fio.dat", dir)
+	size := b.N * fioBytesPerOp
+	defer container.Exec(ctx, dockerutil.ExecOpts{}, "rm", "-f", file)
+
+	// Lay out the file before it is read, so that doing so is not
+	// measured.
+	if !strings.Contains(job, "write") {
+		if out, err := container.Exec(ctx, dockerutil.ExecOpts{}, "fio", "--name=layout", "--filename="+file, fmt.Sprintf("--size=%d", size), "--bs=1m", "--rw=write"); err != nil {
+			b.Fatalf("failed to lay out %s: %v: %s", file, err, out)
+		}
+	}
+
+	jobFile := fmt.Sprintf(fioJobFile, file, size, bs, job)
+	cmd := fmt.Sprintf("cat > /tmp/job.fio <<'EOF'\n%sEOF\nfio --output-format=json /tmp/job.fio", jobFile)
+
+	b.ResetTimer()
+	b.StartTimer()
+	out, err := container.Exec(ctx, dockerutil.ExecOpts{}, "sh", "-c", cmd)
+	b.StopTimer()
+	if err != nil {
+		b.Fatalf("fio failed with: %v: %s", err, out)
+	}
+
+	results, err := parseFio(out)
+	if err != nil {
+		b.Fatalf("failed to parse fio output: %v", err)
+	}
+	r := h.Reporter(b)
+	for _, res := range results {
+		r.ReportMetric(res.bandwidth, "bandwidth[B/s]")
+		r.ReportMetric(res.iops, "iops")
+	}
+	r.Finish()
+}
+
+// fioOutput is the part of the --output-format=json output of fio used
+// here.
+type fioOutput struct {
+	Jobs []struct {
+		JobName string   `json:"jobname"`
+		Read    fioStats `json:"read"`
+		Write   fioStats `json:"write"`
+	} `json:"jobs"`
+}
+
+// fioStats are the statistics of a direction of I/O of a fio job.
+type fioStats struct {
+	// BW is the bandwidth in KiB/s.
+	BW   float64 `json:"bw"`
+	IOPS float64 `json:"iops"`
+}
+
+// fioResult is the result of a fio job.
+type fioResult struct {
+	job string
+
+	// bandwidth is in bytes per second.
+	bandwidth float64
+	iops      float64
+}
+
+// parseFio parses the results of each job from fio's JSON output. The
+// results of a job are those of the direction of I/O it did.
+func parseFio(data string) ([]fioResult, error) {
+	var out fioOutput
+	if err := json.NewDecoder(strings.NewReader(data)).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to decode %q: %v", data, err)
+	}
+	if len(out.Jobs) == 0 {
+		return nil, fmt.Errorf("no jobs: %s", data)
+	}
+	var results []fioResult
+	for _, job := range out.Jobs {
+		stats := job.Read
+		if job.Write.IOPS > stats.IOPS {
+			stats = job.Write
+		}
+		results = append(results, fioResult{
+			job:       job.JobName,
+			bandwidth: stats.BW * 1024,
+			iops:      stats.IOPS,
+		})
+	}
+	return results, nil
+}
+
+// sampleData is sample JSON output from fio, trimmed.
+const sampleData = `{
+  "fio version" : "fio-3.1",
+  "timestamp" : 1593036021,
+  "time" : "Wed Jun 24 22:00:21 2020",
+  "global options" : {
+    "filename" : "/tmpfs/fio.dat",
+    "size" : "104857600",
+    "bs" : "4k",
+    "ioengine" : "sync",
+    "end_fsync" : "1"
+  },
+  "jobs" : [
+    {
+      "jobname" : "job",
+      "groupid" : 0,
+      "error" : 0,
+      "eta" : 0,
+      "elapsed" : 1,
+      "job options" : {
+        "rw" : "randwrite"
+      },
+      "read" : {
+        "io_bytes" : 0,
+        "io_kbytes" : 0,
+        "bw" : 0,
+        "iops" : 0.000000,
+        "runtime" : 0
+      },
+      "write" : {
+        "io_bytes" : 104857600,
+        "io_kbytes" : 102400,
+        "bw" : 512000,
+        "iops" : 128000.000000,
+        "runtime" : 200
+      }
+    }
+  ]
+}`
+
+// TestParsers checks the parsers work.
+func TestParsers(t *testing.T) {
+	got, err := parseFio(sampleData)
+	if err != nil {
+		t.Fatalf("failed to parse fio output with error: %v", err)
+	}
+	want := []fioResult{{job: "job", bandwidth: 512000 * 1024, iops: 128000}}
+	if len(got) != len(want) || got[0] != want[0] {
+		t.Fatalf("parseFio got: %+v, want: %+v", got, want)
+	}
+
+	for _, data := range []string{`{"jobs": []}`, "garbage"} {
+		if got, err := parseFio(data); err == nil {
+			t.Errorf("parseFio got: %+v for %q, want error", got, data)
+		}
+	}
+}
+
+// TestMain initializes the harness before running the benchmarks.
+func TestMain(m *testing.M) {
+	if err := h.Init(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize harness: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
@@ -0,0 +1,170 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+var tarFiles = flag.Int("tar-files", 10000, "number of files in the archive extracted by BenchmarkTar")
+
+// tarTargets are the directories the archive is extracted in, by name: one
+// in the container's root filesystem, one bind mounted from the host, and one
+// on a tmpfs.
+var tarTargets = []struct {
+	name string
+	dir  string
+}{
+	{name: "rootfs", dir: "/rootfs"},
+	{name: "bind", dir: "/bind"},
+	{name: "tmpfs", dir: "/tmpfs"},
+}
+
+// tarSpec returns the spec of the corpus archived: files small files spread
+// over 256 directories.
+func tarSpec(files int) harness.CorpusSpec {
+	return harness.CorpusSpec{
+		Seed:     1,
+		Files:    files,
+		FileSize: 4096,
+		Fanout:   16,
+		Depth:    2,
+	}
+}
+
+// BenchmarkTar extracts an archive of many small files in each target with
+// tar, then removes the extracted tree. ns/op is the time of an extraction;
+// that of the removal is reported separately, as unlinking takes different
+// paths.
+func BenchmarkTar(b *testing.B) {
+	ctx := h.Context()
+	machine, err := h.GetMachine()
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer machine.CleanUp()
+
+	// The archive is prepared on the host, outside of any sandbox.
+	corpus, err := harness.DefaultCorpusCache().Path(tarSpec(*tarFiles))
+	if err != nil {
+		b.Fatalf("failed to generate corpus: %v", err)
+	}
+	tmp, err := ioutil.TempDir("", "tar")
+	if err != nil {
+		b.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+	archive := filepath.Join(tmp, "files.tar")
+	if out, err := exec.Command("tar", "cf", archive, "-C", corpus, ".").CombinedOutput(); err != nil {
+		b.Fatalf("failed to create archive: %v: %s", err, out)
+	}
+
+	// The bind mount is a directory on the container's machine.
+	out, err := machine.RunCommand("mktemp", "-d")
+	if err != nil {
+		b.Fatalf("failed to create bind mount source: %v: %s", err, out)
+	}
+	bindSource := strings.TrimSpace(out)
+	defer machine.RunCommand("rm", "-rf", bindSource)
+
+	container := machine.GetContainer(ctx, b)
+	defer container.CleanUp(ctx)
+	if err := container.Spawn(ctx, dockerutil.RunOpts{
+		Image: "basic/ubuntu",
+		Mounts: []mount.Mount{
+			{
+				Type:   mount.TypeBind,
+				Source: bindSource,
+				Target: "/bind",
+			},
+		},
+		WritablePaths: []string{"/tmpfs"},
+	}, "sh", "-c", "mkdir -p /rootfs && sleep infinity"); err != nil {
+		b.Fatalf("failed to start container: %v", err)
+	}
+	if err := harness.VerifyRuntime(ctx, container); err != nil {
+		b.Fatalf("container runs under the wrong runtime: %v", err)
+	}
+	if err := container.CopyTo(ctx, archive, "/"); err != nil {
+		b.Fatalf("failed to copy archive: %v", err)
+	}
+
+	for _, target := range tarTargets {
+		b.Run(target.name, func(b *testing.B) {
+			runTar(b, container, "/"+filepath.Base(archive), target.dir, *tarFiles)
+		})
+	}
+}
+
+// runTar runs a single benchmark: b.N extractions of archive, holding files
+// regular files, in dir, each followed by the removal of the extracted tree.
+func runTar(b *testing.B, container *dockerutil.Container, archive, dir string, files int) {
+	b.StopTimer()
+	ctx := h.Context()
+	dest := fmt.Sprintf("%s/extract", dir)
+	defer container.Exec(ctx, dockerutil.ExecOpts{}, "rm", "-rf", dest)
+
+	var extract, remove time.Duration
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if out, err := container.Exec(ctx, dockerutil.ExecOpts{}, "sh", "-c", fmt.Sprintf("rm -rf %s && mkdir %s", dest, dest)); err != nil {
+			b.Fatalf("failed to create %s: %v: %s", dest, err, out)
+		}
+
+		start := time.Now()
+		b.StartTimer()
+		out, err := container.Exec(ctx, dockerutil.ExecOpts{}, "tar", "xf", archive, "-C", dest)
+		b.StopTimer()
+		extract += time.Since(start)
+		if err != nil {
+			b.Fatalf("tar failed with: %v: %s", err, out)
+		}
+
+		// Check the whole archive was extracted, so that a partially
+		// failed run is never reported.
+		out, err = container.Exec(ctx, dockerutil.ExecOpts{}, "sh", "-c", fmt.Sprintf("find %s -type f | wc -l", dest))
+		if err != nil {
+			b.Fatalf("failed to count extracted files: %v: %s", err, out)
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(out)); err != nil || n != files {
+			b.Fatalf("extracted %q files, want: %d", strings.TrimSpace(out), files)
+		}
+
+		start = time.Now()
+		out, err = container.Exec(ctx, dockerutil.ExecOpts{}, "rm", "-rf", dest)
+		remove += time.Since(start)
+		if err != nil {
+			b.Fatalf("rm failed with: %v: %s", err, out)
+		}
+	}
+	r := h.Reporter(b)
+	r.ReportMetric(extract.Seconds()/float64(b.N), "extract[s]")
+	r.ReportMetric(float64(files*b.N)/extract.Seconds(), "files_per_second")
+	r.ReportMetric(remove.Seconds()/float64(b.N), "remove[s]")
+	r.Finish()
+}
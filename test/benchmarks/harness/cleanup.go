@@ -0,0 +1,156 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+)
+
+// ownerLabel labels the containers of a run with their owner, the host and
+// pid of the benchmark process, e.g. "host/1234". Containers left behind by
+// runs that were killed are found by it, and removed by later runs.
+const ownerLabel = "dev.gvisor.benchmark.owner"
+
+// owner returns the owner of the containers of this run.
+func owner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s/%d", host, os.Getpid())
+}
+
+// staleOwner returns whether the process owning containers, as returned by
+// owner, is gone. The processes of other hosts can't be checked, so their
+// containers are never stale.
+func staleOwner(o string) bool {
+	i := strings.LastIndex(o, "/")
+	if i < 0 {
+		return false
+	}
+	if host, _ := os.Hostname(); o[:i] != host {
+		return false
+	}
+	pid, err := strconv.Atoi(o[i+1:])
+	if err != nil {
+		return false
+	}
+	return unix.Kill(pid, 0) == unix.ESRCH
+}
+
+// pruneContainers removes the containers of the daemon at host, as for
+// dockerutil.RemoveContainers, that were left behind by runs that are gone.
+func pruneContainers(ctx context.Context, host string) error {
+	n, err := dockerutil.RemoveContainers(ctx, host, ownerLabel, func(labels map[string]string) bool {
+		return !staleOwner(labels[ownerLabel])
+	})
+	if n > 0 {
+		fmt.Fprintf(os.Stderr, "removed %d containers left behind by previous runs\n", n)
+	}
+	return err
+}
+
+// tracker tracks the cleanups of a run, so that they can be run if it is
+// interrupted.
+type tracker struct {
+	mu       sync.Mutex
+	cleanups []func()
+
+	// containers are the tracked containers, e.g. for diagnostics.
+	containers []*dockerutil.Container
+}
+
+// add registers cleanup.
+func (t *tracker) add(cleanup func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cleanups = append(t.cleanups, cleanup)
+}
+
+// track labels the new container c with its owner, and registers its
+// cleanup with t, if any. It returns c.
+func (t *tracker) track(c *dockerutil.Container) *dockerutil.Container {
+	if c == nil {
+		return nil
+	}
+	c.Labels = map[string]string{ownerLabel: owner()}
+	if t != nil {
+		t.add(func() { c.CleanUp(context.Background()) })
+		t.mu.Lock()
+		t.containers = append(t.containers, c)
+		t.mu.Unlock()
+	}
+	return c
+}
+
+// tracked returns the containers tracked so far, including those that were
+// cleaned up since.
+func (t *tracker) tracked() []*dockerutil.Container {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*dockerutil.Container(nil), t.containers...)
+}
+
+// run runs the registered cleanups, most recent first. Each is run once.
+func (t *tracker) run() {
+	t.mu.Lock()
+	cleanups := t.cleanups
+	t.cleanups = nil
+	t.mu.Unlock()
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+}
+
+// exit exits the process once an interrupted run is cleaned up. It is
+// replaced by tests.
+var exit = os.Exit
+
+// handleSignals makes the run clean up and exit on SIGINT or SIGTERM: the
+// harness' context is cancelled, and the registered cleanups are run. It
+// returns a function that stops handling them.
+func (h *Harness) handleSignals() (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, unix.SIGINT, unix.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-sigs:
+			fmt.Fprintf(os.Stderr, "got %v, cleaning up\n", sig)
+			h.cancel()
+			h.tracker.run()
+			// As shells report processes killed by a signal.
+			exit(128 + int(sig.(unix.Signal)))
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
+// AddCleanup registers cleanup to run if the run is interrupted, e.g. to
+// remove state outside of the containers from GetMachine, which are
+// registered already.
+func (h *Harness) AddCleanup(cleanup func()) {
+	h.tracker.add(cleanup)
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestSignalCleanup(t *testing.T) {
+	exited := make(chan int, 1)
+	defer func(old func(int)) { exit = old }(exit)
+	exit = func(code int) { exited <- code }
+
+	var h Harness
+	h.initContext()
+	stop := h.handleSignals()
+	defer stop()
+
+	var ran []int
+	for i := 0; i < 3; i++ {
+		i := i
+		h.AddCleanup(func() { ran = append(ran, i) })
+	}
+	if err := unix.Kill(os.Getpid(), unix.SIGINT); err != nil {
+		t.Fatalf("kill failed: %v", err)
+	}
+
+	select {
+	case code := <-exited:
+		if want := 128 + int(unix.SIGINT); code != want {
+			t.Errorf("got exit status %d, want %d", code, want)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("run did not exit on SIGINT")
+	}
+	if h.Context().Err() == nil {
+		t.Errorf("harness context was not cancelled")
+	}
+	if want := []int{2, 1, 0}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("got cleanups %v run, want %v", ran, want)
+	}
+}
+
+func TestStaleOwner(t *testing.T) {
+	host, err := os.Hostname()
+	if err != nil {
+		t.Fatalf("os.Hostname failed: %v", err)
+	}
+	// Pids are at most 2^22 on Linux.
+	const deadPid = 1 << 23
+
+	for _, tc := range []struct {
+		owner string
+		want  bool
+	}{
+		{owner: owner()},
+		{owner: fmt.Sprintf("%s/%d", host, deadPid), want: true},
+		{owner: fmt.Sprintf("other-%s/%d", host, deadPid)},
+		{owner: "garbage"},
+	} {
+		if got := staleOwner(tc.owner); got != tc.want {
+			t.Errorf("staleOwner(%q) got %t, want %t", tc.owner, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,441 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+var (
+	corpusDir     = flag.String("corpus-dir", filepath.Join(os.TempDir(), "benchmark-corpora"), "directory in which generated benchmark corpora are cached")
+	corpusCacheGB = flag.Int64("corpus-cache-gb", 64, "maximum size in GB of the corpus cache; least recently used corpora are evicted beyond it")
+)
+
+const (
+	// corpusVersion is mixed into every cache key. Bump it whenever the
+	// generator changes the contents or layout it produces.
+	corpusVersion = 2
+
+	// sentinelName is the name of the file, next to the generated data, that
+	// marks a corpus as complete and describes it.
+	sentinelName = "corpus.json"
+
+	// dataName is the name of the directory holding the generated files.
+	dataName = "data"
+
+	// tmpPrefix prefixes directories holding corpora being generated.
+	tmpPrefix = ".tmp-"
+
+	// chunkSize is the size of writes used to fill non-sparse files.
+	chunkSize = 1 << 20
+)
+
+// CorpusSpec describes a generated corpus. Two corpora generated from equal
+// specs have identical contents.
+type CorpusSpec struct {
+	// Seed determines the contents of the files.
+	Seed int64
+
+	// Files is the number of files to generate.
+	Files int
+
+	// FileSize is the size in bytes of each file.
+	FileSize int64
+
+	// Sparse creates files without writing to them, so they read back as
+	// zeros and take no space on disk.
+	Sparse bool
+
+	// Fanout is the number of subdirectories per directory level. Files are
+	// distributed over Depth levels of Fanout subdirectories each; a zero
+	// Fanout or Depth places all files in a single directory.
+	Fanout int
+
+	// Depth is the number of directory levels.
+	Depth int
+}
+
+// key returns the content address of the corpus described by s.
+func (s CorpusSpec) key() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "v%d %+v", corpusVersion, s)
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// size returns the number of bytes the corpus occupies on disk, ignoring
+// file system metadata.
+func (s CorpusSpec) size() int64 {
+	if s.Sparse {
+		return 0
+	}
+	return int64(s.Files) * s.FileSize
+}
+
+// filePath returns the path of the i-th file relative to the data directory.
+func (s CorpusSpec) filePath(i int) string {
+	var parts []string
+	if s.Fanout > 0 {
+		n := i
+		for l := 0; l < s.Depth; l++ {
+			parts = append(parts, strconv.Itoa(n%s.Fanout))
+			n /= s.Fanout
+		}
+	}
+	parts = append(parts, fmt.Sprintf("file-%d", i))
+	return filepath.Join(parts...)
+}
+
+// corpusSentinel is the content of the sentinel file.
+type corpusSentinel struct {
+	Key  string
+	Spec CorpusSpec
+}
+
+// CorpusCache generates benchmark input corpora on the host and caches them
+// in a directory keyed by their CorpusSpec, so that repeated runs reuse them.
+// It is safe for concurrent use, including by several processes sharing Dir.
+type CorpusCache struct {
+	// Dir is the directory holding the cached corpora.
+	Dir string
+
+	// MaxSize is the size in bytes beyond which least recently used corpora
+	// are evicted. A zero MaxSize disables eviction.
+	MaxSize int64
+
+	mu sync.Mutex
+	// generating holds a lock per corpus key, serializing generation of the
+	// same corpus within this process.
+	generating map[string]*sync.Mutex
+}
+
+var (
+	defaultCorpusCacheOnce sync.Once
+	defaultCorpusCache     *CorpusCache
+)
+
+// DefaultCorpusCache returns the cache configured by the --corpus-dir and
+// --corpus-cache-gb flags.
+func DefaultCorpusCache() *CorpusCache {
+	defaultCorpusCacheOnce.Do(func() {
+		defaultCorpusCache = &CorpusCache{
+			Dir:     *corpusDir,
+			MaxSize: *corpusCacheGB << 30,
+		}
+	})
+	return defaultCorpusCache
+}
+
+// CorpusMount returns a read-only bind mount of the corpus described by spec
+// at target, generating it in the default cache if needed.
+func CorpusMount(spec CorpusSpec, target string) (mount.Mount, error) {
+	return DefaultCorpusCache().Mount(spec, target)
+}
+
+// Mount returns a read-only bind mount of the corpus described by spec at
+// target, ready to be added to dockerutil.RunOpts.Mounts. The corpus is
+// generated if it is not cached or if the cached copy fails verification.
+//
+// The mount is read-only because the corpus is shared with later runs;
+// benchmarks that modify their input should copy it first.
+func (c *CorpusCache) Mount(spec CorpusSpec, target string) (mount.Mount, error) {
+	dir, err := c.Path(spec)
+	if err != nil {
+		return mount.Mount{}, err
+	}
+	return mount.Mount{
+		Type:     mount.TypeBind,
+		Source:   dir,
+		Target:   target,
+		ReadOnly: true,
+	}, nil
+}
+
+// Path returns the host directory holding the corpus described by spec,
+// generating it if needed.
+func (c *CorpusCache) Path(spec CorpusSpec) (string, error) {
+	if spec.Files <= 0 || spec.FileSize < 0 {
+		return "", fmt.Errorf("invalid corpus spec %+v", spec)
+	}
+	key := spec.key()
+
+	l := c.lock(key)
+	l.Lock()
+	defer l.Unlock()
+
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create corpus cache %q: %v", c.Dir, err)
+	}
+	dir := filepath.Join(c.Dir, key)
+	if err := verifyCorpus(dir, key, spec); err != nil {
+		if err := os.RemoveAll(dir); err != nil {
+			return "", fmt.Errorf("failed to remove invalid corpus %q: %v", dir, err)
+		}
+		if err := c.generate(dir, key, spec); err != nil {
+			return "", err
+		}
+	}
+
+	// Mark the corpus as recently used.
+	now := time.Now()
+	if err := os.Chtimes(filepath.Join(dir, sentinelName), now, now); err != nil {
+		return "", fmt.Errorf("failed to touch corpus %q: %v", dir, err)
+	}
+	if err := c.evict(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, dataName), nil
+}
+
+// lock returns the generation lock for key.
+func (c *CorpusCache) lock(key string) *sync.Mutex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generating == nil {
+		c.generating = make(map[string]*sync.Mutex)
+	}
+	l, ok := c.generating[key]
+	if !ok {
+		l = &sync.Mutex{}
+		c.generating[key] = l
+	}
+	return l
+}
+
+// generate generates the corpus into a temporary directory and then renames
+// it to dir, so that a corpus is never visible half-written. If another
+// process wins the race to dir, its corpus is used instead.
+func (c *CorpusCache) generate(dir, key string, spec CorpusSpec) error {
+	tmp, err := ioutil.TempDir(c.Dir, tmpPrefix+key+"-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary corpus directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return fmt.Errorf("os.Chmod(%q, 0755) failed: %v", tmp, err)
+	}
+
+	if err := generateFiles(filepath.Join(tmp, dataName), spec); err != nil {
+		return err
+	}
+	sentinel, err := json.Marshal(corpusSentinel{Key: key, Spec: spec})
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmp, sentinelName), sentinel, 0644); err != nil {
+		return fmt.Errorf("failed to write corpus sentinel: %v", err)
+	}
+
+	if err := os.Rename(tmp, dir); err != nil {
+		if verifyCorpus(dir, key, spec) == nil {
+			// Generated concurrently by another process.
+			return nil
+		}
+		return fmt.Errorf("failed to move corpus into place at %q: %v", dir, err)
+	}
+	return nil
+}
+
+// generateFiles creates the files described by spec under dir in parallel.
+func generateFiles(dir string, spec CorpusSpec) error {
+	indices := make(chan int)
+	errs := make(chan error, runtime.NumCPU())
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				if err := generateFile(filepath.Join(dir, spec.filePath(i)), spec, i); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	var err error
+	for i := 0; i < spec.Files && err == nil; i++ {
+		select {
+		case indices <- i:
+		case err = <-errs:
+		}
+	}
+	close(indices)
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+// generateFile creates the i-th file of the corpus described by spec at
+// path. Its contents are derived from the spec's seed and i only.
+func generateFile(path string, spec CorpusSpec, i int) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create corpus directory: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create corpus file: %v", err)
+	}
+	defer f.Close()
+
+	if spec.Sparse {
+		if err := f.Truncate(spec.FileSize); err != nil {
+			return fmt.Errorf("failed to size corpus file %q: %v", path, err)
+		}
+		return f.Close()
+	}
+
+	r := rand.New(rand.NewSource(fileSeed(spec.Seed, i)))
+	buf := make([]byte, chunkSize)
+	for remaining := spec.FileSize; remaining > 0; {
+		n := int64(len(buf))
+		if remaining < n {
+			n = remaining
+		}
+		r.Read(buf[:n])
+		if _, err := f.Write(buf[:n]); err != nil {
+			return fmt.Errorf("failed to write corpus file %q: %v", path, err)
+		}
+		remaining -= n
+	}
+	return f.Close()
+}
+
+// fileSeed returns the seed of the contents of the i-th file of a corpus
+// generated from seed. Seeds are hashed rather than, e.g., added, so that
+// corpora with neighbouring seeds don't share files.
+func fileSeed(seed int64, i int) int64 {
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], uint64(seed))
+	binary.LittleEndian.PutUint64(buf[8:], uint64(i))
+	h := fnv.New64a()
+	h.Write(buf[:])
+	return int64(h.Sum64())
+}
+
+// verifyCorpus checks that dir holds a complete corpus for spec: the sentinel
+// must describe exactly this corpus, and the last file generated must exist
+// with the expected size.
+func verifyCorpus(dir, key string, spec CorpusSpec) error {
+	sentinel, err := readSentinel(dir)
+	if err != nil {
+		return err
+	}
+	if sentinel.Key != key || !reflect.DeepEqual(sentinel.Spec, spec) {
+		return fmt.Errorf("corpus %q has sentinel %+v, want key %s and spec %+v", dir, sentinel, key, spec)
+	}
+	last := filepath.Join(dir, dataName, spec.filePath(spec.Files-1))
+	fi, err := os.Stat(last)
+	if err != nil {
+		return fmt.Errorf("corpus %q is incomplete: %v", dir, err)
+	}
+	if fi.Size() != spec.FileSize {
+		return fmt.Errorf("corpus file %q has size %d, want %d", last, fi.Size(), spec.FileSize)
+	}
+	return nil
+}
+
+// readSentinel reads the sentinel of the corpus in dir.
+func readSentinel(dir string) (corpusSentinel, error) {
+	var sentinel corpusSentinel
+	data, err := ioutil.ReadFile(filepath.Join(dir, sentinelName))
+	if err != nil {
+		return sentinel, fmt.Errorf("corpus %q has no sentinel: %v", dir, err)
+	}
+	if err := json.Unmarshal(data, &sentinel); err != nil {
+		return sentinel, fmt.Errorf("corpus %q has a corrupt sentinel: %v", dir, err)
+	}
+	return sentinel, nil
+}
+
+// evict removes least recently used corpora, other than the one with the
+// given key, until the cache fits in MaxSize.
+func (c *CorpusCache) evict(keep string) error {
+	if c.MaxSize <= 0 {
+		return nil
+	}
+	entries, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to list corpus cache %q: %v", c.Dir, err)
+	}
+
+	type cached struct {
+		dir      string
+		size     int64
+		lastUsed time.Time
+	}
+	var corpora []cached
+	var total int64
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), tmpPrefix) {
+			continue
+		}
+		dir := filepath.Join(c.Dir, e.Name())
+		sentinel, err := readSentinel(dir)
+		if err != nil {
+			// Incomplete or corrupt corpora are regenerated on their next
+			// use anyway.
+			continue
+		}
+		fi, err := os.Stat(filepath.Join(dir, sentinelName))
+		if err != nil {
+			continue
+		}
+		total += sentinel.Spec.size()
+		if sentinel.Key != keep {
+			corpora = append(corpora, cached{dir, sentinel.Spec.size(), fi.ModTime()})
+		}
+	}
+
+	sort.Slice(corpora, func(i, j int) bool {
+		return corpora[i].lastUsed.Before(corpora[j].lastUsed)
+	})
+	for _, cc := range corpora {
+		if total <= c.MaxSize {
+			break
+		}
+		if err := os.RemoveAll(cc.dir); err != nil {
+			return fmt.Errorf("failed to evict corpus %q: %v", cc.dir, err)
+		}
+		total -= cc.size
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+var smallSpec = CorpusSpec{
+	Seed:     1,
+	Files:    100,
+	FileSize: 4096,
+	Fanout:   4,
+	Depth:    2,
+}
+
+func newCache(t *testing.T) *CorpusCache {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "corpus")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return &CorpusCache{Dir: dir}
+}
+
+func TestCorpusGenerate(t *testing.T) {
+	c := newCache(t)
+	m, err := c.Mount(smallSpec, "/corpus")
+	if err != nil {
+		t.Fatalf("Mount failed: %v", err)
+	}
+	if !m.ReadOnly || m.Target != "/corpus" {
+		t.Errorf("got mount %+v, want read-only mount at /corpus", m)
+	}
+
+	var files int
+	if err := filepath.Walk(m.Source, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			files++
+			if fi.Size() != smallSpec.FileSize {
+				t.Errorf("file %q has size %d, want %d", path, fi.Size(), smallSpec.FileSize)
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("filepath.Walk failed: %v", err)
+	}
+	if files != smallSpec.Files {
+		t.Errorf("got %d files, want %d", files, smallSpec.Files)
+	}
+}
+
+func TestCorpusDeterministic(t *testing.T) {
+	a, err := newCache(t).Path(smallSpec)
+	if err != nil {
+		t.Fatalf("Path failed: %v", err)
+	}
+	b, err := newCache(t).Path(smallSpec)
+	if err != nil {
+		t.Fatalf("Path failed: %v", err)
+	}
+	for _, i := range []int{0, smallSpec.Files - 1} {
+		name := smallSpec.filePath(i)
+		got, err := ioutil.ReadFile(filepath.Join(a, name))
+		if err != nil {
+			t.Fatalf("ioutil.ReadFile failed: %v", err)
+		}
+		want, err := ioutil.ReadFile(filepath.Join(b, name))
+		if err != nil {
+			t.Fatalf("ioutil.ReadFile failed: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("file %q differs between corpora generated from the same spec", name)
+		}
+	}
+
+	other := smallSpec
+	other.Seed++
+	c, err := newCache(t).Path(other)
+	if err != nil {
+		t.Fatalf("Path failed: %v", err)
+	}
+	got, _ := ioutil.ReadFile(filepath.Join(a, smallSpec.filePath(0)))
+	want, _ := ioutil.ReadFile(filepath.Join(c, smallSpec.filePath(0)))
+	if bytes.Equal(got, want) {
+		t.Errorf("corpora generated with different seeds are identical")
+	}
+
+	// Files of corpora with neighbouring seeds must not be shifted copies of
+	// each other.
+	got, _ = ioutil.ReadFile(filepath.Join(a, smallSpec.filePath(1)))
+	if bytes.Equal(got, want) {
+		t.Errorf("corpora generated with neighbouring seeds share files")
+	}
+}
+
+func TestCorpusCacheHit(t *testing.T) {
+	c := newCache(t)
+	first, err := c.Path(smallSpec)
+	if err != nil {
+		t.Fatalf("Path failed: %v", err)
+	}
+	// A marker survives only if the corpus is not regenerated.
+	marker := filepath.Join(first, "marker")
+	if err := ioutil.WriteFile(marker, nil, 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile failed: %v", err)
+	}
+
+	second, err := c.Path(smallSpec)
+	if err != nil {
+		t.Fatalf("Path failed: %v", err)
+	}
+	if second != first {
+		t.Errorf("got path %q, want %q", second, first)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("corpus was regenerated on a cache hit: %v", err)
+	}
+}
+
+func TestCorpusCorruption(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		corrupt func(dir string) error
+	}{
+		{
+			name: "garbage sentinel",
+			corrupt: func(dir string) error {
+				return ioutil.WriteFile(filepath.Join(dir, sentinelName), []byte("garbage"), 0644)
+			},
+		},
+		{
+			name: "missing sentinel",
+			corrupt: func(dir string) error {
+				return os.Remove(filepath.Join(dir, sentinelName))
+			},
+		},
+		{
+			name: "truncated file",
+			corrupt: func(dir string) error {
+				return os.Truncate(filepath.Join(dir, dataName, smallSpec.filePath(smallSpec.Files-1)), 1)
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newCache(t)
+			data, err := c.Path(smallSpec)
+			if err != nil {
+				t.Fatalf("Path failed: %v", err)
+			}
+			marker := filepath.Join(data, "marker")
+			if err := ioutil.WriteFile(marker, nil, 0644); err != nil {
+				t.Fatalf("ioutil.WriteFile failed: %v", err)
+			}
+			dir := filepath.Dir(data)
+			if err := tc.corrupt(dir); err != nil {
+				t.Fatalf("failed to corrupt corpus: %v", err)
+			}
+
+			if _, err := c.Path(smallSpec); err != nil {
+				t.Fatalf("Path failed: %v", err)
+			}
+			if _, err := os.Stat(marker); !os.IsNotExist(err) {
+				t.Errorf("corrupt corpus was not regenerated: marker stat got err %v", err)
+			}
+			if err := verifyCorpus(dir, smallSpec.key(), smallSpec); err != nil {
+				t.Errorf("regenerated corpus is invalid: %v", err)
+			}
+		})
+	}
+}
+
+func TestCorpusConcurrent(t *testing.T) {
+	const parallel = 8
+	c := newCache(t)
+	paths := make([]string, parallel)
+	errs := make([]error, parallel)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			paths[i], errs[i] = c.Path(smallSpec)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < parallel; i++ {
+		if errs[i] != nil {
+			t.Fatalf("Path failed: %v", errs[i])
+		}
+		if paths[i] != paths[0] {
+			t.Errorf("got path %q, want %q", paths[i], paths[0])
+		}
+	}
+	entries, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		t.Fatalf("ioutil.ReadDir failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d entries in the cache, want 1: %v", len(entries), entries)
+	}
+}
+
+func TestCorpusEviction(t *testing.T) {
+	c := newCache(t)
+	c.MaxSize = 2 * smallSpec.size()
+
+	var dirs []string
+	for seed := int64(0); seed < 3; seed++ {
+		spec := smallSpec
+		spec.Seed = seed
+		data, err := c.Path(spec)
+		if err != nil {
+			t.Fatalf("Path failed: %v", err)
+		}
+		dirs = append(dirs, filepath.Dir(data))
+	}
+
+	if _, err := os.Stat(dirs[0]); !os.IsNotExist(err) {
+		t.Errorf("least recently used corpus was not evicted: stat got err %v", err)
+	}
+	for _, dir := range dirs[1:] {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("recently used corpus %q was evicted: %v", dir, err)
+		}
+	}
+}
+
+func TestCorpusSparse(t *testing.T) {
+	spec := CorpusSpec{
+		Files:    1,
+		FileSize: 1 << 30,
+		Sparse:   true,
+	}
+	data, err := newCache(t).Path(spec)
+	if err != nil {
+		t.Fatalf("Path failed: %v", err)
+	}
+	fi, err := os.Stat(filepath.Join(data, spec.filePath(0)))
+	if err != nil {
+		t.Fatalf("os.Stat failed: %v", err)
+	}
+	if fi.Size() != spec.FileSize {
+		t.Errorf("got size %d, want %d", fi.Size(), spec.FileSize)
+	}
+}
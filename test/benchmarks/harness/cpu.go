@@ -0,0 +1,89 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+)
+
+// cpuSampleInterval is the interval at which CPUSampler samples. The daemon
+// produces samples about every second, which bounds it in practice.
+const cpuSampleInterval = 500 * time.Millisecond
+
+// CPUSampler samples the CPU usage of a container, from SampleCPU until Stop.
+type CPUSampler struct {
+	cancel func()
+
+	// done is closed once samples is complete.
+	done    chan struct{}
+	samples []types.StatsJSON
+}
+
+// SampleCPU starts sampling the CPU usage of the container c. It should start
+// once the load to measure does, e.g. after warm-up, so that idle time
+// doesn't dilute the average.
+func SampleCPU(ctx context.Context, c *dockerutil.Container) *CPUSampler {
+	samples, cancel := c.SampleStats(ctx, cpuSampleInterval)
+	s := &CPUSampler{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		for stats := range samples {
+			s.samples = append(s.samples, stats)
+		}
+	}()
+	return s
+}
+
+// Stop stops sampling, and returns the average and peak number of cores used
+// by the container while it was sampled. It fails if the sampling was too
+// short to get two samples.
+func (s *CPUSampler) Stop() (avg, peak float64, err error) {
+	s.cancel()
+	<-s.done
+	return cpuCores(s.samples)
+}
+
+// cpuCores returns the average and peak number of cores used between
+// consecutive samples.
+func cpuCores(samples []types.StatsJSON) (avg, peak float64, err error) {
+	if len(samples) < 2 {
+		return 0, 0, fmt.Errorf("got %d samples, need at least 2", len(samples))
+	}
+	for i := 1; i < len(samples); i++ {
+		if cores := coresBetween(samples[i-1], samples[i]); cores > peak {
+			peak = cores
+		}
+	}
+	return coresBetween(samples[0], samples[len(samples)-1]), peak, nil
+}
+
+// coresBetween returns the number of cores used between the samples from and
+// to.
+func coresBetween(from, to types.StatsJSON) float64 {
+	elapsed := to.Read.Sub(from.Read)
+	if elapsed <= 0 {
+		return 0
+	}
+	used := float64(to.CPUStats.CPUUsage.TotalUsage) - float64(from.CPUStats.CPUUsage.TotalUsage)
+	return used / float64(elapsed.Nanoseconds())
+}
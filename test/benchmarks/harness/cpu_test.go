@@ -0,0 +1,89 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// cpuSample returns a sample read at offset from start, having used usage
+// seconds of CPU time in total.
+func cpuSample(start time.Time, offset time.Duration, usage float64) types.StatsJSON {
+	var s types.StatsJSON
+	s.Read = start.Add(offset)
+	s.CPUStats.CPUUsage.TotalUsage = uint64(usage * float64(time.Second))
+	return s
+}
+
+func TestCPUCores(t *testing.T) {
+	start := time.Now()
+	for _, tc := range []struct {
+		name    string
+		samples []types.StatsJSON
+		avg     float64
+		peak    float64
+		wantErr bool
+	}{
+		{
+			name: "steady",
+			samples: []types.StatsJSON{
+				cpuSample(start, 0, 10),
+				cpuSample(start, time.Second, 12),
+				cpuSample(start, 2*time.Second, 14),
+			},
+			avg:  2,
+			peak: 2,
+		},
+		{
+			name: "burst",
+			samples: []types.StatsJSON{
+				cpuSample(start, 0, 0),
+				cpuSample(start, time.Second, 0.5),
+				cpuSample(start, 2*time.Second, 4.5),
+				cpuSample(start, 4*time.Second, 5),
+			},
+			avg:  1.25,
+			peak: 4,
+		},
+		{
+			name:    "single sample",
+			samples: []types.StatsJSON{cpuSample(start, 0, 1)},
+			wantErr: true,
+		},
+		{
+			name:    "no samples",
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			avg, peak, err := cpuCores(tc.samples)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("cpuCores got %f, %f, want error", avg, peak)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("cpuCores failed: %v", err)
+			}
+			if avg != tc.avg || peak != tc.peak {
+				t.Errorf("cpuCores got avg %f, peak %f, want avg %f, peak %f", avg, peak, tc.avg, tc.peak)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IntsFlag is a flag.Value for a comma-separated list of distinct positive
+// integers, e.g. "1,5,10". It holds its default until the flag is set.
+type IntsFlag []int
+
+// String implements flag.Value.String.
+func (f *IntsFlag) String() string {
+	var vals []string
+	for _, v := range *f {
+		vals = append(vals, strconv.Itoa(v))
+	}
+	return strings.Join(vals, ",")
+}
+
+// Set implements flag.Value.Set.
+func (f *IntsFlag) Set(s string) error {
+	elems, err := splitList(s)
+	if err != nil {
+		return err
+	}
+	var vals []int
+	for _, elem := range elems {
+		v, err := strconv.Atoi(elem)
+		if err != nil || v <= 0 {
+			return fmt.Errorf("%q is not a positive integer", elem)
+		}
+		vals = append(vals, v)
+	}
+	*f = vals
+	return nil
+}
+
+// StringsFlag is a flag.Value for a comma-separated list of distinct names,
+// e.g. "10Kb,1Mb", among Allowed if it is not empty. Values holds its
+// default until the flag is set.
+type StringsFlag struct {
+	Values  []string
+	Allowed []string
+}
+
+// String implements flag.Value.String.
+func (f *StringsFlag) String() string {
+	return strings.Join(f.Values, ",")
+}
+
+// Set implements flag.Value.Set.
+func (f *StringsFlag) Set(s string) error {
+	vals, err := splitList(s)
+	if err != nil {
+		return err
+	}
+	for _, v := range vals {
+		if len(f.Allowed) > 0 && !contains(f.Allowed, v) {
+			return fmt.Errorf("unknown value %q, want one of %s", v, strings.Join(f.Allowed, ","))
+		}
+	}
+	f.Values = vals
+	return nil
+}
+
+// LabelsFlag is a flag.Value for a comma-separated list of key=value pairs
+// with distinct keys, e.g. "branch=main,host=bench-1".
+type LabelsFlag map[string]string
+
+// String implements flag.Value.String. Pairs are sorted by key.
+func (f *LabelsFlag) String() string {
+	var pairs []string
+	for k, v := range *f {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set implements flag.Value.Set.
+func (f *LabelsFlag) Set(s string) error {
+	elems, err := splitList(s)
+	if err != nil {
+		return err
+	}
+	labels := make(LabelsFlag)
+	for _, elem := range elems {
+		kv := strings.SplitN(elem, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("%q is not a key=value pair", elem)
+		}
+		if _, ok := labels[kv[0]]; ok {
+			return fmt.Errorf("duplicate key %q in %q", kv[0], s)
+		}
+		labels[kv[0]] = kv[1]
+	}
+	*f = labels
+	return nil
+}
+
+// splitList splits the comma-separated list s, trimming spaces around its
+// elements. It fails if the list is empty, or if any element is empty or
+// repeated.
+func splitList(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("empty list")
+	}
+	var elems []string
+	seen := make(map[string]bool)
+	for _, elem := range strings.Split(s, ",") {
+		elem = strings.TrimSpace(elem)
+		if elem == "" {
+			return nil, fmt.Errorf("empty value in %q", s)
+		}
+		if seen[elem] {
+			return nil, fmt.Errorf("duplicate value %q in %q", elem, s)
+		}
+		seen[elem] = true
+		elems = append(elems, elem)
+	}
+	return elems, nil
+}
+
+// contains returns whether vals contains v.
+func contains(vals []string, v string) bool {
+	for _, val := range vals {
+		if val == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"flag"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestIntsFlag(t *testing.T) {
+	for _, tc := range []struct {
+		value   string
+		want    IntsFlag
+		wantErr bool
+	}{
+		{value: "1,5,10,25", want: IntsFlag{1, 5, 10, 25}},
+		{value: " 100 , 3", want: IntsFlag{100, 3}},
+		{value: "7", want: IntsFlag{7}},
+		{value: "", wantErr: true},
+		{value: "1,,2", wantErr: true},
+		{value: "1,2,1", wantErr: true},
+		{value: "0", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "ten", wantErr: true},
+		{value: "1.5", wantErr: true},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			f := IntsFlag{1, 2}
+			err := f.Set(tc.value)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Set(%q) got %v, want error", tc.value, f)
+				}
+				if !reflect.DeepEqual(f, IntsFlag{1, 2}) {
+					t.Errorf("failed Set(%q) changed the value to %v", tc.value, f)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Set(%q) failed: %v", tc.value, err)
+			}
+			if !reflect.DeepEqual(f, tc.want) {
+				t.Errorf("Set(%q) got %v, want %v", tc.value, f, tc.want)
+			}
+		})
+	}
+}
+
+func TestStringsFlag(t *testing.T) {
+	allowed := []string{"1Kb", "10Kb", "1Mb"}
+	for _, tc := range []struct {
+		value   string
+		allowed []string
+		want    []string
+		wantErr bool
+	}{
+		{value: "1Mb,1Kb", allowed: allowed, want: []string{"1Mb", "1Kb"}},
+		{value: "anything, else", want: []string{"anything", "else"}},
+		{value: "2Kb", allowed: allowed, wantErr: true},
+		{value: "1Kb,1Kb", allowed: allowed, wantErr: true},
+		{value: "1Kb,", allowed: allowed, wantErr: true},
+		{value: " ", wantErr: true},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			f := StringsFlag{Values: []string{"10Kb"}, Allowed: tc.allowed}
+			err := f.Set(tc.value)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Set(%q) got %v, want error", tc.value, f.Values)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Set(%q) failed: %v", tc.value, err)
+			}
+			if !reflect.DeepEqual(f.Values, tc.want) {
+				t.Errorf("Set(%q) got %v, want %v", tc.value, f.Values, tc.want)
+			}
+		})
+	}
+}
+
+func TestLabelsFlag(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want LabelsFlag
+	}{
+		{in: "a=1", want: LabelsFlag{"a": "1"}},
+		{in: " branch=main , host=bench-1", want: LabelsFlag{"branch": "main", "host": "bench-1"}},
+		{in: "empty=", want: LabelsFlag{"empty": ""}},
+		{in: "expr=a=b", want: LabelsFlag{"expr": "a=b"}},
+	} {
+		var f LabelsFlag
+		if err := f.Set(tc.in); err != nil {
+			t.Errorf("Set(%q) failed: %v", tc.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(f, tc.want) {
+			t.Errorf("Set(%q) got %v, want %v", tc.in, f, tc.want)
+		}
+	}
+
+	for _, in := range []string{"", "a", "=1", "a=1,", "a=1,a=2"} {
+		f := LabelsFlag{"kept": "yes"}
+		if err := f.Set(in); err == nil {
+			t.Errorf("Set(%q) succeeded with %v, want error", in, f)
+		} else if !reflect.DeepEqual(f, LabelsFlag{"kept": "yes"}) {
+			t.Errorf("Set(%q) changed the flag to %v on error", in, f)
+		}
+	}
+
+	f := LabelsFlag{"b": "2", "a": "1"}
+	if got, want := f.String(), "a=1,b=2"; got != want {
+		t.Errorf("String got %q, want %q", got, want)
+	}
+}
+
+func TestListFlagsParse(t *testing.T) {
+	// The defaults are kept, and printed, unless the flags are set.
+	threads := IntsFlag{1, 5}
+	docs := StringsFlag{Values: []string{"1Kb"}, Allowed: []string{"1Kb", "1Mb"}}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.Var(&threads, "threads", "")
+	fs.Var(&docs, "docs", "")
+	if got, want := fs.Lookup("threads").DefValue, "1,5"; got != want {
+		t.Errorf("got default %q, want %q", got, want)
+	}
+	if err := fs.Parse([]string{"--docs=1Mb"}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if !reflect.DeepEqual(threads, IntsFlag{1, 5}) || !reflect.DeepEqual(docs.Values, []string{"1Mb"}) {
+		t.Errorf("got threads %v and docs %v, want [1 5] and [1Mb]", threads, docs.Values)
+	}
+
+	if err := fs.Parse([]string{"--threads=1,x"}); err == nil {
+		t.Errorf("Parse succeeded with a malformed list, want error")
+	}
+}
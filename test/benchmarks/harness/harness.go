@@ -0,0 +1,185 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package harness holds utility code for running benchmarks on Docker.
+package harness
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+var (
+	help          = flag.Bool("help", false, "print this usage message")
+	serverRuntime = flag.String("server-runtime", "", "runtime of the containers running benchmark servers, i.e. the one being measured; defaults to --runtime")
+	clientRuntime = flag.String("client-runtime", "runc", "runtime of the containers running benchmark clients, e.g. load generators; the default keeps client overhead out of the measurement")
+	imagePrefix   = flag.String("image-prefix", "", "prefix of benchmark image names, e.g. to pull them from a private registry; defaults to "+testutil.ImagePrefix())
+	warmup        = flag.Bool("benchmark-warmup", true, "warm up servers with a few unmeasured requests before each measured run")
+	serverStats   = flag.Bool("collect-server-stats", false, "sample the CPU usage of benchmark servers while they are loaded, and report it")
+)
+
+// Harness is a handle for managing state in benchmark runs.
+type Harness struct {
+	// ctx is the context of the run, cancelled if it is interrupted.
+	ctx    context.Context
+	cancel func()
+
+	// tracker tracks the cleanups to run if the run is interrupted.
+	tracker tracker
+
+	// version is the version of the server runtime, if known.
+	version runtimeVersion
+}
+
+// Init performs any harness initilialization before runs.
+func (h *Harness) Init() error {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s -- --test.bench=<regex>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+	if *help {
+		flag.Usage()
+		os.Exit(0)
+	}
+	h.initContext()
+	if *imagePrefix != "" {
+		testutil.SetImagePrefix(*imagePrefix)
+	}
+	if err := checkProfileFlags(); err != nil {
+		return err
+	}
+	if *benchmarkOutput != "" {
+		w, err := openResults(*benchmarkOutput)
+		if err != nil {
+			return fmt.Errorf("failed to open --benchmark-output: %v", err)
+		}
+		results = w
+	}
+
+	// Benchmarks are not run when listing their requirements, so docker
+	// need not be available.
+	if *listRequirements {
+		return nil
+	}
+
+	dockerutil.EnsureSupportedDockerVersion()
+	h.handleSignals()
+	if err := pruneContainers(h.ctx, ""); err != nil {
+		return fmt.Errorf("failed to remove containers of previous runs: %v", err)
+	}
+
+	// Results are still worth having without the version, e.g. of a
+	// runtime without --version.
+	v, err := getRuntimeVersion(serverCommandMachine(), h.ServerRuntime())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get the version of runtime %s: %v\n", h.ServerRuntime(), err)
+	}
+	h.version = v
+	return nil
+}
+
+// initContext initializes the context of the run.
+func (h *Harness) initContext() {
+	if h.ctx == nil {
+		h.ctx, h.cancel = context.WithCancel(context.Background())
+	}
+}
+
+// Context returns the context of the run, which is cancelled on SIGINT or
+// SIGTERM. The containers from GetMachine are then cleaned up, along with
+// anything registered with AddCleanup, and the run exits.
+func (h *Harness) Context() context.Context {
+	if h.ctx == nil {
+		return context.Background()
+	}
+	return h.ctx
+}
+
+// ServerRuntime returns the runtime of containers running benchmark servers,
+// set with --server-runtime.
+func (h *Harness) ServerRuntime() string {
+	if *serverRuntime == "" {
+		return dockerutil.Runtime()
+	}
+	return *serverRuntime
+}
+
+// ClientRuntime returns the runtime of containers running benchmark
+// clients, set with --client-runtime.
+func (h *Harness) ClientRuntime() string {
+	return *clientRuntime
+}
+
+// ImagePrefix returns the prefix of benchmark image names, set with
+// --image-prefix.
+func (h *Harness) ImagePrefix() string {
+	return testutil.ImagePrefix()
+}
+
+// Warmup returns whether benchmarks should warm up servers before measuring
+// them, set with --benchmark-warmup.
+func (h *Harness) Warmup() bool {
+	return *warmup
+}
+
+// CollectServerStats returns whether benchmarks should sample the resource
+// usage of servers while measuring them, set with --collect-server-stats.
+func (h *Harness) CollectServerStats() bool {
+	return *serverStats
+}
+
+// GetMachine returns the machine to run a benchmark's server on, and
+// benchmarks that need a single machine: the --server-host machine, or the
+// local machine if it is not set. Benchmarks with clients get the machine to
+// run them on with GetClientMachine.
+//
+// The resources that a benchmark needs from the machine are declared with
+// Requires.
+func (h *Harness) GetMachine() (Machine, error) {
+	m, err := h.newMachine(*serverHost)
+	if err != nil {
+		return nil, err
+	}
+	if results != nil && *serverHost != "" {
+		results.describeServer(m)
+	}
+	return m, nil
+}
+
+// GetClientMachine is like GetMachine, but returns the machine to run a
+// benchmark's clients on: the --client-host machine, or the local machine if
+// it is not set.
+func (h *Harness) GetClientMachine() (Machine, error) {
+	return h.newMachine(*clientHost)
+}
+
+// newMachine returns the machine host, reached over SSH, or the local
+// machine if host is empty.
+func (h *Harness) newMachine(host string) (Machine, error) {
+	if host == "" {
+		return &localMachine{
+			serverRuntime: h.ServerRuntime(),
+			clientRuntime: h.ClientRuntime(),
+			tracker:       &h.tracker,
+		}, nil
+	}
+	return newRemoteMachine(host, h.ServerRuntime(), h.ClientRuntime(), &h.tracker)
+}
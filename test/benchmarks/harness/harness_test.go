@@ -0,0 +1,89 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"context"
+	"flag"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+// setFlag sets the flag name to value for the duration of the test.
+func setFlag(t *testing.T, name, value string) {
+	t.Helper()
+	old := flag.Lookup(name).Value.String()
+	if err := flag.Set(name, value); err != nil {
+		t.Fatalf("flag.Set(%q, %q) failed: %v", name, value, err)
+	}
+	t.Cleanup(func() { flag.Set(name, old) })
+}
+
+func TestInitFlags(t *testing.T) {
+	// Skip the docker version check, which needs a daemon.
+	setFlag(t, "list-requirements", "true")
+	setFlag(t, "client-host", "")
+	setFlag(t, "server-host", "")
+
+	var h Harness
+	if err := h.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if got, want := h.ServerRuntime(), dockerutil.Runtime(); got != want {
+		t.Errorf("got default server runtime %q, want %q", got, want)
+	}
+	if got, want := h.ClientRuntime(), "runc"; got != want {
+		t.Errorf("got default client runtime %q, want %q", got, want)
+	}
+	if got, want := h.ImagePrefix(), "gvisor.dev/images"; got != want {
+		t.Errorf("got default image prefix %q, want %q", got, want)
+	}
+	if !h.Warmup() {
+		t.Errorf("warm-up is disabled by default, want enabled")
+	}
+
+	setFlag(t, "server-runtime", "server")
+	setFlag(t, "client-runtime", "client")
+	setFlag(t, "image-prefix", "registry.example.com/images")
+	setFlag(t, "benchmark-warmup", "false")
+	defer testutil.SetImagePrefix(testutil.ImagePrefix())
+	if err := h.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if got, want := h.ImagePrefix(), "registry.example.com/images"; got != want {
+		t.Errorf("got image prefix %q, want %q", got, want)
+	}
+	if h.Warmup() {
+		t.Errorf("warm-up is enabled, want disabled")
+	}
+	if got, want := testutil.ImageByName("benchmarks/httpd"), "registry.example.com/images/benchmarks/httpd"; got != want {
+		t.Errorf("got image %q, want %q", got, want)
+	}
+
+	m, err := h.GetMachine()
+	if err != nil {
+		t.Fatalf("GetMachine failed: %v", err)
+	}
+	defer m.CleanUp()
+	ctx := context.Background()
+	if got, want := m.GetContainer(ctx, t).Runtime, "server"; got != want {
+		t.Errorf("got server container runtime %q, want %q", got, want)
+	}
+	if got, want := m.GetClientContainer(ctx, t).Runtime, "client"; got != want {
+		t.Errorf("got client container runtime %q, want %q", got, want)
+	}
+}
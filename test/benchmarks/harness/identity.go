@@ -0,0 +1,247 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+// Hostname implements Machine.Hostname for localMachine.
+func (l *localMachine) Hostname() (string, error) {
+	return os.Hostname()
+}
+
+// CPUInfo implements Machine.CPUInfo for localMachine.
+func (l *localMachine) CPUInfo() (string, int, error) {
+	data, err := ioutil.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return "", 0, err
+	}
+	model, cores := parseCPUInfo(string(data))
+	return model, cores, nil
+}
+
+// KernelVersion implements Machine.KernelVersion for localMachine.
+func (l *localMachine) KernelVersion() (string, error) {
+	var u unix.Utsname
+	if err := unix.Uname(&u); err != nil {
+		return "", fmt.Errorf("uname failed: %v", err)
+	}
+	return strings.TrimRight(string(u.Release[:]), "\x00"), nil
+}
+
+// MemoryBytes implements Machine.MemoryBytes for localMachine.
+func (l *localMachine) MemoryBytes() (uint64, error) {
+	info, err := localMachineInfo()
+	if err != nil {
+		return 0, err
+	}
+	return info.MemoryBytes, nil
+}
+
+// machineIdentity is what Machine.Hostname, CPUInfo, KernelVersion and
+// MemoryBytes return for a remote machine, fetched at once.
+type machineIdentity struct {
+	hostname string
+	cpuModel string
+	cores    int
+	kernel   string
+	memory   uint64
+}
+
+// identitySeparator separates the sections of the output of identityScript.
+const identitySeparator = "----"
+
+// identityScript prints the host name, kernel version, meminfo and cpuinfo of
+// the host of a container running under runc. The host name is that of the
+// host's /etc/hostname, mounted at /etc/host-hostname.
+const identityScript = "cat /etc/host-hostname && echo " + identitySeparator +
+	" && uname -r && echo " + identitySeparator +
+	" && cat /proc/meminfo && echo " + identitySeparator +
+	" && cat /proc/cpuinfo"
+
+// Hostname implements Machine.Hostname for remoteMachine.
+func (m *remoteMachine) Hostname() (string, error) {
+	id, err := m.identity()
+	return id.hostname, err
+}
+
+// CPUInfo implements Machine.CPUInfo for remoteMachine.
+func (m *remoteMachine) CPUInfo() (string, int, error) {
+	id, err := m.identity()
+	return id.cpuModel, id.cores, err
+}
+
+// KernelVersion implements Machine.KernelVersion for remoteMachine.
+func (m *remoteMachine) KernelVersion() (string, error) {
+	id, err := m.identity()
+	return id.kernel, err
+}
+
+// MemoryBytes implements Machine.MemoryBytes for remoteMachine.
+func (m *remoteMachine) MemoryBytes() (uint64, error) {
+	id, err := m.identity()
+	return id.memory, err
+}
+
+// identity returns the identity of the machine, fetched by the first call
+// with a one-shot container. The container runs under runc, whatever the
+// runtimes of the run, so that it sees the host's /proc rather than a
+// sandbox's.
+func (m *remoteMachine) identity() (machineIdentity, error) {
+	m.identityOnce.Do(func() {
+		ctx := context.Background()
+		c := m.tracker.track(dockerutil.MakeContainerOnHost(ctx, testutil.DefaultLogger("identity"), "unix://"+m.socket(), "runc"))
+		if c == nil {
+			m.identityErr = fmt.Errorf("failed to connect to the docker daemon of %s", m.host)
+			return
+		}
+		defer c.CleanUp(ctx)
+		out, err := c.Run(ctx, dockerutil.RunOpts{
+			Image: "basic/alpine",
+			Mounts: []mount.Mount{
+				{
+					Type:     mount.TypeBind,
+					Source:   "/etc/hostname",
+					Target:   "/etc/host-hostname",
+					ReadOnly: true,
+				},
+			},
+		}, "sh", "-c", identityScript)
+		if err != nil {
+			m.identityErr = fmt.Errorf("failed to identify %s: %v: %s", m.host, err, out)
+			return
+		}
+		m.identityValue, m.identityErr = parseIdentity(out)
+	})
+	return m.identityValue, m.identityErr
+}
+
+// parseIdentity parses the output of identityScript.
+func parseIdentity(out string) (machineIdentity, error) {
+	sections := strings.Split(out, "\n"+identitySeparator+"\n")
+	if len(sections) != 4 {
+		return machineIdentity{}, fmt.Errorf("got %d sections, want 4: %q", len(sections), out)
+	}
+	memory, err := parseMeminfo(strings.NewReader(sections[2]), "MemTotal")
+	if err != nil {
+		return machineIdentity{}, err
+	}
+	model, cores := parseCPUInfo(sections[3])
+	if cores == 0 {
+		return machineIdentity{}, fmt.Errorf("no CPUs found in cpuinfo %q", sections[3])
+	}
+	return machineIdentity{
+		hostname: strings.TrimSpace(sections[0]),
+		cpuModel: model,
+		cores:    cores,
+		kernel:   strings.TrimSpace(sections[1]),
+		memory:   uint64(memory),
+	}, nil
+}
+
+// parseCPUInfo returns the model of the first CPU in /proc/cpuinfo and the
+// number of logical CPUs it lists. Arm64 kernels don't print a model name,
+// so it is made up of the implementer and part numbers instead.
+func parseCPUInfo(cpuinfo string) (model string, cores int) {
+	var implementer, part string
+	for _, line := range strings.Split(cpuinfo, "\n") {
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(fields[1])
+		switch strings.TrimSpace(fields[0]) {
+		case "processor":
+			cores++
+		case "CPU implementer":
+			if implementer == "" {
+				implementer = value
+			}
+		case "CPU part":
+			if part == "" {
+				part = value
+			}
+		}
+	}
+	if model = parseCPUModel(cpuinfo); model == "" && implementer != "" {
+		model = armCPUModel(implementer, part)
+	}
+	return model, cores
+}
+
+// parseCPUModel returns the model of the first CPU in /proc/cpuinfo.
+func parseCPUModel(cpuinfo string) string {
+	for _, line := range strings.Split(cpuinfo, "\n") {
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) == 2 && strings.TrimSpace(fields[0]) == "model name" {
+			return strings.TrimSpace(fields[1])
+		}
+	}
+	return ""
+}
+
+// armImplementers are the names of Arm CPU implementers, by the value of
+// "CPU implementer" in /proc/cpuinfo.
+var armImplementers = map[uint64]string{
+	0x41: "ARM",
+	0x42: "Broadcom",
+	0x43: "Cavium",
+	0x48: "HiSilicon",
+	0x50: "APM",
+	0x51: "Qualcomm",
+	0x61: "Apple",
+	0xc0: "Ampere",
+}
+
+// armParts are the names of the CPUs designed by ARM, by the value of "CPU
+// part" in /proc/cpuinfo.
+var armParts = map[uint64]string{
+	0xd03: "Cortex-A53",
+	0xd07: "Cortex-A57",
+	0xd08: "Cortex-A72",
+	0xd0b: "Cortex-A76",
+	0xd0c: "Neoverse-N1",
+	0xd40: "Neoverse-V1",
+	0xd49: "Neoverse-N2",
+	0xd4f: "Neoverse-V2",
+}
+
+// armCPUModel returns the model of an Arm CPU, given its implementer and
+// part numbers as printed in /proc/cpuinfo, e.g. "ARM Neoverse-N1". Unknown
+// numbers are kept as they are.
+func armCPUModel(implementer, part string) string {
+	impl, err := strconv.ParseUint(implementer, 0, 64)
+	name, ok := armImplementers[impl]
+	if err != nil || !ok {
+		return fmt.Sprintf("implementer %s part %s", implementer, part)
+	}
+	if p, err := strconv.ParseUint(part, 0, 64); err == nil && impl == 0x41 {
+		if partName, ok := armParts[p]; ok {
+			return name + " " + partName
+		}
+	}
+	return fmt.Sprintf("%s part %s", name, part)
+}
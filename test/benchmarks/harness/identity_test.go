@@ -0,0 +1,116 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCPUInfo(t *testing.T) {
+	for _, tc := range []struct {
+		fixture string
+		model   string
+		cores   int
+	}{
+		{fixture: "cpuinfo_amd64", model: "Intel(R) Xeon(R) CPU @ 2.00GHz", cores: 4},
+		{fixture: "cpuinfo_arm64", model: "ARM Neoverse-N1", cores: 8},
+	} {
+		t.Run(tc.fixture, func(t *testing.T) {
+			data, err := ioutil.ReadFile(filepath.Join("testdata", tc.fixture))
+			if err != nil {
+				t.Fatalf("ioutil.ReadFile failed: %v", err)
+			}
+			model, cores := parseCPUInfo(string(data))
+			if model != tc.model || cores != tc.cores {
+				t.Errorf("parseCPUInfo got %q, %d, want %q, %d", model, cores, tc.model, tc.cores)
+			}
+		})
+	}
+
+	if model, cores := parseCPUInfo(""); model != "" || cores != 0 {
+		t.Errorf("parseCPUInfo got %q, %d for empty cpuinfo, want nothing", model, cores)
+	}
+}
+
+func TestArmCPUModel(t *testing.T) {
+	for _, tc := range []struct {
+		implementer, part string
+		want              string
+	}{
+		{implementer: "0x41", part: "0xd0c", want: "ARM Neoverse-N1"},
+		{implementer: "0x41", part: "0xfff", want: "ARM part 0xfff"},
+		{implementer: "0xc0", part: "0xac3", want: "Ampere part 0xac3"},
+		{implementer: "0x99", part: "0x001", want: "implementer 0x99 part 0x001"},
+		{implementer: "bogus", part: "0x001", want: "implementer bogus part 0x001"},
+	} {
+		if got := armCPUModel(tc.implementer, tc.part); got != tc.want {
+			t.Errorf("armCPUModel(%q, %q) got %q, want %q", tc.implementer, tc.part, got, tc.want)
+		}
+	}
+}
+
+func TestParseIdentity(t *testing.T) {
+	cpuinfo, err := ioutil.ReadFile(filepath.Join("testdata", "cpuinfo_arm64"))
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile failed: %v", err)
+	}
+	sections := []string{
+		"bench-1",
+		"5.4.0-1029-gcp",
+		"MemTotal:       16384 kB\nMemFree:         1024 kB",
+		string(cpuinfo),
+	}
+	out := strings.Join(sections, "\n"+identitySeparator+"\n")
+	got, err := parseIdentity(out)
+	if err != nil {
+		t.Fatalf("parseIdentity failed: %v", err)
+	}
+	want := machineIdentity{
+		hostname: "bench-1",
+		cpuModel: "ARM Neoverse-N1",
+		cores:    8,
+		kernel:   "5.4.0-1029-gcp",
+		memory:   16384 << 10,
+	}
+	if got != want {
+		t.Errorf("parseIdentity got %+v, want %+v", got, want)
+	}
+
+	for _, bad := range []string{
+		"",
+		strings.Join(sections[:3], "\n"+identitySeparator+"\n"),
+		strings.Join([]string{sections[0], sections[1], "MemFree: 1 kB", sections[3]}, "\n"+identitySeparator+"\n"),
+		strings.Join([]string{sections[0], sections[1], sections[2], "garbage"}, "\n"+identitySeparator+"\n"),
+	} {
+		if got, err := parseIdentity(bad); err == nil {
+			t.Errorf("parseIdentity(%q) got %+v, want error", bad, got)
+		}
+	}
+}
+
+func TestDescribeLocalMachine(t *testing.T) {
+	info := describeMachine(&localMachine{})
+	if info.Hostname == "" || info.Kernel == "" || info.CPUs == 0 || info.MemoryBytes == 0 {
+		t.Errorf("describeMachine got %+v, want all of hostname, kernel, CPUs and memory", info)
+	}
+	if want, err := localMachineInfo(); err != nil {
+		t.Errorf("localMachineInfo failed: %v", err)
+	} else if info.MemoryBytes != want.MemoryBytes {
+		t.Errorf("got %d bytes of memory, want %d", info.MemoryBytes, want.MemoryBytes)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+// Machine describes a real machine for use in benchmarks.
+type Machine interface {
+	// GetContainer gets a container from the machine to run a benchmark
+	// server in. It runs under Harness.ServerRuntime.
+	GetContainer(ctx context.Context, logger testutil.Logger) *dockerutil.Container
+
+	// GetClientContainer gets a container from the machine to run a
+	// benchmark client in. It runs under Harness.ClientRuntime.
+	GetClientContainer(ctx context.Context, logger testutil.Logger) *dockerutil.Container
+
+	// RunCommand runs cmd on this machine.
+	RunCommand(cmd string, args ...string) (string, error)
+
+	// IPAddress returns the IP address of the machine.
+	IPAddress() (net.IP, error)
+
+	// PublishedAddr returns the address at which port of container c,
+	// which runs on this machine, is reachable from the other machines. The
+	// port must be published, e.g. with RunOpts.Ports. For remote machines,
+	// that is the machine's IP and the published host port; for the local
+	// machine, the container's own IP and port.
+	PublishedAddr(ctx context.Context, c *dockerutil.Container, port int) (net.IP, int, error)
+
+	// UtilityContainer returns a long-lived container on the machine, for
+	// helpers such as WaitUntilServing to exec tools in. It is created on
+	// first use, under Harness.ClientRuntime, and cleaned up by CleanUp.
+	UtilityContainer(ctx context.Context) (*dockerutil.Container, error)
+
+	// Info describes the resources of the machine.
+	Info() (MachineInfo, error)
+
+	// Hostname returns the host name of the machine.
+	Hostname() (string, error)
+
+	// CPUInfo returns the model of the machine's CPUs and the number of
+	// logical CPUs it has.
+	CPUInfo() (model string, cores int, err error)
+
+	// KernelVersion returns the release of the machine's kernel, as for
+	// 'uname -r'.
+	KernelVersion() (string, error)
+
+	// MemoryBytes returns the total amount of memory of the machine.
+	MemoryBytes() (uint64, error)
+
+	// CleanUp cleans up this machine.
+	CleanUp()
+}
+
+// MachineInfo describes the resources of a machine.
+type MachineInfo struct {
+	// CPUs is the number of CPUs.
+	CPUs int
+
+	// MemoryBytes is the total amount of memory.
+	MemoryBytes uint64
+
+	// Root is set if benchmarks run as root.
+	Root bool
+
+	// Arch is the architecture, as in runtime.GOARCH.
+	Arch string
+}
+
+// IsLocal returns whether m is the machine running the benchmarks, whose
+// docker daemon runs on the same host, as MeasureSandboxMemory requires.
+func IsLocal(m Machine) bool {
+	_, ok := m.(*localMachine)
+	return ok
+}
+
+// localMachine describes this machine.
+type localMachine struct {
+	// serverRuntime and clientRuntime are the runtimes of containers
+	// returned by GetContainer and GetClientContainer.
+	serverRuntime string
+	clientRuntime string
+
+	// utility is the machine's utility container.
+	utility utility
+
+	// tracker tracks the containers of the machine, if set.
+	tracker *tracker
+}
+
+// GetContainer implements Machine.GetContainer for localMachine.
+func (l *localMachine) GetContainer(ctx context.Context, logger testutil.Logger) *dockerutil.Container {
+	return l.tracker.track(dockerutil.MakeContainerWithRuntime(ctx, logger, l.serverRuntime))
+}
+
+// GetClientContainer implements Machine.GetClientContainer for localMachine.
+func (l *localMachine) GetClientContainer(ctx context.Context, logger testutil.Logger) *dockerutil.Container {
+	return l.tracker.track(dockerutil.MakeContainerWithRuntime(ctx, logger, l.clientRuntime))
+}
+
+// RunCommand implements Machine.RunCommand for localMachine.
+func (l *localMachine) RunCommand(cmd string, args ...string) (string, error) {
+	c := exec.Command(cmd, args...)
+	out, err := c.CombinedOutput()
+	return string(out), err
+}
+
+// IPAddress implements Machine.IPAddress.
+func (l *localMachine) IPAddress() (net.IP, error) {
+	conn, err := net.Dial("udp", "8.8.8.8:80")
+	if err != nil {
+		// This case should only happen if the local machine has no network.
+		return net.IP{}, err
+	}
+	defer conn.Close()
+
+	addr := conn.LocalAddr().(*net.UDPAddr)
+	return addr.IP, nil
+}
+
+// PublishedAddr implements Machine.PublishedAddr for localMachine. All
+// machines are local, so the container's own address is reachable.
+func (l *localMachine) PublishedAddr(ctx context.Context, c *dockerutil.Container, port int) (net.IP, int, error) {
+	ip, err := c.FindIP(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return ip, port, nil
+}
+
+// UtilityContainer implements Machine.UtilityContainer for localMachine.
+func (l *localMachine) UtilityContainer(ctx context.Context) (*dockerutil.Container, error) {
+	return l.utility.get(ctx, func() *dockerutil.Container {
+		return l.GetClientContainer(ctx, testutil.DefaultLogger("utility"))
+	})
+}
+
+// Info implements Machine.Info for localMachine.
+func (l *localMachine) Info() (MachineInfo, error) {
+	return localMachineInfo()
+}
+
+// CleanUp implements Machine.CleanUp for localMachine. It cleans up the
+// utility container.
+func (l *localMachine) CleanUp() {
+	l.utility.cleanUp()
+}
+
+// localMachineInfo describes the resources of the host running the
+// benchmarks.
+func localMachineInfo() (MachineInfo, error) {
+	var si unix.Sysinfo_t
+	if err := unix.Sysinfo(&si); err != nil {
+		return MachineInfo{}, fmt.Errorf("sysinfo failed: %v", err)
+	}
+	return MachineInfo{
+		CPUs:        runtime.NumCPU(),
+		MemoryBytes: uint64(si.Totalram) * uint64(si.Unit),
+		Root:        os.Geteuid() == 0,
+		Arch:        runtime.GOARCH,
+	}, nil
+}
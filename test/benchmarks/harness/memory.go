@@ -0,0 +1,192 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+)
+
+// MeasureSandboxMemory returns the resident set size, in bytes, of the host
+// process running the container c: the runsc sandbox, which holds the
+// sentry and the memory of the application, or the container's init process
+// if it isn't sandboxed (e.g. under runc), so that the numbers remain
+// comparable. Gofers are not included.
+//
+// It must run on the host of the docker daemon.
+func MeasureSandboxMemory(ctx context.Context, c *dockerutil.Container) (int64, error) {
+	procs, err := c.SandboxProcesses(ctx)
+	if err != nil {
+		return 0, err
+	}
+	pid := procs.Sandbox
+	if pid == 0 {
+		pid = procs.Init
+	}
+
+	// smaps_rollup is only available from Linux 4.14. Summing smaps gives
+	// the same result, more slowly.
+	f, err := os.Open(fmt.Sprintf("/proc/%d/smaps_rollup", pid))
+	if os.IsNotExist(err) {
+		f, err = os.Open(fmt.Sprintf("/proc/%d/smaps", pid))
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return parseSmapsRSS(f)
+}
+
+// parseSmapsRSS returns the sum of the Rss fields, in bytes, of the smaps or
+// smaps_rollup file r.
+func parseSmapsRSS(r io.Reader) (int64, error) {
+	var rss int64
+	found := false
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 3 || fields[0] != "Rss:" {
+			continue
+		}
+		if fields[2] != "kB" {
+			return 0, fmt.Errorf("unexpected unit in line %q", s.Text())
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad line %q: %v", s.Text(), err)
+		}
+		rss += kb << 10
+		found = true
+	}
+	if err := s.Err(); err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("no Rss field found")
+	}
+	return rss, nil
+}
+
+// MeasureMemAvailable returns the memory available on the host, in bytes, as
+// estimated by the kernel for starting new applications without swapping.
+// Differences between measurements give the memory used in between,
+// including that of processes outside of containers, such as gofers.
+//
+// It must run on the host of the docker daemon.
+func MeasureMemAvailable() (int64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return parseMemAvailable(f)
+}
+
+// parseMemAvailable returns the MemAvailable field, in bytes, of the meminfo
+// file r.
+func parseMemAvailable(r io.Reader) (int64, error) {
+	return parseMeminfo(r, "MemAvailable")
+}
+
+// parseMeminfo returns the field, in bytes, of the meminfo file r.
+func parseMeminfo(r io.Reader, field string) (int64, error) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 3 || fields[0] != field+":" {
+			continue
+		}
+		if fields[2] != "kB" {
+			return 0, fmt.Errorf("unexpected unit in line %q", s.Text())
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad line %q: %v", s.Text(), err)
+		}
+		return kb << 10, nil
+	}
+	if err := s.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no %s field found", field)
+}
+
+// rssSampleInterval is the interval at which RSSSampler samples.
+const rssSampleInterval = 500 * time.Millisecond
+
+// RSSSampler samples the memory usage of a container, from SampleRSS until
+// Stop.
+type RSSSampler struct {
+	cancel func()
+
+	// done is closed once max and samples are final.
+	done    chan struct{}
+	max     int64
+	samples int
+}
+
+// SampleRSS starts sampling the resident memory of the container c, as
+// reported by the daemon's stats. Unlike MeasureSandboxMemory, it works on
+// remote machines, and tracks the peak over time.
+func SampleRSS(ctx context.Context, c *dockerutil.Container) *RSSSampler {
+	samples, cancel := c.SampleStats(ctx, rssSampleInterval)
+	s := &RSSSampler{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		for stats := range samples {
+			if rss := statsRSS(stats); rss > s.max {
+				s.max = rss
+			}
+			s.samples++
+		}
+	}()
+	return s
+}
+
+// Stop stops sampling, and returns the peak resident memory of the
+// container, in bytes, while it was sampled. It fails if no sample was taken.
+func (s *RSSSampler) Stop() (int64, error) {
+	s.cancel()
+	<-s.done
+	if s.samples == 0 {
+		return 0, fmt.Errorf("got no samples")
+	}
+	return s.max, nil
+}
+
+// statsRSS returns the resident memory, in bytes, of a stats sample: the
+// anonymous memory of the container's cgroup, or its total usage if the
+// cgroup doesn't break it down.
+func statsRSS(stats types.StatsJSON) int64 {
+	// cgroup v1 calls it rss, and cgroup v2 anon.
+	for _, key := range []string{"rss", "anon"} {
+		if rss, ok := stats.MemoryStats.Stats[key]; ok {
+			return int64(rss)
+		}
+	}
+	return int64(stats.MemoryStats.Usage)
+}
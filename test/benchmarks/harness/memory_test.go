@@ -0,0 +1,163 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+// smapsRollup is the smaps_rollup file of a sandbox.
+const smapsRollup = `00400000-7ffd3c7fd000 ---p 00000000 00:00 0                          [rollup]
+Rss:              155804 kB
+Pss:              150143 kB
+Pss_Anon:         118220 kB
+Pss_File:          31923 kB
+Pss_Shmem:             0 kB
+Shared_Clean:       5692 kB
+Shared_Dirty:          0 kB
+Private_Clean:     31892 kB
+Private_Dirty:    118220 kB
+Referenced:       155804 kB
+Anonymous:        118220 kB
+LazyFree:              0 kB
+AnonHugePages:     71680 kB
+ShmemPmdMapped:        0 kB
+Shared_Hugetlb:        0 kB
+Private_Hugetlb:       0 kB
+Swap:                  0 kB
+SwapPss:               0 kB
+Locked:                0 kB
+`
+
+// smaps is an smaps file with two mappings.
+const smaps = `00400000-00452000 r-xp 00000000 08:02 173521      /usr/bin/dbus-daemon
+Size:                328 kB
+Rss:                 300 kB
+Pss:                 300 kB
+Swap:                  0 kB
+7ffd3c5dc000-7ffd3c5fd000 rw-p 00000000 00:00 0                          [stack]
+Size:                132 kB
+Rss:                  12 kB
+Pss:                  12 kB
+Swap:                  0 kB
+`
+
+func TestParseSmapsRSS(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{
+			name:  "smaps_rollup",
+			input: smapsRollup,
+			want:  155804 << 10,
+		},
+		{
+			name:  "smaps",
+			input: smaps,
+			want:  312 << 10,
+		},
+		{
+			name:    "empty",
+			input:   "",
+			wantErr: true,
+		},
+		{
+			name:    "bad unit",
+			input:   "Rss:              155804 MB\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseSmapsRSS(strings.NewReader(tc.input))
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("parseSmapsRSS() got err %v, want error: %t", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("parseSmapsRSS() got %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+// meminfo is the start of a meminfo file.
+const meminfo = `MemTotal:       16318480 kB
+MemFree:         1184512 kB
+MemAvailable:    9437184 kB
+Buffers:          512340 kB
+Cached:          7532112 kB
+`
+
+func TestParseMemAvailable(t *testing.T) {
+	got, err := parseMemAvailable(strings.NewReader(meminfo))
+	if err != nil {
+		t.Fatalf("parseMemAvailable() failed: %v", err)
+	}
+	if want := int64(9437184) << 10; got != want {
+		t.Errorf("parseMemAvailable() got %d, want %d", got, want)
+	}
+
+	for _, data := range []string{
+		"",
+		"MemTotal:       16318480 kB\n",
+		"MemAvailable:    9437184 MB\n",
+		"MemAvailable:    lots kB\n",
+	} {
+		if got, err := parseMemAvailable(strings.NewReader(data)); err == nil {
+			t.Errorf("parseMemAvailable(%q) got %d, want error", data, got)
+		}
+	}
+}
+
+func TestStatsRSS(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		usage uint64
+		stats map[string]uint64
+		want  int64
+	}{
+		{
+			name:  "cgroup v1",
+			usage: 300 << 20,
+			stats: map[string]uint64{"cache": 100 << 20, "rss": 200 << 20},
+			want:  200 << 20,
+		},
+		{
+			name:  "cgroup v2",
+			usage: 300 << 20,
+			stats: map[string]uint64{"file": 100 << 20, "anon": 150 << 20},
+			want:  150 << 20,
+		},
+		{
+			name:  "usage only",
+			usage: 300 << 20,
+			want:  300 << 20,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var stats types.StatsJSON
+			stats.MemoryStats.Usage = tc.usage
+			stats.MemoryStats.Stats = tc.stats
+			if got := statsRSS(stats); got != tc.want {
+				t.Errorf("statsRSS got %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"flag"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+)
+
+var noCPUPinning = flag.Bool("no-cpu-pinning", false, "don't pin benchmark servers and clients running on the same machine to disjoint CPUs")
+
+// minPinnedCPUs is the number of CPUs from which servers and clients are
+// pinned. With fewer, halves are too small to run either well.
+const minPinnedCPUs = 4
+
+// cpuPeriod is the CFS period, in microseconds, that RunOpts.CPUQuota is
+// relative to.
+const cpuPeriod = 100000
+
+// CPUPartition splits the CPUs of a machine between a benchmark server and
+// its clients, so that they don't compete for cores. The zero value pins
+// nothing.
+type CPUPartition struct {
+	// Server and Client are the cpusets of the server and client
+	// containers, e.g. "0-3" and "4-7".
+	Server string
+	Client string
+
+	// ServerCPUs and ClientCPUs are the number of CPUs in Server and
+	// Client.
+	ServerCPUs int
+	ClientCPUs int
+}
+
+// CPUPartition returns the partition of CPUs between a server on
+// serverMachine and its clients on clientMachine. Nothing is pinned if they
+// run on different hosts, if the host has fewer than 4 CPUs, or with
+// --no-cpu-pinning.
+func (h *Harness) CPUPartition(clientMachine, serverMachine Machine) (CPUPartition, error) {
+	if *noCPUPinning || !sameHost(clientMachine, serverMachine) {
+		return CPUPartition{}, nil
+	}
+	info, err := serverMachine.Info()
+	if err != nil {
+		return CPUPartition{}, fmt.Errorf("failed to get machine info: %v", err)
+	}
+	return partitionCPUs(info.CPUs), nil
+}
+
+// partitionCPUs splits n CPUs, numbered from 0, in two. The server gets the
+// larger half if n is odd.
+func partitionCPUs(n int) CPUPartition {
+	if n < minPinnedCPUs {
+		return CPUPartition{}
+	}
+	client := n / 2
+	server := n - client
+	return CPUPartition{
+		Server:     cpuRange(0, server),
+		Client:     cpuRange(server, client),
+		ServerCPUs: server,
+		ClientCPUs: client,
+	}
+}
+
+// cpuRange returns the cpuset of the count CPUs from first.
+func cpuRange(first, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", first)
+	}
+	return fmt.Sprintf("%d-%d", first, first+count-1)
+}
+
+// Pinned returns whether p pins anything.
+func (p CPUPartition) Pinned() bool {
+	return p.Server != ""
+}
+
+// ApplyServer pins the server container run with opts to its CPUs.
+func (p CPUPartition) ApplyServer(opts *dockerutil.RunOpts) {
+	pin(opts, p.Server, p.ServerCPUs)
+}
+
+// ApplyClient pins the client container run with opts to its CPUs.
+func (p CPUPartition) ApplyClient(opts *dockerutil.RunOpts) {
+	pin(opts, p.Client, p.ClientCPUs)
+}
+
+// pin restricts opts to the cpus in cpuset. The quota caps the container
+// to its share even for stragglers the cpuset doesn't bind, e.g. processes
+// of the sandbox started before it is applied.
+func pin(opts *dockerutil.RunOpts, cpuset string, cpus int) {
+	if cpuset == "" {
+		return
+	}
+	opts.CpusetCpus = cpuset
+	opts.CPUQuota = int64(cpus) * cpuPeriod
+}
+
+// Report reports p to r, so that results can be segmented by it.
+func (p CPUPartition) Report(r *Reporter) {
+	var pinned float64
+	if p.Pinned() {
+		pinned = 1
+	}
+	r.ReportMetric(pinned, "cpu_pinned")
+	r.ReportMetric(float64(p.ServerCPUs), "server_cpus")
+	r.ReportMetric(float64(p.ClientCPUs), "client_cpus")
+}
+
+// sameHost returns whether a and b are the same host.
+func sameHost(a, b Machine) bool {
+	switch a := a.(type) {
+	case *localMachine:
+		_, ok := b.(*localMachine)
+		return ok
+	case *remoteMachine:
+		b, ok := b.(*remoteMachine)
+		return ok && a.host == b.host
+	}
+	return false
+}
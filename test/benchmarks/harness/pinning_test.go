@@ -0,0 +1,103 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+)
+
+func TestPartitionCPUs(t *testing.T) {
+	for _, tc := range []struct {
+		cpus int
+		want CPUPartition
+	}{
+		{cpus: 1},
+		{cpus: 3},
+		{
+			cpus: 4,
+			want: CPUPartition{Server: "0-1", Client: "2-3", ServerCPUs: 2, ClientCPUs: 2},
+		},
+		{
+			cpus: 5,
+			want: CPUPartition{Server: "0-2", Client: "3-4", ServerCPUs: 3, ClientCPUs: 2},
+		},
+		{
+			cpus: 8,
+			want: CPUPartition{Server: "0-3", Client: "4-7", ServerCPUs: 4, ClientCPUs: 4},
+		},
+	} {
+		if got := partitionCPUs(tc.cpus); got != tc.want {
+			t.Errorf("partitionCPUs(%d) got %+v, want %+v", tc.cpus, got, tc.want)
+		}
+	}
+}
+
+func TestCPUPartitionApply(t *testing.T) {
+	p := partitionCPUs(8)
+	var server, client dockerutil.RunOpts
+	p.ApplyServer(&server)
+	p.ApplyClient(&client)
+	if server.CpusetCpus != "0-3" || server.CPUQuota != 4*cpuPeriod {
+		t.Errorf("got server cpuset %q and quota %d, want \"0-3\" and %d", server.CpusetCpus, server.CPUQuota, 4*cpuPeriod)
+	}
+	if client.CpusetCpus != "4-7" || client.CPUQuota != 4*cpuPeriod {
+		t.Errorf("got client cpuset %q and quota %d, want \"4-7\" and %d", client.CpusetCpus, client.CPUQuota, 4*cpuPeriod)
+	}
+
+	var opts dockerutil.RunOpts
+	CPUPartition{}.ApplyServer(&opts)
+	if opts.CpusetCpus != "" || opts.CPUQuota != 0 {
+		t.Errorf("zero partition pinned server: cpuset %q, quota %d", opts.CpusetCpus, opts.CPUQuota)
+	}
+}
+
+func TestSameHost(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		a, b Machine
+		want bool
+	}{
+		{
+			name: "local",
+			a:    &localMachine{},
+			b:    &localMachine{},
+			want: true,
+		},
+		{
+			name: "same remote",
+			a:    &remoteMachine{host: "a"},
+			b:    &remoteMachine{host: "a"},
+			want: true,
+		},
+		{
+			name: "different remotes",
+			a:    &remoteMachine{host: "a"},
+			b:    &remoteMachine{host: "b"},
+		},
+		{
+			name: "local and remote",
+			a:    &localMachine{},
+			b:    &remoteMachine{host: "a"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := sameHost(tc.a, tc.b); got != tc.want {
+				t.Errorf("got %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
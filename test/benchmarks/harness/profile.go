@@ -0,0 +1,101 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+var (
+	pprofCPU   = flag.Bool("pprof-cpu", false, "collect a CPU profile of the sandboxes of benchmark servers while they are measured; requires --profile-dir")
+	pprofHeap  = flag.Bool("pprof-heap", false, "collect a heap profile of the sandboxes of benchmark servers once they are measured; requires --profile-dir")
+	pprofBlock = flag.Bool("pprof-block", false, "collect a block profile of the sandboxes of benchmark servers once they are measured; requires --profile-dir")
+	profileDir = flag.String("profile-dir", "", "directory to write profiles to, in a subdirectory named after each benchmark")
+)
+
+// profileMaxDuration bounds the CPU profile, which is otherwise stopped at the
+// end of the measurement.
+const profileMaxDuration = time.Hour
+
+// profiling returns whether any profile is requested.
+func profiling() bool {
+	return *pprofCPU || *pprofHeap || *pprofBlock
+}
+
+// checkProfileFlags checks that the profile flags are consistent.
+func checkProfileFlags() error {
+	if profiling() && *profileDir == "" {
+		return fmt.Errorf("--profile-dir is required to collect profiles")
+	}
+	return nil
+}
+
+// StartProfile starts collecting the profiles requested with --pprof-cpu,
+// --pprof-heap and --pprof-block of the sandbox of c, a server being
+// measured. The returned function must be called at the end of the
+// measurement: it stops the CPU profile and then takes the others. The
+// profiles are written to a directory named after the benchmark, logger, in
+// --profile-dir.
+//
+// Collection is skipped, logging why, if c is not sandboxed by runsc, or if
+// its sandbox can't be found, e.g. because its daemon is not local.
+func (h *Harness) StartProfile(ctx context.Context, logger testutil.Logger, c *dockerutil.Container) func() {
+	if !profiling() {
+		return func() {}
+	}
+	procs, err := c.SandboxProcesses(ctx)
+	if err != nil {
+		logger.Logf("not profiling %s: failed to find its sandbox: %v", c.Name, err)
+		return func() {}
+	}
+	if procs.Sandbox == 0 {
+		logger.Logf("not profiling %s: it is not sandboxed by runsc", c.Name)
+		return func() {}
+	}
+
+	dir := filepath.Join(*profileDir, strings.ReplaceAll(logger.Name(), "/", "_"))
+	var cpu *dockerutil.Profile
+	if *pprofCPU {
+		cpu = dockerutil.StartProfile(c, []string{"cpu"}, profileMaxDuration, dir)
+	}
+	return func() {
+		if cpu != nil {
+			if err := cpu.Stop(); err != nil {
+				logger.Logf("failed to collect CPU profile of %s: %v", c.Name, err)
+			}
+		}
+		var types []string
+		if *pprofHeap {
+			types = append(types, "heap")
+		}
+		if *pprofBlock {
+			types = append(types, "block")
+		}
+		if len(types) == 0 {
+			return
+		}
+		if err := dockerutil.StartProfile(c, types, 0, dir).Wait(); err != nil {
+			logger.Logf("failed to collect %s profiles of %s: %v", strings.Join(types, " and "), c.Name, err)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+var (
+	clientHost = flag.String("client-host", "", "host of the remote machine running the benchmark clients; the local machine is used if empty")
+	serverHost = flag.String("server-host", "", "host of the remote machine running the benchmark servers; the local machine is used if empty")
+	sshUser    = flag.String("ssh-user", "", "user to log into the remote machines as")
+	sshKey     = flag.String("ssh-key", "", "private key file to log into the remote machines with")
+)
+
+// remoteDockerSocket is the docker daemon's socket on remote machines.
+const remoteDockerSocket = "/var/run/docker.sock"
+
+// remoteMachine is a machine reached over SSH. Its docker daemon is reached
+// through a tunnel forwarding a local socket to the daemon's socket.
+type remoteMachine struct {
+	host string
+
+	// dir holds the local end of the tunnel.
+	dir string
+
+	// tunnel is the ssh process forwarding the socket.
+	tunnel *exec.Cmd
+
+	// serverRuntime and clientRuntime are the runtimes of containers
+	// returned by GetContainer and GetClientContainer.
+	serverRuntime string
+	clientRuntime string
+
+	// utility is the machine's utility container.
+	utility utility
+
+	// tracker tracks the containers of the machine, if set.
+	tracker *tracker
+
+	// identityOnce guards the fetching of identityValue and identityErr,
+	// the result of identity.
+	identityOnce  sync.Once
+	identityValue machineIdentity
+	identityErr   error
+}
+
+// newRemoteMachine opens a tunnel to the docker daemon on host, and removes
+// the containers left behind there by previous runs.
+func newRemoteMachine(host, serverRuntime, clientRuntime string, t *tracker) (*remoteMachine, error) {
+	dir, err := ioutil.TempDir("", "remote-machine")
+	if err != nil {
+		return nil, err
+	}
+	m := &remoteMachine{
+		host:          host,
+		dir:           dir,
+		serverRuntime: serverRuntime,
+		clientRuntime: clientRuntime,
+		tracker:       t,
+	}
+	args := append(m.sshArgs(), "-N", "-L", m.socket()+":"+remoteDockerSocket, m.target())
+	m.tunnel = exec.Command("ssh", args...)
+	if err := m.tunnel.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to open tunnel to %s: %v", host, err)
+	}
+	if err := testutil.Poll(func() error {
+		_, err := os.Stat(m.socket())
+		return err
+	}, 30*time.Second); err != nil {
+		m.CleanUp()
+		return nil, fmt.Errorf("tunnel to %s not ready: %v", host, err)
+	}
+	if err := pruneContainers(context.Background(), "unix://"+m.socket()); err != nil {
+		m.CleanUp()
+		return nil, fmt.Errorf("failed to remove containers of previous runs on %s: %v", host, err)
+	}
+	return m, nil
+}
+
+// socket returns the local end of the tunnel.
+func (m *remoteMachine) socket() string {
+	return filepath.Join(m.dir, "docker.sock")
+}
+
+// target returns the ssh destination of the machine.
+func (m *remoteMachine) target() string {
+	if *sshUser == "" {
+		return m.host
+	}
+	return *sshUser + "@" + m.host
+}
+
+// sshArgs returns the ssh options shared by all connections to the machine.
+func (m *remoteMachine) sshArgs() []string {
+	args := []string{"-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=no"}
+	if *sshKey != "" {
+		args = append(args, "-i", *sshKey)
+	}
+	return args
+}
+
+// GetContainer implements Machine.GetContainer for remoteMachine.
+func (m *remoteMachine) GetContainer(ctx context.Context, logger testutil.Logger) *dockerutil.Container {
+	return m.label(m.tracker.track(dockerutil.MakeContainerOnHost(ctx, logger, "unix://"+m.socket(), m.serverRuntime)))
+}
+
+// GetClientContainer implements Machine.GetClientContainer for remoteMachine.
+func (m *remoteMachine) GetClientContainer(ctx context.Context, logger testutil.Logger) *dockerutil.Container {
+	return m.label(m.tracker.track(dockerutil.MakeContainerOnHost(ctx, logger, "unix://"+m.socket(), m.clientRuntime)))
+}
+
+// label labels the new container c, if any, with the machine's host. It
+// returns c.
+func (m *remoteMachine) label(c *dockerutil.Container) *dockerutil.Container {
+	if c == nil {
+		return nil
+	}
+	if c.Labels == nil {
+		c.Labels = make(map[string]string)
+	}
+	c.Labels[remoteHostLabel] = m.host
+	return c
+}
+
+// RunCommand implements Machine.RunCommand for remoteMachine.
+func (m *remoteMachine) RunCommand(cmd string, args ...string) (string, error) {
+	// The command line is interpreted by the remote shell.
+	quoted := []string{shellQuote(cmd)}
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	sshArgs := append(m.sshArgs(), m.target(), strings.Join(quoted, " "))
+	out, err := exec.Command("ssh", sshArgs...).CombinedOutput()
+	return string(out), err
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// IPAddress implements Machine.IPAddress for remoteMachine.
+func (m *remoteMachine) IPAddress() (net.IP, error) {
+	ips, err := net.LookupIP(m.host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip, nil
+		}
+	}
+	return ips[0], nil
+}
+
+// PublishedAddr implements Machine.PublishedAddr for remoteMachine.
+// Containers are only reachable from other machines through their published
+// ports.
+func (m *remoteMachine) PublishedAddr(ctx context.Context, c *dockerutil.Container, port int) (net.IP, int, error) {
+	hostPort, err := c.FindPort(ctx, port)
+	if err != nil {
+		return nil, 0, err
+	}
+	ip, err := m.IPAddress()
+	if err != nil {
+		return nil, 0, err
+	}
+	return ip, hostPort, nil
+}
+
+// UtilityContainer implements Machine.UtilityContainer for remoteMachine.
+func (m *remoteMachine) UtilityContainer(ctx context.Context) (*dockerutil.Container, error) {
+	return m.utility.get(ctx, func() *dockerutil.Container {
+		return m.GetClientContainer(ctx, testutil.DefaultLogger("utility"))
+	})
+}
+
+// Info implements Machine.Info for remoteMachine.
+func (m *remoteMachine) Info() (MachineInfo, error) {
+	out, err := m.RunCommand("sh", "-c", "nproc && grep MemTotal /proc/meminfo && id -u && uname -m")
+	if err != nil {
+		return MachineInfo{}, fmt.Errorf("failed to describe %s: %v: %s", m.host, err, out)
+	}
+	return parseRemoteInfo(out)
+}
+
+// parseRemoteInfo parses the output of the command run by
+// remoteMachine.Info.
+func parseRemoteInfo(out string) (MachineInfo, error) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 4 {
+		return MachineInfo{}, fmt.Errorf("unexpected output %q", out)
+	}
+	cpus, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+	if err != nil {
+		return MachineInfo{}, fmt.Errorf("bad CPU count %q: %v", lines[0], err)
+	}
+	mem := strings.Fields(lines[1])
+	if len(mem) != 3 || mem[0] != "MemTotal:" || mem[2] != "kB" {
+		return MachineInfo{}, fmt.Errorf("bad memory line %q", lines[1])
+	}
+	kb, err := strconv.ParseUint(mem[1], 10, 64)
+	if err != nil {
+		return MachineInfo{}, fmt.Errorf("bad memory line %q: %v", lines[1], err)
+	}
+	return MachineInfo{
+		CPUs:        cpus,
+		MemoryBytes: kb << 10,
+		Root:        strings.TrimSpace(lines[2]) == "0",
+		Arch:        goarch(strings.TrimSpace(lines[3])),
+	}, nil
+}
+
+// goarch returns the runtime.GOARCH name of the machine architecture
+// reported by uname.
+func goarch(machine string) string {
+	switch machine {
+	case "x86_64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	default:
+		return machine
+	}
+}
+
+// CleanUp implements Machine.CleanUp for remoteMachine. It cleans up the
+// utility container and closes the tunnel.
+func (m *remoteMachine) CleanUp() {
+	m.utility.cleanUp()
+	if m.tunnel != nil && m.tunnel.Process != nil {
+		m.tunnel.Process.Kill()
+		m.tunnel.Wait()
+	}
+	os.RemoveAll(m.dir)
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	for _, arg := range []string{"", "plain", "with space", "it's", `"$HOME"; ls`, "a'b'c"} {
+		out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(arg)).Output()
+		if err != nil {
+			t.Fatalf("sh failed for %q: %v", arg, err)
+		}
+		if got := string(out); got != arg {
+			t.Errorf("shellQuote(%q) round trip got %q", arg, got)
+		}
+	}
+}
+
+func TestParseRemoteInfo(t *testing.T) {
+	got, err := parseRemoteInfo("8\nMemTotal:       16384 kB\n0\nx86_64\n")
+	if err != nil {
+		t.Fatalf("parseRemoteInfo failed: %v", err)
+	}
+	want := MachineInfo{CPUs: 8, MemoryBytes: 16384 << 10, Root: true, Arch: "amd64"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	for _, out := range []string{"", "8\n", "x\nMemTotal: 1 kB\n0\nx86_64", "8\nMemFree: 1 kB\n0\nx86_64"} {
+		if _, err := parseRemoteInfo(out); err == nil {
+			t.Errorf("parseRemoteInfo(%q) succeeded, want error", out)
+		}
+	}
+}
+
+func TestMachineRoles(t *testing.T) {
+	defer func(client, server string) {
+		*clientHost, *serverHost = client, server
+	}(*clientHost, *serverHost)
+
+	// Roles without a remote host run on the local machine, regardless of
+	// the other role, which is not reached.
+	var h Harness
+	for _, tc := range []struct {
+		name           string
+		client, server string
+		get            func() (Machine, error)
+	}{
+		{name: "server", get: h.GetMachine},
+		{name: "client", get: h.GetClientMachine},
+		{name: "server with remote client", client: "client.invalid", get: h.GetMachine},
+		{name: "client with remote server", server: "server.invalid", get: h.GetClientMachine},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			*clientHost, *serverHost = tc.client, tc.server
+			m, err := tc.get()
+			if err != nil {
+				t.Fatalf("getting machine failed: %v", err)
+			}
+			defer m.CleanUp()
+			if _, ok := m.(*localMachine); !ok {
+				t.Errorf("got machine %T, want *localMachine", m)
+			}
+		})
+	}
+}
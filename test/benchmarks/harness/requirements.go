@@ -0,0 +1,174 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+var listRequirements = flag.Bool("list-requirements", false, "print the resource requirements declared by each benchmark instead of running it")
+
+// Requirement is a resource that a benchmark needs from the machine it runs
+// on. Requirements are declared with Requires.
+type Requirement struct {
+	// desc describes the requirement, e.g. "cpus>=16".
+	desc string
+
+	// have describes what info provides, e.g. "cpus=8", if info does not
+	// meet the requirement. It returns the empty string otherwise.
+	have func(info MachineInfo) string
+}
+
+// String implements fmt.Stringer.String.
+func (r Requirement) String() string {
+	return r.desc
+}
+
+// MinCPUs requires at least n CPUs.
+func MinCPUs(n int) Requirement {
+	return Requirement{
+		desc: fmt.Sprintf("cpus>=%d", n),
+		have: func(info MachineInfo) string {
+			if info.CPUs >= n {
+				return ""
+			}
+			return fmt.Sprintf("cpus=%d", info.CPUs)
+		},
+	}
+}
+
+// MinMemoryGB requires at least n GB of memory.
+func MinMemoryGB(n int) Requirement {
+	return Requirement{
+		desc: fmt.Sprintf("memory>=%dGB", n),
+		have: func(info MachineInfo) string {
+			if info.MemoryBytes >= uint64(n)<<30 {
+				return ""
+			}
+			return fmt.Sprintf("memory=%.1fGB", float64(info.MemoryBytes)/(1<<30))
+		},
+	}
+}
+
+// NeedsRoot requires benchmarks to run as root.
+func NeedsRoot() Requirement {
+	return Requirement{
+		desc: "root",
+		have: func(info MachineInfo) string {
+			if info.Root {
+				return ""
+			}
+			return "non-root"
+		},
+	}
+}
+
+var (
+	// registryMu protects registry and serverInfo.
+	registryMu sync.Mutex
+
+	// registry holds the requirements declared by each benchmark, by name.
+	registry = make(map[string][]Requirement)
+
+	// serverInfo caches the description of the machine running the
+	// benchmark servers, by --server-host.
+	serverInfo = make(map[string]MachineInfo)
+)
+
+// Requires declares the resources that the benchmark b needs and skips it,
+// with a standard message, if the machine it runs on doesn't provide them:
+// the machine returned by Harness.GetMachine. It should be called at the
+// start of the benchmark.
+//
+// With --list-requirements, Requires prints the declared requirements and
+// skips the benchmark without checking them.
+func Requires(b testing.TB, reqs ...Requirement) {
+	b.Helper()
+	registryMu.Lock()
+	registry[b.Name()] = reqs
+	registryMu.Unlock()
+
+	if *listRequirements {
+		fmt.Printf("%s\t%s\n", b.Name(), formatRequirements(reqs))
+		b.SkipNow()
+	}
+
+	info, err := serverMachineInfo()
+	if err != nil {
+		b.Fatalf("failed to get machine info: %v", err)
+	}
+	if unmet := unmetRequirements(info, reqs); len(unmet) > 0 {
+		b.Skipf("machine does not meet requirements: %s", strings.Join(unmet, ", "))
+	}
+}
+
+// serverMachineInfo describes the machine running the benchmark servers. It
+// is cached, as Requires is called on every run of a benchmark.
+func serverMachineInfo() (MachineInfo, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if info, ok := serverInfo[*serverHost]; ok {
+		return info, nil
+	}
+	info, err := serverCommandMachine().Info()
+	if err != nil {
+		return MachineInfo{}, err
+	}
+	serverInfo[*serverHost] = info
+	return info, nil
+}
+
+// DeclaredRequirements returns the requirements declared so far with
+// Requires, by benchmark name.
+func DeclaredRequirements() map[string][]Requirement {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	declared := make(map[string][]Requirement, len(registry))
+	for name, reqs := range registry {
+		declared[name] = append([]Requirement(nil), reqs...)
+	}
+	return declared
+}
+
+// formatRequirements returns a space-separated list of reqs, or "none".
+func formatRequirements(reqs []Requirement) string {
+	if len(reqs) == 0 {
+		return "none"
+	}
+	descs := make([]string, 0, len(reqs))
+	for _, r := range reqs {
+		descs = append(descs, r.desc)
+	}
+	sort.Strings(descs)
+	return strings.Join(descs, " ")
+}
+
+// unmetRequirements returns a description of each requirement in reqs that
+// info doesn't meet.
+func unmetRequirements(info MachineInfo, reqs []Requirement) []string {
+	var unmet []string
+	for _, r := range reqs {
+		if have := r.have(info); have != "" {
+			unmet = append(unmet, fmt.Sprintf("%s (have %s)", r.desc, have))
+		}
+	}
+	return unmet
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnmetRequirements(t *testing.T) {
+	info := MachineInfo{
+		CPUs:        8,
+		MemoryBytes: 16 << 30,
+		Root:        false,
+	}
+	for _, tc := range []struct {
+		name string
+		reqs []Requirement
+		want []string
+	}{
+		{
+			name: "none",
+		},
+		{
+			name: "met",
+			reqs: []Requirement{MinCPUs(8), MinMemoryGB(16)},
+		},
+		{
+			name: "cpus",
+			reqs: []Requirement{MinCPUs(16), MinMemoryGB(16)},
+			want: []string{"cpus>=16 (have cpus=8)"},
+		},
+		{
+			name: "all",
+			reqs: []Requirement{MinCPUs(16), MinMemoryGB(32), NeedsRoot()},
+			want: []string{"cpus>=16 (have cpus=8)", "memory>=32GB (have memory=16.0GB)", "root (have non-root)"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := unmetRequirements(info, tc.reqs)
+			if strings.Join(got, ", ") != strings.Join(tc.want, ", ") {
+				t.Errorf("got unmet requirements %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRequiresSkips(t *testing.T) {
+	ran := false
+	t.Run("absurd", func(t *testing.T) {
+		Requires(t, MinCPUs(1<<20))
+		ran = true
+	})
+	if ran {
+		t.Errorf("benchmark with unmet requirements was not skipped")
+	}
+
+	ran = false
+	t.Run("met", func(t *testing.T) {
+		Requires(t, MinCPUs(1))
+		ran = true
+	})
+	if !ran {
+		t.Errorf("benchmark with met requirements was skipped")
+	}
+}
+
+func TestRequiresServerMachine(t *testing.T) {
+	defer func(server string) {
+		*serverHost = server
+	}(*serverHost)
+	*serverHost = "server.invalid"
+	registryMu.Lock()
+	serverInfo[*serverHost] = MachineInfo{CPUs: 1 << 20}
+	registryMu.Unlock()
+	defer func() {
+		registryMu.Lock()
+		delete(serverInfo, "server.invalid")
+		registryMu.Unlock()
+	}()
+
+	// The local machine doesn't have the CPUs, but the server machine does.
+	ran := false
+	t.Run("server", func(t *testing.T) {
+		Requires(t, MinCPUs(1<<20))
+		ran = true
+	})
+	if !ran {
+		t.Errorf("benchmark was skipped for the resources of the local machine")
+	}
+}
+
+func TestRequiresRegistry(t *testing.T) {
+	var name string
+	t.Run("declared", func(t *testing.T) {
+		name = t.Name()
+		Requires(t, NeedsRoot(), MinCPUs(1))
+	})
+	reqs, ok := DeclaredRequirements()[name]
+	if !ok {
+		t.Fatalf("requirements of %q were not registered", name)
+	}
+	if got, want := formatRequirements(reqs), "cpus>=1 root"; got != want {
+		t.Errorf("got requirements %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+var (
+	benchmarkOutput = flag.String("benchmark-output", "", "file to append benchmark results to, as a JSON object per line, in addition to the test output")
+	resultLabels    LabelsFlag
+)
+
+func init() {
+	flag.Var(&resultLabels, "result-labels", "comma-separated key=value labels to include in benchmark results, e.g. to tell runs apart")
+}
+
+// Result is the result of a benchmark, as written to --benchmark-output.
+type Result struct {
+	// Name is the full name of the benchmark, e.g. "BenchmarkFoo/Bar".
+	Name string `json:"name"`
+
+	// N is the number of iterations of the benchmark.
+	N int `json:"n"`
+
+	// Metrics are the custom metrics of the benchmark, by unit.
+	Metrics map[string]float64 `json:"metrics"`
+
+	// Runtime is the runtime under test, as for --server-runtime.
+	Runtime string `json:"runtime"`
+
+	// RuntimeVersion is the version printed by the runtime's binary, and
+	// RuntimeCommit the git commit it was built from, if known.
+	RuntimeVersion string `json:"runtime_version"`
+	RuntimeCommit  string `json:"runtime_commit"`
+
+	// Labels are the labels of the run, as for --result-labels.
+	Labels map[string]string `json:"labels"`
+
+	// Timestamp is when the result was reported.
+	Timestamp time.Time `json:"timestamp"`
+
+	// Host describes the machine running the benchmark servers.
+	Host HostInfo `json:"host"`
+}
+
+// HostInfo describes the machine running a benchmark.
+type HostInfo struct {
+	Hostname    string `json:"hostname"`
+	Kernel      string `json:"kernel"`
+	CPUModel    string `json:"cpu_model"`
+	CPUs        int    `json:"cpus"`
+	MemoryBytes uint64 `json:"memory_bytes"`
+}
+
+// Reporter reports the metrics of a run of a benchmark: to the test output,
+// like testing.B, and with --benchmark-output, to a file as a Result.
+type Reporter struct {
+	*testing.B
+
+	h       *Harness
+	metrics map[string]float64
+}
+
+// Reporter returns a Reporter for the current run of b.
+func (h *Harness) Reporter(b *testing.B) *Reporter {
+	return &Reporter{
+		B:       b,
+		h:       h,
+		metrics: make(map[string]float64),
+	}
+}
+
+// ReportMetric is like testing.B.ReportMetric, but also records the metric
+// for Finish.
+func (r *Reporter) ReportMetric(n float64, unit string) {
+	r.B.ReportMetric(n, unit)
+	r.metrics[unit] = n
+}
+
+// Finish logs the runtime under test and the labels of the run, and writes
+// the result of the run, with the metrics reported so far, to
+// --benchmark-output, if set. It must be called at the end of each run of the
+// benchmark function, so a benchmark yields a Result per run: ReadResults
+// keeps the last one, the one reported by the testing package.
+func (r *Reporter) Finish() {
+	r.Logf("%s", r.h.runDescription())
+	if results == nil {
+		return
+	}
+	if err := results.write(Result{
+		Name:           r.Name(),
+		N:              r.N,
+		Metrics:        r.metrics,
+		Runtime:        r.h.ServerRuntime(),
+		RuntimeVersion: r.h.version.version,
+		RuntimeCommit:  r.h.version.commit,
+		Labels:         resultLabels,
+		Timestamp:      time.Now(),
+		Host:           results.hostInfo(),
+	}); err != nil {
+		r.Errorf("failed to write result to %s: %v", results.f.Name(), err)
+	}
+}
+
+// runDescription describes the runtime under test and the labels of the
+// run, for human readers of the test output.
+func (h *Harness) runDescription() string {
+	version := h.version.String()
+	if version == "" {
+		version = "unknown"
+	}
+	desc := fmt.Sprintf("runtime: %s, version: %s", h.ServerRuntime(), version)
+	if len(resultLabels) > 0 {
+		desc += ", labels: " + resultLabels.String()
+	}
+	return desc
+}
+
+// results is the writer of --benchmark-output, once opened by Init.
+var results *resultWriter
+
+// resultWriter writes results to a file, a JSON object per line. It is safe
+// for concurrent use.
+type resultWriter struct {
+	// serverOnce guards describeServer.
+	serverOnce sync.Once
+
+	// mu serializes writes to f and guards host.
+	mu sync.Mutex
+	f  *os.File
+
+	// host is the description of the machine included in results: this
+	// one, unless the servers run on a remote machine.
+	host HostInfo
+}
+
+// openResults opens path, creating it if needed, to append results to.
+func openResults(path string) (*resultWriter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &resultWriter{
+		f:    f,
+		host: describeMachine(&localMachine{}),
+	}, nil
+}
+
+// hostInfo returns the description of the machine included in results.
+func (w *resultWriter) hostInfo() HostInfo {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.host
+}
+
+// describeServer makes results describe m, the remote machine running the
+// benchmark servers, rather than this one. Only the first call has an
+// effect.
+func (w *resultWriter) describeServer(m Machine) {
+	w.serverOnce.Do(func() {
+		info := describeMachine(m)
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.host = info
+	})
+}
+
+// write appends r to the file. Results are not buffered, so that a crashed
+// run still leaves the results written so far.
+func (w *resultWriter) write(r Result) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err = w.f.Write(data)
+	return err
+}
+
+// ReadResults reads the results written to path with --benchmark-output: the
+// last result of each benchmark, in the order they were first written.
+func ReadResults(path string) ([]Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var results []Result
+	index := make(map[string]int)
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	for line := 1; s.Scan(); line++ {
+		var r Result
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		if i, ok := index[r.Name]; ok {
+			results[i] = r
+			continue
+		}
+		index[r.Name] = len(results)
+		results = append(results, r)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// describeMachine describes m for results. Fields that can't be found are
+// left empty.
+func describeMachine(m Machine) HostInfo {
+	var info HostInfo
+	info.Hostname, _ = m.Hostname()
+	info.Kernel, _ = m.KernelVersion()
+	info.CPUModel, info.CPUs, _ = m.CPUInfo()
+	info.MemoryBytes, _ = m.MemoryBytes()
+	return info
+}
@@ -0,0 +1,172 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+func newResults(t *testing.T) (*resultWriter, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "results")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "results.json")
+	w, err := openResults(path)
+	if err != nil {
+		t.Fatalf("openResults failed: %v", err)
+	}
+	t.Cleanup(func() { w.f.Close() })
+	return w, path
+}
+
+func TestResultsRoundTrip(t *testing.T) {
+	w, path := newResults(t)
+	want := []Result{
+		{
+			Name:           "BenchmarkFoo/1",
+			N:              100,
+			Metrics:        map[string]float64{"requests_per_second": 1234.5, "p99_latency[ms]": 3},
+			Runtime:        "runsc",
+			RuntimeVersion: "release-20200622.1-171-gc66991ad7de6",
+			RuntimeCommit:  "c66991ad7de6",
+			Labels:         map[string]string{"branch": "main"},
+			Timestamp:      time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC),
+			Host:           HostInfo{Hostname: "bench-1", Kernel: "5.4.0", CPUModel: "Some CPU @ 2.20GHz", CPUs: 8, MemoryBytes: 16 << 30},
+		},
+		{
+			Name:    "BenchmarkFoo/2",
+			N:       1,
+			Metrics: map[string]float64{},
+		},
+	}
+	for _, r := range want {
+		if err := w.write(r); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	got, err := ReadResults(path)
+	if err != nil {
+		t.Fatalf("ReadResults failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadResults got %+v, want %+v", got, want)
+	}
+}
+
+func TestResultsLastRun(t *testing.T) {
+	w, path := newResults(t)
+	// The benchmark function runs with increasing b.N.
+	for _, r := range []Result{
+		{Name: "BenchmarkFoo", N: 1},
+		{Name: "BenchmarkBar", N: 1},
+		{Name: "BenchmarkFoo", N: 100},
+		{Name: "BenchmarkFoo", N: 10000},
+	} {
+		if err := w.write(r); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	got, err := ReadResults(path)
+	if err != nil {
+		t.Fatalf("ReadResults failed: %v", err)
+	}
+	want := []Result{{Name: "BenchmarkFoo", N: 10000}, {Name: "BenchmarkBar", N: 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadResults got %+v, want %+v", got, want)
+	}
+}
+
+func TestResultsConcurrent(t *testing.T) {
+	const (
+		writers   = 8
+		perWriter = 100
+	)
+	w, path := newResults(t)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < perWriter; j++ {
+				r := Result{
+					Name:    fmt.Sprintf("Benchmark%d/%d", i, j),
+					N:       j,
+					Metrics: map[string]float64{"writer": float64(i)},
+				}
+				if err := w.write(r); err != nil {
+					t.Errorf("write failed: %v", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Every result is whole: none is interleaved with another.
+	got, err := ReadResults(path)
+	if err != nil {
+		t.Fatalf("ReadResults failed: %v", err)
+	}
+	if len(got) != writers*perWriter {
+		t.Fatalf("got %d results, want %d", len(got), writers*perWriter)
+	}
+	for _, r := range got {
+		var i, j int
+		if _, err := fmt.Sscanf(r.Name, "Benchmark%d/%d", &i, &j); err != nil || r.N != j || r.Metrics["writer"] != float64(i) {
+			t.Errorf("got corrupt result %+v", r)
+		}
+	}
+}
+
+func TestReadResultsCorrupt(t *testing.T) {
+	_, path := newResults(t)
+	if err := ioutil.WriteFile(path, []byte("{\"name\": \"BenchmarkFoo\"}\n{\"name\": \"Bench"), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile failed: %v", err)
+	}
+	if got, err := ReadResults(path); err == nil {
+		t.Errorf("ReadResults got %+v for a truncated file, want error", got)
+	}
+}
+
+func TestParseCPUModel(t *testing.T) {
+	const cpuinfo = `processor	: 0
+vendor_id	: GenuineIntel
+cpu family	: 6
+model		: 79
+model name	: Intel(R) Xeon(R) CPU @ 2.20GHz
+stepping	: 0
+
+processor	: 1
+model name	: Intel(R) Xeon(R) CPU @ 2.20GHz
+`
+	if got, want := parseCPUModel(cpuinfo), "Intel(R) Xeon(R) CPU @ 2.20GHz"; got != want {
+		t.Errorf("parseCPUModel got %q, want %q", got, want)
+	}
+	if got := parseCPUModel("processor	: 0\n"); got != "" {
+		t.Errorf("parseCPUModel got %q without a model, want none", got)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+// remoteHostLabel labels the containers of remote machines with the host of
+// the machine. Their processes are not in the local /proc.
+const remoteHostLabel = "dev.gvisor.benchmark.remote-host"
+
+// sandboxCommand is argv[0] of runsc sandbox processes, which run the sentry.
+const sandboxCommand = "runsc-sandbox"
+
+// VerifyRuntime checks that the container c, which must be running, runs
+// under the runtime it was requested with, and, if that is runsc, that it is
+// sandboxed by a runsc sandbox. A misconfigured daemon can silently run
+// containers under another runtime, e.g. if the runsc runtime points at
+// runc, which would make the results meaningless.
+//
+// It should be called right after the server of a benchmark is started.
+func VerifyRuntime(ctx context.Context, c *dockerutil.Container) error {
+	runtime, err := c.EffectiveRuntime(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container %s: %v", c.Name, err)
+	}
+	var argv []string
+	if isRunsc(runtime) {
+		if argv, err = hostCommandLine(ctx, c); err != nil {
+			return fmt.Errorf("failed to find the host process of container %s: %v", c.Name, err)
+		}
+	}
+	return checkRuntime(c.Name, c.Runtime, runtime, argv)
+}
+
+// checkRuntime checks that the container name, which was requested with the
+// runtime want, runs under want, given the runtime it was created with and,
+// for runsc, the command line of its host process.
+func checkRuntime(name, want, got string, argv []string) error {
+	if want != "" && got != want {
+		return fmt.Errorf("container %s runs under runtime %q, want %q", name, got, want)
+	}
+	if !isRunsc(got) {
+		return nil
+	}
+	if len(argv) == 0 || argv[0] != sandboxCommand {
+		return fmt.Errorf("container %s has runtime %q but is not sandboxed by runsc: its host process is %q; check the runtime's path in the docker daemon configuration", name, got, strings.Join(argv, " "))
+	}
+	return nil
+}
+
+// isRunsc returns whether runtime is a runsc runtime, e.g. "runsc" or
+// "runsc-debug", by the convention of their names.
+func isRunsc(runtime string) bool {
+	return strings.HasPrefix(runtime, "runsc")
+}
+
+// hostCommandLine returns the command line of the host process of the
+// running container c: its runsc sandbox if it is sandboxed, or its init
+// process otherwise. For containers of remote machines, /proc is read from a
+// container on the same daemon.
+func hostCommandLine(ctx context.Context, c *dockerutil.Container) ([]string, error) {
+	pid, err := c.SandboxPid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if c.Labels[remoteHostLabel] == "" {
+		data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+		if err != nil {
+			return nil, err
+		}
+		return parseCommandLine(string(data)), nil
+	}
+
+	proc := dockerutil.MakeContainerOnHost(ctx, testutil.DefaultLogger("runtime"), c.DaemonHost(), "runc")
+	if proc == nil {
+		return nil, fmt.Errorf("failed to connect to the docker daemon of %s", c.Labels[remoteHostLabel])
+	}
+	defer proc.CleanUp(ctx)
+	out, err := proc.Run(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+		Mounts: []mount.Mount{
+			{
+				Type:     mount.TypeBind,
+				Source:   "/proc",
+				Target:   "/host-proc",
+				ReadOnly: true,
+			},
+		},
+	}, "cat", fmt.Sprintf("/host-proc/%d/cmdline", pid))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, out)
+	}
+	return parseCommandLine(out), nil
+}
+
+// parseCommandLine splits the contents of a /proc/<pid>/cmdline file.
+func parseCommandLine(data string) []string {
+	data = strings.TrimRight(data, "\x00")
+	if data == "" {
+		return nil
+	}
+	return strings.Split(data, "\x00")
+}
@@ -0,0 +1,63 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckRuntime(t *testing.T) {
+	sandbox := []string{"runsc-sandbox", "--root=/var/run/docker/runtime-runc/moby", "boot", "--bundle=/run/containerd/io.containerd.runtime.v1.linux/moby/abc"}
+	runcInit := []string{"sleep", "infinity"}
+	for _, tc := range []struct {
+		name    string
+		want    string
+		got     string
+		argv    []string
+		wantErr bool
+	}{
+		{name: "runsc", want: "runsc", got: "runsc", argv: sandbox},
+		{name: "runsc variant", want: "runsc-debug", got: "runsc-debug", argv: sandbox},
+		{name: "runc", want: "runc", got: "runc"},
+		{name: "daemon default", want: "", got: "runc"},
+		{name: "fell back to runc", want: "runsc", got: "runc", wantErr: true},
+		{name: "unexpected runsc", want: "runc", got: "runsc", argv: sandbox, wantErr: true},
+		{name: "runsc is runc", want: "runsc", got: "runsc", argv: runcInit, wantErr: true},
+		{name: "no host process", want: "runsc", got: "runsc", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkRuntime("server", tc.want, tc.got, tc.argv)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("checkRuntime got err: %v, want err: %t", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseCommandLine(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		want []string
+	}{
+		{data: "", want: nil},
+		{data: "sleep\x00infinity\x00", want: []string{"sleep", "infinity"}},
+		{data: "runsc-sandbox\x00--debug\x00\x00boot\x00", want: []string{"runsc-sandbox", "--debug", "", "boot"}},
+	} {
+		if got := parseCommandLine(tc.data); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseCommandLine(%q) got: %q, want: %q", tc.data, got, tc.want)
+		}
+	}
+}
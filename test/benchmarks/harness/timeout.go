@@ -0,0 +1,108 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// diagnosticsTimeout bounds the collection of the diagnostics of a benchmark
+// that timed out.
+const diagnosticsTimeout = time.Minute
+
+// diagnosticsLogTail is the number of bytes kept from the end of the logs of
+// each container in the diagnostics of a benchmark that timed out.
+const diagnosticsLogTail = 64 << 10
+
+// RunWithTimeout runs f, the body of the benchmark b, with a context that is
+// cancelled after d, or when the run is interrupted. f must return once the
+// context is done, e.g. by passing it to the operations that may block.
+//
+// If d elapses first, the logs of the live containers of the run, such as
+// the benchmark's server and clients, and a dump of the goroutines of the
+// benchmark process are logged to b before the context is cancelled. b then
+// fails, but not the other benchmarks of the run, so that a hung server does
+// not stall the whole run.
+func (h *Harness) RunWithTimeout(b *testing.B, d time.Duration, f func(ctx context.Context)) {
+	b.Helper()
+	ctx, cancel := context.WithCancel(h.Context())
+	defer cancel()
+
+	fired := make(chan struct{})
+	timer := time.AfterFunc(d, func() {
+		defer close(fired)
+		// The diagnostics are taken before cancelling, while the
+		// containers are still in the state they hung in.
+		b.Logf("timed out after %v, diagnostics follow:\n%s", d, h.diagnostics())
+		cancel()
+	})
+	var (
+		stopOnce sync.Once
+		timedOut bool
+	)
+	stop := func() {
+		stopOnce.Do(func() {
+			if !timer.Stop() {
+				<-fired
+				timedOut = true
+			}
+		})
+	}
+	// If f fails the benchmark, the diagnostics must still be done
+	// logging to b before it completes.
+	defer stop()
+
+	f(ctx)
+	stop()
+	if timedOut {
+		b.Fatalf("timed out after %v", d)
+	}
+}
+
+// diagnostics returns the logs of the containers of the run that were not
+// removed yet, and a dump of the goroutines of the benchmark process.
+func (h *Harness) diagnostics() string {
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticsTimeout)
+	defer cancel()
+	var buf bytes.Buffer
+	for _, c := range h.tracker.tracked() {
+		// The containers that were removed are gone, but those that
+		// exited are kept: they may have crashed.
+		if _, err := c.Status(ctx); err != nil {
+			continue
+		}
+		logs, err := c.Logs(ctx)
+		if err != nil {
+			fmt.Fprintf(&buf, "failed to get logs of container %s: %v\n", c.Name, err)
+			continue
+		}
+		if len(logs) > diagnosticsLogTail {
+			logs = "[...]" + logs[len(logs)-diagnosticsLogTail:]
+		}
+		fmt.Fprintf(&buf, "=== logs of container %s ===\n%s\n", c.Name, logs)
+	}
+	fmt.Fprintf(&buf, "=== goroutines ===\n")
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 2); err != nil {
+		fmt.Fprintf(&buf, "failed to dump goroutines: %v\n", err)
+	}
+	return buf.String()
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitUntilReady waits for a server to accept connections at addr, until ctx
+// is done.
+func waitUntilReady(ctx context.Context, addr string) error {
+	var d net.Dialer
+	for {
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestRunWithTimeout(t *testing.T) {
+	// A server that is never ready: nothing listens at its address.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen failed: %v", err)
+	}
+	neverReady := l.Addr().String()
+	l.Close()
+
+	var (
+		h                Harness
+		hung, ran, after bool
+		hungErr          error
+	)
+	testing.Benchmark(func(b *testing.B) {
+		hung = b.Run("NeverReady", func(b *testing.B) {
+			h.RunWithTimeout(b, 100*time.Millisecond, func(ctx context.Context) {
+				hungErr = waitUntilReady(ctx, neverReady)
+			})
+		})
+		ran = b.Run("Quick", func(b *testing.B) {
+			h.RunWithTimeout(b, time.Minute, func(ctx context.Context) {})
+		})
+		after = true
+	})
+
+	if hung {
+		t.Errorf("benchmark with a never-ready server succeeded, want failure")
+	}
+	if hungErr != context.Canceled {
+		t.Errorf("never-ready server wait got err: %v, want: %v", hungErr, context.Canceled)
+	}
+	if !ran {
+		t.Errorf("benchmark after the timed out one failed, want success")
+	}
+	if !after {
+		t.Errorf("parent benchmark did not continue after the timeout")
+	}
+}
+
+func TestRunWithTimeoutInterrupted(t *testing.T) {
+	var h Harness
+	h.initContext()
+	h.cancel()
+	var got error
+	r := testing.Benchmark(func(b *testing.B) {
+		h.RunWithTimeout(b, time.Minute, func(ctx context.Context) {
+			<-ctx.Done()
+			got = ctx.Err()
+		})
+	})
+	if got != context.Canceled {
+		t.Errorf("interrupted run got err: %v, want: %v", got, context.Canceled)
+	}
+	if r.N == 0 {
+		t.Errorf("interrupted run without a timeout failed, want success")
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	var h Harness
+	got := h.diagnostics()
+	// The dump includes the goroutine taking it.
+	if !strings.Contains(got, "=== goroutines ===") || !strings.Contains(got, "TestDiagnostics") {
+		t.Errorf("diagnostics got: %q, want a dump of the goroutines", got)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+)
+
+// probeInterval is the time between attempts to reach a server.
+const probeInterval = 100 * time.Millisecond
+
+// probeLoop returns a shell command that runs the shell command probe until
+// it succeeds, sleeping probeInterval between attempts. It gives up, and
+// fails, after timeout, even if an attempt is under way. If timeout is zero,
+// the probe is attempted once.
+func probeLoop(probe string, timeout time.Duration) string {
+	if timeout <= 0 {
+		return probe
+	}
+	loop := fmt.Sprintf("until %s; do sleep %g; done", probe, probeInterval.Seconds())
+	return fmt.Sprintf("timeout %g sh -c %s", timeout.Seconds(), shellQuote(loop))
+}
+
+// utilityImage is the image of utility containers. It has the tools used by
+// the helpers here, such as netcat and openssl.
+const utilityImage = "benchmarks/util"
+
+// utility is a lazily created utility container, e.g. for
+// Machine.UtilityContainer.
+type utility struct {
+	// mu protects container.
+	mu sync.Mutex
+
+	// container is the utility container, once created.
+	container *dockerutil.Container
+}
+
+// get returns the utility container, first spawning it in the container
+// returned by newContainer if needed.
+func (u *utility) get(ctx context.Context, newContainer func() *dockerutil.Container) (*dockerutil.Container, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.container != nil {
+		return u.container, nil
+	}
+	c := newContainer()
+	if err := c.Spawn(ctx, dockerutil.RunOpts{
+		Image:      utilityImage,
+		SkipAttach: true,
+	}, "sleep", "infinity"); err != nil {
+		c.CleanUp(ctx)
+		return nil, fmt.Errorf("failed to spawn utility container: %v", err)
+	}
+	u.container = c
+	return c, nil
+}
+
+// cleanUp cleans up the utility container, if it was created.
+func (u *utility) cleanUp() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.container != nil {
+		u.container.CleanUp(context.Background())
+		u.container = nil
+	}
+}
+
+// WaitUntilServing waits, for at most timeout, for a server to accept TCP
+// connections at ip:port. It probes the server from utility, a container
+// returned by Machine.UtilityContainer. If the server doesn't come up, or ctx
+// is done first, the returned error includes the output of the probes and,
+// unless server is nil, the logs of the server's container.
+func WaitUntilServing(ctx context.Context, utility, server *dockerutil.Container, ip net.IP, port int, timeout time.Duration) error {
+	probe := fmt.Sprintf("nc -zv -w 1 %s %d", ip, port)
+	return waitForProbe(ctx, utility, server, fmt.Sprintf("%s:%d", ip, port), probe, timeout)
+}
+
+// WaitUntilServingUDP is like WaitUntilServing, but for a UDP server. Since
+// UDP has no connections, the server is probed by sending it payload, which
+// should be a request of the server's protocol, e.g. a DNS query: the server
+// is serving once it sends any response. If payload is empty, the probe only
+// checks that the port is not unreachable, which most servers report before
+// they can respond.
+func WaitUntilServingUDP(ctx context.Context, utility, server *dockerutil.Container, ip net.IP, port int, payload []byte, timeout time.Duration) error {
+	return waitForProbe(ctx, utility, server, fmt.Sprintf("udp %s:%d", ip, port), udpProbe(ip, port, payload), timeout)
+}
+
+// WaitUntilServingTLS is like WaitUntilServing, but for a TLS server. A server
+// can accept connections before it can complete handshakes, e.g. if it failed
+// to load its certificate, so the probe completes a handshake. The server's
+// certificate is not verified.
+func WaitUntilServingTLS(ctx context.Context, utility, server *dockerutil.Container, ip net.IP, port int, timeout time.Duration) error {
+	return waitForProbe(ctx, utility, server, fmt.Sprintf("tls %s:%d", ip, port), tlsProbe(ip, port), timeout)
+}
+
+// tlsProbe returns the shell command probing a TLS server for
+// WaitUntilServingTLS. openssl exits with an error if the handshake fails,
+// but not if the certificate can't be verified.
+func tlsProbe(ip net.IP, port int) string {
+	return fmt.Sprintf("timeout 5 openssl s_client -connect %s:%d </dev/null", ip, port)
+}
+
+// udpProbe returns the shell command probing a UDP server for
+// WaitUntilServingUDP.
+func udpProbe(ip net.IP, port int, payload []byte) string {
+	if len(payload) == 0 {
+		return fmt.Sprintf("nc -uzv -w 1 %s %d", ip, port)
+	}
+	// The payload is encoded to survive the shell.
+	return fmt.Sprintf("[ $(echo %s | base64 -d | nc -u -w 1 %s %d | wc -c) -gt 0 ]", base64.StdEncoding.EncodeToString(payload), ip, port)
+}
+
+// waitForProbe runs the shell command probe in utility until it succeeds,
+// for at most timeout. It returns a servingError for the server at addr if
+// the probe never succeeds.
+func waitForProbe(ctx context.Context, utility, server *dockerutil.Container, addr, probe string, timeout time.Duration) error {
+	p, err := utility.ExecProcess(ctx, dockerutil.ExecOpts{}, "sh", "-c", probeLoop(probe, timeout))
+	if err != nil {
+		return fmt.Errorf("failed to start probe: %v", err)
+	}
+	// The probes stop by themselves after timeout, but the exec may not
+	// report it promptly, e.g. if the daemon is slow.
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	status, err := p.WaitExitStatus(waitCtx)
+	if err != nil {
+		// Stop the probes, so that they don't linger in the utility
+		// container. This is best effort.
+		p.Signal(context.Background(), syscall.SIGKILL)
+		if ctx.Err() == nil {
+			err = fmt.Errorf("not serving after %v", timeout)
+		}
+	} else if status != 0 {
+		err = fmt.Errorf("not serving after %v", timeout)
+	}
+	if err != nil {
+		out, logErr := p.Logs()
+		if logErr != nil {
+			out = fmt.Sprintf("<failed to get output: %v>", logErr)
+		}
+		return servingError(server, addr, out, err)
+	}
+	return nil
+}
+
+// servingError returns an error for a server at addr that failed to come up
+// with err, including the output of the probes and the logs of the server
+// container, if not nil.
+func servingError(server *dockerutil.Container, addr, out string, err error) error {
+	var serverLogs string
+	if server != nil {
+		// The logs are wanted even if the caller's context is done.
+		logs, logErr := server.Logs(context.Background())
+		if logErr != nil {
+			logs = fmt.Sprintf("<failed to get logs: %v>", logErr)
+		}
+		serverLogs = fmt.Sprintf("\nserver logs:\n%s", logs)
+	}
+	return fmt.Errorf("server at %s: %w\nprobe output:\n%s%s", addr, err, out, serverLogs)
+}
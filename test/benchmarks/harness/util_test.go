@@ -0,0 +1,144 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestProbeLoop(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		probe   string
+		timeout time.Duration
+		ok      bool
+		tries   int
+	}{
+		{
+			name:    "immediate",
+			probe:   "true",
+			timeout: time.Second,
+			ok:      true,
+			tries:   1,
+		},
+		{
+			name:    "eventually",
+			probe:   `i=$((i+1)); [ "$i" -ge 3 ]`,
+			timeout: time.Second,
+			ok:      true,
+			tries:   3,
+		},
+		{
+			name:    "never",
+			probe:   "false",
+			timeout: 5 * probeInterval,
+		},
+		{
+			// The timeout cuts the attempt under way short.
+			name:    "slow",
+			probe:   "sleep 10",
+			timeout: 5 * probeInterval,
+			tries:   1,
+		},
+		{
+			name:  "no timeout",
+			probe: "false",
+			tries: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Each attempt prints a line, so that they can be counted.
+			cmd := probeLoop("echo; "+tc.probe, tc.timeout)
+			start := time.Now()
+			out, err := exec.Command("sh", "-c", cmd).Output()
+			elapsed := time.Since(start)
+			if ok := err == nil; ok != tc.ok {
+				t.Errorf("%q succeeded %t, want %t (err %v)", cmd, ok, tc.ok, err)
+			}
+			if got := len(out); tc.tries > 0 && got != tc.tries {
+				t.Errorf("%q made %d attempts, want %d", cmd, got, tc.tries)
+			}
+			// Allow for slow machines, but not for another attempt of
+			// the slow probe.
+			if max := tc.timeout + 2*time.Second; elapsed > max {
+				t.Errorf("%q took %v, want at most %v", cmd, elapsed, max)
+			}
+		})
+	}
+}
+
+func TestUDPProbe(t *testing.T) {
+	payload := []byte("query 'with' \"quotes\"\x00\n")
+	probe := udpProbe(net.IPv4(127, 0, 0, 1), 53, payload)
+	for _, tc := range []struct {
+		name string
+		nc   string
+		ok   bool
+	}{
+		{
+			name: "response",
+			// The server echoes the request if it is intact.
+			nc: fmt.Sprintf(`[ "$(cat | base64)" = %q ] && echo response`, base64.StdEncoding.EncodeToString(payload)),
+			ok: true,
+		},
+		{
+			name: "no response",
+			nc:   "cat >/dev/null",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// nc is replaced by a function standing in for the server.
+			cmd := fmt.Sprintf("nc() { %s; }; %s", tc.nc, probe)
+			err := exec.Command("sh", "-c", cmd).Run()
+			if ok := err == nil; ok != tc.ok {
+				t.Errorf("%q succeeded %t, want %t (err %v)", cmd, ok, tc.ok, err)
+			}
+		})
+	}
+}
+
+func TestTLSProbe(t *testing.T) {
+	probe := tlsProbe(net.IPv4(127, 0, 0, 1), 443)
+	for _, tc := range []struct {
+		name    string
+		openssl string
+		ok      bool
+	}{
+		{
+			name:    "handshake",
+			openssl: `[ "$*" = "s_client -connect 127.0.0.1:443" ] && [ -z "$(cat)" ]`,
+			ok:      true,
+		},
+		{
+			name:    "handshake failure",
+			openssl: "false",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// timeout and openssl are replaced by functions standing in
+			// for them and the server.
+			cmd := fmt.Sprintf(`timeout() { shift; "$@"; }; openssl() { %s; }; %s`, tc.openssl, probe)
+			err := exec.Command("sh", "-c", cmd).Run()
+			if ok := err == nil; ok != tc.ok {
+				t.Errorf("%q succeeded %t, want %t (err %v)", cmd, ok, tc.ok, err)
+			}
+		})
+	}
+}
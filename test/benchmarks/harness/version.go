@@ -0,0 +1,93 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// runtimeVersion is the version of a runtime, as reported in results.
+type runtimeVersion struct {
+	// version is the version printed by the runtime, e.g.
+	// "release-20200622.1-171-gc66991ad7de6" for runsc.
+	version string
+
+	// commit is the git commit the runtime was built from, if its version
+	// names one.
+	commit string
+}
+
+// String implements fmt.Stringer.String.
+func (v runtimeVersion) String() string {
+	if v.commit == "" {
+		return v.version
+	}
+	return fmt.Sprintf("%s (commit %s)", v.version, v.commit)
+}
+
+// getRuntimeVersion returns the version of runtime on m, as printed by
+// 'docker info' for its binary and by the binary's --version flag. It
+// returns an error if the binary has no --version flag.
+func getRuntimeVersion(m Machine, runtime string) (runtimeVersion, error) {
+	out, err := m.RunCommand("docker", "info", "--format", fmt.Sprintf("{{(index .Runtimes %q).Path}}", runtime))
+	path := strings.TrimSpace(out)
+	if err != nil || path == "" {
+		return runtimeVersion{}, fmt.Errorf("failed to find the binary of runtime %q: %v: %s", runtime, err, out)
+	}
+	out, err = m.RunCommand(path, "--version")
+	if err != nil {
+		return runtimeVersion{}, fmt.Errorf("%s --version failed: %v: %s", path, err, out)
+	}
+	return parseRuntimeVersion(out)
+}
+
+// versionRE matches the version line of runtimes, e.g. "runsc version
+// release-20200622.1-171-gc66991ad7de6".
+var versionRE = regexp.MustCompile(`(?m)^\S+ version (\S+)`)
+
+// commitRE matches the commit line of runtimes that print one, e.g. runc's
+// "commit: dc9208a3303feef5b3839f4323d9beb36df0a9dd".
+var commitRE = regexp.MustCompile(`(?m)^commit: ([0-9a-f]+)`)
+
+// describeCommitRE matches the commit in versions from 'git describe', e.g.
+// "release-20200622.1-171-gc66991ad7de6".
+var describeCommitRE = regexp.MustCompile(`-g([0-9a-f]{7,40})$`)
+
+// parseRuntimeVersion parses the output of a runtime's --version flag.
+func parseRuntimeVersion(out string) (runtimeVersion, error) {
+	match := versionRE.FindStringSubmatch(out)
+	if match == nil {
+		return runtimeVersion{}, fmt.Errorf("no version found in %q", out)
+	}
+	v := runtimeVersion{version: match[1]}
+	if match := commitRE.FindStringSubmatch(out); match != nil {
+		v.commit = match[1]
+	} else if match := describeCommitRE.FindStringSubmatch(v.version); match != nil {
+		v.commit = match[1]
+	}
+	return v, nil
+}
+
+// serverCommandMachine returns a machine to run commands on the host of the
+// benchmark servers: the --server-host machine, whose commands run over SSH
+// without a tunnel to its docker daemon, or the local machine.
+func serverCommandMachine() Machine {
+	if *serverHost != "" {
+		return &remoteMachine{host: *serverHost}
+	}
+	return &localMachine{}
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseRuntimeVersion(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		out  string
+		want runtimeVersion
+	}{
+		{
+			name: "runsc release",
+			out:  "runsc version release-20200622.1-171-gc66991ad7de6\nspec: 1.0.1-dev\n",
+			want: runtimeVersion{version: "release-20200622.1-171-gc66991ad7de6", commit: "c66991ad7de6"},
+		},
+		{
+			name: "runsc tag",
+			out:  "runsc version release-20200622.1\nspec: 1.0.1-dev\n",
+			want: runtimeVersion{version: "release-20200622.1"},
+		},
+		{
+			name: "runc",
+			out:  "runc version 1.0.0-rc10\ncommit: dc9208a3303feef5b3839f4323d9beb36df0a9dd\nspec: 1.0.1-dev\n",
+			want: runtimeVersion{version: "1.0.0-rc10", commit: "dc9208a3303feef5b3839f4323d9beb36df0a9dd"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseRuntimeVersion(tc.out)
+			if err != nil {
+				t.Fatalf("parseRuntimeVersion failed: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("parseRuntimeVersion got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+
+	// Binaries without --version print their usage instead.
+	for _, out := range []string{"", "flag provided but not defined: -version\nUsage: runsc <flags> <subcommand> <subcommand args>\n"} {
+		if got, err := parseRuntimeVersion(out); err == nil {
+			t.Errorf("parseRuntimeVersion(%q) got %+v, want error", out, got)
+		}
+	}
+}
+
+func TestRuntimeVersionString(t *testing.T) {
+	for _, tc := range []struct {
+		v    runtimeVersion
+		want string
+	}{
+		{v: runtimeVersion{version: "release-20200622.1"}, want: "release-20200622.1"},
+		{v: runtimeVersion{version: "1.0.0-rc10", commit: "dc9208a"}, want: "1.0.0-rc10 (commit dc9208a)"},
+	} {
+		if got := tc.v.String(); got != tc.want {
+			t.Errorf("String got %q, want %q", got, tc.want)
+		}
+	}
+}
+
+func TestGetRuntimeVersion(t *testing.T) {
+	// A fake docker and runtime, on the local machine.
+	dir, err := ioutil.TempDir("", "version")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	writeScript(t, dir, "docker", `echo `+dir+`/runsc`)
+	writeScript(t, dir, "runsc", `[ "$1" = --version ] && echo "runsc version release-20200622.1-171-gc66991ad7de6"`)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+":"+os.Getenv("PATH"))
+
+	got, err := getRuntimeVersion(&localMachine{}, "runsc")
+	if err != nil {
+		t.Fatalf("getRuntimeVersion failed: %v", err)
+	}
+	if want := (runtimeVersion{version: "release-20200622.1-171-gc66991ad7de6", commit: "c66991ad7de6"}); got != want {
+		t.Errorf("getRuntimeVersion got %+v, want %+v", got, want)
+	}
+
+	// A runtime without --version is an error, not a crash.
+	writeScript(t, dir, "runsc", `echo "flag provided but not defined: -version" >&2; exit 2`)
+	if got, err := getRuntimeVersion(&localMachine{}, "runsc"); err == nil {
+		t.Errorf("getRuntimeVersion got %+v for a runtime without --version, want error", got)
+	}
+}
+
+// writeScript writes an executable shell script named name in dir.
+func writeScript(t *testing.T, dir, name, body string) {
+	t.Helper()
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+		t.Fatalf("ioutil.WriteFile failed: %v", err)
+	}
+}
@@ -0,0 +1,706 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+// abMaxRate bounds the rate of requests of ab runs with a duration, in
+// requests per second. ab allocates the statistics of every request up
+// front, so their number must be bounded; a single ab thread makes fewer
+// requests than this.
+const abMaxRate = 100000
+
+// runAb runs ab in client, making requests to url, concurrency at a time,
+// and returns its output. It makes the given number of requests, or, if
+// duration is set, as many as it can for duration. With keepAlive, it reuses
+// connections.
+func runAb(ctx context.Context, b *testing.B, client *dockerutil.Container, url string, requests, concurrency int, duration time.Duration, keepAlive bool) string {
+	// See apachebench (ab) for flags.
+	var cmd string
+	if duration > 0 {
+		secs := seconds(duration)
+		// -n must follow -t, which resets it to 50000.
+		cmd = fmt.Sprintf("ab -t %d -n %d -c %d", secs, secs*abMaxRate, concurrency)
+	} else {
+		// ab refuses more concurrency than requests.
+		if concurrency > requests {
+			concurrency = requests
+		}
+		cmd = fmt.Sprintf("ab -n %d -c %d", requests, concurrency)
+	}
+	if keepAlive {
+		cmd += " -k"
+	}
+	cmd += " " + url
+	out, err := client.Exec(ctx, dockerutil.ExecOpts{}, "sh", "-c", cmd)
+	if err != nil {
+		b.Fatalf("run failed with: %v: %s", err, out)
+	}
+	return out
+}
+
+// reportAb reports the metrics in the output of ab. It fails the benchmark
+// if any request failed, or got a non-2xx response unless notFound is set.
+// With keepAlive, the number of requests made over reused connections is
+// reported too.
+func reportAb(b *harness.Reporter, out string, notFound, keepAlive bool) {
+	// Fail on errors, which would otherwise be measured as if they were
+	// served.
+	failed, err := parseFailedRequests(out)
+	if err != nil {
+		b.Fatalf("failed to parse failed requests: %v", err)
+	}
+	b.ReportMetric(float64(failed), "failed_requests")
+	non2xx, err := parseNon2xx(out)
+	if err != nil {
+		b.Fatalf("failed to parse non-2xx responses: %v", err)
+	}
+	b.ReportMetric(float64(non2xx), "non2xx_responses")
+	if notFound {
+		non2xx = 0
+	}
+	if failed > 0 || non2xx > 0 {
+		b.Fatalf("%d requests failed and %d got non-2xx responses:\n%s", failed, non2xx, out)
+	}
+
+	// Parse and report custom metrics.
+	transferRate, err := parseTransferRate(out)
+	if err != nil {
+		b.Logf("failed to parse transfer rate: %v", err)
+	}
+	b.ReportMetric(transferRate*1024, "transfer_rate") // Convert from Kb/s to b/s.
+
+	stats, err := parseConnectionStats(out)
+	if err != nil {
+		b.Logf("failed to parse connection times: %v", err)
+	}
+	b.ReportMetric(stats.mean, "mean_latency[ms]")
+	b.ReportMetric(stats.stddev, "stddev_latency[ms]")
+	b.ReportMetric(stats.max, "max_latency[ms]")
+
+	ttfb, ttfbMax, err := parseWaitingTime(out)
+	if err != nil {
+		b.Logf("failed to parse waiting times: %v", err)
+	}
+	b.ReportMetric(ttfb, "mean_ttfb[ms]")
+	b.ReportMetric(ttfbMax, "max_ttfb[ms]")
+
+	reqPerSecond, err := parseRequestsPerSecond(out)
+	if err != nil {
+		b.Logf("failed to parse requests per second: %v", err)
+	}
+	b.ReportMetric(reqPerSecond, "requests_per_second")
+
+	if keepAlive {
+		keepAliveRequests, err := parseKeepAliveRequests(out)
+		if err != nil {
+			b.Logf("failed to parse keep-alive requests: %v", err)
+		}
+		b.ReportMetric(float64(keepAliveRequests), "keepalive_requests")
+	}
+
+	for _, pct := range []int{50, 90, 99} {
+		latency, err := parsePercentile(out, pct)
+		if err != nil {
+			b.Logf("failed to parse p%d latency: %v", pct, err)
+			continue
+		}
+		b.ReportMetric(latency, fmt.Sprintf("p%d_latency[ms]", pct))
+	}
+}
+
+var transferRateRE = regexp.MustCompile(`Transfer rate:\s+(\d+\.?\d*)\s+\[Kbytes/sec\]\s+received`)
+
+// parseTransferRate parses the transfer rate, in Kb/s, from ab output.
+func parseTransferRate(data string) (float64, error) {
+	match := transferRateRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, fmt.Errorf("failed to get transfer rate: %s", data)
+	}
+	return strconv.ParseFloat(match[1], 64)
+}
+
+// connectionStats are the statistics of the total time of requests, in ms,
+// from the connection times table of ab output.
+type connectionStats struct {
+	min    float64
+	mean   float64
+	stddev float64
+	median float64
+	max    float64
+}
+
+// abNumber matches the numbers of the connection times table, which ab
+// prints with or without a decimal part.
+const abNumber = `(\d+(?:\.\d+)?)`
+
+// connectionTimesRE returns a regexp matching row of the connection times
+// table of ab output, e.g. "Total".
+func connectionTimesRE(row string) *regexp.Regexp {
+	return regexp.MustCompile(`(?m)^` + row + `:\s+` + strings.Repeat(abNumber+`\s+`, 4) + abNumber + `\s*$`)
+}
+
+var (
+	connectionStatsRE = connectionTimesRE("Total")
+	waitingTimesRE    = connectionTimesRE("Waiting")
+)
+
+// parseConnectionStats parses the "Total:" row of the connection times table
+// from ab output.
+func parseConnectionStats(data string) (connectionStats, error) {
+	return parseConnectionTimes(data, connectionStatsRE)
+}
+
+// parseConnectionTimes parses the row of the connection times table matched
+// by re from ab output.
+func parseConnectionTimes(data string, re *regexp.Regexp) (connectionStats, error) {
+	match := re.FindStringSubmatch(data)
+	if len(match) < 6 {
+		return connectionStats{}, fmt.Errorf("failed to get connection times: %s", data)
+	}
+	var values [5]float64
+	for i := range values {
+		v, err := strconv.ParseFloat(match[i+1], 64)
+		if err != nil {
+			return connectionStats{}, err
+		}
+		values[i] = v
+	}
+	return connectionStats{
+		min:    values[0],
+		mean:   values[1],
+		stddev: values[2],
+		median: values[3],
+		max:    values[4],
+	}, nil
+}
+
+// parseWaitingTime parses the mean and max time to first byte, in ms, from
+// ab output: the "Waiting:" row of the connection times table, the time
+// from writing a request to reading the first byte of its response.
+func parseWaitingTime(data string) (mean, max float64, err error) {
+	stats, err := parseConnectionTimes(data, waitingTimesRE)
+	if err != nil {
+		return 0, 0, err
+	}
+	return stats.mean, stats.max, nil
+}
+
+// parseLatency parses the mean latency, in ms, from ab output.
+func parseLatency(data string) (float64, error) {
+	stats, err := parseConnectionStats(data)
+	if err != nil {
+		return 0, err
+	}
+	return stats.mean, nil
+}
+
+var completeRequestsRE = regexp.MustCompile(`Complete requests:\s+(\d+)`)
+
+// parseCompleteRequests parses the number of requests completed from ab
+// output, which is only known after the run if it had a duration.
+func parseCompleteRequests(data string) (int, error) {
+	match := completeRequestsRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, fmt.Errorf("failed to get complete requests: %s", data)
+	}
+	return strconv.Atoi(match[1])
+}
+
+var keepAliveRequestsRE = regexp.MustCompile(`Keep-Alive requests:\s+(\d+)`)
+
+// parseKeepAliveRequests parses the number of requests made over reused
+// connections from ab output, which is only printed with -k.
+func parseKeepAliveRequests(data string) (int, error) {
+	match := keepAliveRequestsRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, fmt.Errorf("failed to get keep-alive requests: %s", data)
+	}
+	return strconv.Atoi(match[1])
+}
+
+var requestsPerSecondRE = regexp.MustCompile(`Requests per second:\s+(\d+\.?\d*)\s+`)
+
+// parseRequestsPerSecond parses the requests per second from ab output.
+func parseRequestsPerSecond(data string) (float64, error) {
+	match := requestsPerSecondRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, fmt.Errorf("failed to get requests per second: %s", data)
+	}
+	return strconv.ParseFloat(match[1], 64)
+}
+
+var failedRequestsRE = regexp.MustCompile(`Failed requests:\s+(\d+)`)
+
+// parseFailedRequests parses the number of failed requests from ab output.
+func parseFailedRequests(data string) (int, error) {
+	match := failedRequestsRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, fmt.Errorf("failed to get failed requests: %s", data)
+	}
+	return strconv.Atoi(match[1])
+}
+
+var non2xxRE = regexp.MustCompile(`Non-2xx responses:\s+(\d+)`)
+
+// parseNon2xx parses the number of responses with a non-2xx status from ab
+// output. ab omits it if there are none.
+func parseNon2xx(data string) (int, error) {
+	match := non2xxRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, nil
+	}
+	return strconv.Atoi(match[1])
+}
+
+// percentileHeader starts the table of latency percentiles in ab output. ab
+// omits the table if all requests fail.
+const percentileHeader = "Percentage of the requests served within a certain time (ms)"
+
+var percentileRE = regexp.MustCompile(`(?m)^\s*(\d+)%\s+(\d+)`)
+
+// parsePercentile parses the pct percentile of latency, in ms, from ab
+// output.
+func parsePercentile(data string, pct int) (float64, error) {
+	i := strings.Index(data, percentileHeader)
+	if i < 0 {
+		return 0, fmt.Errorf("no percentile table: %s", data)
+	}
+	for _, match := range percentileRE.FindAllStringSubmatch(data[i:], -1) {
+		if match[1] == strconv.Itoa(pct) {
+			return strconv.ParseFloat(match[2], 64)
+		}
+	}
+	return 0, fmt.Errorf("no %d%% percentile: %s", pct, data)
+}
+
+// sampleData is sample output from ab.
+const sampleData = `This is ApacheBench, Version 2.3 <$Revision: 1826891 $>
+Copyright 1996 Adam Twiss, Zeus Technology Ltd, http://www.zeustech.net/
+Licensed to The Apache Software Foundation, http://www.apache.org/
+
+Benchmarking 10.10.10.10 (be patient).....done
+
+
+Server Software:        Apache/2.4.38
+Server Hostname:        10.10.10.10
+Server Port:            80
+
+Document Path:          /latin10k.txt
+Document Length:        210 bytes
+
+Concurrency Level:      1
+Time taken for tests:   0.180 seconds
+Complete requests:      100
+Failed requests:        0
+Non-2xx responses:      100
+Total transferred:      38800 bytes
+HTML transferred:       21000 bytes
+Requests per second:    556.44 [#/sec] (mean)
+Time per request:       1.797 [ms] (mean)
+Time per request:       1.797 [ms] (mean, across all concurrent requests)
+Transfer rate:          210.84 [Kbytes/sec] received
+
+Connection Times (ms)
+              min  mean[+/-sd] median   max
+Connect:        0    0   0.2      0       2
+Processing:     1    2   1.0      1       8
+Waiting:        1    1   1.0      1       7
+Total:          1    2   1.2      1      10
+
+Percentage of the requests served within a certain time (ms)
+  50%      1
+  66%      2
+  75%      2
+  80%      2
+  90%      2
+  95%      3
+  98%      7
+  99%     10
+ 100%     10 (longest request)`
+
+// allFailedSampleData is sample output from ab when all requests fail.
+const allFailedSampleData = `This is ApacheBench, Version 2.3 <$Revision: 1826891 $>
+Copyright 1996 Adam Twiss, Zeus Technology Ltd, http://www.zeustech.net/
+Licensed to The Apache Software Foundation, http://www.apache.org/
+
+Benchmarking 10.10.10.10 (be patient).....done
+
+
+Server Software:
+Server Hostname:        10.10.10.10
+Server Port:            80
+
+Document Path:          /latin10k.txt
+Document Length:        0 bytes
+
+Concurrency Level:      1
+Time taken for tests:   0.052 seconds
+Complete requests:      100
+Failed requests:        100
+   (Connect: 0, Receive: 0, Length: 0, Exceptions: 100)
+Total transferred:      0 bytes
+HTML transferred:       0 bytes
+Requests per second:    1923.08 [#/sec] (mean)
+Time per request:       0.520 [ms] (mean)
+Time per request:       0.520 [ms] (mean, across all concurrent requests)
+Transfer rate:          0.00 [Kbytes/sec] received`
+
+// durationSampleData is sample output from ab run with -t. Progress is
+// printed as requests complete, and the number of requests is only known at
+// the end.
+const durationSampleData = `This is ApacheBench, Version 2.3 <$Revision: 1826891 $>
+Copyright 1996 Adam Twiss, Zeus Technology Ltd, http://www.zeustech.net/
+Licensed to The Apache Software Foundation, http://www.apache.org/
+
+Benchmarking 10.10.10.10 (be patient)
+Completed 5000 requests
+Completed 10000 requests
+Completed 15000 requests
+Finished 17342 requests
+
+
+Server Software:        Apache/2.4.38
+Server Hostname:        10.10.10.10
+Server Port:            80
+
+Document Path:          /latin10k.txt
+Document Length:        10240 bytes
+
+Concurrency Level:      5
+Time taken for tests:   10.000 seconds
+Complete requests:      17342
+Failed requests:        0
+Total transferred:      182173710 bytes
+HTML transferred:       177582080 bytes
+Requests per second:    1734.19 [#/sec] (mean)
+Time per request:       2.883 [ms] (mean)
+Time per request:       0.577 [ms] (mean, across all concurrent requests)
+Transfer rate:          17790.21 [Kbytes/sec] received
+
+Connection Times (ms)
+              min  mean[+/-sd] median   max
+Connect:        0    0   0.1      0       3
+Processing:     1    3   1.4      2      31
+Waiting:        0    2   1.3      2      30
+Total:          1    3   1.4      3      31
+
+Percentage of the requests served within a certain time (ms)
+  50%      3
+  66%      3
+  75%      3
+  80%      3
+  90%      4
+  95%      5
+  98%      7
+  99%      9
+ 100%     31 (longest request)`
+
+// TestDurationParsers checks the parsers of the number of requests completed
+// work, including with the output of runs with a duration.
+func TestDurationParsers(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data string
+		want int
+	}{
+		{
+			name: "requests",
+			data: sampleData,
+			want: 100,
+		},
+		{
+			name: "duration",
+			data: durationSampleData,
+			want: 17342,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseCompleteRequests(tc.data)
+			if err != nil {
+				t.Fatalf("failed to parse complete requests with error: %v", err)
+			} else if got != tc.want {
+				t.Errorf("parseCompleteRequests got: %d, want: %d", got, tc.want)
+			}
+		})
+	}
+	if got, err := parseCompleteRequests("garbage"); err == nil {
+		t.Errorf("parseCompleteRequests got: %d for garbage, want error", got)
+	}
+
+	// The other metrics are parsed as without a duration.
+	if got, err := parseRequestsPerSecond(durationSampleData); err != nil || got != 1734.19 {
+		t.Errorf("parseRequestsPerSecond got: %f, %v, want: 1734.19", got, err)
+	}
+	want := connectionStats{min: 1, mean: 3, stddev: 1.4, median: 3, max: 31}
+	if got, err := parseConnectionStats(durationSampleData); err != nil || got != want {
+		t.Errorf("parseConnectionStats got: %+v, %v, want: %+v", got, err, want)
+	}
+
+	for _, tc := range []struct {
+		d    time.Duration
+		want int
+	}{
+		{d: time.Second, want: 1},
+		{d: 1500 * time.Millisecond, want: 2},
+		{d: time.Millisecond, want: 1},
+	} {
+		if got := seconds(tc.d); got != tc.want {
+			t.Errorf("seconds(%v) got: %d, want: %d", tc.d, got, tc.want)
+		}
+	}
+}
+
+// TestKeepAliveParsers checks the parsers work with the output of ab run with
+// -k, which has an extra line.
+func TestKeepAliveParsers(t *testing.T) {
+	data := strings.Replace(sampleData, "Failed requests:        0\n", "Failed requests:        0\nKeep-Alive requests:    100\n", 1)
+	if got, err := parseKeepAliveRequests(data); err != nil {
+		t.Errorf("failed to parse keep-alive requests with error: %v", err)
+	} else if got != 100 {
+		t.Errorf("parseKeepAliveRequests got: %d, want: 100", got)
+	}
+	if got, err := parseKeepAliveRequests(sampleData); err == nil {
+		t.Errorf("parseKeepAliveRequests got: %d without -k, want error", got)
+	}
+
+	if got, err := parseFailedRequests(data); err != nil || got != 0 {
+		t.Errorf("parseFailedRequests got: %d, %v, want: 0", got, err)
+	}
+	if got, err := parseCompleteRequests(data); err != nil || got != 100 {
+		t.Errorf("parseCompleteRequests got: %d, %v, want: 100", got, err)
+	}
+	if got, err := parseRequestsPerSecond(data); err != nil || got != 556.44 {
+		t.Errorf("parseRequestsPerSecond got: %f, %v, want: 556.44", got, err)
+	}
+	if got, err := parseLatency(data); err != nil || got != 2 {
+		t.Errorf("parseLatency got: %f, %v, want: 2", got, err)
+	}
+}
+
+// TestParsers checks the parsers work.
+func TestParsers(t *testing.T) {
+	want := 210.84
+	got, err := parseTransferRate(sampleData)
+	if err != nil {
+		t.Fatalf("failed to parse transfer rate with error: %v", err)
+	} else if got != want {
+		t.Fatalf("parseTransferRate got: %f, want: %f", got, want)
+	}
+
+	want = 2.0
+	got, err = parseLatency(sampleData)
+	if err != nil {
+		t.Fatalf("failed to parse latency with error: %v", err)
+	} else if got != want {
+		t.Fatalf("parseLatency got: %f, want: %f", got, want)
+	}
+
+	want = 556.44
+	got, err = parseRequestsPerSecond(sampleData)
+	if err != nil {
+		t.Fatalf("failed to parse requests per second with error: %v", err)
+	} else if got != want {
+		t.Fatalf("parseRequestsPerSecond got: %f, want: %f", got, want)
+	}
+
+	for pct, want := range map[int]float64{50: 1, 90: 2, 99: 10, 100: 10} {
+		got, err := parsePercentile(sampleData, pct)
+		if err != nil {
+			t.Fatalf("failed to parse %d%% percentile with error: %v", pct, err)
+		} else if got != want {
+			t.Fatalf("parsePercentile(%d) got: %f, want: %f", pct, got, want)
+		}
+	}
+	if got, err := parsePercentile(sampleData, 42); err == nil {
+		t.Fatalf("parsePercentile(42) got: %f, want error", got)
+	}
+	if got, err := parsePercentile(allFailedSampleData, 50); err == nil {
+		t.Fatalf("parsePercentile got: %f without a percentile table, want error", got)
+	}
+}
+
+// TestConnectionStats checks parseConnectionStats works with the connection
+// times tables of several ab runs.
+func TestConnectionStats(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data string
+		want connectionStats
+	}{
+		{
+			name: "sample",
+			data: sampleData,
+			want: connectionStats{min: 1, mean: 2, stddev: 1.2, median: 1, max: 10},
+		},
+		{
+			// Requests to a local server connect in under a millisecond.
+			name: "zero connect max",
+			data: `Connection Times (ms)
+              min  mean[+/-sd] median   max
+Connect:        0    0   0.0      0       0
+Processing:     0    0   0.1      0       1
+Waiting:        0    0   0.1      0       1
+Total:          0    0   0.1      0       1
+
+Percentage of the requests served within a certain time (ms)
+  50%      0
+ 100%      1 (longest request)`,
+			want: connectionStats{max: 1, stddev: 0.1},
+		},
+		{
+			// The total is the last row when ab prints no percentiles, e.g.
+			// with -d.
+			name: "end of output",
+			data: `Connection Times (ms)
+              min  mean[+/-sd] median   max
+Connect:        0    1   0.8      1       5
+Processing:    12   48  20.5     45     212
+Waiting:       11   47  20.4     44     211
+Total:         13   49  20.6     46     213`,
+			want: connectionStats{min: 13, mean: 49, stddev: 20.6, median: 46, max: 213},
+		},
+		{
+			name: "decimal mean",
+			data: "Total:          1    1.2   0.4      1      10\n",
+			want: connectionStats{min: 1, mean: 1.2, stddev: 0.4, median: 1, max: 10},
+		},
+		{
+			name: "slow server",
+			data: `Connection Times (ms)
+              min  mean[+/-sd] median   max
+Connect:        0    3  12.1      1    1031
+Processing:    96 1204 321.9   1187    3320
+Waiting:       95 1203 321.9   1186    3319
+Total:         97 1207 322.4   1190    3321
+`,
+			want: connectionStats{min: 97, mean: 1207, stddev: 322.4, median: 1190, max: 3321},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseConnectionStats(tc.data)
+			if err != nil {
+				t.Fatalf("failed to parse connection times with error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("parseConnectionStats got: %+v, want: %+v", got, tc.want)
+			}
+		})
+	}
+
+	for _, data := range []string{allFailedSampleData, "Total:          1    2"} {
+		if got, err := parseConnectionStats(data); err == nil {
+			t.Errorf("parseConnectionStats got: %+v for %q, want error", got, data)
+		}
+	}
+}
+
+// TestWaitingTime checks parseWaitingTime gets the time to first byte from
+// the Waiting row, and not from the others.
+func TestWaitingTime(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		data      string
+		mean, max float64
+	}{
+		{name: "sample", data: sampleData, mean: 1, max: 7},
+		{
+			name: "slow server",
+			data: `Connection Times (ms)
+              min  mean[+/-sd] median   max
+Connect:        0    3  12.1      1    1031
+Processing:    96 1204 321.9   1187    3320
+Waiting:       95 1203.5 321.9   1186    3319
+Total:         97 1207 322.4   1190    3321
+`,
+			mean: 1203.5,
+			max:  3319,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mean, max, err := parseWaitingTime(tc.data)
+			if err != nil {
+				t.Fatalf("failed to parse waiting time with error: %v", err)
+			}
+			if mean != tc.mean || max != tc.max {
+				t.Errorf("parseWaitingTime got: %f, %f, want: %f, %f", mean, max, tc.mean, tc.max)
+			}
+		})
+	}
+
+	for _, data := range []string{allFailedSampleData, "Waiting:        1    2"} {
+		if mean, max, err := parseWaitingTime(data); err == nil {
+			t.Errorf("parseWaitingTime got: %f, %f for %q, want error", mean, max, data)
+		}
+	}
+}
+
+// TestFailureParsers checks the parsers of failures work, with and without
+// failures.
+func TestFailureParsers(t *testing.T) {
+	// ab omits the count of non-2xx responses if there are none.
+	successSampleData := strings.Replace(sampleData, "Non-2xx responses:      100\n", "", 1)
+	for _, tc := range []struct {
+		name   string
+		data   string
+		failed int
+		non2xx int
+	}{
+		{
+			name: "success",
+			data: successSampleData,
+		},
+		{
+			name:   "non-2xx",
+			data:   sampleData,
+			non2xx: 100,
+		},
+		{
+			name:   "all failed",
+			data:   allFailedSampleData,
+			failed: 100,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			failed, err := parseFailedRequests(tc.data)
+			if err != nil {
+				t.Fatalf("failed to parse failed requests with error: %v", err)
+			} else if failed != tc.failed {
+				t.Errorf("parseFailedRequests got: %d, want: %d", failed, tc.failed)
+			}
+			non2xx, err := parseNon2xx(tc.data)
+			if err != nil {
+				t.Fatalf("failed to parse non-2xx responses with error: %v", err)
+			} else if non2xx != tc.non2xx {
+				t.Errorf("parseNon2xx got: %d, want: %d", non2xx, tc.non2xx)
+			}
+		})
+	}
+
+	if got, err := parseFailedRequests("garbage"); err == nil {
+		t.Errorf("parseFailedRequests got: %d for garbage, want error", got)
+	}
+}
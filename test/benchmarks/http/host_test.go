@@ -0,0 +1,390 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+// hostLoad drives load from the benchmark process itself, for
+// --client-on-host. Like ab, it opens a connection per request unless
+// keepAlive is set.
+type hostLoad struct {
+	// url is requested.
+	url string
+
+	// concurrency is the number of requests in flight at a time.
+	concurrency int
+
+	// requests is the number of requests to make, if not zero.
+	requests int
+
+	// duration bounds the time spent making requests, if not zero.
+	duration time.Duration
+
+	// keepAlive makes requests reuse connections.
+	keepAlive bool
+}
+
+// hostResult is the result of a hostLoad run.
+type hostResult struct {
+	// elapsed is the duration of the whole run.
+	elapsed time.Duration
+
+	// latencies are the durations of the successful requests, including
+	// reading their response, in the order they completed.
+	latencies []time.Duration
+
+	// failed is the number of requests that failed without a response, and
+	// non2xx the number of responses that weren't 2xx.
+	failed int
+	non2xx int
+
+	// bytes is the size of the bodies received.
+	bytes int64
+}
+
+// run makes the requests of l, concurrency at a time, until requests were
+// made, duration passed or ctx is done.
+func (l hostLoad) run(ctx context.Context) hostResult {
+	if l.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.duration)
+		defer cancel()
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			DisableKeepAlives: !l.keepAlive,
+			// Every request in flight keeps its connection.
+			MaxIdleConnsPerHost: l.concurrency,
+			// As with ab and wrk, certificates are not verified.
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	var (
+		started int64
+		mu      sync.Mutex
+		res     hostResult
+		wg      sync.WaitGroup
+	)
+	start := time.Now()
+	for i := 0; i < l.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				if l.requests > 0 && atomic.AddInt64(&started, 1) > int64(l.requests) {
+					return
+				}
+				latency, n, code, err := l.request(ctx, client)
+				if err != nil && ctx.Err() != nil {
+					// Cut short by the end of the run.
+					return
+				}
+				mu.Lock()
+				switch {
+				case err != nil:
+					res.failed++
+				case code < 200 || code > 299:
+					res.non2xx++
+					fallthrough
+				default:
+					res.latencies = append(res.latencies, latency)
+					res.bytes += n
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	res.elapsed = time.Since(start)
+	return res
+}
+
+// request makes a single request, and returns its latency, the size of the
+// body received and the status code of the response.
+func (l hostLoad) request(ctx context.Context, client *http.Client) (time.Duration, int64, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.url, nil)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer resp.Body.Close()
+	n, err := io.Copy(ioutil.Discard, resp.Body)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return time.Since(start), n, resp.StatusCode, nil
+}
+
+// meanLatency returns the mean latency of the successful requests.
+func (r hostResult) meanLatency() time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	var sum time.Duration
+	for _, l := range r.latencies {
+		sum += l
+	}
+	return sum / time.Duration(len(r.latencies))
+}
+
+// percentile returns the pct percentile of the latencies of the successful
+// requests, by the nearest-rank method.
+func (r hostResult) percentile(pct int) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), r.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := (pct*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// requestsPerSecond returns the rate of successful requests over the run.
+func (r hostResult) requestsPerSecond() float64 {
+	if r.elapsed <= 0 {
+		return 0
+	}
+	return float64(len(r.latencies)) / r.elapsed.Seconds()
+}
+
+// completed returns the number of requests completed, as ab counts them:
+// including failed ones.
+func (r hostResult) completed() int {
+	return len(r.latencies) + r.failed
+}
+
+// transferRate returns the rate of bytes received over the run, in b/s.
+func (r hostResult) transferRate() float64 {
+	if r.elapsed <= 0 {
+		return 0
+	}
+	return float64(r.bytes) / r.elapsed.Seconds()
+}
+
+// runHost makes requests to url, concurrency at a time, from the benchmark
+// process. It makes the given number of requests, or, if duration is set, as
+// many as it can for duration. With keepAlive, it reuses connections.
+func runHost(ctx context.Context, url string, requests, concurrency int, duration time.Duration, keepAlive bool) hostResult {
+	l := hostLoad{
+		url:         url,
+		concurrency: concurrency,
+		requests:    requests,
+		keepAlive:   keepAlive,
+	}
+	if duration > 0 {
+		l.requests = 0
+		l.duration = duration
+	}
+	return l.run(ctx)
+}
+
+// reportHost reports the metrics of r, as reportAb does for ab.
+func reportHost(b *harness.Reporter, r hostResult, notFound bool) {
+	b.ReportMetric(float64(r.failed), "failed_requests")
+	b.ReportMetric(float64(r.non2xx), "non2xx_responses")
+	non2xx := r.non2xx
+	if notFound {
+		non2xx = 0
+	}
+	if r.failed > 0 || non2xx > 0 {
+		b.Fatalf("%d requests failed and %d got non-2xx responses", r.failed, non2xx)
+	}
+
+	b.ReportMetric(r.transferRate(), "transfer_rate")
+	b.ReportMetric(float64(r.meanLatency())/float64(time.Millisecond), "mean_latency[ms]")
+	b.ReportMetric(r.requestsPerSecond(), "requests_per_second")
+	for _, pct := range []int{50, 90, 99} {
+		b.ReportMetric(float64(r.percentile(pct))/float64(time.Millisecond), fmt.Sprintf("p%d_latency[ms]", pct))
+	}
+}
+
+// waitUntilServingOnHost waits, for at most timeout, for a server to accept
+// connections at addr from the benchmark process. With useTLS, the server must
+// also complete a TLS handshake.
+func waitUntilServingOnHost(addr string, useTLS bool, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	dialer := &net.Dialer{Timeout: time.Second}
+	for {
+		var (
+			conn net.Conn
+			err  error
+		)
+		if useTLS {
+			conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{InsecureSkipVerify: true})
+		} else {
+			conn, err = dialer.Dial("tcp", addr)
+		}
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("server at %s not serving after %v: %v", addr, timeout, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestHostResult(t *testing.T) {
+	var latencies []time.Duration
+	for i := 100; i > 0; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	r := hostResult{
+		elapsed:   2 * time.Second,
+		latencies: latencies,
+		bytes:     1000,
+	}
+	if got, want := r.meanLatency(), 50500*time.Microsecond; got != want {
+		t.Errorf("meanLatency got %v, want %v", got, want)
+	}
+	for pct, want := range map[int]time.Duration{
+		0:   time.Millisecond,
+		50:  50 * time.Millisecond,
+		90:  90 * time.Millisecond,
+		99:  99 * time.Millisecond,
+		100: 100 * time.Millisecond,
+	} {
+		if got := r.percentile(pct); got != want {
+			t.Errorf("percentile(%d) got %v, want %v", pct, got, want)
+		}
+	}
+	if got, want := r.requestsPerSecond(), 50.0; got != want {
+		t.Errorf("requestsPerSecond got %f, want %f", got, want)
+	}
+	if got, want := r.transferRate(), 500.0; got != want {
+		t.Errorf("transferRate got %f, want %f", got, want)
+	}
+	r.failed = 3
+	if got, want := r.completed(), 103; got != want {
+		t.Errorf("completed got %d, want %d", got, want)
+	}
+
+	// Nothing is measured without successful requests.
+	var empty hostResult
+	if got := empty.meanLatency(); got != 0 {
+		t.Errorf("meanLatency got %v without requests, want 0", got)
+	}
+	if got := empty.percentile(50); got != 0 {
+		t.Errorf("percentile(50) got %v without requests, want 0", got)
+	}
+}
+
+func TestHostLoad(t *testing.T) {
+	const delay = 10 * time.Millisecond
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		time.Sleep(delay)
+		if r.URL.Path == "/notfound" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "hello")
+	}))
+	defer server.Close()
+
+	r := hostLoad{url: server.URL + "/doc", concurrency: 4, requests: 20}.run(context.Background())
+	if got := atomic.LoadInt64(&requests); got != 20 {
+		t.Errorf("server got %d requests, want 20", got)
+	}
+	if len(r.latencies) != 20 || r.failed != 0 || r.non2xx != 0 {
+		t.Errorf("got %d successful, %d failed and %d non-2xx requests, want 20 successful", len(r.latencies), r.failed, r.non2xx)
+	}
+	for _, l := range r.latencies {
+		if l < delay {
+			t.Errorf("got latency %v, want at least the server's delay %v", l, delay)
+		}
+	}
+	if r.bytes != 20*int64(len("hello")) {
+		t.Errorf("got %d bytes, want %d", r.bytes, 20*len("hello"))
+	}
+	// The requests are concurrent.
+	if max := 20 * delay; r.elapsed >= max {
+		t.Errorf("run took %v, want less than %v", r.elapsed, max)
+	}
+
+	r = hostLoad{url: server.URL + "/notfound", concurrency: 2, requests: 4}.run(context.Background())
+	if r.non2xx != 4 {
+		t.Errorf("got %d non-2xx responses, want 4", r.non2xx)
+	}
+
+	// The run ends after its duration without a number of requests.
+	r = hostLoad{url: server.URL + "/doc", concurrency: 2, duration: 100 * time.Millisecond}.run(context.Background())
+	if r.elapsed > time.Second || len(r.latencies) == 0 {
+		t.Errorf("duration run took %v for %d requests, want about 100ms", r.elapsed, len(r.latencies))
+	}
+
+	server.Close()
+	r = hostLoad{url: server.URL + "/doc", concurrency: 1, requests: 2}.run(context.Background())
+	if r.failed != 2 {
+		t.Errorf("got %d failed requests to a closed server, want 2", r.failed)
+	}
+}
+
+func TestHostLoadKeepAlive(t *testing.T) {
+	var conns int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello")
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	for _, tc := range []struct {
+		keepAlive bool
+		want      int64
+	}{
+		{keepAlive: false, want: 10},
+		{keepAlive: true, want: 1},
+	} {
+		atomic.StoreInt64(&conns, 0)
+		r := hostLoad{url: server.URL, concurrency: 1, requests: 10, keepAlive: tc.keepAlive}.run(context.Background())
+		if len(r.latencies) != 10 {
+			t.Errorf("keepAlive %t: got %d successful requests, want 10", tc.keepAlive, len(r.latencies))
+		}
+		if got := atomic.LoadInt64(&conns); got != tc.want {
+			t.Errorf("keepAlive %t: got %d connections, want %d", tc.keepAlive, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,547 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+// h is the harness of the benchmarks.
+var h harness.Harness
+
+var clientOnHost = flag.Bool("client-on-host", false, "make requests from the benchmark process rather than from a client container; the server must run on the local machine")
+
+var benchmarkDuration = flag.Duration("benchmark-duration", 0, "run the load of each measured run for this long, rather than for b.N requests, and report ns/op per request completed; implies -test.benchtime=1x unless it is set")
+
+var httpGenerator = flag.String("http-generator", "", "HTTP load generator: ab or wrk; defaults to ab for low concurrency and wrk otherwise")
+
+// docs are the documents served by the benchmark servers, by size.
+var docs = map[string]string{
+	"notfound": "notfound",
+	"1Kb":      "latin1k.txt",
+	"10Kb":     "latin10k.txt",
+	"100Kb":    "latin100k.txt",
+	"1000Kb":   "latin1000k.txt",
+	"1Mb":      "latin1024k.txt",
+	"10Mb":     "latin10240k.txt",
+}
+
+// docNames returns the names of the docs, sorted.
+func docNames() []string {
+	var names []string
+	for name := range docs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sweep holds the parameters swept by the benchmarks of a server, which can
+// be overridden with flags.
+type sweep struct {
+	// threads are the client concurrencies of its Threads benchmark.
+	threads harness.IntsFlag
+
+	// docs are the names of the docs of its DocSize benchmark.
+	docs harness.StringsFlag
+}
+
+// newSweep returns the default sweep of the server name, and registers the
+// flags overriding it: --<name>-threads and --<name>-docs.
+func newSweep(name string) *sweep {
+	s := &sweep{
+		threads: harness.IntsFlag{1, 5, 10, 25},
+		docs: harness.StringsFlag{
+			Values:  docNames(),
+			Allowed: docNames(),
+		},
+	}
+	flag.Var(&s.threads, name+"-threads", fmt.Sprintf("comma-separated client concurrencies of the %s threads benchmarks", name))
+	flag.Var(&s.docs, name+"-docs", fmt.Sprintf("comma-separated docs of the %s doc size benchmarks, among %s", name, strings.Join(docNames(), ",")))
+	return s
+}
+
+// getMachines returns the machines running the client and the server.
+func getMachines(b *testing.B) (harness.Machine, harness.Machine) {
+	clientMachine, err := h.GetClientMachine()
+	if err != nil {
+		b.Fatalf("failed to get client machine: %v", err)
+	}
+	serverMachine, err := h.GetMachine()
+	if err != nil {
+		clientMachine.CleanUp()
+		b.Fatalf("failed to get server machine: %v", err)
+	}
+	return clientMachine, serverMachine
+}
+
+// ServerSpec describes an HTTP server for startServer.
+type ServerSpec struct {
+	// Image is the image of the server, as for RunOpts.Image.
+	Image string
+
+	// Port is the port the server listens on.
+	Port int
+
+	// Env are additional environment variables of the server.
+	Env []string
+
+	// Cmd runs the server in the foreground. The docs should be copied from
+	// /local to the directory they are served from first, so that they are
+	// not served from the image's filesystem.
+	Cmd []string
+
+	// Files are copied into the server's container at FilesDir with
+	// CopyFiles, e.g. the sources of an app. They are paths relative to the
+	// repository's root, and must be in the test's data.
+	Files    []string
+	FilesDir string
+
+	// TLS is set if the server serves HTTPS rather than HTTP.
+	TLS bool
+
+	// Timeout bounds each run of the benchmarks of the server, on top of
+	// --benchmark-duration: a run that takes longer fails, with
+	// diagnostics. Zero means defaultRunTimeout.
+	Timeout time.Duration
+}
+
+// defaultRunTimeout is the default of ServerSpec.Timeout.
+const defaultRunTimeout = 10 * time.Minute
+
+// serverBench is a server, and the clients loading it, shared by the
+// sub-benchmarks of a benchmark. They are kept alive across the runs of each
+// sub-benchmark, so that setting them up is not measured.
+type serverBench struct {
+	clientMachine harness.Machine
+	serverMachine harness.Machine
+
+	// server is the server's container, listening at ip:port.
+	server *dockerutil.Container
+	ip     net.IP
+	port   int
+
+	// hostPort is the port of the server published on the local machine,
+	// with --client-on-host.
+	hostPort int
+
+	// scheme is the scheme of the URLs of the server: http or https.
+	scheme string
+
+	// cpus is the partition of CPUs between the server and the clients.
+	cpus harness.CPUPartition
+
+	// clientCPUs is the number of CPUs available to the clients.
+	clientCPUs int
+
+	// timeout bounds each run, as ServerSpec.Timeout.
+	timeout time.Duration
+
+	// clients are the pools of client containers, by load generator. They
+	// are created on first use, and each run checks a container out, so
+	// that the load generator is execed in the same container every time.
+	clients map[string]*dockerutil.ContainerPool
+}
+
+// startServer starts the server described by spec, and waits for it to
+// serve. The returned serverBench must be cleaned up.
+func startServer(b *testing.B, spec ServerSpec) *serverBench {
+	ctx := h.Context()
+	clientMachine, serverMachine := getMachines(b)
+	s := &serverBench{
+		clientMachine: clientMachine,
+		serverMachine: serverMachine,
+		scheme:        "http",
+		timeout:       spec.Timeout,
+		clients:       make(map[string]*dockerutil.ContainerPool),
+	}
+	if s.timeout == 0 {
+		s.timeout = defaultRunTimeout
+	}
+	if spec.TLS {
+		s.scheme = "https"
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			s.cleanUp()
+		}
+	}()
+
+	var err error
+	s.cpus, err = h.CPUPartition(clientMachine, serverMachine)
+	if err != nil {
+		b.Fatalf("failed to partition CPUs: %v", err)
+	}
+
+	s.server = serverMachine.GetContainer(ctx, b)
+	opts := dockerutil.RunOpts{
+		Image: spec.Image,
+		Ports: []int{spec.Port},
+		Env:   spec.Env,
+	}
+	s.cpus.ApplyServer(&opts)
+	if len(spec.Files) > 0 {
+		s.server.CopyFiles(&opts, spec.FilesDir, spec.Files...)
+	}
+	if err := s.server.Spawn(ctx, opts, spec.Cmd...); err != nil {
+		b.Fatalf("failed to start server: %v", err)
+	}
+	if err := harness.VerifyRuntime(ctx, s.server); err != nil {
+		b.Fatalf("server runs under the wrong runtime: %v", err)
+	}
+
+	s.ip, s.port, err = serverMachine.PublishedAddr(ctx, s.server, spec.Port)
+	if err != nil {
+		b.Fatalf("failed to find server address: %v", err)
+	}
+	// The server is probed until it is up only, rather than with a health
+	// check, which docker would keep running in the server's container
+	// while it is measured.
+	if *clientOnHost {
+		// The server is probed from the benchmark process too, so that
+		// no container is needed.
+		s.hostPort, err = s.server.FindPort(ctx, spec.Port)
+		if err != nil {
+			b.Fatalf("failed to find server's published port: %v", err)
+		}
+		if err := waitUntilServingOnHost(fmt.Sprintf("127.0.0.1:%d", s.hostPort), spec.TLS, time.Minute); err != nil {
+			b.Fatalf("server did not start: %v", err)
+		}
+	} else {
+		utility, err := clientMachine.UtilityContainer(ctx)
+		if err != nil {
+			b.Fatalf("failed to get utility container: %v", err)
+		}
+		wait := harness.WaitUntilServing
+		if spec.TLS {
+			wait = harness.WaitUntilServingTLS
+		}
+		if err := wait(ctx, utility, s.server, s.ip, s.port, time.Minute); err != nil {
+			b.Fatalf("server did not start: %v", err)
+		}
+	}
+
+	info, err := clientMachine.Info()
+	if err != nil {
+		b.Fatalf("failed to get client machine info: %v", err)
+	}
+	s.clientCPUs = info.CPUs
+	if s.cpus.Pinned() {
+		s.clientCPUs = s.cpus.ClientCPUs
+	}
+	ok = true
+	return s
+}
+
+// cleanUp cleans up the server, the clients and the machines.
+func (s *serverBench) cleanUp() {
+	ctx := context.Background()
+	for _, pool := range s.clients {
+		pool.Close(ctx)
+	}
+	if s.server != nil {
+		s.server.CleanUp(ctx)
+	}
+	s.clientMachine.CleanUp()
+	s.serverMachine.CleanUp()
+}
+
+// clientPool returns the pool of containers to run the load generator gen
+// in.
+func (s *serverBench) clientPool(ctx context.Context, b *testing.B, gen string) *dockerutil.ContainerPool {
+	if pool, ok := s.clients[gen]; ok {
+		return pool
+	}
+	opts := dockerutil.RunOpts{
+		Image: generatorImages[gen],
+	}
+	s.cpus.ApplyClient(&opts)
+	// A single client loads the server at a time. It execs the load
+	// generator for each run.
+	pool, err := dockerutil.NewContainerPoolWith(ctx, b, 1, s.clientMachine.GetClientContainer, opts, "sleep", "infinity")
+	if err != nil {
+		b.Fatalf("failed to start client: %v", err)
+	}
+	s.clients[gen] = pool
+	return pool
+}
+
+// warmupRequests is the number of requests warming up a server.
+const warmupRequests = 100
+
+// run runs a single benchmark: b.N requests to doc, concurrency at a time,
+// or as many as complete in --benchmark-duration if set. ns/op is the time
+// per request. Each request opens a connection, unless keepAlive is set, in
+// which case connections are reused. Unless disabled with --benchmark-warmup,
+// the server is first warmed up with unmeasured requests. The peak memory of
+// the server under load is reported too, as well as the memory of its sandbox
+// after the run if it runs locally, and with --collect-server-stats its CPU
+// usage. The server is profiled as requested by the --pprof flags.
+//
+// The run fails if it takes longer than the server's timeout.
+func (s *serverBench) run(b *testing.B, doc string, concurrency int, keepAlive bool) {
+	h.RunWithTimeout(b, s.timeout+*benchmarkDuration, func(ctx context.Context) {
+		s.runWithContext(ctx, b, doc, concurrency, keepAlive)
+	})
+}
+
+// runWithContext is run, with a context bounding the run.
+func (s *serverBench) runWithContext(ctx context.Context, b *testing.B, doc string, concurrency int, keepAlive bool) {
+	b.StopTimer()
+	gen := loadGenerator(concurrency)
+	var client *dockerutil.Container
+	url := fmt.Sprintf("%s://%s:%d/%s", s.scheme, s.ip, s.port, doc)
+	if gen == "host" {
+		url = fmt.Sprintf("%s://127.0.0.1:%d/%s", s.scheme, s.hostPort, doc)
+	} else {
+		pool := s.clientPool(ctx, b, gen)
+		var err error
+		if client, err = pool.Get(ctx); err != nil {
+			b.Fatalf("failed to get client: %v", err)
+		}
+		// Leftovers of the run, e.g. a load generator that timed out, are
+		// cleared before the next one, even if ctx is done by then.
+		defer func() {
+			if err := pool.Put(h.Context(), client); err != nil {
+				b.Errorf("failed to return client: %v", err)
+			}
+		}()
+	}
+	// The notfound doc intentionally gets 404 responses.
+	notFound := doc == docs["notfound"]
+	// wrk runs a thread per CPU at most, each handling a share of the
+	// connections.
+	threads := concurrency
+	if threads > s.clientCPUs {
+		threads = s.clientCPUs
+	}
+
+	if h.Warmup() {
+		// The output is discarded: only the server's state matters.
+		switch gen {
+		case "ab":
+			runAb(ctx, b, client, url, warmupRequests, concurrency, 0, keepAlive)
+		case "wrk":
+			runWrk(ctx, b, client, url, threads, concurrency, warmupRequests, 0, keepAlive)
+		case "host":
+			runHost(ctx, url, warmupRequests, concurrency, 0, keepAlive)
+		}
+	}
+
+	var sampler *harness.CPUSampler
+	if h.CollectServerStats() {
+		sampler = harness.SampleCPU(ctx, s.server)
+	}
+	rssSampler := harness.SampleRSS(ctx, s.server)
+	stopProfile := h.StartProfile(ctx, b, s.server)
+	duration := *benchmarkDuration
+	b.ResetTimer()
+	b.StartTimer()
+	start := time.Now()
+	var (
+		out        string
+		hostResult hostResult
+	)
+	switch gen {
+	case "ab":
+		out = runAb(ctx, b, client, url, b.N, concurrency, duration, keepAlive)
+	case "wrk":
+		out = runWrk(ctx, b, client, url, threads, concurrency, b.N, duration, keepAlive)
+	case "host":
+		hostResult = runHost(ctx, url, b.N, concurrency, duration, keepAlive)
+	}
+	b.StopTimer()
+	elapsed := time.Since(start)
+	stopProfile()
+	r := h.Reporter(b)
+	if sampler != nil {
+		reportServerCPU(r, sampler)
+	}
+	reportServerRSS(r, rssSampler)
+	if harness.IsLocal(s.serverMachine) {
+		reportSandboxRSS(ctx, r, s.server)
+	}
+	switch gen {
+	case "ab":
+		reportAb(r, out, notFound, keepAlive)
+	case "wrk":
+		reportWrk(r, out, notFound)
+	case "host":
+		reportHost(r, hostResult, notFound)
+	}
+	if duration > 0 {
+		var (
+			completed int
+			err       error
+		)
+		switch gen {
+		case "ab":
+			completed, err = parseCompleteRequests(out)
+		case "wrk":
+			completed, err = parseWrkRequests(out)
+		case "host":
+			completed = hostResult.completed()
+		}
+		if err != nil {
+			b.Fatalf("failed to parse completed requests: %v", err)
+		}
+		reportCompleted(r, completed, elapsed)
+	}
+
+	// Dashboards segment results by whether they were warmed up.
+	var warmedUp float64
+	if h.Warmup() {
+		warmedUp = 1
+	}
+	r.ReportMetric(warmedUp, "warmup")
+	// Likewise by whether the client ran on the host.
+	var onHost float64
+	if gen == "host" {
+		onHost = 1
+	}
+	r.ReportMetric(onHost, "client_on_host")
+	// Likewise by whether connections were reused.
+	var keptAlive float64
+	if keepAlive {
+		keptAlive = 1
+	}
+	r.ReportMetric(keptAlive, "keepalive")
+	s.cpus.Report(r)
+	r.Finish()
+}
+
+// reportServerCPU stops sampler, and reports the CPU usage of the server it
+// sampled.
+func reportServerCPU(b *harness.Reporter, sampler *harness.CPUSampler) {
+	avg, peak, err := sampler.Stop()
+	if err != nil {
+		// Runs shorter than the daemon's sampling interval are expected
+		// at low b.N.
+		b.Logf("failed to get server CPU usage: %v", err)
+		return
+	}
+	b.ReportMetric(avg, "serverCPU[cores]")
+	b.ReportMetric(peak, "serverPeakCPU[cores]")
+}
+
+// reportServerRSS stops sampler, and reports the peak resident memory of the
+// server it sampled.
+func reportServerRSS(b *harness.Reporter, sampler *harness.RSSSampler) {
+	rss, err := sampler.Stop()
+	if err != nil {
+		b.Logf("failed to get server memory usage: %v", err)
+		return
+	}
+	b.ReportMetric(float64(rss)/(1<<20), "serverMaxRSS[MB]")
+}
+
+// reportSandboxRSS reports the resident memory of the host process running
+// the server, which must run on the local machine. Under runsc, this is the
+// sandbox, including the sentry's overhead.
+func reportSandboxRSS(ctx context.Context, b *harness.Reporter, server *dockerutil.Container) {
+	rss, err := harness.MeasureSandboxMemory(ctx, server)
+	if err != nil {
+		b.Fatalf("failed to measure sandbox memory: %v", err)
+	}
+	b.ReportMetric(float64(rss)/(1<<20), "sandboxRSS[MB]")
+}
+
+// reportCompleted reports the requests completed by a run with a duration,
+// which took elapsed. ns/op is normalized per request, as it is for runs of
+// b.N requests.
+func reportCompleted(b *harness.Reporter, completed int, elapsed time.Duration) {
+	if completed == 0 {
+		b.Fatalf("no requests completed in %v", elapsed)
+	}
+	b.ReportMetric(float64(completed), "complete_requests")
+	b.ReportMetric(float64(elapsed.Nanoseconds())/float64(completed), "ns/op")
+}
+
+// seconds returns d in whole seconds, rounded up, as ab and wrk take
+// durations.
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// generatorImages are the images of the load generators, by name.
+var generatorImages = map[string]string{
+	"ab":  "benchmarks/ab",
+	"wrk": "benchmarks/wrk",
+}
+
+// loadGenerator returns the load generator to make requests, concurrency at
+// a time, with.
+func loadGenerator(concurrency int) string {
+	if *clientOnHost {
+		return "host"
+	}
+	if *httpGenerator != "" {
+		return *httpGenerator
+	}
+	// ab sets up connections on a single thread, which becomes the
+	// bottleneck at high concurrency.
+	if concurrency < wrkMinConcurrency {
+		return "ab"
+	}
+	return "wrk"
+}
+
+// wrkMinConcurrency is the concurrency from which wrk is used by default.
+const wrkMinConcurrency = 10
+
+// flagSet returns whether the flag name was set on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// TestMain initializes the harness before running the benchmarks.
+func TestMain(m *testing.M) {
+	if err := h.Init(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize harness: %v\n", err)
+		os.Exit(1)
+	}
+	if _, ok := generatorImages[*httpGenerator]; *httpGenerator != "" && !ok {
+		fmt.Fprintf(os.Stderr, "unknown HTTP load generator %q\n", *httpGenerator)
+		os.Exit(1)
+	}
+	if *clientOnHost && *httpGenerator != "" {
+		fmt.Fprintf(os.Stderr, "--client-on-host and --http-generator are exclusive\n")
+		os.Exit(1)
+	}
+	if *benchmarkDuration > 0 && !flagSet("test.benchtime") {
+		// Runs take the duration regardless of b.N, so a single one is
+		// enough.
+		flag.Set("test.benchtime", "1x")
+	}
+	os.Exit(m.Run())
+}
@@ -0,0 +1,108 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"testing"
+
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+// httpd runs apache, serving the docs.
+var httpd = ServerSpec{
+	Image: "benchmarks/httpd",
+	Port:  80,
+	Env: []string{
+		// Standard environment variables for httpd.
+		"APACHE_RUN_DIR=/tmp",
+		"APACHE_RUN_USER=nobody",
+		"APACHE_RUN_GROUP=nogroup",
+		"APACHE_LOG_DIR=/tmp",
+		"APACHE_PID_FILE=/tmp/apache.pid",
+	},
+	Cmd: []string{"sh", "-c", "mkdir -p /tmp/html; cp -r /local/* /tmp/html/.; apache2 -X"},
+}
+
+// httpsd runs apache like httpd, but serving the docs over TLS with a
+// self-signed certificate generated at start.
+var httpsd = ServerSpec{
+	Image: httpd.Image,
+	Port:  443,
+	Env:   httpd.Env,
+	Cmd: []string{"sh", "-c", "openssl req -x509 -nodes -newkey rsa:2048 -subj /CN=localhost -keyout /tmp/tls.key -out /tmp/tls.crt && " +
+		"a2ensite tls && mkdir -p /tmp/html; cp -r /local/* /tmp/html/.; apache2 -X"},
+	TLS: true,
+}
+
+// httpdSweep is the sweep of the httpd benchmarks.
+var httpdSweep = newSweep("httpd")
+
+// BenchmarkHttpdThreads iterates the concurrency of the client and tests how
+// well the runtime under test handles requests in parallel. The -keepalive
+// runs reuse connections: comparing them with the others separates the cost
+// of setting up connections from that of serving requests.
+func BenchmarkHttpdThreads(b *testing.B) {
+	// With fewer CPUs, the client and server are not pinned apart, and the
+	// higher concurrencies measure them competing for CPUs.
+	harness.Requires(b, harness.MinCPUs(4))
+	s := startServer(b, httpd)
+	defer s.cleanUp()
+
+	// The test iterates over client concurrency, so set other parameters.
+	doc := docs["10Kb"]
+	for _, c := range httpdSweep.threads {
+		b.Run(fmt.Sprintf("%dThreads", c), func(b *testing.B) {
+			s.run(b, doc, c, false)
+		})
+		b.Run(fmt.Sprintf("%dThreads-keepalive", c), func(b *testing.B) {
+			s.run(b, doc, c, true)
+		})
+	}
+}
+
+// BenchmarkHttpdDocSize iterates over the size of the document served.
+func BenchmarkHttpdDocSize(b *testing.B) {
+	s := startServer(b, httpd)
+	defer s.cleanUp()
+
+	for _, name := range httpdSweep.docs.Values {
+		doc := docs[name]
+		for _, c := range []int{1, 25} {
+			b.Run(fmt.Sprintf("%s_%dThreads", name, c), func(b *testing.B) {
+				s.run(b, doc, c, false)
+			})
+			b.Run(fmt.Sprintf("%s_%dThreads-keepalive", name, c), func(b *testing.B) {
+				s.run(b, doc, c, true)
+			})
+		}
+	}
+}
+
+// BenchmarkHttpsDocSize is like BenchmarkHttpdDocSize, but over TLS. Comparing
+// the two gives the overhead of TLS.
+func BenchmarkHttpsDocSize(b *testing.B) {
+	s := startServer(b, httpsd)
+	defer s.cleanUp()
+
+	for _, name := range httpdSweep.docs.Values {
+		doc := docs[name]
+		for _, c := range []int{1, 25} {
+			b.Run(fmt.Sprintf("%s_%dThreads", name, c), func(b *testing.B) {
+				s.run(b, doc, c, false)
+			})
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"testing"
+)
+
+// nginx runs nginx, serving the docs.
+var nginx = ServerSpec{
+	Image: "benchmarks/nginx",
+	Port:  80,
+	Cmd:   []string{"sh", "-c", "mkdir -p /tmp/html; cp -r /local/* /tmp/html/.; nginx -c /etc/nginx/nginx.conf -g 'daemon off;'"},
+}
+
+// nginxSweep is the sweep of the nginx benchmarks.
+var nginxSweep = newSweep("nginx")
+
+// BenchmarkNginxThreads iterates the concurrency of the client and tests how
+// well the runtime under test handles requests in parallel.
+func BenchmarkNginxThreads(b *testing.B) {
+	s := startServer(b, nginx)
+	defer s.cleanUp()
+
+	// The test iterates over client concurrency, so set other parameters.
+	doc := docs["10Kb"]
+	for _, c := range nginxSweep.threads {
+		b.Run(fmt.Sprintf("%dThreads", c), func(b *testing.B) {
+			s.run(b, doc, c, false)
+		})
+	}
+}
+
+// BenchmarkNginxDocSize iterates over the size of the document served.
+func BenchmarkNginxDocSize(b *testing.B) {
+	s := startServer(b, nginx)
+	defer s.cleanUp()
+
+	for _, name := range nginxSweep.docs.Values {
+		doc := docs[name]
+		for _, c := range []int{1, 25} {
+			b.Run(fmt.Sprintf("%s_%dThreads", name, c), func(b *testing.B) {
+				s.run(b, doc, c, false)
+			})
+		}
+	}
+}
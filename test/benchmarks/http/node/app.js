@@ -0,0 +1,45 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// A small web app with a static JSON endpoint and a rendered page.
+const express = require('express');
+
+const port = 8080;
+
+const app = express();
+app.set('views', __dirname);
+app.set('view engine', 'hbs');
+
+// doc is serialized on each request to /json.
+const doc = {
+  name: 'gvisor',
+  description: 'Application Kernel for Containers',
+  tags: ['sandbox', 'containers', 'kernel', 'security'],
+  stars: 10000,
+};
+
+app.get('/json', (req, res) => {
+  res.json(doc);
+});
+
+// The page is rendered from a template for each request to /render.
+app.get('/render', (req, res) => {
+  const items = [];
+  for (let i = 0; i < 100; i++) {
+    items.push({id: i, name: `item ${i}`});
+  }
+  res.render('index', {title: 'gVisor', items: items});
+});
+
+app.listen(port, () => console.log(`listening on ${port}`));
@@ -0,0 +1,47 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"testing"
+)
+
+// node runs a small Express app, with a JSON endpoint and a rendered page.
+var node = ServerSpec{
+	Image:    "benchmarks/node",
+	Port:     8080,
+	Cmd:      []string{"node", "/usr/src/app/src/app.js"},
+	Files:    []string{"test/benchmarks/http/node/app.js", "test/benchmarks/http/node/index.hbs"},
+	FilesDir: "/usr/src/app/src",
+}
+
+// nodeEndpoints are the endpoints of the node app.
+var nodeEndpoints = []string{"json", "render"}
+
+// BenchmarkNode iterates over the endpoints of the node app and the
+// concurrency of the client.
+func BenchmarkNode(b *testing.B) {
+	s := startServer(b, node)
+	defer s.cleanUp()
+
+	for _, endpoint := range nodeEndpoints {
+		for _, c := range []int{1, 25} {
+			b.Run(fmt.Sprintf("%s_%dThreads", endpoint, c), func(b *testing.B) {
+				s.run(b, endpoint, c, false)
+			})
+		}
+	}
+}
@@ -0,0 +1,43 @@
+# Copyright 2020 The gVisor Authors.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# A small web app with a static and a dynamic endpoint.
+require 'sinatra/base'
+
+class App < Sinatra::Base
+  PAGE = <<~ERB.freeze
+    <!DOCTYPE html>
+    <html>
+      <head><title><%= @title %></title></head>
+      <body>
+        <ul>
+          <% @items.each do |item| %>
+          <li id="item-<%= item[:id] %>"><%= item[:name] %></li>
+          <% end %>
+        </ul>
+      </body>
+    </html>
+  ERB
+
+  get '/static' do
+    'Hello, gVisor!'
+  end
+
+  # The page is rendered from a template for each request.
+  get '/dynamic' do
+    @title = 'gVisor'
+    @items = (0...100).map { |i| { id: i, name: "item #{i}" } }
+    erb PAGE
+  end
+end
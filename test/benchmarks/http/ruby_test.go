@@ -0,0 +1,71 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"testing"
+)
+
+// rubyPort is the port the ruby app listens on.
+const rubyPort = 9292
+
+// ruby returns a server running a small Sinatra app, with a static and a
+// dynamic endpoint, on puma with the given numbers of workers and threads
+// per worker.
+func ruby(workers, threads int) ServerSpec {
+	return ServerSpec{
+		Image: "benchmarks/ruby",
+		Port:  rubyPort,
+		Cmd: []string{
+			"puma",
+			"--workers", fmt.Sprintf("%d", workers),
+			"--threads", fmt.Sprintf("%d:%d", threads, threads),
+			"--bind", fmt.Sprintf("tcp://0.0.0.0:%d", rubyPort),
+			"/usr/src/app/config.ru",
+		},
+		Files:    []string{"test/benchmarks/http/ruby/app.rb", "test/benchmarks/http/ruby/config.ru"},
+		FilesDir: "/usr/src/app",
+	}
+}
+
+// rubyEndpoints are the endpoints of the ruby app.
+var rubyEndpoints = []string{"static", "dynamic"}
+
+// BenchmarkRuby iterates over puma's configuration, the endpoints of the ruby
+// app and the concurrency of the client. The threads of puma are what is
+// interesting for gVisor.
+func BenchmarkRuby(b *testing.B) {
+	for _, puma := range []struct {
+		workers int
+		threads int
+	}{
+		{workers: 1, threads: 4},
+		{workers: 2, threads: 8},
+	} {
+		b.Run(fmt.Sprintf("%dx%d", puma.workers, puma.threads), func(b *testing.B) {
+			s := startServer(b, ruby(puma.workers, puma.threads))
+			defer s.cleanUp()
+
+			for _, endpoint := range rubyEndpoints {
+				for _, c := range []int{1, 25} {
+					b.Run(fmt.Sprintf("%s_%dThreads", endpoint, c), func(b *testing.B) {
+						s.run(b, endpoint, c, false)
+					})
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,484 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+// wrkTimeout bounds the duration of runs of wrk.
+const wrkTimeout = 10 * time.Minute
+
+// wrkScript is the wrk script of runs, taking the code run on each response
+// after recording its time, e.g. wrkStopScript.
+//
+// It reports the mean response time: the time from writing a request to
+// reading its whole response. This is not the time to first byte, as wrk
+// has no hook on the first byte of a response. Nor does wrk tell which
+// connection a response is on, so responses are matched with requests in
+// order. Their times may then be mismatched, but not the mean, as it only
+// depends on the sums of the times of the requests and of the responses.
+const wrkScript = `local ffi = require("ffi")
+ffi.cdef[[
+typedef struct { long tv_sec; long tv_nsec; } wrk_timespec;
+int clock_gettime(int clk_id, wrk_timespec *tp);
+]]
+local CLOCK_MONOTONIC = 1
+local ts = ffi.new("wrk_timespec")
+local function now()
+  ffi.C.clock_gettime(CLOCK_MONOTONIC, ts)
+  return tonumber(ts.tv_sec) + tonumber(ts.tv_nsec) / 1e9
+end
+
+local threads = {}
+function setup(thread)
+  table.insert(threads, thread)
+end
+
+-- Requests in flight, oldest first.
+local sent = {}
+local first, last = 1, 0
+
+-- response_time_sum and response_time_count are read by done, so they must
+-- be global.
+response_time_sum = 0
+response_time_count = 0
+
+function request()
+  last = last + 1
+  sent[last] = now()
+  return wrk.request()
+end
+
+local responses = 0
+function response()
+  if first <= last then
+    response_time_sum = response_time_sum + now() - sent[first]
+    response_time_count = response_time_count + 1
+    sent[first] = nil
+    first = first + 1
+  end
+  responses = responses + 1
+%s
+end
+
+function done()
+  local sum, count = 0, 0
+  for _, thread in ipairs(threads) do
+    sum = sum + thread:get("response_time_sum")
+    count = count + thread:get("response_time_count")
+  end
+  if count > 0 then
+    io.write(string.format("Response time mean: %%.3fms over %%d responses\n", sum / count * 1000, count))
+  end
+end
+`
+
+// wrkStopScript makes each thread of wrkScript stop after the given number
+// of responses.
+const wrkStopScript = `  if responses >= %d then
+    wrk.thread:stop()
+  end`
+
+// runWrk runs wrk in client, making requests to url over connections, from
+// threads, and returns its output. It makes the given number of requests,
+// or, if duration is set, as many as it can for duration.
+//
+// wrk runs for a duration rather than a number of requests, so without one
+// wrkStopScript stops each thread once it has made its share of the
+// requests. Each thread makes at least one request.
+//
+// wrk reuses connections, so unless keepAlive is set, requests ask the
+// server to close them, as ab does without -k.
+func runWrk(ctx context.Context, b *testing.B, client *dockerutil.Container, url string, threads, connections, requests int, duration time.Duration, keepAlive bool) string {
+	header := ""
+	if !keepAlive {
+		header = "-H 'Connection: close' "
+	}
+	secs := int(wrkTimeout.Seconds())
+	stop := ""
+	if duration > 0 {
+		secs = seconds(duration)
+	} else {
+		perThread := (requests + threads - 1) / threads
+		stop = fmt.Sprintf(wrkStopScript, perThread)
+	}
+	script := fmt.Sprintf(wrkScript, stop)
+	cmd := fmt.Sprintf("cat > /tmp/wrk.lua <<'EOF'\n%sEOF\nwrk --latency %s-s /tmp/wrk.lua -t %d -c %d -d %ds %s", script, header, threads, connections, secs, url)
+	out, err := client.Exec(ctx, dockerutil.ExecOpts{}, "sh", "-c", cmd)
+	if err != nil {
+		b.Fatalf("run failed with: %v: %s", err, out)
+	}
+	return out
+}
+
+// reportWrk reports the metrics in the output of wrk, as reportAb does for
+// ab.
+func reportWrk(b *harness.Reporter, out string, notFound bool) {
+	failed, err := parseWrkErrors(out)
+	if err != nil {
+		b.Fatalf("failed to parse socket errors: %v", err)
+	}
+	b.ReportMetric(float64(failed), "failed_requests")
+	non2xx, err := parseWrkNon2xx(out)
+	if err != nil {
+		b.Fatalf("failed to parse non-2xx responses: %v", err)
+	}
+	b.ReportMetric(float64(non2xx), "non2xx_responses")
+	if notFound {
+		non2xx = 0
+	}
+	if failed > 0 || non2xx > 0 {
+		b.Fatalf("%d requests failed and %d got non-2xx responses:\n%s", failed, non2xx, out)
+	}
+
+	transferRate, err := parseWrkTransferRate(out)
+	if err != nil {
+		b.Logf("failed to parse transfer rate: %v", err)
+	}
+	b.ReportMetric(transferRate, "transfer_rate")
+
+	latency, err := parseWrkLatency(out)
+	if err != nil {
+		b.Logf("failed to parse latency: %v", err)
+	}
+	b.ReportMetric(float64(latency)/float64(time.Millisecond), "mean_latency[ms]")
+
+	responseTime, err := parseWrkResponseTime(out)
+	if err != nil {
+		b.Logf("failed to parse response time: %v", err)
+	}
+	b.ReportMetric(float64(responseTime)/float64(time.Millisecond), "mean_response_time[ms]")
+
+	reqPerSecond, err := parseWrkRequestsPerSecond(out)
+	if err != nil {
+		b.Logf("failed to parse requests per second: %v", err)
+	}
+	b.ReportMetric(reqPerSecond, "requests_per_second")
+
+	for _, pct := range []int{50, 90, 99} {
+		latency, err := parseWrkPercentile(out, pct)
+		if err != nil {
+			b.Logf("failed to parse p%d latency: %v", pct, err)
+			continue
+		}
+		b.ReportMetric(float64(latency)/float64(time.Millisecond), fmt.Sprintf("p%d_latency[ms]", pct))
+	}
+}
+
+// parseWrkDuration parses a duration printed by wrk, e.g. "2.47ms". wrk uses the
+// same units as time.ParseDuration.
+func parseWrkDuration(s string) (time.Duration, error) {
+	return time.ParseDuration(s)
+}
+
+// wrkByteUnits are the multipliers of the units of sizes printed by wrk.
+var wrkByteUnits = map[string]float64{
+	"B":  1,
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+	"TB": 1 << 40,
+}
+
+// parseWrkBytes parses a size printed by wrk, e.g. "412.18MB", in bytes.
+func parseWrkBytes(value, unit string) (float64, error) {
+	mult, ok := wrkByteUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", unit)
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	return v * mult, nil
+}
+
+var wrkRequestsRE = regexp.MustCompile(`(\d+) requests in \d+\.?\d*(?:us|ms|s|m|h),`)
+
+// parseWrkRequests parses the number of requests completed from wrk output.
+func parseWrkRequests(data string) (int, error) {
+	match := wrkRequestsRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, fmt.Errorf("failed to get requests: %s", data)
+	}
+	return strconv.Atoi(match[1])
+}
+
+var wrkRequestsPerSecondRE = regexp.MustCompile(`Requests/sec:\s+(\d+\.?\d*)`)
+
+// parseWrkRequestsPerSecond parses the requests per second from wrk output.
+func parseWrkRequestsPerSecond(data string) (float64, error) {
+	match := wrkRequestsPerSecondRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, fmt.Errorf("failed to get requests per second: %s", data)
+	}
+	return strconv.ParseFloat(match[1], 64)
+}
+
+var wrkTransferRateRE = regexp.MustCompile(`Transfer/sec:\s+(\d+\.?\d*)([KMGT]?B)`)
+
+// parseWrkTransferRate parses the transfer rate, in b/s, from wrk output.
+func parseWrkTransferRate(data string) (float64, error) {
+	match := wrkTransferRateRE.FindStringSubmatch(data)
+	if len(match) < 3 {
+		return 0, fmt.Errorf("failed to get transfer rate: %s", data)
+	}
+	return parseWrkBytes(match[1], match[2])
+}
+
+var wrkLatencyRE = regexp.MustCompile(`Latency\s+(\d+\.?\d*(?:us|ms|s|m|h))\s`)
+
+// parseWrkLatency parses the mean latency from wrk output.
+func parseWrkLatency(data string) (time.Duration, error) {
+	match := wrkLatencyRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, fmt.Errorf("failed to get latency: %s", data)
+	}
+	return parseWrkDuration(match[1])
+}
+
+var wrkResponseTimeRE = regexp.MustCompile(`Response time mean: (\d+\.?\d*)ms`)
+
+// parseWrkResponseTime parses the mean response time printed by wrkScript
+// from wrk output.
+func parseWrkResponseTime(data string) (time.Duration, error) {
+	match := wrkResponseTimeRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, fmt.Errorf("failed to get response time: %s", data)
+	}
+	ms, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms * float64(time.Millisecond)), nil
+}
+
+// wrkPercentileHeader starts the latency distribution in wrk output, which
+// is only printed with --latency.
+const wrkPercentileHeader = "Latency Distribution"
+
+var wrkPercentileRE = regexp.MustCompile(`(?m)^\s*(\d+)%\s+(\d+\.?\d*(?:us|ms|s|m|h))\s*$`)
+
+// parseWrkPercentile parses the pct percentile of latency from wrk output.
+func parseWrkPercentile(data string, pct int) (time.Duration, error) {
+	i := strings.Index(data, wrkPercentileHeader)
+	if i < 0 {
+		return 0, fmt.Errorf("no latency distribution: %s", data)
+	}
+	for _, match := range wrkPercentileRE.FindAllStringSubmatch(data[i:], -1) {
+		if match[1] == strconv.Itoa(pct) {
+			return parseWrkDuration(match[2])
+		}
+	}
+	return 0, fmt.Errorf("no %d%% percentile: %s", pct, data)
+}
+
+var wrkErrorsRE = regexp.MustCompile(`Socket errors: connect (\d+), read (\d+), write (\d+), timeout (\d+)`)
+
+// parseWrkErrors parses the total number of socket errors from wrk output.
+// wrk omits them if there are none.
+func parseWrkErrors(data string) (int, error) {
+	match := wrkErrorsRE.FindStringSubmatch(data)
+	if len(match) < 5 {
+		return 0, nil
+	}
+	var total int
+	for _, s := range match[1:] {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+var wrkNon2xxRE = regexp.MustCompile(`Non-2xx or 3xx responses:\s+(\d+)`)
+
+// parseWrkNon2xx parses the number of responses with a non-2xx or 3xx
+// status from wrk output. wrk omits it if there are none.
+func parseWrkNon2xx(data string) (int, error) {
+	match := wrkNon2xxRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, nil
+	}
+	return strconv.Atoi(match[1])
+}
+
+// wrkSampleData is sample output from wrk.
+const wrkSampleData = `Running 10s test @ http://10.10.10.10:80/latin10k.txt
+  4 threads and 100 connections
+  Thread Stats   Avg      Stdev     Max   +/- Stdev
+    Latency     2.47ms    1.08ms  22.41ms   84.90%
+    Req/Sec    10.30k     1.26k   14.39k    73.25%
+  Latency Distribution
+     50%    2.29ms
+     75%    2.81ms
+     90%    3.53ms
+     99%    6.34ms
+  410193 requests in 10.01s, 4.03GB read
+Requests/sec:  40981.72
+Transfer/sec:    412.18MB
+Response time mean: 2.310ms over 410193 responses
+`
+
+// wrkErrorSampleData is sample output from wrk with errors, and with other
+// units.
+const wrkErrorSampleData = `Running 10s test @ http://10.10.10.10:80/notfound
+  1 threads and 1 connections
+  Thread Stats   Avg      Stdev     Max   +/- Stdev
+    Latency   870.12us  150.30us   1.20s    95.00%
+    Req/Sec     1.15k   100.00     1.30k    70.00%
+  Latency Distribution
+     50%  850.00us
+     75%  900.00us
+     90%    1.00ms
+     99%    1.20s
+  11500 requests in 10.00s, 2.34MB read
+  Socket errors: connect 0, read 2, write 0, timeout 3
+  Non-2xx or 3xx responses: 11500
+Requests/sec:   1150.00
+Transfer/sec:    239.62KB
+Response time mean: 0.845ms over 11495 responses
+`
+
+// TestWrkParsers checks the wrk parsers work.
+func TestWrkParsers(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		data         string
+		requests     int
+		reqPerSecond float64
+		transferRate float64
+		latency      time.Duration
+		responseTime time.Duration
+		percentiles  map[int]time.Duration
+		failed       int
+		non2xx       int
+	}{
+		{
+			name:         "success",
+			data:         wrkSampleData,
+			requests:     410193,
+			reqPerSecond: 40981.72,
+			transferRate: 412.18 * (1 << 20),
+			latency:      2470 * time.Microsecond,
+			responseTime: 2310 * time.Microsecond,
+			percentiles: map[int]time.Duration{
+				50: 2290 * time.Microsecond,
+				90: 3530 * time.Microsecond,
+				99: 6340 * time.Microsecond,
+			},
+		},
+		{
+			name:         "errors",
+			data:         wrkErrorSampleData,
+			requests:     11500,
+			reqPerSecond: 1150,
+			transferRate: 239.62 * (1 << 10),
+			latency:      870120 * time.Nanosecond,
+			responseTime: 845 * time.Microsecond,
+			percentiles: map[int]time.Duration{
+				50: 850 * time.Microsecond,
+				90: time.Millisecond,
+				99: 1200 * time.Millisecond,
+			},
+			failed: 5,
+			non2xx: 11500,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := parseWrkRequests(tc.data); err != nil {
+				t.Errorf("failed to parse requests with error: %v", err)
+			} else if got != tc.requests {
+				t.Errorf("parseWrkRequests got: %d, want: %d", got, tc.requests)
+			}
+			if got, err := parseWrkRequestsPerSecond(tc.data); err != nil {
+				t.Errorf("failed to parse requests per second with error: %v", err)
+			} else if got != tc.reqPerSecond {
+				t.Errorf("parseWrkRequestsPerSecond got: %f, want: %f", got, tc.reqPerSecond)
+			}
+			if got, err := parseWrkTransferRate(tc.data); err != nil {
+				t.Errorf("failed to parse transfer rate with error: %v", err)
+			} else if got != tc.transferRate {
+				t.Errorf("parseWrkTransferRate got: %f, want: %f", got, tc.transferRate)
+			}
+			if got, err := parseWrkLatency(tc.data); err != nil {
+				t.Errorf("failed to parse latency with error: %v", err)
+			} else if got != tc.latency {
+				t.Errorf("parseWrkLatency got: %v, want: %v", got, tc.latency)
+			}
+			if got, err := parseWrkResponseTime(tc.data); err != nil {
+				t.Errorf("failed to parse response time with error: %v", err)
+			} else if got != tc.responseTime {
+				t.Errorf("parseWrkResponseTime got: %v, want: %v", got, tc.responseTime)
+			}
+			for pct, want := range tc.percentiles {
+				if got, err := parseWrkPercentile(tc.data, pct); err != nil {
+					t.Errorf("failed to parse %d%% percentile with error: %v", pct, err)
+				} else if got != want {
+					t.Errorf("parseWrkPercentile(%d) got: %v, want: %v", pct, got, want)
+				}
+			}
+			if got, err := parseWrkErrors(tc.data); err != nil {
+				t.Errorf("failed to parse socket errors with error: %v", err)
+			} else if got != tc.failed {
+				t.Errorf("parseWrkErrors got: %d, want: %d", got, tc.failed)
+			}
+			if got, err := parseWrkNon2xx(tc.data); err != nil {
+				t.Errorf("failed to parse non-2xx responses with error: %v", err)
+			} else if got != tc.non2xx {
+				t.Errorf("parseWrkNon2xx got: %d, want: %d", got, tc.non2xx)
+			}
+		})
+	}
+
+	if got, err := parseWrkPercentile(strings.Replace(wrkSampleData, wrkPercentileHeader, "", 1), 50); err == nil {
+		t.Errorf("parseWrkPercentile got: %v without a latency distribution, want error", got)
+	}
+	if got, err := parseWrkResponseTime(strings.Replace(wrkSampleData, "Response time", "", 1)); err == nil {
+		t.Errorf("parseWrkResponseTime got: %v without the output of the script, want error", got)
+	}
+	if got, err := parseWrkBytes("1", "XB"); err == nil {
+		t.Errorf("parseWrkBytes got: %f for an unknown unit, want error", got)
+	}
+}
+
+// TestWrkScript checks wrkScript is well formed, with and without
+// wrkStopScript.
+func TestWrkScript(t *testing.T) {
+	for _, stop := range []string{"", fmt.Sprintf(wrkStopScript, 10)} {
+		script := fmt.Sprintf(wrkScript, stop)
+		if strings.Contains(script, "%!") {
+			t.Errorf("wrkScript is badly formatted:\n%s", script)
+		}
+		if !strings.Contains(script, `"Response time mean: %.3fms over %d responses\n"`) {
+			t.Errorf("wrkScript doesn't print the response time as parseWrkResponseTime expects:\n%s", script)
+		}
+		if stop != "" && !strings.Contains(script, "if responses >= 10 then") {
+			t.Errorf("wrkScript doesn't stop threads:\n%s", script)
+		}
+	}
+}
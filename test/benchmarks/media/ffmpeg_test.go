@@ -0,0 +1,183 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package media
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+// h is the harness of the benchmarks.
+var h harness.Harness
+
+// ffmpegInput is the input video, baked into the image.
+const ffmpegInput = "/input.mp4"
+
+// ffmpegTargets are the directories the video is transcoded in, by name: one
+// in the container's root filesystem and one bind mounted from the host.
+var ffmpegTargets = []struct {
+	name string
+	dir  string
+}{
+	{name: "rootfs", dir: "/rootfs"},
+	{name: "bind", dir: "/bind"},
+}
+
+// BenchmarkFfmpeg transcodes a H.264 video to H.264 at a lower bitrate, with
+// the input and output in each target. ns/op is the time of one transcode.
+func BenchmarkFfmpeg(b *testing.B) {
+	ctx := h.Context()
+	machine, err := h.GetMachine()
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer machine.CleanUp()
+
+	// The bind mount is a directory on the container's machine.
+	out, err := machine.RunCommand("mktemp", "-d")
+	if err != nil {
+		b.Fatalf("failed to create bind mount source: %v: %s", err, out)
+	}
+	bindSource := strings.TrimSpace(out)
+	defer machine.RunCommand("rm", "-rf", bindSource)
+
+	container := machine.GetContainer(ctx, b)
+	defer container.CleanUp(ctx)
+	if err := container.Spawn(ctx, dockerutil.RunOpts{
+		Image: "benchmarks/ffmpeg",
+		Mounts: []mount.Mount{
+			{
+				Type:   mount.TypeBind,
+				Source: bindSource,
+				Target: "/bind",
+			},
+		},
+	}, "sh", "-c", "mkdir -p /rootfs && sleep infinity"); err != nil {
+		b.Fatalf("failed to start container: %v", err)
+	}
+	if err := harness.VerifyRuntime(ctx, container); err != nil {
+		b.Fatalf("container runs under the wrong runtime: %v", err)
+	}
+
+	for _, target := range ffmpegTargets {
+		b.Run(target.name, func(b *testing.B) {
+			runFfmpeg(b, container, target.dir)
+		})
+	}
+}
+
+// runFfmpeg runs a single benchmark: b.N transcodes of a copy of the input
+// in dir.
+func runFfmpeg(b *testing.B, container *dockerutil.Container, dir string) {
+	b.StopTimer()
+	ctx := h.Context()
+	input := fmt.Sprintf("%s/input.mp4", dir)
+	output := fmt.Sprintf("%s/output.mp4", dir)
+	defer container.Exec(ctx, dockerutil.ExecOpts{}, "rm", "-f", input, output)
+
+	if out, err := container.Exec(ctx, dockerutil.ExecOpts{}, "cp", ffmpegInput, input); err != nil {
+		b.Fatalf("failed to copy input to %s: %v: %s", dir, err, out)
+	}
+	args := []string{
+		"ffmpeg", "-nostdin", "-y",
+		"-i", input,
+		"-c:v", "libx264", "-b:v", "1M",
+		output,
+	}
+
+	var (
+		out     string
+		err     error
+		elapsed time.Duration
+	)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		b.StartTimer()
+		out, err = container.Exec(ctx, dockerutil.ExecOpts{}, args...)
+		b.StopTimer()
+		elapsed += time.Since(start)
+		if err != nil {
+			b.Fatalf("ffmpeg failed with: %v: %s", err, out)
+		}
+	}
+
+	fps, err := parseFPS(out)
+	if err != nil {
+		b.Fatalf("failed to parse fps: %v", err)
+	}
+	r := h.Reporter(b)
+	r.ReportMetric(elapsed.Seconds()/float64(b.N), "wall[s]")
+	r.ReportMetric(fps, "fps")
+	r.Finish()
+}
+
+var fpsRE = regexp.MustCompile(`frame=\s*\d+\s+fps=\s*(\d+(?:\.\d+)?)`)
+
+// parseFPS parses the frames encoded per second from the final progress line
+// ffmpeg prints to stderr.
+func parseFPS(data string) (float64, error) {
+	matches := fpsRE.FindAllStringSubmatch(data, -1)
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("failed get fps: %s", data)
+	}
+	return strconv.ParseFloat(matches[len(matches)-1][1], 64)
+}
+
+// sampleData is the tail of the stderr of ffmpeg. Progress lines are
+// separated by carriage returns.
+const sampleData = "Output #0, mp4, to '/rootfs/output.mp4':\n" +
+	"  Metadata:\n" +
+	"    major_brand     : isom\n" +
+	"    encoder         : Lavf57.83.100\n" +
+	"    Stream #0:0(und): Video: h264 (libx264) (avc1 / 0x31637661), yuv444p, 1280x720 [SAR 1:1 DAR 16:9], q=-1--1, 1000 kb/s, 30 fps, 15360 tbn, 30 tbc (default)\n" +
+	"frame=  101 fps=0.0 q=28.0 size=       0kB time=00:00:01.26 bitrate=   0.3kbits/s speed=2.49x    \r" +
+	"frame=  456 fps=149 q=28.0 size=    1280kB time=00:00:13.10 bitrate= 800.2kbits/s speed=4.28x    \r" +
+	"frame=  900 fps=152.4 q=-1.0 Lsize=    3704kB time=00:00:29.93 bitrate=1013.7kbits/s speed=5.08x    \n" +
+	"video:3693kB audio:0kB subtitle:0kB other streams:0kB global headers:0kB muxing overhead: 0.283208%\n" +
+	"[libx264 @ 0x55d0d6b4e8c0] frame I:4     Avg QP:19.42  size: 60262\n"
+
+// TestParsers checks the parsers work.
+func TestParsers(t *testing.T) {
+	want := 152.4
+	got, err := parseFPS(sampleData)
+	if err != nil {
+		t.Fatalf("failed to parse fps with error: %v", err)
+	} else if got != want {
+		t.Fatalf("parseFPS got: %f, want: %f", got, want)
+	}
+
+	if got, err := parseFPS("garbage"); err == nil {
+		t.Errorf("parseFPS got: %f for garbage, want error", got)
+	}
+}
+
+// TestMain initializes the harness before running the benchmarks.
+func TestMain(m *testing.M) {
+	if err := h.Init(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize harness: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ml
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+// h is the harness of the benchmarks.
+var h harness.Harness
+
+// mnistSteps is the number of training steps of each run of the script.
+const mnistSteps = 200
+
+// BenchmarkTensorflow trains a small Keras model on MNIST, with a single
+// thread and with as many threads as the machine has CPUs. ns/op is the wall
+// time of a whole run of the training script, including its startup.
+func BenchmarkTensorflow(b *testing.B) {
+	ctx := h.Context()
+	machine, err := h.GetMachine()
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer machine.CleanUp()
+	info, err := machine.Info()
+	if err != nil {
+		b.Fatalf("failed to get machine info: %v", err)
+	}
+
+	container := machine.GetContainer(ctx, b)
+	defer container.CleanUp(ctx)
+	if err := container.Spawn(ctx, dockerutil.RunOpts{
+		Image: "benchmarks/tensorflow",
+	}, "sleep", "infinity"); err != nil {
+		b.Fatalf("failed to start container: %v", err)
+	}
+	if err := harness.VerifyRuntime(ctx, container); err != nil {
+		b.Fatalf("container runs under the wrong runtime: %v", err)
+	}
+
+	for _, threads := range []struct {
+		name string
+		n    int
+	}{
+		{name: "1Thread", n: 1},
+		{name: "MaxThreads", n: info.CPUs},
+	} {
+		b.Run(threads.name, func(b *testing.B) {
+			runMnist(b, container, threads.n)
+		})
+	}
+}
+
+// runMnist runs a single benchmark: b.N runs of the training script with the
+// given number of threads.
+func runMnist(b *testing.B, container *dockerutil.Container, threads int) {
+	b.StopTimer()
+	ctx := h.Context()
+	opts := dockerutil.ExecOpts{
+		Env: []string{fmt.Sprintf("OMP_NUM_THREADS=%d", threads)},
+	}
+
+	var (
+		out     string
+		err     error
+		elapsed time.Duration
+	)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		b.StartTimer()
+		out, err = container.Exec(ctx, opts, "python", "/mnist.py", strconv.Itoa(mnistSteps))
+		b.StopTimer()
+		elapsed += time.Since(start)
+		if err != nil {
+			b.Fatalf("training failed with: %v: %s", err, out)
+		}
+	}
+
+	examples, err := parseExamplesPerSecond(out)
+	if err != nil {
+		b.Fatalf("failed to parse examples/sec: %v", err)
+	}
+	r := h.Reporter(b)
+	r.ReportMetric(elapsed.Seconds()/float64(b.N), "wall[s]")
+	r.ReportMetric(examples, "examples_per_second")
+	r.Finish()
+}
+
+var resultRE = regexp.MustCompile(`(?m)^RESULT steps=\d+ seconds=\d+(?:\.\d+)? examples_per_sec=(\d+(?:\.\d+)?)$`)
+
+// parseExamplesPerSecond parses the training throughput from the result line
+// printed by the script.
+func parseExamplesPerSecond(data string) (float64, error) {
+	match := resultRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, fmt.Errorf("failed get examples/sec: %s", data)
+	}
+	return strconv.ParseFloat(match[1], 64)
+}
+
+// sampleData is sample output of the training script.
+const sampleData = `2020-07-01 18:21:04.501923: I tensorflow/core/platform/cpu_feature_guard.cc:143] Your CPU supports instructions that this TensorFlow binary was not compiled to use: AVX2 FMA
+2020-07-01 18:21:04.527651: I tensorflow/core/platform/profile_utils/cpu_utils.cc:102] CPU Frequency: 2200000000 Hz
+2020-07-01 18:21:04.528291: I tensorflow/compiler/xla/service/service.cc:168] XLA service 0x4a27e10 initialized for platform Host (this does not guarantee that XLA will be used). Devices:
+RESULT steps=200 seconds=4.815327 examples_per_sec=2658.179113
+`
+
+// TestParsers checks the parsers work.
+func TestParsers(t *testing.T) {
+	want := 2658.179113
+	got, err := parseExamplesPerSecond(sampleData)
+	if err != nil {
+		t.Fatalf("failed to parse examples/sec with error: %v", err)
+	} else if got != want {
+		t.Fatalf("parseExamplesPerSecond got: %f, want: %f", got, want)
+	}
+
+	if got, err := parseExamplesPerSecond("garbage"); err == nil {
+		t.Errorf("parseExamplesPerSecond got: %f for garbage, want error", got)
+	}
+}
+
+// TestMain initializes the harness before running the benchmarks.
+func TestMain(m *testing.M) {
+	if err := h.Init(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize harness: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
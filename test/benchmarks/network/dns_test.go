@@ -0,0 +1,237 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+var dnsRecords = flag.Int("dns-records", 1000, "number of records the DNS server of BenchmarkDNS serves")
+
+// dnsDomain is the domain of the records of BenchmarkDNS, host<i>.dnsDomain
+// for i from 1 to --dns-records.
+const dnsDomain = "bench.test"
+
+// BenchmarkDNS measures the rate of name resolutions a client container gets
+// from a dnsmasq server container, over UDP and TCP. The client resolves
+// names with the server, which must be on the same host.
+func BenchmarkDNS(b *testing.B) {
+	clientMachine, err := h.GetClientMachine()
+	if err != nil {
+		b.Fatalf("failed to get client machine: %v", err)
+	}
+	defer clientMachine.CleanUp()
+	serverMachine, err := h.GetMachine()
+	if err != nil {
+		b.Fatalf("failed to get server machine: %v", err)
+	}
+	defer serverMachine.CleanUp()
+
+	ctx := h.Context()
+	server := serverMachine.GetContainer(ctx, b)
+	defer server.CleanUp(ctx)
+	records := fmt.Sprintf(`seq 1 %d | awk '{ printf "10.%%d.%%d.%%d host%%d.%s\n", int($1/65536)%%256, int($1/256)%%256, $1%%256, $1 }' > /tmp/records`, *dnsRecords, dnsDomain)
+	if err := server.Spawn(ctx, dockerutil.RunOpts{
+		Image: "benchmarks/dns",
+	}, "sh", "-c", records+" && exec dnsmasq --keep-in-foreground --no-resolv --no-hosts --addn-hosts=/tmp/records --local=/"+dnsDomain+"/"); err != nil {
+		b.Fatalf("failed to start server: %v", err)
+	}
+	if err := harness.VerifyRuntime(ctx, server); err != nil {
+		b.Fatalf("server runs under the wrong runtime: %v", err)
+	}
+	ip, err := server.FindIP(ctx)
+	if err != nil {
+		b.Fatalf("failed to find server IP: %v", err)
+	}
+
+	client := clientMachine.GetClientContainer(ctx, b)
+	defer client.CleanUp(ctx)
+	if err := client.Spawn(ctx, dockerutil.RunOpts{
+		Image: "benchmarks/dns",
+		DNS:   []string{ip.String()},
+	}, "sleep", "infinity"); err != nil {
+		b.Fatalf("failed to start client: %v", err)
+	}
+
+	// The server is ready once the client resolves one of its names, which
+	// also checks the client's resolver is set up with it.
+	if err := testutil.Poll(func() error {
+		out, err := client.Exec(ctx, dockerutil.ExecOpts{}, "getent", "hosts", "host1."+dnsDomain)
+		if err != nil {
+			return fmt.Errorf("getent failed: %v: %s", err, out)
+		}
+		if !strings.HasPrefix(out, "10.0.0.1 ") {
+			return fmt.Errorf("host1.%s resolved to: %q, want: 10.0.0.1", dnsDomain, out)
+		}
+		return nil
+	}, time.Minute); err != nil {
+		b.Fatalf("server did not start: %v", err)
+	}
+
+	for _, transport := range []string{"udp", "tcp"} {
+		b.Run(strings.ToUpper(transport), func(b *testing.B) {
+			runDNSPerf(b, client, ip.String(), transport)
+		})
+	}
+}
+
+// runDNSPerf runs b.N queries from client to the server at addr, over
+// transport, and reports their rate and latency.
+func runDNSPerf(b *testing.B, client *dockerutil.Container, addr, transport string) {
+	b.StopTimer()
+	ctx := h.Context()
+
+	// Queries cycle through the records.
+	queries := fmt.Sprintf(`seq 1 %d | awk '{ printf "host%%d.%s A\n", ($1-1)%%%d+1 }' > /tmp/queries`, b.N, dnsDomain, *dnsRecords)
+	if out, err := client.Exec(ctx, dockerutil.ExecOpts{}, "sh", "-c", queries); err != nil {
+		b.Fatalf("failed to write queries: %v: %s", err, out)
+	}
+
+	b.ResetTimer()
+	b.StartTimer()
+	out, err := client.Exec(ctx, dockerutil.ExecOpts{}, "dnsperf", "-s", addr, "-m", transport, "-d", "/tmp/queries", "-n", "1")
+	b.StopTimer()
+	if err != nil {
+		b.Fatalf("dnsperf failed with: %v: %s", err, out)
+	}
+
+	qps, err := parseQueriesPerSecond(out)
+	if err != nil {
+		b.Fatalf("failed to parse queries per second: %v", err)
+	}
+	latency, err := parseDNSLatency(out)
+	if err != nil {
+		b.Fatalf("failed to parse latency: %v", err)
+	}
+	lost, err := parseLostQueries(out)
+	if err != nil {
+		b.Fatalf("failed to parse lost queries: %v", err)
+	}
+	r := h.Reporter(b)
+	r.ReportMetric(qps, "queries_per_second")
+	r.ReportMetric(latency, "mean_latency[ms]")
+	r.ReportMetric(float64(lost), "lost_queries")
+	r.Finish()
+}
+
+var queriesPerSecondRE = regexp.MustCompile(`Queries per second:\s+(\d+(?:\.\d+)?)`)
+
+// parseQueriesPerSecond parses the rate of completed queries from dnsperf
+// output.
+func parseQueriesPerSecond(data string) (float64, error) {
+	match := queriesPerSecondRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, fmt.Errorf("failed to get queries per second: %s", data)
+	}
+	return strconv.ParseFloat(match[1], 64)
+}
+
+var dnsLatencyRE = regexp.MustCompile(`Average Latency \(s\):\s+(\d+(?:\.\d+)?)`)
+
+// parseDNSLatency parses the mean latency of queries, in ms, from dnsperf
+// output.
+func parseDNSLatency(data string) (float64, error) {
+	match := dnsLatencyRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, fmt.Errorf("failed to get latency: %s", data)
+	}
+	secs, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	return secs * 1000, nil
+}
+
+var lostQueriesRE = regexp.MustCompile(`Queries lost:\s+(\d+)`)
+
+// parseLostQueries parses the number of queries without a response from
+// dnsperf output.
+func parseLostQueries(data string) (int, error) {
+	match := lostQueriesRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, fmt.Errorf("failed to get lost queries: %s", data)
+	}
+	return strconv.Atoi(match[1])
+}
+
+// dnsperfSampleData is sample output from dnsperf.
+const dnsperfSampleData = `DNS Performance Testing Tool
+Version 2.3.2
+
+[Status] Command line: dnsperf -s 172.17.0.2 -m udp -d /tmp/queries -n 1
+[Status] Sending queries (to 172.17.0.2)
+[Status] Started at: Thu Oct 15 04:50:12 2026
+[Status] Stopping after 1 run through file
+[Status] Testing complete (end of file)
+
+Statistics:
+
+  Queries sent:         100000
+  Queries completed:    99987 (99.99%)
+  Queries lost:         13 (0.01%)
+
+  Response codes:       NOERROR 99987 (100.00%)
+  Average packet size:  request 34, response 50
+  Run time (s):         2.106478
+  Queries per second:   47466.813689
+
+  Average Latency (s):  0.002067 (min 0.000045, max 0.031226)
+  Latency StdDev (s):   0.001113
+`
+
+// TestDNSParsers checks the dnsperf parsers work.
+func TestDNSParsers(t *testing.T) {
+	qps, err := parseQueriesPerSecond(dnsperfSampleData)
+	if err != nil {
+		t.Fatalf("failed to parse queries per second with error: %v", err)
+	} else if qps != 47466.813689 {
+		t.Errorf("parseQueriesPerSecond got: %f, want: %f", qps, 47466.813689)
+	}
+
+	latency, err := parseDNSLatency(dnsperfSampleData)
+	if err != nil {
+		t.Fatalf("failed to parse latency with error: %v", err)
+	} else if math.Abs(latency-2.067) > 1e-9 {
+		t.Errorf("parseDNSLatency got: %f, want: %f", latency, 2.067)
+	}
+
+	lost, err := parseLostQueries(dnsperfSampleData)
+	if err != nil {
+		t.Fatalf("failed to parse lost queries with error: %v", err)
+	} else if lost != 13 {
+		t.Errorf("parseLostQueries got: %d, want: 13", lost)
+	}
+
+	if _, err := parseQueriesPerSecond("garbage"); err == nil {
+		t.Errorf("parseQueriesPerSecond got no error for garbage")
+	}
+	if _, err := parseDNSLatency("garbage"); err == nil {
+		t.Errorf("parseDNSLatency got no error for garbage")
+	}
+	if _, err := parseLostQueries("garbage"); err == nil {
+		t.Errorf("parseLostQueries got no error for garbage")
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+// h is the harness of the benchmarks.
+var h harness.Harness
+
+// iperfPort is the port iperf3 servers listen on.
+const iperfPort = 5201
+
+// iperfBytesPerOp is the number of bytes transferred per iteration.
+const iperfBytesPerOp = 1 << 20
+
+// BenchmarkIperf measures the throughput of TCP streams between a client and
+// a server, in both directions. Upload streams go from the client to the
+// server, and download streams from the server to the client.
+func BenchmarkIperf(b *testing.B) {
+	// With fewer CPUs, the client and server are not pinned apart, and the
+	// streams compete with both for CPUs.
+	harness.Requires(b, harness.MinCPUs(4))
+	clientMachine, err := h.GetClientMachine()
+	if err != nil {
+		b.Fatalf("failed to get client machine: %v", err)
+	}
+	defer clientMachine.CleanUp()
+	serverMachine, err := h.GetMachine()
+	if err != nil {
+		b.Fatalf("failed to get server machine: %v", err)
+	}
+	defer serverMachine.CleanUp()
+	cpus, err := h.CPUPartition(clientMachine, serverMachine)
+	if err != nil {
+		b.Fatalf("failed to partition CPUs: %v", err)
+	}
+
+	for _, dir := range []struct {
+		name    string
+		reverse bool
+	}{
+		{name: "Upload"},
+		{name: "Download", reverse: true},
+	} {
+		b.Run(dir.name, func(b *testing.B) {
+			for _, streams := range []int{1, 4, 16} {
+				b.Run(fmt.Sprintf("%dStreams", streams), func(b *testing.B) {
+					runIperf(b, clientMachine, serverMachine, cpus, streams, dir.reverse)
+				})
+			}
+		})
+	}
+}
+
+// runIperf runs a single benchmark: b.N iterations of iperfBytesPerOp bytes,
+// over streams parallel streams. With reverse, the server sends the data.
+func runIperf(b *testing.B, clientMachine, serverMachine harness.Machine, cpus harness.CPUPartition, streams int, reverse bool) {
+	b.StopTimer()
+	ctx := h.Context()
+
+	server := serverMachine.GetContainer(ctx, b)
+	defer server.CleanUp(ctx)
+	serverOpts := dockerutil.RunOpts{
+		Image: "benchmarks/iperf",
+		Ports: []int{iperfPort},
+	}
+	cpus.ApplyServer(&serverOpts)
+	if err := server.Spawn(ctx, serverOpts, "iperf3", "-s"); err != nil {
+		b.Fatalf("failed to start server: %v", err)
+	}
+	if err := harness.VerifyRuntime(ctx, server); err != nil {
+		b.Fatalf("server runs under the wrong runtime: %v", err)
+	}
+	ip, port, err := serverMachine.PublishedAddr(ctx, server, iperfPort)
+	if err != nil {
+		b.Fatalf("failed to find server address: %v", err)
+	}
+	utility, err := clientMachine.UtilityContainer(ctx)
+	if err != nil {
+		b.Fatalf("failed to get utility container: %v", err)
+	}
+	if err := harness.WaitUntilServing(ctx, utility, server, ip, port, time.Minute); err != nil {
+		b.Fatalf("server did not start: %v", err)
+	}
+
+	client := clientMachine.GetClientContainer(ctx, b)
+	defer client.CleanUp(ctx)
+	args := []string{
+		"iperf3", "--json",
+		"-c", ip.String(),
+		"-p", fmt.Sprintf("%d", port),
+		"-P", fmt.Sprintf("%d", streams),
+		"-n", fmt.Sprintf("%d", b.N*iperfBytesPerOp),
+	}
+	if reverse {
+		args = append(args, "-R")
+	}
+	clientOpts := dockerutil.RunOpts{
+		Image: "benchmarks/iperf",
+	}
+	cpus.ApplyClient(&clientOpts)
+
+	b.ResetTimer()
+	b.StartTimer()
+	out, err := client.Run(ctx, clientOpts, args...)
+	b.StopTimer()
+	if err != nil {
+		b.Fatalf("iperf3 failed with: %v: %s", err, out)
+	}
+
+	bps, err := parseBandwidth(out)
+	if err != nil {
+		b.Fatalf("failed to parse bandwidth: %v", err)
+	}
+	r := h.Reporter(b)
+	r.ReportMetric(bps/1e9, "bandwidth[Gbps]")
+	cpus.Report(r)
+	r.Finish()
+}
+
+// iperfResult is the part of the --json output of iperf3 used here.
+type iperfResult struct {
+	End struct {
+		SumReceived struct {
+			BitsPerSecond float64 `json:"bits_per_second"`
+		} `json:"sum_received"`
+	} `json:"end"`
+
+	// Error describes why the test failed, if it did.
+	Error string `json:"error"`
+}
+
+// parseBandwidth parses the bandwidth measured by the receiver, in bits per
+// second, from the --json output of iperf3.
+func parseBandwidth(data string) (float64, error) {
+	var r iperfResult
+	if err := json.NewDecoder(strings.NewReader(data)).Decode(&r); err != nil {
+		return 0, fmt.Errorf("failed to decode %q: %v", data, err)
+	}
+	if r.Error != "" {
+		return 0, fmt.Errorf("iperf3 failed: %s", r.Error)
+	}
+	if r.End.SumReceived.BitsPerSecond == 0 {
+		return 0, fmt.Errorf("no bandwidth received: %s", data)
+	}
+	return r.End.SumReceived.BitsPerSecond, nil
+}
+
+// sampleData is sample --json output from iperf3, trimmed.
+const sampleData = `{
+	"start":	{
+		"connected":	[{
+				"socket":	5,
+				"local_host":	"172.17.0.3",
+				"local_port":	44312,
+				"remote_host":	"172.17.0.2",
+				"remote_port":	5201
+			}],
+		"version":	"iperf 3.1.3",
+		"test_start":	{
+			"protocol":	"TCP",
+			"num_streams":	1,
+			"blksize":	131072,
+			"omit":	0,
+			"duration":	0,
+			"bytes":	104857600,
+			"blocks":	0,
+			"reverse":	0
+		}
+	},
+	"intervals":	[],
+	"end":	{
+		"streams":	[],
+		"sum_sent":	{
+			"start":	0,
+			"end":	0.036906,
+			"seconds":	0.036906,
+			"bytes":	104857600,
+			"bits_per_second":	22729780035.1,
+			"retransmits":	0
+		},
+		"sum_received":	{
+			"start":	0,
+			"end":	0.037120,
+			"seconds":	0.037120,
+			"bytes":	104857600,
+			"bits_per_second":	22598734918.3
+		}
+	}
+}`
+
+// errorSampleData is sample --json output from iperf3 when it fails.
+const errorSampleData = `{
+	"start":	{
+		"connected":	[],
+		"version":	"iperf 3.1.3"
+	},
+	"intervals":	[],
+	"end":	{
+	},
+	"error":	"unable to connect to server: Connection refused"
+}`
+
+// TestParsers checks the parsers work.
+func TestParsers(t *testing.T) {
+	want := 22598734918.3
+	got, err := parseBandwidth(sampleData)
+	if err != nil {
+		t.Fatalf("failed to parse bandwidth with error: %v", err)
+	} else if got != want {
+		t.Fatalf("parseBandwidth got: %f, want: %f", got, want)
+	}
+
+	for _, data := range []string{errorSampleData, "garbage"} {
+		if got, err := parseBandwidth(data); err == nil {
+			t.Errorf("parseBandwidth got: %f for %q, want error", got, data)
+		}
+	}
+}
+
+// TestPublishedAddr checks that an iperf3 server is reachable from the client
+// machine at its published address. It covers remote machines when run with
+// --client-host and --server-host.
+func TestPublishedAddr(t *testing.T) {
+	harness.Requires(t)
+	clientMachine, err := h.GetClientMachine()
+	if err != nil {
+		t.Fatalf("failed to get client machine: %v", err)
+	}
+	defer clientMachine.CleanUp()
+	serverMachine, err := h.GetMachine()
+	if err != nil {
+		t.Fatalf("failed to get server machine: %v", err)
+	}
+	defer serverMachine.CleanUp()
+
+	ctx := h.Context()
+	server := serverMachine.GetContainer(ctx, t)
+	defer server.CleanUp(ctx)
+	if err := server.Spawn(ctx, dockerutil.RunOpts{
+		Image: "benchmarks/iperf",
+		Ports: []int{iperfPort},
+	}, "iperf3", "-s"); err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	ip, port, err := serverMachine.PublishedAddr(ctx, server, iperfPort)
+	if err != nil {
+		t.Fatalf("PublishedAddr failed: %v", err)
+	}
+
+	// Local machines share the docker network, so the server is reached
+	// directly; remote ones through its published port.
+	containerIP, err := server.FindIP(ctx)
+	if err != nil {
+		t.Fatalf("failed to find container IP: %v", err)
+	}
+	wantPort := iperfPort
+	if !ip.Equal(containerIP) {
+		if wantPort, err = server.FindPort(ctx, iperfPort); err != nil {
+			t.Fatalf("failed to find published port: %v", err)
+		}
+	}
+	if port != wantPort {
+		t.Errorf("got address %s:%d, want port %d", ip, port, wantPort)
+	}
+
+	utility, err := clientMachine.UtilityContainer(ctx)
+	if err != nil {
+		t.Fatalf("failed to get utility container: %v", err)
+	}
+	if err := harness.WaitUntilServing(ctx, utility, server, ip, port, time.Minute); err != nil {
+		t.Errorf("server is not reachable at %s:%d: %v", ip, port, err)
+	}
+}
+
+// TestMain initializes the harness before running the benchmarks.
+func TestMain(m *testing.M) {
+	if err := h.Init(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize harness: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
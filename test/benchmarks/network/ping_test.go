@@ -0,0 +1,361 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+var pingGateway = flag.Bool("ping-gateway", false, "also ping the client's gateway, i.e. the host, as a baseline for BenchmarkPing")
+
+// pingCount is the number of echo requests of a ping run.
+const pingCount = 1000
+
+// tcprrPort is the port tcprr servers listen on.
+const tcprrPort = 7000
+
+// netlatContainers starts the server and client containers of the latency
+// benchmarks. The server runs cmd; the client idles, for commands to be
+// exec'd in. They must be cleaned up.
+func netlatContainers(b *testing.B, clientMachine, serverMachine harness.Machine, cmd ...string) (server, client *dockerutil.Container) {
+	ctx := h.Context()
+	server = serverMachine.GetContainer(ctx, b)
+	if err := server.Spawn(ctx, dockerutil.RunOpts{
+		Image: "benchmarks/netlat",
+		Ports: []int{tcprrPort},
+	}, cmd...); err != nil {
+		server.CleanUp(ctx)
+		b.Fatalf("failed to start server: %v", err)
+	}
+	if err := harness.VerifyRuntime(ctx, server); err != nil {
+		server.CleanUp(ctx)
+		b.Fatalf("server runs under the wrong runtime: %v", err)
+	}
+	client = clientMachine.GetClientContainer(ctx, b)
+	if err := client.Spawn(ctx, dockerutil.RunOpts{
+		Image: "benchmarks/netlat",
+	}, "sleep", "infinity"); err != nil {
+		server.CleanUp(ctx)
+		client.CleanUp(ctx)
+		b.Fatalf("failed to start client: %v", err)
+	}
+	return server, client
+}
+
+// BenchmarkPing measures the round-trip time of ICMP echo requests from a
+// client container to a server container, which answers them in its network
+// stack. With --ping-gateway, the client's gateway is pinged too, as a
+// baseline. Pings need the client and server on the same host, as containers
+// are not reachable across hosts.
+//
+// Each run sends pingCount echo requests regardless of b.N, 10ms apart, and
+// ns/op is the mean round-trip time.
+func BenchmarkPing(b *testing.B) {
+	clientMachine, err := h.GetClientMachine()
+	if err != nil {
+		b.Fatalf("failed to get client machine: %v", err)
+	}
+	defer clientMachine.CleanUp()
+	serverMachine, err := h.GetMachine()
+	if err != nil {
+		b.Fatalf("failed to get server machine: %v", err)
+	}
+	defer serverMachine.CleanUp()
+
+	ctx := h.Context()
+	server, client := netlatContainers(b, clientMachine, serverMachine, "sleep", "infinity")
+	defer server.CleanUp(ctx)
+	defer client.CleanUp(ctx)
+
+	ip, err := server.FindIP(ctx)
+	if err != nil {
+		b.Fatalf("failed to find server IP: %v", err)
+	}
+	targets := []struct {
+		name string
+		addr string
+	}{
+		{name: "Server", addr: ip.String()},
+	}
+	if *pingGateway {
+		out, err := client.Exec(ctx, dockerutil.ExecOpts{}, "sh", "-c", "ip route | awk '/^default/ { print $3 }'")
+		if err != nil {
+			b.Fatalf("failed to find gateway: %v: %s", err, out)
+		}
+		targets = append(targets, struct {
+			name string
+			addr string
+		}{name: "Gateway", addr: strings.TrimSpace(out)})
+	}
+
+	for _, target := range targets {
+		b.Run(target.name, func(b *testing.B) {
+			runPing(b, client, target.addr)
+		})
+	}
+}
+
+// runPing runs a single ping benchmark from client to addr.
+func runPing(b *testing.B, client *dockerutil.Container, addr string) {
+	b.StopTimer()
+	// Intervals under 200ms need root, which the client is.
+	args := []string{"ping", "-q", "-c", strconv.Itoa(pingCount), "-i", "0.01", addr}
+	b.ResetTimer()
+	b.StartTimer()
+	out, err := client.Exec(h.Context(), dockerutil.ExecOpts{}, args...)
+	b.StopTimer()
+	if err != nil {
+		b.Fatalf("ping failed with: %v: %s", err, out)
+	}
+
+	loss, err := parsePacketLoss(out)
+	if err != nil {
+		b.Fatalf("failed to parse packet loss: %v", err)
+	}
+	rtt, err := parseRTT(out)
+	if err != nil {
+		b.Fatalf("failed to parse round-trip times: %v", err)
+	}
+	r := h.Reporter(b)
+	reportRTT(r, rtt)
+	r.ReportMetric(loss, "packet_loss[%]")
+	r.Finish()
+}
+
+// BenchmarkTCPRR measures the round-trip time of request-response
+// transactions over a TCP connection, from a client container to a server
+// container echoing them. ns/op is the time per transaction.
+func BenchmarkTCPRR(b *testing.B) {
+	clientMachine, err := h.GetClientMachine()
+	if err != nil {
+		b.Fatalf("failed to get client machine: %v", err)
+	}
+	defer clientMachine.CleanUp()
+	serverMachine, err := h.GetMachine()
+	if err != nil {
+		b.Fatalf("failed to get server machine: %v", err)
+	}
+	defer serverMachine.CleanUp()
+
+	ctx := h.Context()
+	server, client := netlatContainers(b, clientMachine, serverMachine, "tcprr", "server", strconv.Itoa(tcprrPort))
+	defer server.CleanUp(ctx)
+	defer client.CleanUp(ctx)
+
+	ip, port, err := serverMachine.PublishedAddr(ctx, server, tcprrPort)
+	if err != nil {
+		b.Fatalf("failed to find server address: %v", err)
+	}
+	utility, err := clientMachine.UtilityContainer(ctx)
+	if err != nil {
+		b.Fatalf("failed to get utility container: %v", err)
+	}
+	if err := harness.WaitUntilServing(ctx, utility, server, ip, port, time.Minute); err != nil {
+		b.Fatalf("server did not start: %v", err)
+	}
+
+	b.ResetTimer()
+	out, err := client.Exec(ctx, dockerutil.ExecOpts{}, "tcprr", "client", ip.String(), strconv.Itoa(port), strconv.Itoa(b.N))
+	b.StopTimer()
+	if err != nil {
+		b.Fatalf("tcprr failed with: %v: %s", err, out)
+	}
+
+	tps, err := parseTransactionsPerSecond(out)
+	if err != nil {
+		b.Fatalf("failed to parse transactions: %v", err)
+	}
+	rtt, err := parseRTT(out)
+	if err != nil {
+		b.Fatalf("failed to parse round-trip times: %v", err)
+	}
+	r := h.Reporter(b)
+	reportRTT(r, rtt)
+	r.ReportMetric(tps, "tps")
+	r.Finish()
+}
+
+// rttStats are the round-trip times of a run, in ms.
+type rttStats struct {
+	min  float64
+	mean float64
+	max  float64
+
+	// mdev is the mean deviation, which busybox's ping doesn't print. It
+	// is negative then.
+	mdev float64
+}
+
+// reportRTT reports rtt. ns/op is the mean round-trip time.
+func reportRTT(b *harness.Reporter, rtt rttStats) {
+	b.ReportMetric(rtt.min, "min_rtt[ms]")
+	b.ReportMetric(rtt.mean, "mean_rtt[ms]")
+	b.ReportMetric(rtt.max, "max_rtt[ms]")
+	if rtt.mdev >= 0 {
+		b.ReportMetric(rtt.mdev, "mdev_rtt[ms]")
+	}
+	b.ReportMetric(rtt.mean*float64(time.Millisecond), "ns/op")
+}
+
+// rttRE matches the summary of round-trip times of iputils' ping, "rtt
+// min/avg/max/mdev = ...", and of busybox's, "round-trip min/avg/max = ...".
+var rttRE = regexp.MustCompile(`(?:rtt|round-trip) min/avg/max(/mdev)? = ([\d.]+)/([\d.]+)/([\d.]+)(?:/([\d.]+))? ms`)
+
+// parseRTT parses the summary of round-trip times from ping or tcprr output.
+func parseRTT(data string) (rttStats, error) {
+	match := rttRE.FindStringSubmatch(data)
+	if match == nil || (match[1] != "") != (match[5] != "") {
+		return rttStats{}, fmt.Errorf("failed to get round-trip times: %s", data)
+	}
+	var values [4]float64
+	values[3] = -1
+	for i, s := range match[2:] {
+		if s == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return rttStats{}, err
+		}
+		values[i] = v
+	}
+	return rttStats{min: values[0], mean: values[1], max: values[2], mdev: values[3]}, nil
+}
+
+var packetLossRE = regexp.MustCompile(`(\d+(?:\.\d+)?)% packet loss`)
+
+// parsePacketLoss parses the percentage of echo requests without a reply
+// from ping output.
+func parsePacketLoss(data string) (float64, error) {
+	match := packetLossRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, fmt.Errorf("failed to get packet loss: %s", data)
+	}
+	return strconv.ParseFloat(match[1], 64)
+}
+
+var transactionsRE = regexp.MustCompile(`(\d+) transactions in ([\d.]+) s`)
+
+// parseTransactionsPerSecond parses the rate of transactions from tcprr
+// output.
+func parseTransactionsPerSecond(data string) (float64, error) {
+	match := transactionsRE.FindStringSubmatch(data)
+	if len(match) < 3 {
+		return 0, fmt.Errorf("failed to get transactions: %s", data)
+	}
+	n, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	secs, err := strconv.ParseFloat(match[2], 64)
+	if err != nil {
+		return 0, err
+	}
+	if secs <= 0 {
+		return 0, fmt.Errorf("bad duration in %q", match[0])
+	}
+	return n / secs, nil
+}
+
+// iputilsSampleData is sample output from iputils' ping -q.
+const iputilsSampleData = `PING 172.17.0.3 (172.17.0.3) 56(84) bytes of data.
+
+--- 172.17.0.3 ping statistics ---
+1000 packets transmitted, 1000 received, 0% packet loss, time 10989ms
+rtt min/avg/max/mdev = 0.045/0.067/0.129/0.015 ms
+`
+
+// busyboxSampleData is sample output from busybox's ping -q, with losses.
+const busyboxSampleData = `PING 172.17.0.3 (172.17.0.3): 56 data bytes
+
+--- 172.17.0.3 ping statistics ---
+1000 packets transmitted, 998 packets received, 0.2% packet loss
+round-trip min/avg/max = 0.061/0.078/1.125 ms
+`
+
+// tcprrSampleData is sample output from tcprr.
+const tcprrSampleData = `20000 transactions in 0.812 s
+rtt min/avg/max/mdev = 0.031/0.040/0.522/0.009 ms
+`
+
+// TestPingParsers checks the ping and tcprr parsers work.
+func TestPingParsers(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data string
+		rtt  rttStats
+		loss float64
+	}{
+		{
+			name: "iputils",
+			data: iputilsSampleData,
+			rtt:  rttStats{min: 0.045, mean: 0.067, max: 0.129, mdev: 0.015},
+		},
+		{
+			name: "busybox",
+			data: busyboxSampleData,
+			rtt:  rttStats{min: 0.061, mean: 0.078, max: 1.125, mdev: -1},
+			loss: 0.2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rtt, err := parseRTT(tc.data)
+			if err != nil {
+				t.Fatalf("failed to parse round-trip times with error: %v", err)
+			} else if rtt != tc.rtt {
+				t.Errorf("parseRTT got: %+v, want: %+v", rtt, tc.rtt)
+			}
+			loss, err := parsePacketLoss(tc.data)
+			if err != nil {
+				t.Fatalf("failed to parse packet loss with error: %v", err)
+			} else if loss != tc.loss {
+				t.Errorf("parsePacketLoss got: %f, want: %f", loss, tc.loss)
+			}
+		})
+	}
+
+	want := rttStats{min: 0.031, mean: 0.040, max: 0.522, mdev: 0.009}
+	if got, err := parseRTT(tcprrSampleData); err != nil || got != want {
+		t.Errorf("parseRTT got: %+v, %v for tcprr output, want: %+v", got, err, want)
+	}
+	if got, err := parseTransactionsPerSecond(tcprrSampleData); err != nil || got != 20000/0.812 {
+		t.Errorf("parseTransactionsPerSecond got: %f, %v, want: %f", got, err, 20000/0.812)
+	}
+
+	for _, data := range []string{
+		"garbage",
+		"rtt min/avg/max/mdev = 0.045/0.067/0.129 ms",
+		"round-trip min/avg/max = 0.061/0.078/1.125/0.1 ms",
+	} {
+		if got, err := parseRTT(data); err == nil {
+			t.Errorf("parseRTT got: %+v for %q, want error", got, data)
+		}
+	}
+	if got, err := parsePacketLoss("garbage"); err == nil {
+		t.Errorf("parsePacketLoss got: %f for garbage, want error", got)
+	}
+	if got, err := parseTransactionsPerSecond("0 transactions in 0.000 s"); err == nil {
+		t.Errorf("parseTransactionsPerSecond got: %f without time, want error", got)
+	}
+}
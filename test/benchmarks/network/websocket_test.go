@@ -0,0 +1,180 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+var websocketMessageSize = flag.Int("websocket-message-size", 64, "size in bytes of the messages sent by BenchmarkWebSocket")
+
+// websocketPort is the port the WebSocket echo server listens on.
+const websocketPort = 8080
+
+// BenchmarkWebSocket measures the rate and round-trip latency of messages
+// echoed by a WebSocket server, over 10, 100 and 1000 concurrent connections
+// from a client container. Each connection waits for the echo of a message
+// before sending the next.
+//
+// Each iteration is one message; b.N messages are spread evenly over the
+// connections.
+func BenchmarkWebSocket(b *testing.B) {
+	clientMachine, err := h.GetClientMachine()
+	if err != nil {
+		b.Fatalf("failed to get client machine: %v", err)
+	}
+	defer clientMachine.CleanUp()
+	serverMachine, err := h.GetMachine()
+	if err != nil {
+		b.Fatalf("failed to get server machine: %v", err)
+	}
+	defer serverMachine.CleanUp()
+
+	for _, conns := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("%dConnections", conns), func(b *testing.B) {
+			runWebSocket(b, clientMachine, serverMachine, conns)
+		})
+	}
+}
+
+// runWebSocket runs a single benchmark over conns connections.
+func runWebSocket(b *testing.B, clientMachine, serverMachine harness.Machine, conns int) {
+	b.StopTimer()
+	ctx := h.Context()
+
+	server := serverMachine.GetContainer(ctx, b)
+	defer server.CleanUp(ctx)
+	if err := server.Spawn(ctx, dockerutil.RunOpts{
+		Image: "benchmarks/websocket",
+		Ports: []int{websocketPort},
+	}, "websocket-server", "--port", strconv.Itoa(websocketPort)); err != nil {
+		b.Fatalf("failed to start server: %v", err)
+	}
+	if err := harness.VerifyRuntime(ctx, server); err != nil {
+		b.Fatalf("server runs under the wrong runtime: %v", err)
+	}
+	ip, port, err := serverMachine.PublishedAddr(ctx, server, websocketPort)
+	if err != nil {
+		b.Fatalf("failed to find server address: %v", err)
+	}
+	utility, err := clientMachine.UtilityContainer(ctx)
+	if err != nil {
+		b.Fatalf("failed to get utility container: %v", err)
+	}
+	if err := harness.WaitUntilServing(ctx, utility, server, ip, port, time.Minute); err != nil {
+		b.Fatalf("server did not start: %v", err)
+	}
+
+	messages := (b.N + conns - 1) / conns
+	client := clientMachine.GetClientContainer(ctx, b)
+	defer client.CleanUp(ctx)
+	b.ResetTimer()
+	b.StartTimer()
+	out, err := client.Run(ctx, dockerutil.RunOpts{
+		Image: "benchmarks/websocket",
+	}, "websocket-client",
+		"--url", fmt.Sprintf("ws://%s:%d/echo", ip, port),
+		"--connections", strconv.Itoa(conns),
+		"--messages", strconv.Itoa(messages),
+		"--size", strconv.Itoa(*websocketMessageSize))
+	b.StopTimer()
+	if err != nil {
+		b.Fatalf("websocket-client failed with: %v: %s", err, out)
+	}
+
+	stats, err := parseWebSocketStats(out)
+	if err != nil {
+		b.Fatalf("failed to parse client output: %v", err)
+	}
+	r := h.Reporter(b)
+	r.ReportMetric(stats["messages_per_second"], "messages_per_second")
+	r.ReportMetric(stats["mean_latency_us"]/1e3, "mean_latency[ms]")
+	r.ReportMetric(stats["p50_latency_us"]/1e3, "p50_latency[ms]")
+	r.ReportMetric(stats["p99_latency_us"]/1e3, "p99_latency[ms]")
+	r.ReportMetric(stats["max_latency_us"]/1e3, "max_latency[ms]")
+	r.Finish()
+}
+
+// websocketStatRE matches a "<name> <value>" line of websocket-client output.
+var websocketStatRE = regexp.MustCompile(`(?m)^(\w+) (\d+(?:\.\d+)?)$`)
+
+// websocketStats are the metrics parseWebSocketStats requires.
+var websocketStats = []string{
+	"messages_per_second",
+	"mean_latency_us",
+	"p50_latency_us",
+	"p99_latency_us",
+	"max_latency_us",
+}
+
+// parseWebSocketStats parses the metrics printed by websocket-client.
+func parseWebSocketStats(data string) (map[string]float64, error) {
+	stats := make(map[string]float64)
+	for _, m := range websocketStatRE.FindAllStringSubmatch(data, -1) {
+		v, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %v", m[0], err)
+		}
+		stats[m[1]] = v
+	}
+	for _, name := range websocketStats {
+		if _, ok := stats[name]; !ok {
+			return nil, fmt.Errorf("no %s in output: %s", name, data)
+		}
+	}
+	return stats, nil
+}
+
+// sampleWebSocketData is sample output from websocket-client.
+const sampleWebSocketData = `connections 100
+messages 100000
+elapsed_seconds 1.284
+messages_per_second 77881.6
+mean_latency_us 1281.3
+p50_latency_us 1183.0
+p99_latency_us 3055.0
+max_latency_us 14012.7
+`
+
+// TestWebSocketParser tests parseWebSocketStats with sample data.
+func TestWebSocketParser(t *testing.T) {
+	stats, err := parseWebSocketStats(sampleWebSocketData)
+	if err != nil {
+		t.Fatalf("parseWebSocketStats failed: %v", err)
+	}
+	for name, want := range map[string]float64{
+		"messages_per_second": 77881.6,
+		"mean_latency_us":     1281.3,
+		"p50_latency_us":      1183.0,
+		"p99_latency_us":      3055.0,
+		"max_latency_us":      14012.7,
+	} {
+		if got := stats[name]; got != want {
+			t.Errorf("parseWebSocketStats %s got: %v, want: %v", name, got, want)
+		}
+	}
+
+	if _, err := parseWebSocketStats("connections 100\nmessages 0\n"); err == nil {
+		t.Errorf("parseWebSocketStats on truncated output succeeded, want error")
+	}
+}
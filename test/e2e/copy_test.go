@@ -0,0 +1,275 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+// testTree is a directory tree used by the copy tests, by path relative to
+// its root.
+var testTree = []struct {
+	path    string
+	mode    os.FileMode
+	content string
+}{
+	{path: "dir", mode: os.ModeDir | 0755},
+	{path: "dir/exec", mode: 0755, content: "#!/bin/sh\necho hello\n"},
+	{path: "dir/private", mode: 0600, content: "private\n"},
+	{path: "dir/sub", mode: os.ModeDir | 0700},
+	{path: "dir/sub/file", mode: 0644, content: "file\n"},
+	{path: "dir/link", mode: os.ModeSymlink | 0777, content: "sub/file"},
+}
+
+// makeTestTree creates testTree in a new temporary directory and returns
+// the path of its "dir" directory.
+func makeTestTree(t *testing.T) string {
+	t.Helper()
+	root, err := ioutil.TempDir(testutil.TmpDir(), "copy")
+	if err != nil {
+		t.Fatalf("TempDir(): %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+	for _, f := range testTree {
+		path := filepath.Join(root, f.path)
+		switch {
+		case f.mode.IsDir():
+			if err := os.Mkdir(path, f.mode.Perm()); err != nil {
+				t.Fatalf("Mkdir(): %v", err)
+			}
+		case f.mode&os.ModeSymlink != 0:
+			if err := os.Symlink(f.content, path); err != nil {
+				t.Fatalf("Symlink(): %v", err)
+			}
+			continue
+		default:
+			if err := ioutil.WriteFile(path, []byte(f.content), f.mode); err != nil {
+				t.Fatalf("WriteFile(): %v", err)
+			}
+		}
+		// Don't let the umask interfere.
+		if err := os.Chmod(path, f.mode.Perm()); err != nil {
+			t.Fatalf("Chmod(): %v", err)
+		}
+	}
+	return filepath.Join(root, "dir")
+}
+
+// TestCopyTo checks that a directory tree copied into a running container
+// keeps its contents and permissions.
+func TestCopyTo(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sleep", "1000"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+
+	if err := d.CopyTo(ctx, makeTestTree(t), "/tmp"); err != nil {
+		t.Fatalf("CopyTo failed: %v", err)
+	}
+
+	for _, f := range testTree {
+		path := filepath.Join("/tmp", f.path)
+		if f.mode&os.ModeSymlink != 0 {
+			got, err := d.Exec(ctx, dockerutil.ExecOpts{}, "readlink", path)
+			if err != nil {
+				t.Fatalf("docker exec failed: %v", err)
+			}
+			if want := f.content + "\n"; got != want {
+				t.Errorf("invalid target of %q, want: %q, got: %q", path, want, got)
+			}
+			continue
+		}
+		got, err := d.Exec(ctx, dockerutil.ExecOpts{}, "stat", "-c", "%a", path)
+		if err != nil {
+			t.Fatalf("docker exec failed: %v", err)
+		}
+		if want := fmt.Sprintf("%o", f.mode.Perm()); strings.TrimSpace(got) != want {
+			t.Errorf("invalid mode of %q, want: %s, got: %s", path, want, got)
+		}
+		if f.mode.IsDir() {
+			continue
+		}
+		got, err = d.Exec(ctx, dockerutil.ExecOpts{}, "cat", path)
+		if err != nil {
+			t.Fatalf("docker exec failed: %v", err)
+		}
+		if got != f.content {
+			t.Errorf("invalid content of %q, want: %q, got: %q", path, f.content, got)
+		}
+	}
+
+	// The copied script must still be executable.
+	got, err := d.Exec(ctx, dockerutil.ExecOpts{}, "/tmp/dir/exec")
+	if err != nil {
+		t.Fatalf("docker exec failed: %v", err)
+	}
+	if want := "hello\n"; got != want {
+		t.Errorf("invalid output, want: %q, got: %q", want, got)
+	}
+}
+
+// TestCopyToMissingPath checks that copying into a path that doesn't exist
+// in the container fails with a clear error.
+func TestCopyToMissingPath(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sleep", "1000"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+
+	if err := d.CopyTo(ctx, makeTestTree(t), "/does/not/exist"); !errors.Is(err, dockerutil.ErrNotExist) {
+		t.Errorf("CopyTo to missing path got err: %v, want: %v", err, dockerutil.ErrNotExist)
+	}
+}
+
+// hashTree returns the SHA-256 of each regular file, and the target of each
+// symlink, in the tree rooted at dir, by path relative to dir.
+func hashTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	hashes := make(map[string]string)
+	if err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			hashes[rel] = "-> " + target
+		case fi.Mode().IsRegular():
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			hashes[rel] = fmt.Sprintf("%x %o", sha256.Sum256(data), fi.Mode().Perm())
+		default:
+			hashes[rel] = fmt.Sprintf("dir %o", fi.Mode().Perm())
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("Walk(): %v", err)
+	}
+	return hashes
+}
+
+// TestCopyRoundTrip checks that a directory tree copied into a container
+// and back out is unchanged.
+func TestCopyRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sleep", "1000"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+
+	src := makeTestTree(t)
+	if err := d.CopyTo(ctx, src, "/tmp"); err != nil {
+		t.Fatalf("CopyTo failed: %v", err)
+	}
+	dst, err := ioutil.TempDir(testutil.TmpDir(), "copy-from")
+	if err != nil {
+		t.Fatalf("TempDir(): %v", err)
+	}
+	defer os.RemoveAll(dst)
+	if err := d.CopyFrom(ctx, "/tmp/dir", dst); err != nil {
+		t.Fatalf("CopyFrom failed: %v", err)
+	}
+
+	want := hashTree(t, src)
+	got := hashTree(t, filepath.Join(dst, "dir"))
+	for path, w := range want {
+		if g := got[path]; g != w {
+			t.Errorf("copied %q differs, want: %q, got: %q", path, w, g)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d copied files, want %d: %v", len(got), len(want), got)
+	}
+
+	if err := d.CopyFrom(ctx, "/does/not/exist", dst); !errors.Is(err, dockerutil.ErrNotExist) {
+		t.Errorf("CopyFrom of missing path got err: %v, want: %v", err, dockerutil.ErrNotExist)
+	}
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	if _, err := d.Run(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sh", "-c", "echo exported > /file"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+
+	// Read the archive as it is streamed.
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(d.Export(ctx, w))
+	}()
+	defer r.Close()
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			t.Fatalf("file not found in the exported archive")
+		}
+		if err != nil {
+			t.Fatalf("reading exported archive failed: %v", err)
+		}
+		if hdr.Name != "file" {
+			continue
+		}
+		got, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("reading file from the exported archive failed: %v", err)
+		}
+		if want := "exported\n"; string(got) != want {
+			t.Errorf("invalid file content, want: %q, got: %q", want, got)
+		}
+		return
+	}
+}
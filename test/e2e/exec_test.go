@@ -23,9 +23,13 @@ package integration
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"strconv"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -117,6 +121,65 @@ func TestExecPrivileged(t *testing.T) {
 	}
 }
 
+// TestCapabilities checks that containers get the same capabilities under
+// runsc as under runc. Capabilities that runsc doesn't support are ignored.
+func TestCapabilities(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts dockerutil.RunOpts
+	}{
+		{
+			name: "default",
+			opts: dockerutil.RunOpts{Image: "basic/alpine"},
+		},
+		{
+			name: "drop all",
+			opts: dockerutil.RunOpts{Image: "basic/alpine", CapDrop: []string{"ALL"}},
+		},
+		{
+			name: "privileged",
+			opts: dockerutil.RunOpts{Image: "basic/alpine", Privileged: true},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			sandboxed := dockerutil.MakeContainer(ctx, t)
+			defer sandboxed.CleanUp(ctx)
+			native := dockerutil.MakeContainerWithRuntime(ctx, t, "runc")
+			defer native.CleanUp(ctx)
+
+			var caps [2]uint64
+			for i, d := range []*dockerutil.Container{sandboxed, native} {
+				if err := d.Spawn(ctx, tc.opts, "sleep", "1000"); err != nil {
+					t.Fatalf("docker run failed: %v", err)
+				}
+				got, err := d.EffectiveCapabilities(ctx)
+				if err != nil {
+					t.Fatalf("EffectiveCapabilities() failed: %v", err)
+				}
+				caps[i] = got & specutils.AllCapabilitiesUint64()
+			}
+			if caps[0] != caps[1] {
+				t.Errorf("got capabilities %v, runc has %v", dockerutil.CapabilityNames(caps[0]), dockerutil.CapabilityNames(caps[1]))
+			}
+		})
+	}
+}
+
+func TestCapAdd(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image:  "basic/alpine",
+		CapAdd: []string{"NET_ADMIN"},
+	}, "sleep", "1000"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	dockerutil.AssertHasCapability(t, d, "CAP_NET_ADMIN")
+}
+
 func TestExecJobControl(t *testing.T) {
 	ctx := context.Background()
 	d := dockerutil.MakeContainer(ctx, t)
@@ -134,16 +197,16 @@ func TestExecJobControl(t *testing.T) {
 		t.Fatalf("docker exec failed: %v", err)
 	}
 
-	if _, err = p.Write(time.Second, []byte("sleep 100 | cat\n")); err != nil {
+	if _, err = p.Write([]byte("sleep 100 | cat\n")); err != nil {
 		t.Fatalf("error exit: %v", err)
 	}
 	time.Sleep(time.Second)
 
-	if _, err = p.Write(time.Second, []byte{0x03}); err != nil {
+	if _, err = p.Write([]byte{0x03}); err != nil {
 		t.Fatalf("error exit: %v", err)
 	}
 
-	if _, err = p.Write(time.Second, []byte("exit $(expr $? + 10)\n")); err != nil {
+	if _, err = p.Write([]byte("exit $(expr $? + 10)\n")); err != nil {
 		t.Fatalf("error exit: %v", err)
 	}
 
@@ -156,6 +219,189 @@ func TestExecJobControl(t *testing.T) {
 	}
 }
 
+// TestExecInteractive tests reading, writing and resizing the TTY of an
+// interactive shell.
+func TestExecInteractive(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	// Start the container.
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sleep", "1000"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+
+	p, err := d.ExecProcess(ctx, dockerutil.ExecOpts{UseTTY: true}, "/bin/sh")
+	if err != nil {
+		t.Fatalf("docker exec failed: %v", err)
+	}
+	if err := p.ResizeTTY(ctx, 24, 100); err != nil {
+		t.Fatalf("resize failed: %v", err)
+	}
+	if _, err := p.Write([]byte("stty size\n")); err != nil {
+		t.Fatalf("error writing: %v", err)
+	}
+
+	// The TTY echoes the command before its output.
+	const want = "24 100"
+	for i := 0; ; i++ {
+		line, err := p.ReadLine()
+		if err != nil {
+			t.Fatalf("error reading: %v", err)
+		}
+		if strings.TrimSpace(line) == want {
+			break
+		}
+		if i == 10 {
+			t.Fatalf("TTY size %q not found in output", want)
+		}
+	}
+
+	if _, err := p.Write([]byte("exit 3\n")); err != nil {
+		t.Fatalf("error writing: %v", err)
+	}
+	if got, err := p.WaitExitStatus(ctx); err != nil {
+		t.Fatalf("wait for exit failed with: %v", err)
+	} else if got != 3 {
+		t.Fatalf("wait for exit returned: %d want: 3", got)
+	}
+
+	if _, err := p.Write([]byte("echo\n")); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("write after exit returned: %v, want: %v", err, io.ErrClosedPipe)
+	}
+}
+
+// TestExecReadDemultiplexes tests that reading the output of a process
+// without a TTY returns both stdout and stderr.
+func TestExecReadDemultiplexes(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	// Start the container.
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sleep", "1000"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+
+	p, err := d.ExecProcess(ctx, dockerutil.ExecOpts{}, "sh", "-c", "echo out; sleep 0.1; echo err >&2")
+	if err != nil {
+		t.Fatalf("docker exec failed: %v", err)
+	}
+	got, err := ioutil.ReadAll(&p)
+	if err != nil {
+		t.Fatalf("error reading: %v", err)
+	}
+	if want := "out\nerr\n"; string(got) != want {
+		t.Errorf("wrong output, got: %q, want: %q", got, want)
+	}
+}
+
+// TestExecSignal tests that a signal sent to an execed process runs its
+// handler, unless the signal can't be caught.
+func TestExecSignal(t *testing.T) {
+	for _, tc := range []struct {
+		sig      syscall.Signal
+		trapped  bool
+		exitCode int
+	}{
+		{sig: syscall.SIGTERM, trapped: true, exitCode: 0},
+		{sig: syscall.SIGKILL, trapped: false, exitCode: 128 + int(syscall.SIGKILL)},
+	} {
+		t.Run(tc.sig.String(), func(t *testing.T) {
+			ctx := context.Background()
+			d := dockerutil.MakeContainer(ctx, t)
+			defer d.CleanUp(ctx)
+
+			// Start the container.
+			if err := d.Spawn(ctx, dockerutil.RunOpts{
+				Image: "basic/alpine",
+			}, "sleep", "1000"); err != nil {
+				t.Fatalf("docker run failed: %v", err)
+			}
+
+			p, err := d.ExecProcess(ctx, dockerutil.ExecOpts{}, "sh", "-c", "trap 'echo trapped; exit 0' TERM; echo ready; while true; do sleep 0.1; done")
+			if err != nil {
+				t.Fatalf("docker exec failed: %v", err)
+			}
+			if line, err := p.ReadLine(); err != nil || line != "ready" {
+				t.Fatalf("got output: %q, %v, want: %q", line, err, "ready")
+			}
+
+			if err := p.Signal(ctx, tc.sig); err != nil {
+				t.Fatalf("signal failed: %v", err)
+			}
+			got, err := p.WaitExitStatus(ctx)
+			if err != nil {
+				t.Fatalf("wait for exit failed with: %v", err)
+			} else if got != tc.exitCode {
+				t.Errorf("wait for exit returned: %d want: %d", got, tc.exitCode)
+			}
+			// The exit status comes from the host process backing the exec, so
+			// check that the process in the container is gone too.
+			if pids, err := d.Exec(ctx, dockerutil.ExecOpts{}, "pgrep", "-f", "echo ready"); err == nil {
+				t.Errorf("process still running in the container with PIDs: %s", pids)
+			}
+			out, err := ioutil.ReadAll(&p)
+			if err != nil {
+				t.Fatalf("error reading: %v", err)
+			}
+			if trapped := strings.Contains(string(out), "trapped"); trapped != tc.trapped {
+				t.Errorf("handler ran: %t, want: %t, output: %q", trapped, tc.trapped, out)
+			}
+
+			if err := p.Signal(ctx, tc.sig); err != dockerutil.ErrProcessExited {
+				t.Errorf("signal after exit returned: %v, want: %v", err, dockerutil.ErrProcessExited)
+			}
+		})
+	}
+}
+
+// TestExecSignalSameCommand checks that signaling an execed process doesn't
+// signal other processes running the same command.
+func TestExecSignalSameCommand(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	// The init process runs the same command as the execs.
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sleep", "1000"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	var procs [2]dockerutil.Process
+	for i := range procs {
+		p, err := d.ExecProcess(ctx, dockerutil.ExecOpts{}, "sleep", "1000")
+		if err != nil {
+			t.Fatalf("docker exec failed: %v", err)
+		}
+		procs[i] = p
+	}
+
+	if err := procs[0].Signal(ctx, syscall.SIGKILL); err != nil {
+		t.Fatalf("signal failed: %v", err)
+	}
+	if got, err := procs[0].WaitExitStatus(ctx); err != nil {
+		t.Fatalf("wait for exit failed with: %v", err)
+	} else if want := 128 + int(syscall.SIGKILL); got != want {
+		t.Errorf("wait for exit returned: %d want: %d", got, want)
+	}
+	if running, err := procs[1].IsRunning(ctx); err != nil {
+		t.Fatalf("IsRunning() failed: %v", err)
+	} else if !running {
+		t.Errorf("other exec of the same command was signaled")
+	}
+	if status, err := d.Status(ctx); err != nil {
+		t.Fatalf("docker inspect failed: %v", err)
+	} else if !status.Running {
+		t.Errorf("container init process was signaled")
+	}
+}
+
 // Test that failure to exec returns proper error message.
 func TestExecError(t *testing.T) {
 	ctx := context.Background()
@@ -0,0 +1,182 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+// TestEnsureImage checks that a missing image is pulled when several tests
+// need it concurrently.
+func TestEnsureImage(t *testing.T) {
+	ctx := context.Background()
+	cli, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		t.Fatalf("docker client failed: %v", err)
+	}
+	cli.NegotiateAPIVersion(ctx)
+
+	// Images used by tests are built locally and can't be pulled, so use a
+	// small public image instead.
+	const image = "busybox:1.32"
+	if _, err := cli.ImageRemove(ctx, image, types.ImageRemoveOptions{Force: true}); err != nil && !client.IsErrNotFound(err) {
+		t.Fatalf("docker rmi failed: %v", err)
+	}
+
+	const parallel = 4
+	errs := make([]error, parallel)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = dockerutil.EnsureImage(ctx, cli, image)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("EnsureImage failed: %v", err)
+		}
+	}
+
+	images, err := cli.ImageList(ctx, types.ImageListOptions{
+		Filters: filters.NewArgs(filters.Arg("reference", image)),
+	})
+	if err != nil {
+		t.Fatalf("docker images failed: %v", err)
+	}
+	if len(images) != 1 {
+		t.Errorf("got %d images for %q after EnsureImage, want 1", len(images), image)
+	}
+}
+
+// TestBuildImage checks that an image built from a Dockerfile can be run.
+func TestBuildImage(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir(testutil.TmpDir(), "build")
+	if err != nil {
+		t.Fatalf("TempDir(): %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dockerfile := fmt.Sprintf("FROM %s\nARG MESSAGE\nRUN echo ${MESSAGE} > /built\n", testutil.ImageByName("basic/alpine"))
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(dockerfile), 0644); err != nil {
+		t.Fatalf("WriteFile(): %v", err)
+	}
+	image, err := dockerutil.BuildImage(ctx, t, dockerutil.BuildOpts{
+		ContextDir: dir,
+		BuildArgs:  map[string]string{"MESSAGE": "hello"},
+	})
+	if err != nil {
+		t.Fatalf("docker build failed: %v", err)
+	}
+
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+	got, err := d.Run(ctx, dockerutil.RunOpts{Image: image}, "cat", "/built")
+	if err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	if want := "hello\n"; got != want {
+		t.Errorf("invalid file content, want: %q, got: %q", want, got)
+	}
+}
+
+// TestCommit checks that changes made in a container are visible in a
+// container started from its committed image.
+func TestCommit(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	if _, err := d.Run(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sh", "-c", "echo committed > /file"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	image := "commit/" + strings.ToLower(d.Name)
+	_, cleanup, err := d.Commit(ctx, image, "CMD cat /file")
+	if err != nil {
+		t.Fatalf("docker commit failed: %v", err)
+	}
+	defer cleanup()
+
+	d2 := dockerutil.MakeContainer(ctx, t)
+	defer d2.CleanUp(ctx)
+	got, err := d2.Run(ctx, dockerutil.RunOpts{Image: image})
+	if err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	if want := "committed\n"; got != want {
+		t.Errorf("invalid file content, want: %q, got: %q", want, got)
+	}
+}
+
+func TestImportImage(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	if _, err := d.Run(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sh", "-c", "echo imported > /file"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+
+	image := "import/" + strings.ToLower(d.Name)
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(d.Export(ctx, w))
+	}()
+	if err := dockerutil.ImportImage(ctx, r, image); err != nil {
+		t.Fatalf("ImportImage() failed: %v", err)
+	}
+	defer func() {
+		client, err := client.NewClientWithOpts(client.FromEnv)
+		if err != nil {
+			t.Fatalf("docker client failed: %v", err)
+		}
+		client.NegotiateAPIVersion(ctx)
+		if _, err := client.ImageRemove(ctx, testutil.ImageByName(image), types.ImageRemoveOptions{Force: true}); err != nil {
+			t.Errorf("docker rmi failed: %v", err)
+		}
+	}()
+
+	// Imported images have no command, so give one.
+	d2 := dockerutil.MakeContainer(ctx, t)
+	defer d2.CleanUp(ctx)
+	got, err := d2.Run(ctx, dockerutil.RunOpts{Image: image}, "cat", "/file")
+	if err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	if want := "imported\n"; got != want {
+		t.Errorf("invalid file content, want: %q, got: %q", want, got)
+	}
+}
@@ -23,6 +23,7 @@ package integration
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -35,7 +36,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
+	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/test/dockerutil"
 	"gvisor.dev/gvisor/pkg/test/testutil"
 )
@@ -92,6 +95,754 @@ func TestLifeCycle(t *testing.T) {
 	}
 }
 
+// TestReadOnlyServes checks that a server runs with a read-only rootfs, given
+// the paths it writes to.
+func TestReadOnlyServes(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	// nginx writes its PID file to /var/run, which is kept writable.
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image:         "basic/nginx",
+		Ports:         []int{80},
+		ReadOnly:      true,
+		WritablePaths: []string{"/var/cache/nginx"},
+	}); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+
+	port, err := d.FindPort(ctx, 80)
+	if err != nil {
+		t.Fatalf("docker.FindPort(80) failed: %v", err)
+	}
+	if err := testutil.WaitForHTTP(port, 30*time.Second); err != nil {
+		t.Fatalf("WaitForHTTP() timeout: %v", err)
+	}
+	client := http.Client{Timeout: time.Duration(2 * time.Second)}
+	if err := httpRequestSucceeds(client, "localhost", port); err != nil {
+		t.Errorf("http request failed: %v", err)
+	}
+
+	// Everything else is read-only.
+	if _, err := d.Exec(ctx, dockerutil.ExecOpts{}, "touch", "/etc/nginx/file"); err == nil {
+		t.Errorf("writing to the read-only rootfs succeeded")
+	}
+}
+
+// TestStopSignal checks that stopping a container delivers the configured
+// stop signal to it.
+func TestStopSignal(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image:      "basic/alpine",
+		StopSignal: "SIGUSR1",
+	}, "sh", "-c", "trap 'echo got SIGUSR1; exit 0' USR1; echo ready; while true; do sleep 0.1; done"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	if _, err := d.WaitForOutput(ctx, "ready", 5*time.Second); err != nil {
+		t.Fatalf("WaitForOutput() failed: %v", err)
+	}
+
+	if err := d.Stop(ctx); err != nil {
+		t.Fatalf("docker stop failed: %v", err)
+	}
+	logs, err := d.Logs(ctx)
+	if err != nil {
+		t.Fatalf("docker logs failed: %v", err)
+	}
+	if want := "got SIGUSR1"; !strings.Contains(logs, want) {
+		t.Errorf("signal handler didn't run, logs: %q, want to contain: %q", logs, want)
+	}
+}
+
+// TestKillSignal checks that Kill delivers the requested signal.
+func TestKillSignal(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sh", "-c", "trap 'echo got SIGUSR1; exit 0' USR1; echo ready; while true; do sleep 0.1; done"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	if _, err := d.WaitForOutput(ctx, "ready", 5*time.Second); err != nil {
+		t.Fatalf("WaitForOutput() failed: %v", err)
+	}
+
+	if err := d.Kill(ctx, "SIGUSR1"); err != nil {
+		t.Fatalf("docker kill failed: %v", err)
+	}
+	if _, err := d.WaitForOutput(ctx, "got SIGUSR1", 5*time.Second); err != nil {
+		t.Errorf("signal handler didn't run: %v", err)
+	}
+}
+
+func TestDieEvent(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sleep", "1000"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+
+	if err := d.Kill(ctx, "SIGKILL"); err != nil {
+		t.Fatalf("docker kill failed: %v", err)
+	}
+	msg, err := d.WaitForEvent(ctx, "die", 10*time.Second)
+	if err != nil {
+		t.Fatalf("WaitForEvent() failed: %v", err)
+	}
+	if msg.Actor.ID != d.ID() {
+		t.Errorf("got event for container %q, want %q", msg.Actor.ID, d.ID())
+	}
+	// Killed by SIGKILL: 128 + 9.
+	if got, want := msg.Actor.Attributes["exitCode"], "137"; got != want {
+		t.Errorf("got exit code %q, want %q", got, want)
+	}
+}
+
+func TestMixedRuntimes(t *testing.T) {
+	ctx := context.Background()
+	sandboxed := dockerutil.MakeContainer(ctx, t)
+	defer sandboxed.CleanUp(ctx)
+	native := dockerutil.MakeContainerWithRuntime(ctx, t, "runc")
+	defer native.CleanUp(ctx)
+
+	for _, d := range []*dockerutil.Container{sandboxed, native} {
+		if err := d.Spawn(ctx, dockerutil.RunOpts{
+			Image: "basic/alpine",
+		}, "sleep", "1000"); err != nil {
+			t.Fatalf("docker run with runtime %q failed: %v", d.Runtime, err)
+		}
+		got, err := d.EffectiveRuntime(ctx)
+		if err != nil {
+			t.Fatalf("EffectiveRuntime() failed: %v", err)
+		}
+		if got != d.Runtime {
+			t.Errorf("got runtime %q, want %q", got, d.Runtime)
+		}
+	}
+
+	// Both containers must be removable, whichever runtime they use.
+	for _, d := range []*dockerutil.Container{sandboxed, native} {
+		if err := d.Remove(ctx); err != nil {
+			t.Errorf("docker rm with runtime %q failed: %v", d.Runtime, err)
+		}
+	}
+}
+
+func TestRename(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sh", "-c", "echo started; sleep 1000"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	if _, err := d.WaitForOutput(ctx, "started", 5*time.Second); err != nil {
+		t.Fatalf("WaitForOutput() failed: %v", err)
+	}
+
+	newName := d.Name + "-renamed"
+	if err := d.Rename(ctx, newName); err != nil {
+		t.Fatalf("docker rename failed: %v", err)
+	}
+	if d.Name != newName {
+		t.Errorf("got name %q after rename, want %q", d.Name, newName)
+	}
+
+	// Everything should keep working after the rename.
+	logs, err := d.Logs(ctx)
+	if err != nil {
+		t.Fatalf("docker logs failed: %v", err)
+	}
+	if !strings.Contains(logs, "started") {
+		t.Errorf("got logs %q, want to contain %q", logs, "started")
+	}
+	if err := d.Stop(ctx); err != nil {
+		t.Fatalf("docker stop failed: %v", err)
+	}
+	if err := d.Remove(ctx); err != nil {
+		t.Fatalf("docker rm failed: %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	if _, err := d.Run(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sh", "-c", "touch /tmp/foo && rm /etc/hostname"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+
+	changes, err := d.Diff(ctx)
+	if err != nil {
+		t.Fatalf("docker diff failed: %v", err)
+	}
+	want := map[string]dockerutil.ChangeKind{
+		"/tmp/foo":      dockerutil.ChangeAdded,
+		"/etc/hostname": dockerutil.ChangeDeleted,
+	}
+	for _, c := range changes {
+		if kind, ok := want[c.Path]; ok {
+			if c.Kind != kind {
+				t.Errorf("got %s, want %s %s", c, kind, c.Path)
+			}
+			delete(want, c.Path)
+		}
+	}
+	for path, kind := range want {
+		t.Errorf("change %s %s not reported, got: %v", kind, path, changes)
+	}
+	dockerutil.AssertOnlyChanged(t, changes, "/tmp/foo", "/etc/hostname")
+}
+
+// TestNamedVolume checks that data written to a named volume survives the
+// removal of the container that wrote it.
+func TestNamedVolume(t *testing.T) {
+	ctx := context.Background()
+	v := dockerutil.NewVolume(ctx, t)
+	if err := v.Create(ctx); err != nil {
+		t.Fatalf("docker volume create failed: %v", err)
+	}
+	defer func() {
+		if err := v.Remove(ctx); err != nil {
+			t.Errorf("docker volume rm failed: %v", err)
+		}
+	}()
+
+	writer := dockerutil.MakeContainer(ctx, t)
+	opts := dockerutil.RunOpts{Image: "basic/alpine"}
+	opts.AddNamedVolume(v.Name, "/data")
+	if _, err := writer.Run(ctx, opts, "sh", "-c", "echo persisted > /data/file"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	if err := writer.CleanUp(ctx); err != nil {
+		t.Fatalf("CleanUp() failed: %v", err)
+	}
+
+	reader := dockerutil.MakeContainer(ctx, t)
+	defer reader.CleanUp(ctx)
+	got, err := reader.Run(ctx, opts, "cat", "/data/file")
+	if err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	if want := "persisted\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAutoRemove(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image:      "basic/alpine",
+		AutoRemove: true,
+	}, "echo", "removed"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	if _, err := d.WaitForOutput(ctx, "removed", 30*time.Second); err != nil {
+		t.Fatalf("WaitForOutput() failed: %v", err)
+	}
+
+	// The daemon removes the container shortly after it exits, from which
+	// point its logs are gone.
+	if err := testutil.Poll(func() error {
+		if _, err := d.Logs(ctx); !errors.Is(err, dockerutil.ErrContainerRemoved) {
+			return fmt.Errorf("Logs() got err %v, want %v", err, dockerutil.ErrContainerRemoved)
+		}
+		return nil
+	}, 30*time.Second); err != nil {
+		t.Fatalf("container was not removed: %v", err)
+	}
+	if err := d.CleanUp(ctx); err != nil {
+		t.Errorf("CleanUp() failed: %v", err)
+	}
+}
+
+// cmdline returns the command line of the host process pid.
+func cmdline(t *testing.T, pid int) []string {
+	t.Helper()
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		t.Fatalf("failed to read command line of process %d: %v", pid, err)
+	}
+	return strings.Split(strings.TrimRight(string(b), "\x00"), "\x00")
+}
+
+func TestSandboxProcesses(t *testing.T) {
+	ctx := context.Background()
+	sandboxed := dockerutil.MakeContainer(ctx, t)
+	defer sandboxed.CleanUp(ctx)
+	native := dockerutil.MakeContainerWithRuntime(ctx, t, "runc")
+	defer native.CleanUp(ctx)
+
+	for _, d := range []*dockerutil.Container{sandboxed, native} {
+		if err := d.Spawn(ctx, dockerutil.RunOpts{
+			Image: "basic/alpine",
+		}, "sleep", "1000"); err != nil {
+			t.Fatalf("docker run with runtime %q failed: %v", d.Runtime, err)
+		}
+	}
+
+	procs, err := sandboxed.SandboxProcesses(ctx)
+	if err != nil {
+		t.Fatalf("SandboxProcesses() failed: %v", err)
+	}
+	if procs.Sandbox == 0 {
+		// The tests may be run with --runtime=runc.
+		t.Logf("container with runtime %q is not sandboxed", sandboxed.Runtime)
+	} else {
+		if got := cmdline(t, procs.Sandbox)[0]; got != "runsc-sandbox" {
+			t.Errorf("got sandbox process %q, want runsc-sandbox", got)
+		}
+		if len(procs.Gofers) == 0 {
+			t.Errorf("no gofer processes found")
+		}
+		for _, pid := range procs.Gofers {
+			if got := cmdline(t, pid)[0]; got != "runsc-gofer" {
+				t.Errorf("got gofer process %q, want runsc-gofer", got)
+			}
+		}
+		if procs.Init != 1 {
+			t.Errorf("got init PID %d in the sandbox, want 1", procs.Init)
+		}
+	}
+
+	procs, err = native.SandboxProcesses(ctx)
+	if err != nil {
+		t.Fatalf("SandboxProcesses() failed: %v", err)
+	}
+	if procs.Sandbox != 0 || len(procs.Gofers) != 0 {
+		t.Errorf("got sandbox processes %+v under runc, want none", procs)
+	}
+	if got, want := strings.Join(cmdline(t, procs.Init), " "), "sleep 1000"; got != want {
+		t.Errorf("got init process %q, want %q", got, want)
+	}
+}
+
+func TestWaitHealthy(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name    string
+		check   *container.HealthConfig
+		wantErr string
+	}{
+		{
+			name: "healthy",
+			check: &container.HealthConfig{
+				Test:     []string{"CMD", "test", "-f", "/tmp/ready"},
+				Interval: 100 * time.Millisecond,
+			},
+		},
+		{
+			name: "unhealthy",
+			check: &container.HealthConfig{
+				Test:     []string{"CMD-SHELL", "echo probe failed; false"},
+				Interval: 100 * time.Millisecond,
+			},
+			wantErr: "probe failed",
+		},
+		{
+			name:    "no health check",
+			wantErr: dockerutil.ErrNoHealthCheck.Error(),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := dockerutil.MakeContainer(ctx, t)
+			defer d.CleanUp(ctx)
+
+			if err := d.Spawn(ctx, dockerutil.RunOpts{
+				Image:       "basic/alpine",
+				HealthCheck: tc.check,
+			}, "sh", "-c", "sleep 1; touch /tmp/ready; sleep 1000"); err != nil {
+				t.Fatalf("docker run failed: %v", err)
+			}
+
+			err := d.WaitHealthy(ctx, 5*time.Second)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("WaitHealthy() failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("WaitHealthy() got err %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestPod(t *testing.T) {
+	ctx := context.Background()
+	pod, err := dockerutil.NewPod(ctx, t)
+	if err != nil {
+		t.Fatalf("NewPod() failed: %v", err)
+	}
+	defer pod.CleanUp(ctx)
+
+	// The server listens on port 8080, see Dockerfile.
+	if _, err := pod.Add(ctx, dockerutil.RunOpts{
+		Image: "basic/python",
+	}); err != nil {
+		t.Fatalf("docker run of server failed: %v", err)
+	}
+	client, err := pod.Add(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sleep", "1000")
+	if err != nil {
+		t.Fatalf("docker run of client failed: %v", err)
+	}
+
+	// Retry until the server is up.
+	out, err := client.Exec(ctx, dockerutil.ExecOpts{}, "sh", "-c",
+		"for i in $(seq 50); do wget -qO- http://localhost:8080/ && exit 0; sleep 0.1; done; exit 1")
+	if err != nil {
+		t.Fatalf("fetching from server on localhost failed: %v", err)
+	}
+	if !strings.Contains(out, "Directory listing") {
+		t.Errorf("got response %q, want a directory listing", out)
+	}
+}
+
+func TestSkipAttach(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image:      "basic/alpine",
+		SkipAttach: true,
+	}, "sh", "-c", "echo hello; sleep 1; echo goodbye"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	if _, err := d.WaitForOutput(ctx, "goodbye", 5*time.Second); err != nil {
+		t.Errorf("WaitForOutput() failed: %v", err)
+	}
+	_, err := d.WaitForOutput(ctx, "never", 5*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "exited") {
+		t.Errorf("WaitForOutput() got err %v, want exited error", err)
+	}
+}
+
+// openFDs returns the number of file descriptors open in this process.
+func openFDs(t *testing.T) int {
+	t.Helper()
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Fatalf("failed to list file descriptors: %v", err)
+	}
+	return len(fds)
+}
+
+// TestManyDetachedContainers checks that containers started without
+// attaching don't hold file descriptors in the test.
+func TestManyDetachedContainers(t *testing.T) {
+	const (
+		containers = 200
+		parallel   = 10
+	)
+	ctx := context.Background()
+	before := openFDs(t)
+
+	ds := make([]*dockerutil.Container, containers)
+	for i := range ds {
+		ds[i] = dockerutil.MakeContainer(ctx, t)
+		defer ds[i].CleanUp(ctx)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, containers)
+	sem := make(chan struct{}, parallel)
+	for _, d := range ds {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(d *dockerutil.Container) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := d.Spawn(ctx, dockerutil.RunOpts{
+				Image:      "basic/alpine",
+				SkipAttach: true,
+			}, "sleep", "1000"); err != nil {
+				errs <- err
+			}
+		}(d)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("docker run failed: %v", err)
+	}
+
+	// Allow for idle connections to the daemon, but not one per container.
+	if after := openFDs(t); after-before >= containers/4 {
+		t.Errorf("got %d file descriptors open with %d containers running, had %d before", after, containers, before)
+	}
+}
+
+func TestCleanUpError(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sleep", "1000"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+
+	// A cancelled context abandons the calls to the daemon.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	err := d.CleanUp(cancelled)
+	var errs dockerutil.CleanUpError
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("CleanUp() with cancelled context got err %v, want kill and remove errors", err)
+	}
+	for _, err := range errs {
+		if !strings.Contains(err.Error(), context.Canceled.Error()) {
+			t.Errorf("got err %v, want %v", err, context.Canceled)
+		}
+	}
+
+	if err := d.CleanUp(ctx); err != nil {
+		t.Fatalf("CleanUp() failed: %v", err)
+	}
+	// Cleaning up again does nothing.
+	if err := d.CleanUp(ctx); err != nil {
+		t.Errorf("CleanUp() of removed container failed: %v", err)
+	}
+}
+
+func TestGPUs(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	// nvidia-smi is made available in the container by the nvidia runtime.
+	out, err := d.Run(ctx, dockerutil.RunOpts{
+		Image: "basic/ubuntu",
+		GPUs:  "all",
+	}, "nvidia-smi", "-L")
+	if errors.Is(err, dockerutil.ErrNoGPU) {
+		t.Skipf("no GPUs: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	if !strings.Contains(out, "GPU 0:") {
+		t.Errorf("got nvidia-smi output %q, want GPU 0 listed", out)
+	}
+}
+
+// swapLimit returns the swap limit of the host cgroup at path, relative to
+// the root of the cgroup hierarchy, as a limit of memory plus swap for cgroup
+// v1 and of swap only for cgroup v2. Unlimited swap is returned as -1. The
+// returned bool is false if swap accounting is disabled on the host.
+func swapLimit(path string, v2 bool) (int64, bool, error) {
+	file := filepath.Join("/sys/fs/cgroup/memory", path, "memory.memsw.limit_in_bytes")
+	if v2 {
+		file = filepath.Join("/sys/fs/cgroup", path, "memory.swap.max")
+	}
+	out, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	val := strings.TrimSpace(string(out))
+	if val == "max" {
+		return -1, true, nil
+	}
+	limit, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid limit %q in %s: %v", val, file, err)
+	}
+	// cgroup v1 reports unlimited as the largest page-aligned value.
+	if limit >= 1<<62 {
+		return -1, true, nil
+	}
+	return limit, true, nil
+}
+
+func TestMemorySwap(t *testing.T) {
+	ctx := context.Background()
+	const memory = 64 << 20
+	// The hierarchy is unified with cgroup v2.
+	_, err := os.Stat("/sys/fs/cgroup/cgroup.controllers")
+	v2 := err == nil
+	for _, tc := range []struct {
+		name string
+		swap int64
+		// wantV1 is memory.memsw.limit_in_bytes, memory plus swap.
+		wantV1 int64
+		// wantV2 is memory.swap.max, swap only.
+		wantV2 int64
+	}{
+		{
+			name:   "no swap",
+			swap:   memory,
+			wantV1: memory,
+			wantV2: 0,
+		},
+		{
+			name:   "limited swap",
+			swap:   2 * memory,
+			wantV1: 2 * memory,
+			wantV2: memory,
+		},
+		{
+			name:   "unlimited swap",
+			swap:   -1,
+			wantV1: -1,
+			wantV2: -1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := dockerutil.MakeContainer(ctx, t)
+			defer d.CleanUp(ctx)
+
+			if err := d.Spawn(ctx, dockerutil.RunOpts{
+				Image:      "basic/alpine",
+				Memory:     memory,
+				MemorySwap: tc.swap,
+			}, "sleep", "1000"); err != nil {
+				t.Fatalf("docker run failed: %v", err)
+			}
+
+			// The limits are read from the host, since the container's view
+			// of its cgroup depends on the runtime.
+			path, err := d.CgroupPath(ctx)
+			if err != nil {
+				t.Fatalf("CgroupPath() failed: %v", err)
+			}
+			got, ok, err := swapLimit(path, v2)
+			if err != nil {
+				t.Fatalf("failed to read swap limit: %v", err)
+			}
+			if !ok {
+				t.Skip("swap accounting is disabled on the host")
+			}
+			want := tc.wantV1
+			if v2 {
+				want = tc.wantV2
+			}
+			if got != want {
+				t.Errorf("got swap limit %d (v2: %t), want %d", got, v2, want)
+			}
+		})
+	}
+}
+
+func TestWaitForStatus(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	if err := d.Create(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sh", "-c", "sleep 1"); err != nil {
+		t.Fatalf("docker create failed: %v", err)
+	}
+	if err := d.WaitForStatus(ctx, "created", 10*time.Second); err != nil {
+		t.Errorf("WaitForStatus() failed: %v", err)
+	}
+	if err := d.Start(ctx); err != nil {
+		t.Fatalf("docker start failed: %v", err)
+	}
+	if err := d.WaitForStatus(ctx, "running", 10*time.Second); err != nil {
+		t.Errorf("WaitForStatus() failed: %v", err)
+	}
+	if err := d.WaitForStatus(ctx, "exited", 10*time.Second); err != nil {
+		t.Errorf("WaitForStatus() failed: %v", err)
+	}
+
+	err := d.WaitForStatus(ctx, "paused", 500*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "last status: exited") {
+		t.Errorf("WaitForStatus() got err %v, want timeout with last status", err)
+	}
+}
+
+// failedTest is a test that reports having failed.
+type failedTest struct {
+	*testing.T
+}
+
+// Failed implements testing.TB.Failed.
+func (failedTest) Failed() bool {
+	return true
+}
+
+func TestFailureArtifacts(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name   string
+		failed bool
+	}{
+		{name: "passed"},
+		{name: "failed", failed: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir(testutil.TmpDir(), "artifacts")
+			if err != nil {
+				t.Fatalf("ioutil.TempDir failed: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			d := dockerutil.MakeContainer(ctx, t)
+			var test testing.TB = t
+			if tc.failed {
+				test = failedTest{t}
+			}
+			d.EnableFailureArtifacts(test, dir)
+			if _, err := d.Run(ctx, dockerutil.RunOpts{
+				Image: "basic/alpine",
+			}, "echo", "diagnostics"); err != nil {
+				t.Fatalf("docker run failed: %v", err)
+			}
+			if err := d.CleanUp(ctx); err != nil {
+				t.Fatalf("CleanUp() failed: %v", err)
+			}
+
+			logs, err := ioutil.ReadFile(filepath.Join(dir, d.Name+".log"))
+			if !tc.failed {
+				if !os.IsNotExist(err) {
+					t.Errorf("logs were saved for a passing test: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to read saved logs: %v", err)
+			}
+			if !strings.Contains(string(logs), "diagnostics") {
+				t.Errorf("got saved logs %q, want to contain %q", logs, "diagnostics")
+			}
+			inspect, err := ioutil.ReadFile(filepath.Join(dir, d.Name+".inspect.json"))
+			if err != nil {
+				t.Fatalf("failed to read saved inspect output: %v", err)
+			}
+			if !strings.Contains(string(inspect), d.ID()) {
+				t.Errorf("saved inspect output doesn't contain the container ID: %s", inspect)
+			}
+		})
+	}
+}
+
 func TestPauseResume(t *testing.T) {
 	if !testutil.IsCheckpointSupported() {
 		t.Skip("Checkpoint is not supported.")
@@ -129,6 +880,9 @@ func TestPauseResume(t *testing.T) {
 	if err := d.Pause(ctx); err != nil {
 		t.Fatalf("docker pause failed: %v", err)
 	}
+	if err := d.WaitForStatus(ctx, "paused", 10*time.Second); err != nil {
+		t.Fatalf("WaitForStatus() failed: %v", err)
+	}
 
 	// Check if container is paused.
 	switch _, err := client.Get(fmt.Sprintf("http://localhost:%d", port)); v := err.(type) {
@@ -145,6 +899,9 @@ func TestPauseResume(t *testing.T) {
 	if err := d.Unpause(ctx); err != nil {
 		t.Fatalf("docker unpause failed: %v", err)
 	}
+	if err := d.WaitForStatus(ctx, "running", 10*time.Second); err != nil {
+		t.Fatalf("WaitForStatus() failed: %v", err)
+	}
 
 	// Wait until it's up and running.
 	if err := testutil.WaitForHTTP(port, 30*time.Second); err != nil {
@@ -205,6 +962,61 @@ func TestCheckpointRestore(t *testing.T) {
 	}
 }
 
+// TestCheckpointRestoreCounter checks that a counter continues from where it
+// was checkpointed once restored.
+func TestCheckpointRestoreCounter(t *testing.T) {
+	if !testutil.IsCheckpointSupported() {
+		t.Skip("Checkpoint is not supported.")
+	}
+
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sh", "-c", "i=0; while true; do echo $i; i=$((i+1)); sleep 0.1; done"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	if _, err := d.WaitForOutput(ctx, "3", 30*time.Second); err != nil {
+		t.Fatalf("WaitForOutput() failed: %v", err)
+	}
+
+	err := dockerutil.CheckpointRestoreRoundTrip(ctx, d, "test", func(before, after string) error {
+		last, err := counterLine(before, len(strings.Fields(before))-1)
+		if err != nil {
+			return err
+		}
+		first, err := counterLine(after, 0)
+		if err != nil {
+			return err
+		}
+		if first != last+1 {
+			return fmt.Errorf("counter went from %d to %d across restore", last, first)
+		}
+		return nil
+	})
+	if errors.Is(err, dockerutil.ErrCheckpointUnsupported) {
+		t.Skipf("checkpoint not supported by the daemon: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("CheckpointRestoreRoundTrip() failed: %v", err)
+	}
+}
+
+// counterLine returns the counter value printed on the i-th line of out.
+func counterLine(out string, i int) (int, error) {
+	lines := strings.Fields(out)
+	if i < 0 || i >= len(lines) {
+		return 0, fmt.Errorf("no line %d in output %q", i, out)
+	}
+	n, err := strconv.Atoi(lines[i])
+	if err != nil {
+		return 0, fmt.Errorf("bad counter line %q: %v", lines[i], err)
+	}
+	return n, nil
+}
+
 // Create client and server that talk to each other using the local IP.
 func TestConnectToSelf(t *testing.T) {
 	ctx := context.Background()
@@ -241,6 +1053,56 @@ func TestConnectToSelf(t *testing.T) {
 	}
 }
 
+// TestWaitForOutputExit checks that waiting for output that never appears
+// fails as soon as the container exits, with the output it produced.
+func TestWaitForOutputExit(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "echo", "goodbye"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+
+	const timeout = time.Minute
+	start := time.Now()
+	_, err := d.WaitForOutput(ctx, "never", timeout)
+	if err == nil {
+		t.Fatalf("WaitForOutput() succeeded, want error")
+	}
+	if elapsed := time.Since(start); elapsed >= timeout {
+		t.Errorf("WaitForOutput() returned after %v, want before the %v timeout", elapsed, timeout)
+	}
+	if !strings.Contains(err.Error(), "goodbye") {
+		t.Errorf("WaitForOutput() error %q doesn't contain the output %q", err, "goodbye")
+	}
+}
+
+// TestWaitForOutputCancel checks that waiting for output stops when the
+// context is cancelled.
+func TestWaitForOutputCancel(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sleep", "1000"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if _, err := d.WaitForOutput(waitCtx, "never", time.Minute); err == nil {
+		t.Fatalf("WaitForOutput() succeeded, want error")
+	}
+	if waitCtx.Err() == nil {
+		t.Errorf("WaitForOutput() returned before the context was cancelled")
+	}
+}
+
 func TestMemLimit(t *testing.T) {
 	ctx := context.Background()
 	d := dockerutil.MakeContainer(ctx, t)
@@ -276,6 +1138,68 @@ func TestMemLimit(t *testing.T) {
 	}
 }
 
+// TestOOMKilled checks that a container allocating past its memory limit is
+// reported as killed for running out of memory.
+func TestOOMKilled(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	// Keep doubling a string until the memory limit is hit.
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image:  "basic/alpine",
+		Memory: 64 * 1024 * 1024, // In bytes.
+	}, "sh", "-c", "x=x; while true; do x=$x$x; done"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+
+	status, err := d.Wait(ctx)
+	if err != nil {
+		t.Fatalf("docker wait failed: %v", err)
+	}
+	if !status.OOMKilled {
+		t.Errorf("container exited with %+v, want OOMKilled", status)
+	}
+}
+
+// TestOomScoreAdj checks that the OOM score adjustment is applied to the
+// container's processes.
+func TestOomScoreAdj(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	oomScoreAdj := 500
+	got, err := d.Run(ctx, dockerutil.RunOpts{
+		Image:       "basic/alpine",
+		OomScoreAdj: &oomScoreAdj,
+	}, "cat", "/proc/self/oom_score_adj")
+	if err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	if want := "500\n"; got != want {
+		t.Errorf("invalid oom_score_adj, want: %q, got: %q", want, got)
+	}
+}
+
+// TestShmSize checks that /dev/shm is sized as requested.
+func TestShmSize(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	got, err := d.Run(ctx, dockerutil.RunOpts{
+		Image:   "basic/alpine",
+		ShmSize: 128 << 20,
+	}, "df", "-k", "/dev/shm")
+	if err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	if want := fmt.Sprintf(" %d ", 128<<10); !strings.Contains(got, want) {
+		t.Errorf("invalid /dev/shm size, want %q in: %q", want, got)
+	}
+}
+
 func TestNumCPU(t *testing.T) {
 	ctx := context.Background()
 	d := dockerutil.MakeContainer(ctx, t)
@@ -316,7 +1240,7 @@ func TestJobControl(t *testing.T) {
 	// Give shell a few seconds to start executing the sleep.
 	time.Sleep(2 * time.Second)
 
-	if _, err := p.Write(time.Second, []byte{0x03}); err != nil {
+	if _, err := p.Write([]byte{0x03}); err != nil {
 		t.Fatalf("error exit: %v", err)
 	}
 
@@ -434,6 +1358,186 @@ func TestHostOverlayfsCopyUp(t *testing.T) {
 	}
 }
 
+// TestGroupAdd checks that supplementary groups are added to the groups of
+// the configured user.
+func TestGroupAdd(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	got, err := d.Run(ctx, dockerutil.RunOpts{
+		Image:    "basic/alpine",
+		User:     "1000:1000",
+		GroupAdd: []string{"1234", "5678"},
+	}, "id", "-G")
+	if err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	if want := "1000 1234 5678\n"; got != want {
+		t.Errorf("invalid groups, want: %q, got: %q", want, got)
+	}
+}
+
+// TestGroupAddFileAccess checks that supplementary groups grant access to a
+// group-readable file in the sandbox.
+func TestGroupAddFileAccess(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir(testutil.TmpDir(), "group-add")
+	if err != nil {
+		t.Fatalf("TempDir(): %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatalf("Chmod(): %v", err)
+	}
+	file := filepath.Join(dir, "file.txt")
+	if err := ioutil.WriteFile(file, []byte("123"), 0640); err != nil {
+		t.Fatalf("WriteFile(): %v", err)
+	}
+	if err := os.Chown(file, 0, 1234); err != nil {
+		t.Fatalf("Chown(): %v", err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		groupAdd []string
+		want     string
+	}{
+		{name: "member", groupAdd: []string{"1234"}, want: "123"},
+		{name: "non-member", want: "denied\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := dockerutil.MakeContainer(ctx, t)
+			defer d.CleanUp(ctx)
+
+			got, err := d.Run(ctx, dockerutil.RunOpts{
+				Image:    "basic/alpine",
+				User:     "1000:1000",
+				GroupAdd: tc.groupAdd,
+				Mounts: []mount.Mount{
+					{
+						Type:     mount.TypeBind,
+						Source:   dir,
+						Target:   "/data",
+						ReadOnly: true,
+					},
+				},
+			}, "sh", "-c", "cat /data/file.txt 2>/dev/null || echo denied")
+			if err != nil {
+				t.Fatalf("docker run failed: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("invalid file content, want: %q, got: %q", tc.want, got)
+			}
+		})
+	}
+}
+
+// TestInit checks that orphaned processes are reaped when the container runs
+// an init process, and that they are left as zombies otherwise.
+func TestInit(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		init    bool
+		zombies string
+	}{
+		{name: "init", init: true, zombies: "0\n"},
+		{name: "no-init", init: false, zombies: "1\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			d := dockerutil.MakeContainer(ctx, t)
+			defer d.CleanUp(ctx)
+
+			// The root process never reaps children it didn't start.
+			init := tc.init
+			if err := d.Spawn(ctx, dockerutil.RunOpts{
+				Image: "basic/alpine",
+				Init:  &init,
+			}, "sleep", "1000"); err != nil {
+				if tc.init && strings.Contains(err.Error(), "init") {
+					t.Skipf("docker daemon doesn't support init: %v", err)
+				}
+				t.Fatalf("docker run failed: %v", err)
+			}
+
+			// Orphan a child, which is reparented to PID 1 in the container.
+			if _, err := d.Exec(ctx, dockerutil.ExecOpts{}, "sh", "-c", "sleep 0.1 &"); err != nil {
+				t.Fatalf("docker exec failed: %v", err)
+			}
+			time.Sleep(time.Second)
+
+			got, err := d.Exec(ctx, dockerutil.ExecOpts{}, "sh", "-c", "cat /proc/[0-9]*/stat | awk '{print $3}' | grep -c Z || true")
+			if err != nil {
+				t.Fatalf("docker exec failed: %v", err)
+			}
+			if got != tc.zombies {
+				t.Errorf("invalid zombie count, want: %q, got: %q", tc.zombies, got)
+			}
+		})
+	}
+}
+
+// TestSharedPIDNamespace checks that a container started in another
+// container's PID namespace can see that container's processes.
+func TestSharedPIDNamespace(t *testing.T) {
+	ctx := context.Background()
+	victim := dockerutil.MakeContainer(ctx, t)
+	defer victim.CleanUp(ctx)
+
+	if err := victim.Spawn(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sleep", "1000"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	out, err := d.Run(ctx, dockerutil.RunOpts{
+		Image:   "basic/alpine",
+		PidMode: "container:" + victim.Name,
+	}, "sh", "-c", "cat /proc/[0-9]*/cmdline | tr '\\0' ' '")
+	if err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	if want := "sleep 1000"; !strings.Contains(out, want) {
+		t.Errorf("processes in shared PID namespace got: %q, want to contain: %q", out, want)
+	}
+}
+
+// TestSharedIPCNamespace checks that a container started in another
+// container's IPC namespace can see that container's POSIX shared memory.
+func TestSharedIPCNamespace(t *testing.T) {
+	ctx := context.Background()
+	victim := dockerutil.MakeContainer(ctx, t)
+	defer victim.CleanUp(ctx)
+
+	if err := victim.Spawn(ctx, dockerutil.RunOpts{
+		Image:   "basic/alpine",
+		IpcMode: "shareable",
+	}, "sh", "-c", "echo victim > /dev/shm/segment && echo ready && sleep 1000"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	if _, err := victim.WaitForOutput(ctx, "ready", 5*time.Second); err != nil {
+		t.Fatalf("WaitForOutput() failed: %v", err)
+	}
+
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	out, err := d.Run(ctx, dockerutil.RunOpts{
+		Image:   "basic/alpine",
+		IpcMode: "container:" + victim.Name,
+	}, "cat", "/dev/shm/segment")
+	if err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	if want := "victim\n"; out != want {
+		t.Errorf("shared memory segment got: %q, want: %q", out, want)
+	}
+}
+
 func TestMain(m *testing.M) {
 	dockerutil.EnsureSupportedDockerVersion()
 	flag.Parse()
@@ -0,0 +1,129 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+)
+
+func newPool(ctx context.Context, t *testing.T, n int) *dockerutil.ContainerPool {
+	t.Helper()
+	pool, err := dockerutil.NewContainerPool(ctx, t, n, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sleep", "1000000")
+	if err != nil {
+		t.Fatalf("NewContainerPool() failed: %v", err)
+	}
+	return pool
+}
+
+// TestContainerPoolConcurrent checks that concurrent users of a pool each get
+// a container to themselves, reset from any previous use.
+func TestContainerPoolConcurrent(t *testing.T) {
+	ctx := context.Background()
+	pool := newPool(ctx, t, 2)
+	defer pool.Close(ctx)
+
+	const users = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, users)
+	for i := 0; i < users; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			d, err := pool.Get(ctx)
+			if err != nil {
+				errs <- fmt.Errorf("Get() failed: %v", err)
+				return
+			}
+			defer func() {
+				if err := pool.Put(ctx, d); err != nil {
+					errs <- fmt.Errorf("Put() failed: %v", err)
+				}
+			}()
+
+			// Leave a file and a process behind, which the next user
+			// must not see.
+			out, err := d.Exec(ctx, dockerutil.ExecOpts{}, "sh", "-c",
+				fmt.Sprintf("ls -A /tmp; pgrep -x sleep | wc -l; touch /tmp/user-%d; sleep 1000 >/dev/null 2>&1 &", i))
+			if err != nil {
+				errs <- fmt.Errorf("docker exec failed: %v", err)
+				return
+			}
+			// The root process is the only sleep.
+			if got := strings.TrimSpace(out); got != "1" {
+				errs <- fmt.Errorf("container was not reset, got /tmp and sleep count: %q", got)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// TestContainerPoolClose checks that closing a pool cleans up the containers
+// that are checked out.
+func TestContainerPoolClose(t *testing.T) {
+	ctx := context.Background()
+	pool := newPool(ctx, t, 2)
+	defer pool.Close(ctx)
+
+	d, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	pool.Close(ctx)
+
+	if _, err := d.Status(ctx); err == nil {
+		t.Errorf("checked out container still exists after Close")
+	}
+	if _, err := pool.Get(ctx); !errors.Is(err, dockerutil.ErrPoolClosed) {
+		t.Errorf("Get() after Close got err %v, want %v", err, dockerutil.ErrPoolClosed)
+	}
+	if err := pool.Put(ctx, d); err != nil {
+		t.Errorf("Put() after Close failed: %v", err)
+	}
+}
+
+// TestContainerPoolDoublePut checks that returning a container twice fails
+// rather than blocking or handing it out twice.
+func TestContainerPoolDoublePut(t *testing.T) {
+	ctx := context.Background()
+	pool := newPool(ctx, t, 1)
+	defer pool.Close(ctx)
+
+	d, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if err := pool.Put(ctx, d); err != nil {
+		t.Fatalf("Put() failed: %v", err)
+	}
+	if err := pool.Put(ctx, d); err == nil {
+		t.Errorf("second Put() of the same container succeeded")
+	}
+	if _, err := pool.Get(ctx); err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+}
@@ -303,6 +303,7 @@ func TestOne(t *testing.T) {
 		"--remote_ipv4", addressInSubnet(dutAddr, *testNet.Subnet).String(),
 		"--local_ipv4", addressInSubnet(testbenchAddr, *testNet.Subnet).String(),
 		"--remote_ipv6", remoteIPv6.String(),
+		"--remote_interface_id", fmt.Sprint(dutDeviceInfo.ID),
 		"--remote_mac", remoteMAC.String(),
 		"--device", testNetDev,
 		"--dut_type", *dutPlatform,
@@ -260,6 +260,13 @@ type tcpState struct {
 	synAck                    *TCP
 	portPickerFD              int
 	finSent                   bool
+
+	// ackDelay is how long segments with the ACK flag set are held back
+	// before they are sent, simulating the round-trip time of the path.
+	ackDelay time.Duration
+	// delayed receives the result of sending each segment held back by
+	// ackDelay.
+	delayed []<-chan error
 }
 
 var _ layerState = (*tcpState)(nil)
@@ -427,6 +434,33 @@ type Connection struct {
 	injector    Injector
 	sniffer     Sniffer
 	t           *testing.T
+
+	// parseIPv6Fragments is whether IPv6 Fragment Extension Headers are
+	// parsed. See SetIPv6FragmentParsing.
+	parseIPv6Fragments bool
+
+	// lastFrameTime is when the sniffer captured the last frame returned by
+	// ExpectFrame.
+	lastFrameTime time.Time
+}
+
+// SetIPv6FragmentParsing sets whether frames sent and received on conn are
+// parsed with an IPv6FragmentExtHdr layer for each IPv6 Fragment Extension
+// Header. When enabled, the first fragment of a packet is followed by the
+// layers of the fragmentable part and the other fragments by a Payload, as the
+// bytes they carry are not headers. When disabled, the default, the fragment
+// header and everything after it are parsed as a single Payload.
+func (conn *Connection) SetIPv6FragmentParsing(enabled bool) {
+	conn.parseIPv6Fragments = enabled
+}
+
+// parse parses the bytes of an Ethernet frame sent or received on conn.
+func (conn *Connection) parse(b []byte) Layers {
+	layers := parse(parseEther, b)
+	if conn.parseIPv6Fragments {
+		layers = parseIPv6Fragments(layers)
+	}
+	return layers
 }
 
 // Returns the default incoming frame against which to match. If received is
@@ -517,11 +551,33 @@ func (conn *Connection) SendFrame(frame Layers) {
 		conn.t.Fatalf("can't build outgoing packet: %s", err)
 	}
 	conn.injector.Send(outBytes)
+	conn.updateSent(outBytes)
+}
 
+// sendFrameAfter is like SendFrame, except that the frame is only put on the
+// wire after d. The layer states are updated right away, so frames sent in the
+// meantime follow on from it. The returned channel receives the result of
+// writing the frame.
+func (conn *Connection) sendFrameAfter(frame Layers, d time.Duration) <-chan error {
+	outBytes, err := frame.ToBytes()
+	if err != nil {
+		conn.t.Fatalf("can't build outgoing packet: %s", err)
+	}
+	errCh := make(chan error, 1)
+	time.AfterFunc(d, func() {
+		errCh <- conn.injector.write(outBytes)
+	})
+	conn.updateSent(outBytes)
+	return errCh
+}
+
+// updateSent updates the state of all layers with the bytes of a frame sent on
+// the wire.
+func (conn *Connection) updateSent(outBytes []byte) {
 	// frame might have nil values where the caller wanted to use default values.
 	// sentFrame will have no nil values in it because it comes from parsing the
 	// bytes that were actually sent.
-	sentFrame := parse(parseEther, outBytes)
+	sentFrame := conn.parse(outBytes)
 	// Update the state of each layer based on what was sent.
 	for i, s := range conn.layerStates {
 		if err := s.sent(sentFrame[i]); err != nil {
@@ -540,17 +596,17 @@ func (conn *Connection) send(overrideLayers Layers, additionalLayers ...Layer) {
 }
 
 // recvFrame gets the next successfully parsed frame (of type Layers) within the
-// timeout provided. If no parsable frame arrives before the timeout, it returns
-// nil.
-func (conn *Connection) recvFrame(timeout time.Duration) Layers {
+// timeout provided, along with the time at which it was captured. If no
+// parsable frame arrives before the timeout, it returns nil.
+func (conn *Connection) recvFrame(timeout time.Duration) (Layers, time.Time) {
 	if timeout <= 0 {
-		return nil
+		return nil, time.Time{}
 	}
-	b := conn.sniffer.Recv(timeout)
+	b, ts := conn.sniffer.RecvTimestamped(timeout)
 	if b == nil {
-		return nil
+		return nil, time.Time{}
 	}
-	return parse(parseEther, b)
+	return conn.parse(b), ts
 }
 
 // layersError stores the Layers that we got and the Layers that we wanted to
@@ -590,8 +646,9 @@ func (conn *Connection) ExpectFrame(layers Layers, timeout time.Duration) (Layer
 	var errs error
 	for {
 		var gotLayers Layers
+		var gotTime time.Time
 		if timeout = time.Until(deadline); timeout > 0 {
-			gotLayers = conn.recvFrame(timeout)
+			gotLayers, gotTime = conn.recvFrame(timeout)
 		}
 		if gotLayers == nil {
 			if errs == nil {
@@ -605,12 +662,21 @@ func (conn *Connection) ExpectFrame(layers Layers, timeout time.Duration) (Layer
 					conn.t.Fatal(err)
 				}
 			}
+			conn.lastFrameTime = gotTime
 			return gotLayers, nil
 		}
 		errs = multierr.Combine(errs, &layersError{got: gotLayers, want: conn.incoming(gotLayers)})
 	}
 }
 
+// LastFrameTime returns the time at which the sniffer captured the last frame
+// returned by ExpectFrame, or by the methods built on it. It is not affected
+// by how long the frame waited to be read, so it is suitable for measuring the
+// timing of the DUT's frames.
+func (conn *Connection) LastFrameTime() time.Time {
+	return conn.lastFrameTime
+}
+
 // Drain drains the sniffer's receive buffer by receiving packets until there's
 // nothing else to receive.
 func (conn *Connection) Drain() {
@@ -728,11 +794,65 @@ func (conn *TCPIPv4) ExpectNextData(tcp *TCP, payload *Payload, timeout time.Dur
 // Send a packet with reasonable defaults. Potentially override the TCP layer in
 // the connection with the provided layer and add additionLayers.
 func (conn *TCPIPv4) Send(tcp TCP, additionalLayers ...Layer) {
+	if state := conn.tcpState(); state.ackDelay > 0 && tcp.Flags != nil && *tcp.Flags&header.TCPFlagAck != 0 {
+		frame := (*Connection)(conn).CreateFrame(Layers{&tcp}, additionalLayers...)
+		state.delayed = append(state.delayed, (*Connection)(conn).sendFrameAfter(frame, state.ackDelay))
+		return
+	}
 	(*Connection)(conn).send(Layers{&tcp}, additionalLayers...)
 }
 
+// SetACKDelay makes the connection hold back every segment it sends with the
+// ACK flag set by d. The DUT then observes a round-trip time of roughly d for
+// the connection, which lets tests exercise RTT-dependent behavior such as the
+// retransmission timeout. A zero d disables the delay.
+//
+// Held back segments are scheduled in the background, so Send returns right
+// away and the testbench keeps receiving the DUT's frames in the meantime.
+func (conn *TCPIPv4) SetACKDelay(d time.Duration) {
+	conn.tcpState().ackDelay = d
+}
+
+// ExpectRetransmits expects the DUT to send a segment carrying payload at the
+// next expected sequence number and then to retransmit that same segment n
+// times while the testbench leaves it unacknowledged. It returns the intervals
+// between consecutive transmissions of the segment, so the first interval is
+// the DUT's initial retransmission timeout and the remaining ones show its
+// backoff. Every transmission must arrive within timeout of the previous one.
+// The intervals are measured between the times the frames were captured.
+func (conn *TCPIPv4) ExpectRetransmits(payload *Payload, n int, timeout time.Duration) ([]time.Duration, error) {
+	seq := Uint32(uint32(*conn.RemoteSeqNum()))
+	if _, err := conn.ExpectData(&TCP{SeqNum: seq}, payload, timeout); err != nil {
+		return nil, fmt.Errorf("expected segment was not received: %w", err)
+	}
+	last := conn.LastFrameTime()
+	intervals := make([]time.Duration, 0, n)
+	for i := 0; i < n; i++ {
+		if _, err := conn.ExpectData(&TCP{SeqNum: seq}, payload, timeout); err != nil {
+			return intervals, fmt.Errorf("retransmit %d was not received: %w", i, err)
+		}
+		now := conn.LastFrameTime()
+		intervals = append(intervals, now.Sub(last))
+		last = now
+	}
+	return intervals, nil
+}
+
+// LastFrameTime returns the time at which the sniffer captured the last frame
+// returned by Expect, ExpectData or the methods built on them.
+func (conn *TCPIPv4) LastFrameTime() time.Time {
+	return (*Connection)(conn).LastFrameTime()
+}
+
 // Close frees associated resources held by the TCPIPv4 connection.
 func (conn *TCPIPv4) Close() {
+	var errs error
+	for _, errCh := range conn.tcpState().delayed {
+		errs = multierr.Append(errs, <-errCh)
+	}
+	if errs != nil {
+		conn.t.Errorf("unable to send delayed ACKs: %s", errs)
+	}
 	(*Connection)(conn).Close()
 }
 
@@ -794,6 +914,99 @@ func (conn *TCPIPv4) Drain() {
 	conn.sniffer.Drain()
 }
 
+// EtherConn maintains the state for the Ethernet layer, for testing protocols
+// that run directly over Ethernet, such as ARP.
+type EtherConn Connection
+
+// NewEtherConn creates a new EtherConn connection with reasonable defaults.
+func NewEtherConn(t *testing.T, outgoingEther, incomingEther Ether) EtherConn {
+	etherState, err := newEtherState(outgoingEther, incomingEther)
+	if err != nil {
+		t.Fatalf("can't make EtherState: %s", err)
+	}
+
+	injector, err := NewInjector(t)
+	if err != nil {
+		t.Fatalf("can't make injector: %s", err)
+	}
+	sniffer, err := NewSniffer(t)
+	if err != nil {
+		t.Fatalf("can't make sniffer: %s", err)
+	}
+
+	return EtherConn{
+		layerStates: []layerState{etherState},
+		injector:    injector,
+		sniffer:     sniffer,
+		t:           t,
+	}
+}
+
+// Send sends a frame with ether overriding the Ethernet layer defaults and
+// additionalLayers added after it.
+func (conn *EtherConn) Send(ether Ether, additionalLayers ...Layer) {
+	(*Connection)(conn).send(Layers{&ether}, additionalLayers...)
+}
+
+// Close to clean up any resources held.
+func (conn *EtherConn) Close() {
+	(*Connection)(conn).Close()
+}
+
+// ExpectFrame expects a frame that matches the provided Layers within the
+// timeout specified. If it doesn't arrive in time, an error is returned.
+func (conn *EtherConn) ExpectFrame(frame Layers, timeout time.Duration) (Layers, error) {
+	return (*Connection)(conn).ExpectFrame(frame, timeout)
+}
+
+// IPv4Conn maintains the state for all the layers in a IPv4 connection.
+type IPv4Conn Connection
+
+// NewIPv4Conn creates a new IPv4Conn connection with reasonable defaults.
+func NewIPv4Conn(t *testing.T, outgoingIPv4, incomingIPv4 IPv4) IPv4Conn {
+	etherState, err := newEtherState(Ether{}, Ether{})
+	if err != nil {
+		t.Fatalf("can't make EtherState: %s", err)
+	}
+	ipv4State, err := newIPv4State(outgoingIPv4, incomingIPv4)
+	if err != nil {
+		t.Fatalf("can't make IPv4State: %s", err)
+	}
+
+	injector, err := NewInjector(t)
+	if err != nil {
+		t.Fatalf("can't make injector: %s", err)
+	}
+	sniffer, err := NewSniffer(t)
+	if err != nil {
+		t.Fatalf("can't make sniffer: %s", err)
+	}
+
+	return IPv4Conn{
+		layerStates: []layerState{etherState, ipv4State},
+		injector:    injector,
+		sniffer:     sniffer,
+		t:           t,
+	}
+}
+
+// Send sends a frame with ipv4 overriding the IPv4 layer defaults and
+// additionalLayers added after it.
+func (conn *IPv4Conn) Send(ipv4 IPv4, additionalLayers ...Layer) {
+	(*Connection)(conn).send(Layers{&ipv4}, additionalLayers...)
+}
+
+// Close to clean up any resources held.
+func (conn *IPv4Conn) Close() {
+	(*Connection)(conn).Close()
+}
+
+// ExpectFrame expects a frame that matches the provided Layers within the
+// timeout specified. If it doesn't arrive in time, an error is returned.
+func (conn *IPv4Conn) ExpectFrame(frame Layers, timeout time.Duration) (Layers, error) {
+	return (*Connection)(conn).ExpectFrame(frame, timeout)
+}
+
 // IPv6Conn maintains the state for all the layers in a IPv6 connection.
 type IPv6Conn Connection
 
@@ -15,8 +15,11 @@
 package testbench
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"math"
 	"reflect"
 	"strings"
 
@@ -26,6 +29,7 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/buffer"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/seqnum"
 )
 
 // Layer is the interface that all encapsulations must implement.
@@ -93,23 +97,24 @@ func (lb *LayerBase) setPrev(l Layer) {
 	lb.prevLayer = l
 }
 
+// ignoreNil ignores comparison pairs where either of the inputs is a nil.
+var ignoreNil = cmp.FilterValues(func(x, y interface{}) bool {
+	for _, l := range []interface{}{x, y} {
+		v := reflect.ValueOf(l)
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Slice) && v.IsNil() {
+			return true
+		}
+	}
+	return false
+}, cmp.Ignore())
+
 // equalLayer compares that two Layer structs match while ignoring field in
 // which either input has a nil and also ignoring the LayerBase of the inputs.
 func equalLayer(x, y Layer) bool {
 	if x == nil || y == nil {
 		return true
 	}
-	// opt ignores comparison pairs where either of the inputs is a nil.
-	opt := cmp.FilterValues(func(x, y interface{}) bool {
-		for _, l := range []interface{}{x, y} {
-			v := reflect.ValueOf(l)
-			if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Slice) && v.IsNil() {
-				return true
-			}
-		}
-		return false
-	}, cmp.Ignore())
-	return cmp.Equal(x, y, opt, cmpopts.IgnoreTypes(LayerBase{}))
+	return cmp.Equal(x, y, ignoreNil, cmpopts.IgnoreTypes(LayerBase{}))
 }
 
 // mergeLayer merges y into x. Any fields for which y has a non-nil value, that
@@ -194,6 +199,8 @@ func (l *Ether) ToBytes() ([]byte, error) {
 			fields.Type = header.IPv4ProtocolNumber
 		case *IPv6:
 			fields.Type = header.IPv6ProtocolNumber
+		case *ARP:
+			fields.Type = header.ARPProtocolNumber
 		default:
 			return nil, fmt.Errorf("ethernet header's next layer is unrecognized: %#v", n)
 		}
@@ -251,6 +258,8 @@ func parseEther(b []byte) (Layer, layerParser) {
 		nextParser = parseIPv4
 	case header.IPv6ProtocolNumber:
 		nextParser = parseIPv6
+	case header.ARPProtocolNumber:
+		nextParser = parseARP
 	default:
 		// Assume that the rest is a payload.
 		nextParser = parsePayload
@@ -271,6 +280,91 @@ func (l *Ether) merge(other Layer) error {
 	return mergeLayer(l, other)
 }
 
+// ARP can construct and match an ARP packet for IPv4 over Ethernet.
+type ARP struct {
+	LayerBase
+	HardwareType       *uint16
+	ProtocolType       *tcpip.NetworkProtocolNumber
+	Op                 *header.ARPOp
+	SenderHardwareAddr *tcpip.LinkAddress
+	SenderProtocolAddr *tcpip.Address
+	TargetHardwareAddr *tcpip.LinkAddress
+	TargetProtocolAddr *tcpip.Address
+}
+
+func (l *ARP) String() string {
+	return stringLayer(l)
+}
+
+// ToBytes implements Layer.ToBytes.
+func (l *ARP) ToBytes() ([]byte, error) {
+	b := make([]byte, header.ARPSize)
+	h := header.ARP(b)
+	h.SetIPv4OverEthernet()
+	if l.HardwareType != nil {
+		binary.BigEndian.PutUint16(b[0:], *l.HardwareType)
+	}
+	if l.ProtocolType != nil {
+		binary.BigEndian.PutUint16(b[2:], uint16(*l.ProtocolType))
+	}
+	if l.Op != nil {
+		h.SetOp(*l.Op)
+	}
+	if l.SenderHardwareAddr != nil {
+		copy(h.HardwareAddressSender(), *l.SenderHardwareAddr)
+	}
+	if l.SenderProtocolAddr != nil {
+		copy(h.ProtocolAddressSender(), *l.SenderProtocolAddr)
+	}
+	if l.TargetHardwareAddr != nil {
+		copy(h.HardwareAddressTarget(), *l.TargetHardwareAddr)
+	}
+	if l.TargetProtocolAddr != nil {
+		copy(h.ProtocolAddressTarget(), *l.TargetProtocolAddr)
+	}
+	return h, nil
+}
+
+// ARPOp is a helper routine that allocates a new header.ARPOp value to store v
+// and returns a pointer to it.
+func ARPOp(v header.ARPOp) *header.ARPOp {
+	return &v
+}
+
+// parseARP parses the bytes assuming that they start with an ARP packet for
+// IPv4 over Ethernet. Anything after it, such as Ethernet padding, is parsed
+// as a Payload.
+func parseARP(b []byte) (Layer, layerParser) {
+	h := header.ARP(b)
+	if !h.IsValid() {
+		return parsePayload(b)
+	}
+	arp := ARP{
+		HardwareType:       Uint16(binary.BigEndian.Uint16(b[0:])),
+		ProtocolType:       NetworkProtocolNumber(tcpip.NetworkProtocolNumber(binary.BigEndian.Uint16(b[2:]))),
+		Op:                 ARPOp(h.Op()),
+		SenderHardwareAddr: LinkAddress(tcpip.LinkAddress(h.HardwareAddressSender())),
+		SenderProtocolAddr: Address(tcpip.Address(h.ProtocolAddressSender())),
+		TargetHardwareAddr: LinkAddress(tcpip.LinkAddress(h.HardwareAddressTarget())),
+		TargetProtocolAddr: Address(tcpip.Address(h.ProtocolAddressTarget())),
+	}
+	return &arp, parsePayload
+}
+
+func (l *ARP) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+func (l *ARP) length() int {
+	return header.ARPSize
+}
+
+// merge overrides the values in l with the values from other but only in fields
+// where the value is not nil.
+func (l *ARP) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
 // IPv4 can construct and match an IPv4 encapsulation.
 type IPv4 struct {
 	LayerBase
@@ -285,6 +379,9 @@ type IPv4 struct {
 	Checksum       *uint16
 	SrcAddr        *tcpip.Address
 	DstAddr        *tcpip.Address
+	// Options are serialized as is and padded with zeroes, which mark the end
+	// of the options, to a multiple of 4 bytes.
+	Options []byte
 }
 
 func (l *IPv4) String() string {
@@ -293,10 +390,10 @@ func (l *IPv4) String() string {
 
 // ToBytes implements Layer.ToBytes.
 func (l *IPv4) ToBytes() ([]byte, error) {
-	b := make([]byte, header.IPv4MinimumSize)
+	b := make([]byte, l.headerLength())
 	h := header.IPv4(b)
 	fields := &header.IPv4Fields{
-		IHL:            20,
+		IHL:            uint8(len(b)),
 		TOS:            0,
 		TotalLength:    0,
 		ID:             0,
@@ -308,6 +405,9 @@ func (l *IPv4) ToBytes() ([]byte, error) {
 		SrcAddr:        tcpip.Address(""),
 		DstAddr:        tcpip.Address(""),
 	}
+	if l.IHL != nil {
+		fields.IHL = *l.IHL
+	}
 	if l.TOS != nil {
 		fields.TOS = *l.TOS
 	}
@@ -343,6 +443,8 @@ func (l *IPv4) ToBytes() ([]byte, error) {
 			fields.Protocol = uint8(header.UDPProtocolNumber)
 		case *ICMPv4:
 			fields.Protocol = uint8(header.ICMPv4ProtocolNumber)
+		case *IGMP:
+			fields.Protocol = uint8(header.IGMPProtocolNumber)
 		default:
 			// TODO(b/150301488): Support more protocols as needed.
 			return nil, fmt.Errorf("ipv4 header's next layer is unrecognized: %#v", n)
@@ -358,12 +460,24 @@ func (l *IPv4) ToBytes() ([]byte, error) {
 		fields.Checksum = *l.Checksum
 	}
 	h.Encode(fields)
+	copy(b[header.IPv4MinimumSize:], l.Options)
 	if l.Checksum == nil {
 		h.SetChecksum(^h.CalculateChecksum())
 	}
 	return h, nil
 }
 
+// headerLength returns the length of the header serialized by ToBytes.
+func (l *IPv4) headerLength() int {
+	return header.IPv4MinimumSize + (len(l.Options)+3)&^3
+}
+
+// IPv4RouterAlertOptions returns IPv4 options holding a Router Alert option,
+// RFC 2113, as IGMP messages carry.
+func IPv4RouterAlertOptions() []byte {
+	return []byte{148, 4, 0, 0}
+}
+
 // Uint16 is a helper routine that allocates a new
 // uint16 value to store v and returns a pointer to it.
 func Uint16(v uint16) *uint16 {
@@ -376,6 +490,12 @@ func Uint8(v uint8) *uint8 {
 	return &v
 }
 
+// Bool is a helper routine that allocates a new
+// bool value to store v and returns a pointer to it.
+func Bool(v bool) *bool {
+	return &v
+}
+
 // Address is a helper routine that allocates a new tcpip.Address value to store
 // v and returns a pointer to it.
 func Address(v tcpip.Address) *tcpip.Address {
@@ -400,6 +520,9 @@ func parseIPv4(b []byte) (Layer, layerParser) {
 		SrcAddr:        Address(h.SourceAddress()),
 		DstAddr:        Address(h.DestinationAddress()),
 	}
+	if hl := int(h.HeaderLength()); hl >= header.IPv4MinimumSize && hl <= len(b) {
+		ipv4.Options = b[header.IPv4MinimumSize:hl]
+	}
 	var nextParser layerParser
 	switch h.TransportProtocol() {
 	case header.TCPProtocolNumber:
@@ -408,6 +531,8 @@ func parseIPv4(b []byte) (Layer, layerParser) {
 		nextParser = parseUDP
 	case header.ICMPv4ProtocolNumber:
 		nextParser = parseICMPv4
+	case header.IGMPProtocolNumber:
+		nextParser = parseIGMP
 	default:
 		// Assume that the rest is a payload.
 		nextParser = parsePayload
@@ -421,7 +546,7 @@ func (l *IPv4) match(other Layer) bool {
 
 func (l *IPv4) length() int {
 	if l.IHL == nil {
-		return header.IPv4MinimumSize
+		return l.headerLength()
 	}
 	return int(*l.IHL)
 }
@@ -470,21 +595,12 @@ func (l *IPv6) ToBytes() ([]byte, error) {
 	if l.NextHeader != nil {
 		fields.NextHeader = *l.NextHeader
 	} else {
-		switch n := l.next().(type) {
-		case *TCP:
-			fields.NextHeader = uint8(header.TCPProtocolNumber)
-		case *UDP:
-			fields.NextHeader = uint8(header.UDPProtocolNumber)
-		case *ICMPv6:
-			fields.NextHeader = uint8(header.ICMPv6ProtocolNumber)
-		case *IPv6HopByHopOptionsExtHdr:
-			fields.NextHeader = uint8(header.IPv6HopByHopOptionsExtHdrIdentifier)
-		case *IPv6DestinationOptionsExtHdr:
-			fields.NextHeader = uint8(header.IPv6DestinationOptionsExtHdrIdentifier)
-		default:
+		id, ok := ipv6Identifier(l.next())
+		if !ok {
 			// TODO(b/150301488): Support more protocols as needed.
-			return nil, fmt.Errorf("ToBytes can't deduce the IPv6 header's next protocol: %#v", n)
+			return nil, fmt.Errorf("ToBytes can't deduce the IPv6 header's next protocol: %#v", l.next())
 		}
+		fields.NextHeader = uint8(id)
 	}
 	if l.HopLimit != nil {
 		fields.HopLimit = *l.HopLimit
@@ -499,6 +615,35 @@ func (l *IPv6) ToBytes() ([]byte, error) {
 	return h, nil
 }
 
+// ipv6Identifier returns the Next Header value that identifies l when it follows
+// an IPv6 header or extension header.
+func ipv6Identifier(l Layer) (header.IPv6ExtensionHeaderIdentifier, bool) {
+	switch l.(type) {
+	case *TCP:
+		return header.IPv6ExtensionHeaderIdentifier(header.TCPProtocolNumber), true
+	case *UDP:
+		return header.IPv6ExtensionHeaderIdentifier(header.UDPProtocolNumber), true
+	case *ICMPv6:
+		return header.IPv6ExtensionHeaderIdentifier(header.ICMPv6ProtocolNumber), true
+	case *IPv6HopByHopOptionsExtHdr:
+		return header.IPv6HopByHopOptionsExtHdrIdentifier, true
+	case *IPv6DestinationOptionsExtHdr:
+		return header.IPv6DestinationOptionsExtHdrIdentifier, true
+	case *IPv6FragmentExtHdr:
+		return header.IPv6FragmentExtHdrIdentifier, true
+	}
+	return 0, false
+}
+
+// isIPv6ExtHdr returns whether l is an IPv6 extension header.
+func isIPv6ExtHdr(l Layer) bool {
+	switch l.(type) {
+	case *IPv6HopByHopOptionsExtHdr, *IPv6DestinationOptionsExtHdr, *IPv6FragmentExtHdr:
+		return true
+	}
+	return false
+}
+
 // nextIPv6PayloadParser finds the corresponding parser for nextHeader.
 func nextIPv6PayloadParser(nextHeader uint8) layerParser {
 	switch tcpip.TransportProtocolNumber(nextHeader) {
@@ -515,6 +660,8 @@ func nextIPv6PayloadParser(nextHeader uint8) layerParser {
 	case header.IPv6DestinationOptionsExtHdrIdentifier:
 		return parseIPv6DestinationOptionsExtHdr
 	}
+	// Fragment extension headers are left in the payload, unless the
+	// connection parses them with parseIPv6Fragments.
 	return parsePayload
 }
 
@@ -552,28 +699,122 @@ func (l *IPv6) merge(other Layer) error {
 
 // IPv6HopByHopOptionsExtHdr can construct and match an IPv6HopByHopOptions
 // Extension Header.
+//
+// OptionList is a structured form of Options, which is serialized only if
+// Options is nil. Parsing sets both, leaving the Pad1 and PadN options out of
+// OptionList. If NextHeader is nil, it is deduced from the next layer.
 type IPv6HopByHopOptionsExtHdr struct {
 	LayerBase
 	NextHeader *header.IPv6ExtensionHeaderIdentifier
 	Options    []byte
+	OptionList []IPv6ExtHdrOption
 }
 
 // IPv6DestinationOptionsExtHdr can construct and match an IPv6DestinationOptions
-// Extension Header.
+// Extension Header. Its fields are as for IPv6HopByHopOptionsExtHdr.
 type IPv6DestinationOptionsExtHdr struct {
 	LayerBase
 	NextHeader *header.IPv6ExtensionHeaderIdentifier
 	Options    []byte
+	OptionList []IPv6ExtHdrOption
+}
+
+// IPv6ExtHdrOption can construct and match an option of an IPv6 Hop-by-Hop or
+// Destination Options extension header, RFC 8200 section 4.2.
+type IPv6ExtHdrOption struct {
+	Type *header.IPv6ExtHdrOptionIndentifier
+	Data []byte
+}
+
+func (o IPv6ExtHdrOption) String() string {
+	return stringOption(o)
+}
+
+// IPv6ExtHdrOptionType is a helper routine that allocates a new
+// header.IPv6ExtHdrOptionIndentifier value to store v and returns a pointer to
+// it.
+func IPv6ExtHdrOptionType(v header.IPv6ExtHdrOptionIndentifier) *header.IPv6ExtHdrOptionIndentifier {
+	return &v
+}
+
+// Types of the padding options of extension headers, RFC 8200 section 4.2.
+const (
+	ipv6Pad1ExtHdrOptionType = 0
+	ipv6PadNExtHdrOptionType = 1
+)
+
+// ipv6ExtHdrOptionsToBytes serializes options followed by the Pad1 or PadN
+// option needed to make the extension header holding them a multiple of 8
+// octets long.
+func ipv6ExtHdrOptionsToBytes(options []IPv6ExtHdrOption) ([]byte, error) {
+	var b []byte
+	for i, o := range options {
+		if len(o.Data) > math.MaxUint8 {
+			return nil, fmt.Errorf("data of option %d is %d bytes long, more than the maximum of %d", i, len(o.Data), math.MaxUint8)
+		}
+		var typ header.IPv6ExtHdrOptionIndentifier
+		if o.Type != nil {
+			typ = *o.Type
+		}
+		b = append(b, byte(typ), uint8(len(o.Data)))
+		b = append(b, o.Data...)
+	}
+	// The options follow the Next Header and Hdr Ext Len fields.
+	switch padding := -(len(b) + 2) & 7; padding {
+	case 0:
+	case 1:
+		b = append(b, ipv6Pad1ExtHdrOptionType)
+	default:
+		b = append(b, ipv6PadNExtHdrOptionType, uint8(padding-2))
+		b = append(b, make([]byte, padding-2)...)
+	}
+	return b, nil
+}
+
+// ipv6ExtHdrOptions returns the serialized options of an options extension
+// header.
+func ipv6ExtHdrOptions(options []byte, optionList []IPv6ExtHdrOption) ([]byte, error) {
+	if options != nil || optionList == nil {
+		return options, nil
+	}
+	return ipv6ExtHdrOptionsToBytes(optionList)
+}
+
+// parseIPv6ExtHdrOptions parses the options of an options extension header, up
+// to the first option that is truncated.
+func parseIPv6ExtHdrOptions(b []byte) []IPv6ExtHdrOption {
+	options := []IPv6ExtHdrOption{}
+	for len(b) > 0 {
+		if b[0] == ipv6Pad1ExtHdrOptionType {
+			b = b[1:]
+			continue
+		}
+		if len(b) < 2 || 2+int(b[1]) > len(b) {
+			break
+		}
+		typ, data := b[0], b[2:2+int(b[1])]
+		b = b[2+len(data):]
+		if typ != ipv6PadNExtHdrOptionType {
+			options = append(options, IPv6ExtHdrOption{
+				Type: IPv6ExtHdrOptionType(header.IPv6ExtHdrOptionIndentifier(typ)),
+				Data: data,
+			})
+		}
+	}
+	return options
 }
 
-// ipv6OptionsExtHdrToBytes serializes an options extension header into bytes.
-func ipv6OptionsExtHdrToBytes(nextHeader *header.IPv6ExtensionHeaderIdentifier, options []byte) []byte {
+// ipv6OptionsExtHdrToBytes serializes an options extension header, followed by
+// next, into bytes.
+func ipv6OptionsExtHdrToBytes(nextHeader *header.IPv6ExtensionHeaderIdentifier, next Layer, options []byte) []byte {
 	length := len(options) + 2
 	bytes := make([]byte, length)
-	if nextHeader == nil {
-		bytes[0] = byte(header.IPv6NoNextHeaderIdentifier)
-	} else {
+	if nextHeader != nil {
 		bytes[0] = byte(*nextHeader)
+	} else if id, ok := ipv6Identifier(next); ok {
+		bytes[0] = byte(id)
+	} else {
+		bytes[0] = byte(header.IPv6NoNextHeaderIdentifier)
 	}
 	// ExtHdrLen field is the length of the extension header
 	// in 8-octet unit, ignoring the first 8 octets.
@@ -593,12 +834,20 @@ func IPv6ExtHdrIdent(id header.IPv6ExtensionHeaderIdentifier) *header.IPv6Extens
 
 // ToBytes implements Layer.ToBytes
 func (l *IPv6HopByHopOptionsExtHdr) ToBytes() ([]byte, error) {
-	return ipv6OptionsExtHdrToBytes(l.NextHeader, l.Options), nil
+	options, err := ipv6ExtHdrOptions(l.Options, l.OptionList)
+	if err != nil {
+		return nil, err
+	}
+	return ipv6OptionsExtHdrToBytes(l.NextHeader, l.next(), options), nil
 }
 
 // ToBytes implements Layer.ToBytes
 func (l *IPv6DestinationOptionsExtHdr) ToBytes() ([]byte, error) {
-	return ipv6OptionsExtHdrToBytes(l.NextHeader, l.Options), nil
+	options, err := ipv6ExtHdrOptions(l.Options, l.OptionList)
+	if err != nil {
+		return nil, err
+	}
+	return ipv6OptionsExtHdrToBytes(l.NextHeader, l.next(), options), nil
 }
 
 // parseIPv6ExtHdr parses an IPv6 extension header and returns the NextHeader
@@ -621,18 +870,27 @@ func parseIPv6ExtHdr(b []byte) (header.IPv6ExtensionHeaderIdentifier, []byte, la
 // with an IPv6 HopByHop Options Extension Header.
 func parseIPv6HopByHopOptionsExtHdr(b []byte) (Layer, layerParser) {
 	nextHeader, options, nextParser := parseIPv6ExtHdr(b)
-	return &IPv6HopByHopOptionsExtHdr{NextHeader: &nextHeader, Options: options}, nextParser
+	return &IPv6HopByHopOptionsExtHdr{
+		NextHeader: &nextHeader,
+		Options:    options,
+		OptionList: parseIPv6ExtHdrOptions(options),
+	}, nextParser
 }
 
 // parseIPv6DestinationOptionsExtHdr parses the bytes assuming that they start
 // with an IPv6 Destination Options Extension Header.
 func parseIPv6DestinationOptionsExtHdr(b []byte) (Layer, layerParser) {
 	nextHeader, options, nextParser := parseIPv6ExtHdr(b)
-	return &IPv6DestinationOptionsExtHdr{NextHeader: &nextHeader, Options: options}, nextParser
+	return &IPv6DestinationOptionsExtHdr{
+		NextHeader: &nextHeader,
+		Options:    options,
+		OptionList: parseIPv6ExtHdrOptions(options),
+	}, nextParser
 }
 
 func (l *IPv6HopByHopOptionsExtHdr) length() int {
-	return len(l.Options) + 2
+	options, _ := ipv6ExtHdrOptions(l.Options, l.OptionList)
+	return len(options) + 2
 }
 
 func (l *IPv6HopByHopOptionsExtHdr) match(other Layer) bool {
@@ -650,7 +908,8 @@ func (l *IPv6HopByHopOptionsExtHdr) String() string {
 }
 
 func (l *IPv6DestinationOptionsExtHdr) length() int {
-	return len(l.Options) + 2
+	options, _ := ipv6ExtHdrOptions(l.Options, l.OptionList)
+	return len(options) + 2
 }
 
 func (l *IPv6DestinationOptionsExtHdr) match(other Layer) bool {
@@ -667,6 +926,116 @@ func (l *IPv6DestinationOptionsExtHdr) String() string {
 	return stringLayer(l)
 }
 
+// IPv6FragmentExtHdr can construct and match an IPv6 Fragment Extension Header.
+type IPv6FragmentExtHdr struct {
+	LayerBase
+	NextHeader     *header.IPv6ExtensionHeaderIdentifier
+	FragmentOffset *uint16
+	MoreFragments  *bool
+	Identification *uint32
+}
+
+// ToBytes implements Layer.ToBytes.
+func (l *IPv6FragmentExtHdr) ToBytes() ([]byte, error) {
+	b := make([]byte, header.IPv6FragmentHeaderSize)
+	fields := &header.IPv6FragmentFields{
+		NextHeader: uint8(header.IPv6NoNextHeaderIdentifier),
+	}
+	if l.NextHeader != nil {
+		fields.NextHeader = uint8(*l.NextHeader)
+	}
+	if l.FragmentOffset != nil {
+		fields.FragmentOffset = *l.FragmentOffset
+	}
+	if l.MoreFragments != nil {
+		fields.M = *l.MoreFragments
+	}
+	if l.Identification != nil {
+		fields.Identification = *l.Identification
+	}
+	header.IPv6Fragment(b).Encode(fields)
+	return b, nil
+}
+
+// parseIPv6FragmentExtHdr parses the bytes assuming that they start with an
+// IPv6 Fragment Extension Header. Only the first fragment of a packet, at
+// offset zero, holds the headers that follow: the others are parsed as a
+// Payload.
+func parseIPv6FragmentExtHdr(b []byte) (Layer, layerParser) {
+	h := header.IPv6Fragment(b)
+	nextHeader := header.IPv6ExtensionHeaderIdentifier(h.NextHeader())
+	fragment := IPv6FragmentExtHdr{
+		NextHeader:     &nextHeader,
+		FragmentOffset: Uint16(h.FragmentOffset()),
+		MoreFragments:  Bool(h.More()),
+		Identification: Uint32(h.ID()),
+	}
+	nextParser := parsePayload
+	if h.FragmentOffset() == 0 {
+		nextParser = nextIPv6PayloadParser(h.NextHeader())
+	}
+	return &fragment, nextParser
+}
+
+func (l *IPv6FragmentExtHdr) length() int {
+	return header.IPv6FragmentHeaderSize
+}
+
+func (l *IPv6FragmentExtHdr) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+// merge overrides the values in l with the values from other but only in fields
+// where the value is not nil.
+func (l *IPv6FragmentExtHdr) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
+func (l *IPv6FragmentExtHdr) String() string {
+	return stringLayer(l)
+}
+
+// ipv6NextHeader returns the Next Header field of l, if l is an IPv6 header
+// or extension header.
+func ipv6NextHeader(l Layer) (header.IPv6ExtensionHeaderIdentifier, bool) {
+	switch l := l.(type) {
+	case *IPv6:
+		if l.NextHeader != nil {
+			return header.IPv6ExtensionHeaderIdentifier(*l.NextHeader), true
+		}
+	case *IPv6HopByHopOptionsExtHdr:
+		if l.NextHeader != nil {
+			return *l.NextHeader, true
+		}
+	case *IPv6DestinationOptionsExtHdr:
+		if l.NextHeader != nil {
+			return *l.NextHeader, true
+		}
+	}
+	return 0, false
+}
+
+// parseIPv6Fragments parses the IPv6 Fragment Extension Header left in the
+// Payload of layers by parse, and the layers that follow it, as
+// parseIPv6FragmentExtHdr does. Non-first fragments are thus a Payload
+// following the IPv6FragmentExtHdr, rather than bytes mis-parsed as the
+// headers of the next protocol.
+func parseIPv6Fragments(layers Layers) Layers {
+	for i := 1; i < len(layers); i++ {
+		payload, ok := layers[i].(*Payload)
+		if !ok || len(payload.Bytes) < header.IPv6FragmentHeaderSize {
+			continue
+		}
+		if next, ok := ipv6NextHeader(layers[i-1]); !ok || next != header.IPv6FragmentExtHdrIdentifier {
+			continue
+		}
+		layers = append(layers[:i:i], parse(parseIPv6FragmentExtHdr, payload.Bytes)...)
+		layers.linkLayers()
+		break
+	}
+	return layers
+}
+
 // ICMPv6 can construct and match an ICMPv6 encapsulation.
 type ICMPv6 struct {
 	LayerBase
@@ -674,6 +1043,12 @@ type ICMPv6 struct {
 	Code       *byte
 	Checksum   *uint16
 	NDPPayload []byte
+
+	// FullPayload is the payload of the whole ICMPv6 message when it is sent in
+	// several IPv6 fragments and NDPPayload only holds the part in the first
+	// fragment. If set, it is used instead of NDPPayload and the layers that
+	// follow to compute a missing Checksum. It is never set by parsing.
+	FullPayload []byte
 }
 
 func (l *ICMPv6) String() string {
@@ -688,6 +1063,25 @@ func (l *ICMPv6) ToBytes() ([]byte, error) {
 	h := header.ICMPv6(b)
 	if l.Type != nil {
 		h.SetType(*l.Type)
+	} else {
+		switch l.next().(type) {
+		case *ICMPv6NeighborSolicitation:
+			h.SetType(header.ICMPv6NeighborSolicit)
+		case *ICMPv6NeighborAdvertisement:
+			h.SetType(header.ICMPv6NeighborAdvert)
+		case *ICMPv6RouterSolicitation:
+			h.SetType(header.ICMPv6RouterSolicit)
+		case *ICMPv6RouterAdvertisement:
+			h.SetType(header.ICMPv6RouterAdvert)
+		case *MLDListenerQuery:
+			h.SetType(header.ICMPv6MulticastListenerQuery)
+		case *MLDListenerReport:
+			h.SetType(header.ICMPv6MulticastListenerReport)
+		case *MLDListenerDone:
+			h.SetType(header.ICMPv6MulticastListenerDone)
+		case *MLDv2ListenerReport:
+			h.SetType(header.ICMPv6MulticastListenerV2Report)
+		}
 	}
 	if l.Code != nil {
 		h.SetCode(*l.Code)
@@ -696,12 +1090,20 @@ func (l *ICMPv6) ToBytes() ([]byte, error) {
 	if l.Checksum != nil {
 		h.SetChecksum(*l.Checksum)
 	} else {
+		body := l.FullPayload
+		if body == nil {
+			rest, err := payload(l)
+			if err != nil {
+				return nil, err
+			}
+			body = append(append([]byte(nil), l.NDPPayload...), rest.ToView()...)
+		}
 		// It is possible that the ICMPv6 header does not follow the IPv6 header
 		// immediately, there could be one or more extension headers in between.
 		// We need to search forward to find the IPv6 header.
 		for prev := l.Prev(); prev != nil; prev = prev.Prev() {
 			if ipv6, ok := prev.(*IPv6); ok {
-				h.SetChecksum(header.ICMPv6Checksum(h, *ipv6.SrcAddr, *ipv6.DstAddr, buffer.VectorisedView{}))
+				h.SetChecksum(icmpv6Checksum(h, *ipv6.SrcAddr, *ipv6.DstAddr, body))
 				break
 			}
 		}
@@ -709,6 +1111,86 @@ func (l *ICMPv6) ToBytes() ([]byte, error) {
 	return h, nil
 }
 
+// icmpv6Checksum calculates the checksum of an ICMPv6 message with the header
+// of h and payload, which may be longer than the payload of h.
+func icmpv6Checksum(h header.ICMPv6, src, dst tcpip.Address, payload []byte) uint16 {
+	return header.ICMPv6Checksum(h[:header.ICMPv6HeaderSize], src, dst, buffer.View(payload).ToVectorisedView())
+}
+
+// VerifyICMPv6Checksum verifies the checksum of an ICMPv6 message sent in the
+// IPv6 fragments, in order, of one packet. The fragments must be parsed with
+// SetIPv6FragmentParsing enabled, so that the first one holds an ICMPv6 layer
+// and the others a Payload. An error is returned if the fragments do not form
+// the whole message or if its checksum is incorrect.
+func VerifyICMPv6Checksum(fragments ...Layers) error {
+	var (
+		ipv6    *IPv6
+		icmpv6  *ICMPv6
+		payload []byte
+		length  int
+		more    = true
+	)
+	for i, layers := range fragments {
+		if !more {
+			return fmt.Errorf("fragment %d follows the last fragment", i)
+		}
+		j := 0
+		for ; j < len(layers); j++ {
+			if _, ok := layers[j].(*IPv6FragmentExtHdr); ok {
+				break
+			}
+		}
+		if j == 0 || j+1 >= len(layers) {
+			return fmt.Errorf("fragment %d has no IPv6 fragment extension header with a payload: %s", i, &layers)
+		}
+		frag := layers[j].(*IPv6FragmentExtHdr)
+		if frag.FragmentOffset == nil || frag.MoreFragments == nil {
+			return fmt.Errorf("fragment %d has an incomplete fragment extension header: %s", i, frag)
+		}
+		if got, want := int(*frag.FragmentOffset)*8, length; got != want {
+			return fmt.Errorf("fragment %d has offset %d, want %d", i, got, want)
+		}
+		if i == 0 {
+			for k := j - 1; k >= 0 && ipv6 == nil; k-- {
+				ipv6, _ = layers[k].(*IPv6)
+			}
+			var ok bool
+			if icmpv6, ok = layers[j+1].(*ICMPv6); !ok || ipv6 == nil {
+				return fmt.Errorf("first fragment is not IPv6 followed by ICMPv6: %s", &layers)
+			}
+			if ipv6.SrcAddr == nil || ipv6.DstAddr == nil || icmpv6.Checksum == nil {
+				return fmt.Errorf("first fragment is missing addresses or a checksum: %s", &layers)
+			}
+			payload = append(payload, icmpv6.NDPPayload...)
+			length = header.ICMPv6HeaderSize + len(icmpv6.NDPPayload)
+		} else {
+			p, ok := layers[j+1].(*Payload)
+			if !ok {
+				return fmt.Errorf("fragment %d is not followed by a payload: %s", i, &layers)
+			}
+			payload = append(payload, p.Bytes...)
+			length += len(p.Bytes)
+		}
+		more = *frag.MoreFragments
+		// Only the last fragment may end at an offset that can't be expressed
+		// in 8-octet units.
+		if more && length%8 != 0 {
+			return fmt.Errorf("fragment %d ends at offset %d, which is not a multiple of 8", i, length)
+		}
+	}
+	if icmpv6 == nil || more {
+		return fmt.Errorf("missing the last fragment")
+	}
+	b, err := icmpv6.ToBytes()
+	if err != nil {
+		return err
+	}
+	if got, want := *icmpv6.Checksum, icmpv6Checksum(b, *ipv6.SrcAddr, *ipv6.DstAddr, payload); got != want {
+		return fmt.Errorf("got checksum 0x%04x, want 0x%04x", got, want)
+	}
+	return nil
+}
+
 // ICMPv6Type is a helper routine that allocates a new ICMPv6Type value to store
 // v and returns a pointer to it.
 func ICMPv6Type(v header.ICMPv6Type) *header.ICMPv6Type {
@@ -730,7 +1212,31 @@ func parseICMPv6(b []byte) (Layer, layerParser) {
 		Checksum:   Uint16(h.Checksum()),
 		NDPPayload: h.NDPPayload(),
 	}
-	return &icmpv6, nil
+	// Neighbor Discovery and Multicast Listener Discovery messages are parsed
+	// into their own layers.
+	var nextParser layerParser
+	switch {
+	case h.Type() == header.ICMPv6NeighborSolicit && len(icmpv6.NDPPayload) >= header.NDPNSMinimumSize:
+		nextParser = parseICMPv6NeighborSolicitation
+	case h.Type() == header.ICMPv6NeighborAdvert && len(icmpv6.NDPPayload) >= header.NDPNAMinimumSize:
+		nextParser = parseICMPv6NeighborAdvertisement
+	case h.Type() == header.ICMPv6RouterSolicit && len(icmpv6.NDPPayload) >= header.NDPRSMinimumSize:
+		nextParser = parseICMPv6RouterSolicitation
+	case h.Type() == header.ICMPv6RouterAdvert && len(icmpv6.NDPPayload) >= header.NDPRAMinimumSize:
+		nextParser = parseICMPv6RouterAdvertisement
+	case h.Type() == header.ICMPv6MulticastListenerQuery && len(icmpv6.NDPPayload) >= mldMinimumSize:
+		nextParser = parseMLDListenerQuery
+	case h.Type() == header.ICMPv6MulticastListenerReport && len(icmpv6.NDPPayload) >= mldMinimumSize:
+		nextParser = parseMLDListenerReport
+	case h.Type() == header.ICMPv6MulticastListenerDone && len(icmpv6.NDPPayload) >= mldMinimumSize:
+		nextParser = parseMLDListenerDone
+	case h.Type() == header.ICMPv6MulticastListenerV2Report && len(icmpv6.NDPPayload) >= mldv2ReportMinimumSize:
+		nextParser = parseMLDv2ListenerReport
+	}
+	if nextParser != nil {
+		icmpv6.NDPPayload = []byte{}
+	}
+	return &icmpv6, nextParser
 }
 
 func (l *ICMPv6) match(other Layer) bool {
@@ -747,85 +1253,1240 @@ func (l *ICMPv6) merge(other Layer) error {
 	return mergeLayer(l, other)
 }
 
-// ICMPv4Type is a helper routine that allocates a new header.ICMPv4Type value
-// to store t and returns a pointer to it.
-func ICMPv4Type(t header.ICMPv4Type) *header.ICMPv4Type {
-	return &t
-}
+// NDPOptions can construct and match the options of a Neighbor Discovery
+// message. Options other than the ones below, or with an unexpected length,
+// are kept in Unknown as their raw bytes, including the type and length.
+//
+// Lists of options match whatever their order, as long as their options can be
+// paired up so that each pair matches. As for other fields, a nil list matches
+// any list.
+type NDPOptions struct {
+	SourceLinkLayerAddress *tcpip.LinkAddress
+	TargetLinkLayerAddress *tcpip.LinkAddress
+	MTU                    *uint32
+	PrefixInformation      []NDPPrefixInformation
+	RouteInformation       []NDPRouteInformation
+	Unknown                [][]byte
+}
+
+// NDP option types, RFC 4861 section 4.6 and RFC 4191 section 2.3.
+const (
+	ndpSourceLinkLayerAddressType = 1
+	ndpTargetLinkLayerAddressType = 2
+	ndpPrefixInformationType      = 3
+	ndpMTUType                    = 5
+	ndpRouteInformationType       = 24
+)
 
-// ICMPv4 can construct and match an ICMPv4 encapsulation.
-type ICMPv4 struct {
-	LayerBase
-	Type     *header.ICMPv4Type
-	Code     *uint8
-	Checksum *uint16
+// NDPPrefixInformation can construct and match an NDP Prefix Information
+// option, RFC 4861 section 4.6.2.
+type NDPPrefixInformation struct {
+	PrefixLength      *uint8
+	OnLinkFlag        *bool
+	AutonomousFlag    *bool
+	ValidLifetime     *uint32
+	PreferredLifetime *uint32
+	Prefix            *tcpip.Address
 }
 
-func (l *ICMPv4) String() string {
-	return stringLayer(l)
+func (o NDPPrefixInformation) String() string {
+	return stringOption(o)
 }
 
-// ToBytes implements Layer.ToBytes.
-func (l *ICMPv4) ToBytes() ([]byte, error) {
-	b := make([]byte, header.ICMPv4MinimumSize)
-	h := header.ICMPv4(b)
-	if l.Type != nil {
-		h.SetType(*l.Type)
-	}
-	if l.Code != nil {
-		h.SetCode(byte(*l.Code))
-	}
-	if l.Checksum != nil {
-		h.SetChecksum(*l.Checksum)
-		return h, nil
-	}
-	payload, err := payload(l)
-	if err != nil {
-		return nil, err
-	}
-	h.SetChecksum(header.ICMPv4Checksum(h, payload))
-	return h, nil
+// NDPRouteInformation can construct and match an NDP Route Information option,
+// RFC 4191 section 2.3.
+type NDPRouteInformation struct {
+	PrefixLength  *uint8
+	Preference    *uint8
+	RouteLifetime *uint32
+	Prefix        *tcpip.Address
 }
 
-// parseICMPv4 parses the bytes as an ICMPv4 header, returning a Layer and a
-// parser for the encapsulated payload.
-func parseICMPv4(b []byte) (Layer, layerParser) {
-	h := header.ICMPv4(b)
-	icmpv4 := ICMPv4{
-		Type:     ICMPv4Type(h.Type()),
-		Code:     Uint8(h.Code()),
-		Checksum: Uint16(h.Checksum()),
-	}
-	return &icmpv4, parsePayload
+func (o NDPRouteInformation) String() string {
+	return stringOption(o)
 }
 
-func (l *ICMPv4) match(other Layer) bool {
-	return equalLayer(l, other)
+// prefixBytes returns the number of bytes of the prefix in the option, which
+// depends on the prefix length.
+func (o *NDPRouteInformation) prefixBytes() int {
+	switch {
+	case o.Prefix == nil || o.PrefixLength == nil || *o.PrefixLength == 0:
+		return 0
+	case *o.PrefixLength <= 64:
+		return 8
+	default:
+		return header.IPv6AddressSize
+	}
 }
 
-func (l *ICMPv4) length() int {
-	return header.ICMPv4MinimumSize
+func (o NDPOptions) String() string {
+	return stringOption(o)
 }
 
-// merge overrides the values in l with the values from other but only in fields
-// where the value is not nil.
-func (l *ICMPv4) merge(other Layer) error {
-	return mergeLayer(l, other)
+// stringOption formats the non-nil fields of o, an NDP option or an MLDv2 or
+// IGMPv3 record, whose fields must all be pointers or slices.
+func stringOption(o interface{}) string {
+	v := reflect.ValueOf(o)
+	t := v.Type()
+	var ret []string
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if f.IsNil() {
+			continue
+		}
+		ret = append(ret, fmt.Sprintf("%s:%v", t.Field(i).Name, reflect.Indirect(f)))
+	}
+	return fmt.Sprintf("{%s}", strings.Join(ret, " "))
 }
 
-// TCP can construct and match a TCP encapsulation.
-type TCP struct {
-	LayerBase
-	SrcPort       *uint16
-	DstPort       *uint16
-	SeqNum        *uint32
-	AckNum        *uint32
-	DataOffset    *uint8
-	Flags         *uint8
-	WindowSize    *uint16
-	Checksum      *uint16
-	UrgentPointer *uint16
-	Options       []byte
+// Equal is used by equalLayer to match the options of layers.
+func (o *NDPOptions) Equal(other *NDPOptions) bool {
+	if o == nil || other == nil {
+		return true
+	}
+	x, y := *o, *other
+	x.PrefixInformation, x.RouteInformation, x.Unknown = nil, nil, nil
+	y.PrefixInformation, y.RouteInformation, y.Unknown = nil, nil, nil
+	if !cmp.Equal(x, y, ignoreNil) {
+		return false
+	}
+	if o.PrefixInformation != nil && other.PrefixInformation != nil && !matchUnordered(len(o.PrefixInformation), len(other.PrefixInformation), func(i, j int) bool {
+		return cmp.Equal(o.PrefixInformation[i], other.PrefixInformation[j], ignoreNil)
+	}) {
+		return false
+	}
+	if o.RouteInformation != nil && other.RouteInformation != nil && !matchUnordered(len(o.RouteInformation), len(other.RouteInformation), func(i, j int) bool {
+		return cmp.Equal(o.RouteInformation[i], other.RouteInformation[j], ignoreNil)
+	}) {
+		return false
+	}
+	if o.Unknown != nil && other.Unknown != nil && !matchUnordered(len(o.Unknown), len(other.Unknown), func(i, j int) bool {
+		return bytes.Equal(o.Unknown[i], other.Unknown[j])
+	}) {
+		return false
+	}
+	return true
+}
+
+// matchUnordered reports whether the elements of two lists, of lengths n and m,
+// can be paired up so that match(i, j) holds for each pair.
+func matchUnordered(n, m int, match func(i, j int) bool) bool {
+	if n != m {
+		return false
+	}
+	used := make([]bool, m)
+	var pair func(i int) bool
+	pair = func(i int) bool {
+		if i == n {
+			return true
+		}
+		for j := 0; j < m; j++ {
+			if !used[j] && match(i, j) {
+				used[j] = true
+				if pair(i + 1) {
+					return true
+				}
+				used[j] = false
+			}
+		}
+		return false
+	}
+	return pair(0)
+}
+
+func (o *NDPOptions) length() int {
+	if o == nil {
+		return 0
+	}
+	var length int
+	if o.SourceLinkLayerAddress != nil {
+		length += header.NDPLinkLayerAddressSize
+	}
+	if o.TargetLinkLayerAddress != nil {
+		length += header.NDPLinkLayerAddressSize
+	}
+	if o.MTU != nil {
+		length += 8
+	}
+	length += 32 * len(o.PrefixInformation)
+	for i := range o.RouteInformation {
+		length += 8 + o.RouteInformation[i].prefixBytes()
+	}
+	for _, opt := range o.Unknown {
+		length += len(opt)
+	}
+	return length
+}
+
+// toBytes serializes the options, in the order of the fields of o.
+func (o *NDPOptions) toBytes() []byte {
+	b := make([]byte, o.length())
+	if o == nil {
+		return b
+	}
+	rest := b
+	// next returns the next option, of the given type and length, in rest.
+	next := func(typ uint8, length int) []byte {
+		opt := rest[:length]
+		rest = rest[length:]
+		opt[0] = typ
+		opt[1] = uint8(length / 8)
+		return opt
+	}
+	if o.SourceLinkLayerAddress != nil {
+		copy(next(ndpSourceLinkLayerAddressType, header.NDPLinkLayerAddressSize)[2:], *o.SourceLinkLayerAddress)
+	}
+	if o.TargetLinkLayerAddress != nil {
+		copy(next(ndpTargetLinkLayerAddressType, header.NDPLinkLayerAddressSize)[2:], *o.TargetLinkLayerAddress)
+	}
+	if o.MTU != nil {
+		binary.BigEndian.PutUint32(next(ndpMTUType, 8)[4:], *o.MTU)
+	}
+	for _, p := range o.PrefixInformation {
+		opt := next(ndpPrefixInformationType, 32)
+		if p.PrefixLength != nil {
+			opt[2] = *p.PrefixLength
+		}
+		if p.OnLinkFlag != nil && *p.OnLinkFlag {
+			opt[3] |= 1 << 7
+		}
+		if p.AutonomousFlag != nil && *p.AutonomousFlag {
+			opt[3] |= 1 << 6
+		}
+		if p.ValidLifetime != nil {
+			binary.BigEndian.PutUint32(opt[4:], *p.ValidLifetime)
+		}
+		if p.PreferredLifetime != nil {
+			binary.BigEndian.PutUint32(opt[8:], *p.PreferredLifetime)
+		}
+		if p.Prefix != nil {
+			copy(opt[16:], *p.Prefix)
+		}
+	}
+	for i := range o.RouteInformation {
+		r := &o.RouteInformation[i]
+		opt := next(ndpRouteInformationType, 8+r.prefixBytes())
+		if r.PrefixLength != nil {
+			opt[2] = *r.PrefixLength
+		}
+		if r.Preference != nil {
+			opt[3] = (*r.Preference & 0x3) << 3
+		}
+		if r.RouteLifetime != nil {
+			binary.BigEndian.PutUint32(opt[4:], *r.RouteLifetime)
+		}
+		if r.Prefix != nil {
+			copy(opt[8:], *r.Prefix)
+		}
+	}
+	for _, opt := range o.Unknown {
+		rest = rest[copy(rest, opt):]
+	}
+	return b
+}
+
+// parseNDPOptions parses the options of a Neighbor Discovery message.
+func parseNDPOptions(b []byte) *NDPOptions {
+	var o NDPOptions
+	for len(b) >= 2 {
+		length := int(b[1]) * 8
+		if length == 0 || length > len(b) {
+			break
+		}
+		opt := b[:length]
+		b = b[length:]
+		switch typ := opt[0]; {
+		case typ == ndpSourceLinkLayerAddressType && length == header.NDPLinkLayerAddressSize:
+			o.SourceLinkLayerAddress = LinkAddress(tcpip.LinkAddress(opt[2:]))
+		case typ == ndpTargetLinkLayerAddressType && length == header.NDPLinkLayerAddressSize:
+			o.TargetLinkLayerAddress = LinkAddress(tcpip.LinkAddress(opt[2:]))
+		case typ == ndpMTUType && length == 8:
+			o.MTU = Uint32(binary.BigEndian.Uint32(opt[4:]))
+		case typ == ndpPrefixInformationType && length == 32:
+			o.PrefixInformation = append(o.PrefixInformation, NDPPrefixInformation{
+				PrefixLength:      Uint8(opt[2]),
+				OnLinkFlag:        Bool(opt[3]&(1<<7) != 0),
+				AutonomousFlag:    Bool(opt[3]&(1<<6) != 0),
+				ValidLifetime:     Uint32(binary.BigEndian.Uint32(opt[4:])),
+				PreferredLifetime: Uint32(binary.BigEndian.Uint32(opt[8:])),
+				Prefix:            Address(tcpip.Address(opt[16:32])),
+			})
+		case typ == ndpRouteInformationType && length <= 8+header.IPv6AddressSize:
+			prefix := make([]byte, header.IPv6AddressSize)
+			copy(prefix, opt[8:])
+			o.RouteInformation = append(o.RouteInformation, NDPRouteInformation{
+				PrefixLength:  Uint8(opt[2]),
+				Preference:    Uint8((opt[3] >> 3) & 0x3),
+				RouteLifetime: Uint32(binary.BigEndian.Uint32(opt[4:])),
+				Prefix:        Address(tcpip.Address(prefix)),
+			})
+		default:
+			o.Unknown = append(o.Unknown, append([]byte(nil), opt...))
+		}
+	}
+	return &o
+}
+
+// ICMPv6NeighborSolicitation can construct and match the body of an NDP
+// Neighbor Solicitation message, which follows an ICMPv6 header.
+type ICMPv6NeighborSolicitation struct {
+	LayerBase
+	TargetAddress *tcpip.Address
+	Options       *NDPOptions
+}
+
+func (l *ICMPv6NeighborSolicitation) String() string {
+	return stringLayer(l)
+}
+
+// ToBytes implements Layer.ToBytes.
+func (l *ICMPv6NeighborSolicitation) ToBytes() ([]byte, error) {
+	b := make([]byte, header.NDPNSMinimumSize)
+	ns := header.NDPNeighborSolicit(b)
+	if l.TargetAddress != nil {
+		ns.SetTargetAddress(*l.TargetAddress)
+	}
+	return append(b, l.Options.toBytes()...), nil
+}
+
+// parseICMPv6NeighborSolicitation parses the bytes assuming that they start
+// with the body of an NDP Neighbor Solicitation message.
+func parseICMPv6NeighborSolicitation(b []byte) (Layer, layerParser) {
+	ns := header.NDPNeighborSolicit(b)
+	return &ICMPv6NeighborSolicitation{
+		TargetAddress: Address(ns.TargetAddress()),
+		Options:       parseNDPOptions(ns.Options()),
+	}, nil
+}
+
+func (l *ICMPv6NeighborSolicitation) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+func (l *ICMPv6NeighborSolicitation) length() int {
+	return header.NDPNSMinimumSize + l.Options.length()
+}
+
+// merge overrides the values in l with the values from other but only in fields
+// where the value is not nil.
+func (l *ICMPv6NeighborSolicitation) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
+// ICMPv6NeighborAdvertisement can construct and match the body of an NDP
+// Neighbor Advertisement message, which follows an ICMPv6 header.
+type ICMPv6NeighborAdvertisement struct {
+	LayerBase
+	RouterFlag    *bool
+	SolicitedFlag *bool
+	OverrideFlag  *bool
+	TargetAddress *tcpip.Address
+	Options       *NDPOptions
+}
+
+func (l *ICMPv6NeighborAdvertisement) String() string {
+	return stringLayer(l)
+}
+
+// ToBytes implements Layer.ToBytes.
+func (l *ICMPv6NeighborAdvertisement) ToBytes() ([]byte, error) {
+	b := make([]byte, header.NDPNAMinimumSize)
+	na := header.NDPNeighborAdvert(b)
+	if l.RouterFlag != nil {
+		na.SetRouterFlag(*l.RouterFlag)
+	}
+	if l.SolicitedFlag != nil {
+		na.SetSolicitedFlag(*l.SolicitedFlag)
+	}
+	if l.OverrideFlag != nil {
+		na.SetOverrideFlag(*l.OverrideFlag)
+	}
+	if l.TargetAddress != nil {
+		na.SetTargetAddress(*l.TargetAddress)
+	}
+	return append(b, l.Options.toBytes()...), nil
+}
+
+// parseICMPv6NeighborAdvertisement parses the bytes assuming that they start
+// with the body of an NDP Neighbor Advertisement message.
+func parseICMPv6NeighborAdvertisement(b []byte) (Layer, layerParser) {
+	na := header.NDPNeighborAdvert(b)
+	return &ICMPv6NeighborAdvertisement{
+		RouterFlag:    Bool(na.RouterFlag()),
+		SolicitedFlag: Bool(na.SolicitedFlag()),
+		OverrideFlag:  Bool(na.OverrideFlag()),
+		TargetAddress: Address(na.TargetAddress()),
+		Options:       parseNDPOptions(na.Options()),
+	}, nil
+}
+
+func (l *ICMPv6NeighborAdvertisement) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+func (l *ICMPv6NeighborAdvertisement) length() int {
+	return header.NDPNAMinimumSize + l.Options.length()
+}
+
+// merge overrides the values in l with the values from other but only in fields
+// where the value is not nil.
+func (l *ICMPv6NeighborAdvertisement) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
+// ICMPv6RouterSolicitation can construct and match the body of an NDP Router
+// Solicitation message, which follows an ICMPv6 header.
+type ICMPv6RouterSolicitation struct {
+	LayerBase
+	Options *NDPOptions
+}
+
+func (l *ICMPv6RouterSolicitation) String() string {
+	return stringLayer(l)
+}
+
+// ToBytes implements Layer.ToBytes.
+func (l *ICMPv6RouterSolicitation) ToBytes() ([]byte, error) {
+	b := make([]byte, header.NDPRSMinimumSize)
+	return append(b, l.Options.toBytes()...), nil
+}
+
+// parseICMPv6RouterSolicitation parses the bytes assuming that they start with
+// the body of an NDP Router Solicitation message.
+func parseICMPv6RouterSolicitation(b []byte) (Layer, layerParser) {
+	rs := header.NDPRouterSolicit(b)
+	return &ICMPv6RouterSolicitation{
+		Options: parseNDPOptions(rs.Options()),
+	}, nil
+}
+
+func (l *ICMPv6RouterSolicitation) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+func (l *ICMPv6RouterSolicitation) length() int {
+	return header.NDPRSMinimumSize + l.Options.length()
+}
+
+// merge overrides the values in l with the values from other but only in fields
+// where the value is not nil.
+func (l *ICMPv6RouterSolicitation) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
+// ICMPv6RouterAdvertisement can construct and match the body of an NDP Router
+// Advertisement message, which follows an ICMPv6 header. RouterLifetime is in
+// seconds, ReachableTime and RetransTimer are in milliseconds.
+type ICMPv6RouterAdvertisement struct {
+	LayerBase
+	CurrHopLimit        *uint8
+	ManagedAddrConfFlag *bool
+	OtherConfFlag       *bool
+	RouterLifetime      *uint16
+	ReachableTime       *uint32
+	RetransTimer        *uint32
+	Options             *NDPOptions
+}
+
+func (l *ICMPv6RouterAdvertisement) String() string {
+	return stringLayer(l)
+}
+
+// ToBytes implements Layer.ToBytes.
+func (l *ICMPv6RouterAdvertisement) ToBytes() ([]byte, error) {
+	b := make([]byte, header.NDPRAMinimumSize)
+	if l.CurrHopLimit != nil {
+		b[0] = *l.CurrHopLimit
+	}
+	if l.ManagedAddrConfFlag != nil && *l.ManagedAddrConfFlag {
+		b[1] |= 1 << 7
+	}
+	if l.OtherConfFlag != nil && *l.OtherConfFlag {
+		b[1] |= 1 << 6
+	}
+	if l.RouterLifetime != nil {
+		binary.BigEndian.PutUint16(b[2:], *l.RouterLifetime)
+	}
+	if l.ReachableTime != nil {
+		binary.BigEndian.PutUint32(b[4:], *l.ReachableTime)
+	}
+	if l.RetransTimer != nil {
+		binary.BigEndian.PutUint32(b[8:], *l.RetransTimer)
+	}
+	return append(b, l.Options.toBytes()...), nil
+}
+
+// parseICMPv6RouterAdvertisement parses the bytes assuming that they start with
+// the body of an NDP Router Advertisement message.
+func parseICMPv6RouterAdvertisement(b []byte) (Layer, layerParser) {
+	ra := header.NDPRouterAdvert(b)
+	return &ICMPv6RouterAdvertisement{
+		CurrHopLimit:        Uint8(ra.CurrHopLimit()),
+		ManagedAddrConfFlag: Bool(ra.ManagedAddrConfFlag()),
+		OtherConfFlag:       Bool(ra.OtherConfFlag()),
+		RouterLifetime:      Uint16(binary.BigEndian.Uint16(b[2:])),
+		ReachableTime:       Uint32(binary.BigEndian.Uint32(b[4:])),
+		RetransTimer:        Uint32(binary.BigEndian.Uint32(b[8:])),
+		Options:             parseNDPOptions(ra.Options()),
+	}, nil
+}
+
+func (l *ICMPv6RouterAdvertisement) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+func (l *ICMPv6RouterAdvertisement) length() int {
+	return header.NDPRAMinimumSize + l.Options.length()
+}
+
+// merge overrides the values in l with the values from other but only in fields
+// where the value is not nil.
+func (l *ICMPv6RouterAdvertisement) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
+// IPv6RouterAlertMLDOptions returns the options of the Hop-by-Hop Options
+// extension header that precedes MLD messages: a Router Alert option for MLD,
+// RFC 2711 section 2.1, followed by a PadN option to fill the header to 8
+// octets.
+func IPv6RouterAlertMLDOptions() []byte {
+	return []byte{5, 2, 0, 0, 1, 0}
+}
+
+// mldMinimumSize is the size of the body of an MLDv1 message, RFC 2710 section
+// 3: the Maximum Response Delay, a reserved field and the Multicast Address.
+const mldMinimumSize = 20
+
+// mldToBytes serializes the body of an MLDv1 message.
+func mldToBytes(maxResponseDelay *uint16, multicastAddress *tcpip.Address) []byte {
+	b := make([]byte, mldMinimumSize)
+	if maxResponseDelay != nil {
+		binary.BigEndian.PutUint16(b, *maxResponseDelay)
+	}
+	if multicastAddress != nil {
+		copy(b[4:], *multicastAddress)
+	}
+	return b
+}
+
+// parseMLD parses the body of an MLDv1 message.
+func parseMLD(b []byte) (*uint16, *tcpip.Address) {
+	return Uint16(binary.BigEndian.Uint16(b)), Address(tcpip.Address(b[4:mldMinimumSize]))
+}
+
+// MLDListenerQuery can construct and match the body of an MLD Multicast
+// Listener Query, which follows an ICMPv6 header. MaxResponseDelay is in
+// milliseconds. A general query has the unspecified MulticastAddress.
+//
+// The fields after MulticastAddress are only in MLDv2 queries, RFC 3810
+// section 5.1. The query is sent in the MLDv2 format if any of them is set,
+// and they are only set by parsing an MLDv2 query.
+type MLDListenerQuery struct {
+	LayerBase
+	MaxResponseDelay *uint16
+	MulticastAddress *tcpip.Address
+	SuppressFlag     *bool
+	QRV              *uint8
+	QQIC             *uint8
+	Sources          []tcpip.Address
+}
+
+// mldv2QueryMinimumSize is the size of the body of an MLDv2 query without
+// sources.
+const mldv2QueryMinimumSize = mldMinimumSize + 4
+
+func (l *MLDListenerQuery) String() string {
+	return stringLayer(l)
+}
+
+func (l *MLDListenerQuery) isV2() bool {
+	return l.SuppressFlag != nil || l.QRV != nil || l.QQIC != nil || l.Sources != nil
+}
+
+// ToBytes implements Layer.ToBytes.
+func (l *MLDListenerQuery) ToBytes() ([]byte, error) {
+	b := mldToBytes(l.MaxResponseDelay, l.MulticastAddress)
+	if !l.isV2() {
+		return b, nil
+	}
+	v2 := make([]byte, 4+len(l.Sources)*header.IPv6AddressSize)
+	if l.SuppressFlag != nil && *l.SuppressFlag {
+		v2[0] |= 1 << 3
+	}
+	if l.QRV != nil {
+		v2[0] |= *l.QRV & 0x7
+	}
+	if l.QQIC != nil {
+		v2[1] = *l.QQIC
+	}
+	binary.BigEndian.PutUint16(v2[2:], uint16(len(l.Sources)))
+	for i, src := range l.Sources {
+		copy(v2[4+i*header.IPv6AddressSize:], src)
+	}
+	return append(b, v2...), nil
+}
+
+// parseMLDListenerQuery parses the bytes assuming that they start with the
+// body of an MLD Multicast Listener Query, in the MLDv2 format if they are long
+// enough.
+func parseMLDListenerQuery(b []byte) (Layer, layerParser) {
+	var query MLDListenerQuery
+	query.MaxResponseDelay, query.MulticastAddress = parseMLD(b)
+	if len(b) >= mldv2QueryMinimumSize {
+		v2 := b[mldMinimumSize:]
+		query.SuppressFlag = Bool(v2[0]&(1<<3) != 0)
+		query.QRV = Uint8(v2[0] & 0x7)
+		query.QQIC = Uint8(v2[1])
+		query.Sources = []tcpip.Address{}
+		srcs := v2[4:]
+		for n := binary.BigEndian.Uint16(v2[2:]); n > 0 && len(srcs) >= header.IPv6AddressSize; n-- {
+			query.Sources = append(query.Sources, tcpip.Address(srcs[:header.IPv6AddressSize]))
+			srcs = srcs[header.IPv6AddressSize:]
+		}
+	}
+	return &query, nil
+}
+
+func (l *MLDListenerQuery) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+func (l *MLDListenerQuery) length() int {
+	if !l.isV2() {
+		return mldMinimumSize
+	}
+	return mldv2QueryMinimumSize + len(l.Sources)*header.IPv6AddressSize
+}
+
+// merge overrides the values in l with the values from other but only in fields
+// where the value is not nil.
+func (l *MLDListenerQuery) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
+// MLDListenerReport can construct and match the body of an MLDv1 Multicast
+// Listener Report, which follows an ICMPv6 header.
+type MLDListenerReport struct {
+	LayerBase
+	MaxResponseDelay *uint16
+	MulticastAddress *tcpip.Address
+}
+
+func (l *MLDListenerReport) String() string {
+	return stringLayer(l)
+}
+
+// ToBytes implements Layer.ToBytes.
+func (l *MLDListenerReport) ToBytes() ([]byte, error) {
+	return mldToBytes(l.MaxResponseDelay, l.MulticastAddress), nil
+}
+
+// parseMLDListenerReport parses the bytes assuming that they start with the
+// body of an MLDv1 Multicast Listener Report.
+func parseMLDListenerReport(b []byte) (Layer, layerParser) {
+	var report MLDListenerReport
+	report.MaxResponseDelay, report.MulticastAddress = parseMLD(b)
+	return &report, nil
+}
+
+func (l *MLDListenerReport) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+func (l *MLDListenerReport) length() int {
+	return mldMinimumSize
+}
+
+// merge overrides the values in l with the values from other but only in fields
+// where the value is not nil.
+func (l *MLDListenerReport) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
+// MLDListenerDone can construct and match the body of an MLDv1 Multicast
+// Listener Done message, which follows an ICMPv6 header.
+type MLDListenerDone struct {
+	LayerBase
+	MaxResponseDelay *uint16
+	MulticastAddress *tcpip.Address
+}
+
+func (l *MLDListenerDone) String() string {
+	return stringLayer(l)
+}
+
+// ToBytes implements Layer.ToBytes.
+func (l *MLDListenerDone) ToBytes() ([]byte, error) {
+	return mldToBytes(l.MaxResponseDelay, l.MulticastAddress), nil
+}
+
+// parseMLDListenerDone parses the bytes assuming that they start with the body
+// of an MLDv1 Multicast Listener Done message.
+func parseMLDListenerDone(b []byte) (Layer, layerParser) {
+	var done MLDListenerDone
+	done.MaxResponseDelay, done.MulticastAddress = parseMLD(b)
+	return &done, nil
+}
+
+func (l *MLDListenerDone) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+func (l *MLDListenerDone) length() int {
+	return mldMinimumSize
+}
+
+// merge overrides the values in l with the values from other but only in fields
+// where the value is not nil.
+func (l *MLDListenerDone) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
+// MLDv2AddressRecordType is the type of an MLDv2 Multicast Address Record, RFC
+// 3810 section 5.2.12.
+type MLDv2AddressRecordType uint8
+
+// Values of MLDv2AddressRecordType.
+const (
+	MLDv2ModeIsInclude   MLDv2AddressRecordType = 1
+	MLDv2ModeIsExclude   MLDv2AddressRecordType = 2
+	MLDv2ChangeToInclude MLDv2AddressRecordType = 3
+	MLDv2ChangeToExclude MLDv2AddressRecordType = 4
+	MLDv2AllowNewSources MLDv2AddressRecordType = 5
+	MLDv2BlockOldSources MLDv2AddressRecordType = 6
+)
+
+const (
+	// mldv2ReportMinimumSize is the size of the body of an MLDv2 report
+	// without records.
+	mldv2ReportMinimumSize = 4
+	// mldv2AddressRecordSize is the size of an MLDv2 Multicast Address Record
+	// without sources or auxiliary data.
+	mldv2AddressRecordSize = 20
+)
+
+// MLDv2RecordType is a helper routine that allocates a new
+// MLDv2AddressRecordType value to store v and returns a pointer to it.
+func MLDv2RecordType(v MLDv2AddressRecordType) *MLDv2AddressRecordType {
+	return &v
+}
+
+// MLDv2AddressRecord can construct and match a Multicast Address Record of an
+// MLDv2 Multicast Listener Report, RFC 3810 section 5.2.4. AuxData must be a
+// multiple of 4 bytes long.
+type MLDv2AddressRecord struct {
+	Type             *MLDv2AddressRecordType
+	MulticastAddress *tcpip.Address
+	Sources          []tcpip.Address
+	AuxData          []byte
+}
+
+func (r MLDv2AddressRecord) String() string {
+	return stringOption(r)
+}
+
+func (r *MLDv2AddressRecord) length() int {
+	return mldv2AddressRecordSize + len(r.Sources)*header.IPv6AddressSize + len(r.AuxData)
+}
+
+// MLDv2AddressRecords are the Multicast Address Records of an MLDv2 report.
+//
+// Records match whatever their order, as long as they can be paired up so that
+// each pair matches, and so do their sources. As for other fields, nil records
+// or sources match any.
+type MLDv2AddressRecords []MLDv2AddressRecord
+
+// Equal is used by equalLayer to match the records of reports.
+func (r MLDv2AddressRecords) Equal(other MLDv2AddressRecords) bool {
+	return matchUnordered(len(r), len(other), func(i, j int) bool {
+		x, y := r[i], other[j]
+		x.Sources, y.Sources = nil, nil
+		if !cmp.Equal(x, y, ignoreNil) {
+			return false
+		}
+		if r[i].Sources == nil || other[j].Sources == nil {
+			return true
+		}
+		return matchUnordered(len(r[i].Sources), len(other[j].Sources), func(k, l int) bool {
+			return r[i].Sources[k] == other[j].Sources[l]
+		})
+	})
+}
+
+// MLDv2ListenerReport can construct and match the body of an MLDv2 Multicast
+// Listener Report, RFC 3810 section 5.2, which follows an ICMPv6 header.
+type MLDv2ListenerReport struct {
+	LayerBase
+	Records MLDv2AddressRecords
+}
+
+func (l *MLDv2ListenerReport) String() string {
+	return stringLayer(l)
+}
+
+// ToBytes implements Layer.ToBytes.
+func (l *MLDv2ListenerReport) ToBytes() ([]byte, error) {
+	b := make([]byte, l.length())
+	binary.BigEndian.PutUint16(b[2:], uint16(len(l.Records)))
+	rest := b[mldv2ReportMinimumSize:]
+	for i := range l.Records {
+		r := &l.Records[i]
+		if len(r.AuxData)%4 != 0 {
+			return nil, fmt.Errorf("auxiliary data of record %d is %d bytes long, which is not a multiple of 4", i, len(r.AuxData))
+		}
+		rec := rest[:r.length()]
+		rest = rest[r.length():]
+		if r.Type != nil {
+			rec[0] = uint8(*r.Type)
+		}
+		rec[1] = uint8(len(r.AuxData) / 4)
+		binary.BigEndian.PutUint16(rec[2:], uint16(len(r.Sources)))
+		if r.MulticastAddress != nil {
+			copy(rec[4:], *r.MulticastAddress)
+		}
+		srcs := rec[mldv2AddressRecordSize:]
+		for _, src := range r.Sources {
+			copy(srcs, src)
+			srcs = srcs[header.IPv6AddressSize:]
+		}
+		copy(srcs, r.AuxData)
+	}
+	return b, nil
+}
+
+// parseMLDv2ListenerReport parses the bytes assuming that they start with the
+// body of an MLDv2 Multicast Listener Report. Parsing stops at the first record
+// that is truncated.
+func parseMLDv2ListenerReport(b []byte) (Layer, layerParser) {
+	report := MLDv2ListenerReport{Records: MLDv2AddressRecords{}}
+	rest := b[mldv2ReportMinimumSize:]
+	for n := binary.BigEndian.Uint16(b[2:]); n > 0 && len(rest) >= mldv2AddressRecordSize; n-- {
+		auxLen := int(rest[1]) * 4
+		numSources := int(binary.BigEndian.Uint16(rest[2:]))
+		length := mldv2AddressRecordSize + numSources*header.IPv6AddressSize + auxLen
+		if length > len(rest) {
+			break
+		}
+		r := MLDv2AddressRecord{
+			Type:             MLDv2RecordType(MLDv2AddressRecordType(rest[0])),
+			MulticastAddress: Address(tcpip.Address(rest[4:mldv2AddressRecordSize])),
+			Sources:          []tcpip.Address{},
+		}
+		srcs := rest[mldv2AddressRecordSize:]
+		for i := 0; i < numSources; i++ {
+			r.Sources = append(r.Sources, tcpip.Address(srcs[:header.IPv6AddressSize]))
+			srcs = srcs[header.IPv6AddressSize:]
+		}
+		if auxLen > 0 {
+			r.AuxData = srcs[:auxLen]
+		}
+		report.Records = append(report.Records, r)
+		rest = rest[length:]
+	}
+	return &report, nil
+}
+
+func (l *MLDv2ListenerReport) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+func (l *MLDv2ListenerReport) length() int {
+	length := mldv2ReportMinimumSize
+	for i := range l.Records {
+		length += l.Records[i].length()
+	}
+	return length
+}
+
+// merge overrides the values in l with the values from other but only in fields
+// where the value is not nil.
+func (l *MLDv2ListenerReport) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
+// ICMPv4Type is a helper routine that allocates a new header.ICMPv4Type value
+// to store t and returns a pointer to it.
+func ICMPv4Type(t header.ICMPv4Type) *header.ICMPv4Type {
+	return &t
+}
+
+// ICMPv4 can construct and match an ICMPv4 encapsulation.
+//
+// The fields after Checksum are specific to some types of messages: Ident and
+// Sequence to Echo and Echo Reply, MTU to Destination Unreachable with the
+// Fragmentation Needed code. Error messages are followed by the invoking
+// packet, as its IPv4 header and payload layers.
+type ICMPv4 struct {
+	LayerBase
+	Type     *header.ICMPv4Type
+	Code     *uint8
+	Checksum *uint16
+	Ident    *uint16
+	Sequence *uint16
+	MTU      *uint16
+}
+
+func (l *ICMPv4) String() string {
+	return stringLayer(l)
+}
+
+// ToBytes implements Layer.ToBytes.
+func (l *ICMPv4) ToBytes() ([]byte, error) {
+	b := make([]byte, header.ICMPv4MinimumSize)
+	h := header.ICMPv4(b)
+	if l.Type != nil {
+		h.SetType(*l.Type)
+	}
+	if l.Code != nil {
+		h.SetCode(byte(*l.Code))
+	}
+	if l.Ident != nil {
+		h.SetIdent(*l.Ident)
+	}
+	if l.Sequence != nil {
+		h.SetSequence(*l.Sequence)
+	}
+	if l.MTU != nil {
+		h.SetMTU(*l.MTU)
+	}
+	if l.Checksum != nil {
+		h.SetChecksum(*l.Checksum)
+		return h, nil
+	}
+	payload, err := payload(l)
+	if err != nil {
+		return nil, err
+	}
+	h.SetChecksum(header.ICMPv4Checksum(h, payload))
+	return h, nil
+}
+
+// parseICMPv4 parses the bytes as an ICMPv4 header, returning a Layer and a
+// parser for the encapsulated payload.
+func parseICMPv4(b []byte) (Layer, layerParser) {
+	h := header.ICMPv4(b)
+	icmpv4 := ICMPv4{
+		Type:     ICMPv4Type(h.Type()),
+		Code:     Uint8(h.Code()),
+		Checksum: Uint16(h.Checksum()),
+	}
+	nextParser := parsePayload
+	switch h.Type() {
+	case header.ICMPv4Echo, header.ICMPv4EchoReply:
+		icmpv4.Ident = Uint16(h.Ident())
+		icmpv4.Sequence = Uint16(h.Sequence())
+	case header.ICMPv4DstUnreachable:
+		if h.Code() == header.ICMPv4FragmentationNeeded {
+			icmpv4.MTU = Uint16(h.MTU())
+		}
+		nextParser = parseICMPv4Quote
+	case header.ICMPv4SrcQuench, header.ICMPv4Redirect, header.ICMPv4TimeExceeded, header.ICMPv4ParamProblem:
+		nextParser = parseICMPv4Quote
+	}
+	return &icmpv4, nextParser
+}
+
+// parseICMPv4Quote parses the bytes assuming that they start with the invoking
+// packet quoted in an ICMPv4 error message: its IPv4 header followed by at
+// least 8 bytes of its payload, per RFC 792. That is enough for a UDP header,
+// which is parsed as such. Any other payload is parsed as a Payload, as it may
+// be truncated.
+func parseICMPv4Quote(b []byte) (Layer, layerParser) {
+	if len(b) < header.IPv4MinimumSize {
+		return parsePayload(b)
+	}
+	ipv4, nextParser := parseIPv4(b)
+	h := header.IPv4(b)
+	if h.TransportProtocol() != header.UDPProtocolNumber || len(b) < ipv4.length()+header.UDPMinimumSize {
+		nextParser = parsePayload
+	}
+	return ipv4, nextParser
+}
+
+func (l *ICMPv4) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+func (l *ICMPv4) length() int {
+	return header.ICMPv4MinimumSize
+}
+
+// merge overrides the values in l with the values from other but only in fields
+// where the value is not nil.
+func (l *ICMPv4) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
+// IGMPType is a helper routine that allocates a new header.IGMPType value to
+// store v and returns a pointer to it.
+func IGMPType(v header.IGMPType) *header.IGMPType {
+	return &v
+}
+
+// IGMP can construct and match an IGMP message. MaxRespTime is in units of 1/10
+// second.
+//
+// The SuppressFlag, QRV, QQIC and Sources fields are only in IGMPv3 Membership
+// Queries, RFC 3376 section 4.1. A query is sent in the IGMPv3 format if any of
+// them is set, and they are only set by parsing an IGMPv3 query. GroupRecords
+// are only in IGMPv3 Membership Reports, RFC 3376 section 4.2, which have no
+// GroupAddress.
+type IGMP struct {
+	LayerBase
+	Type         *header.IGMPType
+	MaxRespTime  *uint8
+	Checksum     *uint16
+	GroupAddress *tcpip.Address
+	SuppressFlag *bool
+	QRV          *uint8
+	QQIC         *uint8
+	Sources      []tcpip.Address
+	GroupRecords IGMPv3GroupRecords
+}
+
+const (
+	// igmpv3QueryMinimumSize is the size of an IGMPv3 query without sources.
+	igmpv3QueryMinimumSize = 12
+	// igmpv3GroupRecordSize is the size of an IGMPv3 Group Record without
+	// sources or auxiliary data.
+	igmpv3GroupRecordSize = 8
+)
+
+func (l *IGMP) String() string {
+	return stringLayer(l)
+}
+
+func (l *IGMP) isV3Query() bool {
+	return l.SuppressFlag != nil || l.QRV != nil || l.QQIC != nil || l.Sources != nil
+}
+
+func (l *IGMP) isV3Report() bool {
+	return (l.Type != nil && *l.Type == header.IGMPv3MembershipReport) || l.GroupRecords != nil
+}
+
+// ToBytes implements Layer.ToBytes.
+func (l *IGMP) ToBytes() ([]byte, error) {
+	b := make([]byte, l.length())
+	if l.Type != nil {
+		b[0] = uint8(*l.Type)
+	}
+	if l.MaxRespTime != nil {
+		b[1] = *l.MaxRespTime
+	}
+	switch {
+	case l.isV3Report():
+		binary.BigEndian.PutUint16(b[6:], uint16(len(l.GroupRecords)))
+		rest := b[header.IGMPMinimumSize:]
+		for i := range l.GroupRecords {
+			r := &l.GroupRecords[i]
+			if len(r.AuxData)%4 != 0 {
+				return nil, fmt.Errorf("auxiliary data of record %d is %d bytes long, which is not a multiple of 4", i, len(r.AuxData))
+			}
+			rec := rest[:r.length()]
+			rest = rest[r.length():]
+			if r.Type != nil {
+				rec[0] = uint8(*r.Type)
+			}
+			rec[1] = uint8(len(r.AuxData) / 4)
+			binary.BigEndian.PutUint16(rec[2:], uint16(len(r.Sources)))
+			if r.GroupAddress != nil {
+				copy(rec[4:], *r.GroupAddress)
+			}
+			srcs := rec[igmpv3GroupRecordSize:]
+			for _, src := range r.Sources {
+				copy(srcs, src)
+				srcs = srcs[header.IPv4AddressSize:]
+			}
+			copy(srcs, r.AuxData)
+		}
+	default:
+		if l.GroupAddress != nil {
+			copy(b[4:], *l.GroupAddress)
+		}
+		if l.isV3Query() {
+			if l.SuppressFlag != nil && *l.SuppressFlag {
+				b[8] |= 1 << 3
+			}
+			if l.QRV != nil {
+				b[8] |= *l.QRV & 0x7
+			}
+			if l.QQIC != nil {
+				b[9] = *l.QQIC
+			}
+			binary.BigEndian.PutUint16(b[10:], uint16(len(l.Sources)))
+			for i, src := range l.Sources {
+				copy(b[igmpv3QueryMinimumSize+i*header.IPv4AddressSize:], src)
+			}
+		}
+	}
+	if l.Checksum != nil {
+		binary.BigEndian.PutUint16(b[2:], *l.Checksum)
+		return b, nil
+	}
+	payload, err := payload(l)
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint16(b[2:], ^header.Checksum(b, header.ChecksumVV(payload, 0)))
+	return b, nil
+}
+
+// parseIGMP parses the bytes assuming that they start with an IGMP message.
+// IGMPv3 queries and reports are told apart from older messages by their type
+// and length.
+func parseIGMP(b []byte) (Layer, layerParser) {
+	if len(b) < header.IGMPMinimumSize {
+		return parsePayload(b)
+	}
+	igmp := IGMP{
+		Type:        IGMPType(header.IGMPType(b[0])),
+		MaxRespTime: Uint8(b[1]),
+		Checksum:    Uint16(binary.BigEndian.Uint16(b[2:])),
+	}
+	switch {
+	case *igmp.Type == header.IGMPv3MembershipReport:
+		igmp.GroupRecords = IGMPv3GroupRecords{}
+		rest := b[header.IGMPMinimumSize:]
+		for n := binary.BigEndian.Uint16(b[6:]); n > 0 && len(rest) >= igmpv3GroupRecordSize; n-- {
+			auxLen := int(rest[1]) * 4
+			numSources := int(binary.BigEndian.Uint16(rest[2:]))
+			length := igmpv3GroupRecordSize + numSources*header.IPv4AddressSize + auxLen
+			if length > len(rest) {
+				break
+			}
+			r := IGMPv3GroupRecord{
+				Type:         IGMPv3RecordType(IGMPv3GroupRecordType(rest[0])),
+				GroupAddress: Address(tcpip.Address(rest[4:igmpv3GroupRecordSize])),
+				Sources:      []tcpip.Address{},
+			}
+			srcs := rest[igmpv3GroupRecordSize:]
+			for i := 0; i < numSources; i++ {
+				r.Sources = append(r.Sources, tcpip.Address(srcs[:header.IPv4AddressSize]))
+				srcs = srcs[header.IPv4AddressSize:]
+			}
+			if auxLen > 0 {
+				r.AuxData = srcs[:auxLen]
+			}
+			igmp.GroupRecords = append(igmp.GroupRecords, r)
+			rest = rest[length:]
+		}
+	default:
+		igmp.GroupAddress = Address(tcpip.Address(b[4:header.IGMPMinimumSize]))
+		if *igmp.Type == header.IGMPMembershipQuery && len(b) >= igmpv3QueryMinimumSize {
+			igmp.SuppressFlag = Bool(b[8]&(1<<3) != 0)
+			igmp.QRV = Uint8(b[8] & 0x7)
+			igmp.QQIC = Uint8(b[9])
+			igmp.Sources = []tcpip.Address{}
+			srcs := b[igmpv3QueryMinimumSize:]
+			for n := binary.BigEndian.Uint16(b[10:]); n > 0 && len(srcs) >= header.IPv4AddressSize; n-- {
+				igmp.Sources = append(igmp.Sources, tcpip.Address(srcs[:header.IPv4AddressSize]))
+				srcs = srcs[header.IPv4AddressSize:]
+			}
+		}
+	}
+	return &igmp, nil
+}
+
+func (l *IGMP) match(other Layer) bool {
+	return equalLayer(l, other)
+}
+
+func (l *IGMP) length() int {
+	switch {
+	case l.isV3Report():
+		length := header.IGMPMinimumSize
+		for i := range l.GroupRecords {
+			length += l.GroupRecords[i].length()
+		}
+		return length
+	case l.isV3Query():
+		return igmpv3QueryMinimumSize + len(l.Sources)*header.IPv4AddressSize
+	default:
+		return header.IGMPMinimumSize
+	}
+}
+
+// merge overrides the values in l with the values from other but only in fields
+// where the value is not nil.
+func (l *IGMP) merge(other Layer) error {
+	return mergeLayer(l, other)
+}
+
+// IGMPv3GroupRecordType is the type of an IGMPv3 Group Record, RFC 3376 section
+// 4.2.12.
+type IGMPv3GroupRecordType uint8
+
+// Values of IGMPv3GroupRecordType.
+const (
+	IGMPv3ModeIsInclude   IGMPv3GroupRecordType = 1
+	IGMPv3ModeIsExclude   IGMPv3GroupRecordType = 2
+	IGMPv3ChangeToInclude IGMPv3GroupRecordType = 3
+	IGMPv3ChangeToExclude IGMPv3GroupRecordType = 4
+	IGMPv3AllowNewSources IGMPv3GroupRecordType = 5
+	IGMPv3BlockOldSources IGMPv3GroupRecordType = 6
+)
+
+// IGMPv3RecordType is a helper routine that allocates a new
+// IGMPv3GroupRecordType value to store v and returns a pointer to it.
+func IGMPv3RecordType(v IGMPv3GroupRecordType) *IGMPv3GroupRecordType {
+	return &v
+}
+
+// IGMPv3GroupRecord can construct and match a Group Record of an IGMPv3
+// Membership Report, RFC 3376 section 4.2.4. AuxData must be a multiple of 4
+// bytes long.
+type IGMPv3GroupRecord struct {
+	Type         *IGMPv3GroupRecordType
+	GroupAddress *tcpip.Address
+	Sources      []tcpip.Address
+	AuxData      []byte
+}
+
+func (r IGMPv3GroupRecord) String() string {
+	return stringOption(r)
+}
+
+func (r *IGMPv3GroupRecord) length() int {
+	return igmpv3GroupRecordSize + len(r.Sources)*header.IPv4AddressSize + len(r.AuxData)
+}
+
+// IGMPv3GroupRecords are the Group Records of an IGMPv3 Membership Report.
+// They match as MLDv2AddressRecords do.
+type IGMPv3GroupRecords []IGMPv3GroupRecord
+
+// Equal is used by equalLayer to match the records of reports.
+func (r IGMPv3GroupRecords) Equal(other IGMPv3GroupRecords) bool {
+	return matchUnordered(len(r), len(other), func(i, j int) bool {
+		x, y := r[i], other[j]
+		x.Sources, y.Sources = nil, nil
+		if !cmp.Equal(x, y, ignoreNil) {
+			return false
+		}
+		if r[i].Sources == nil || other[j].Sources == nil {
+			return true
+		}
+		return matchUnordered(len(r[i].Sources), len(other[j].Sources), func(k, l int) bool {
+			return r[i].Sources[k] == other[j].Sources[l]
+		})
+	})
+}
+
+// TCP can construct and match a TCP encapsulation.
+type TCP struct {
+	LayerBase
+	SrcPort       *uint16
+	DstPort       *uint16
+	SeqNum        *uint32
+	AckNum        *uint32
+	DataOffset    *uint8
+	Flags         *uint8
+	WindowSize    *uint16
+	Checksum      *uint16
+	UrgentPointer *uint16
+	Options       []byte
+	// TCPOptions is a structured form of Options, which is serialized only if
+	// Options is nil. Parsing sets both.
+	TCPOptions *TCPOptions
 }
 
 func (l *TCP) String() string {
@@ -864,8 +2525,15 @@ func (l *TCP) ToBytes() ([]byte, error) {
 	if l.UrgentPointer != nil {
 		h.SetUrgentPoiner(*l.UrgentPointer)
 	}
-	copy(b[header.TCPMinimumSize:], l.Options)
-	header.AddTCPOptionPadding(b[header.TCPMinimumSize:], len(l.Options))
+	options := l.Options
+	if options == nil && l.TCPOptions != nil {
+		var err error
+		if options, err = l.TCPOptions.toBytes(); err != nil {
+			return nil, err
+		}
+	}
+	copy(b[header.TCPMinimumSize:], options)
+	header.AddTCPOptionPadding(b[header.TCPMinimumSize:], len(options))
 	if l.Checksum != nil {
 		h.SetChecksum(*l.Checksum)
 		return h, nil
@@ -904,11 +2572,18 @@ func payload(l Layer) (buffer.VectorisedView, error) {
 func layerChecksum(l Layer, protoNumber tcpip.TransportProtocolNumber) (uint16, error) {
 	totalLength := uint16(totalLength(l))
 	var xsum uint16
-	switch s := l.Prev().(type) {
+	// Extension headers may come between an IPv6 header and l.
+	prev := l.Prev()
+	for isIPv6ExtHdr(prev) {
+		prev = prev.Prev()
+	}
+	switch s := prev.(type) {
 	case *IPv4:
 		xsum = header.PseudoHeaderChecksum(protoNumber, *s.SrcAddr, *s.DstAddr, totalLength)
+	case *IPv6:
+		xsum = header.PseudoHeaderChecksum(protoNumber, *s.SrcAddr, *s.DstAddr, totalLength)
 	default:
-		// TODO(b/150301488): Support more protocols, like IPv6.
+		// TODO(b/150301488): Support more protocols as needed.
 		return 0, fmt.Errorf("can't get src and dst addr from previous layer: %#v", s)
 	}
 	payloadBytes, err := payload(l)
@@ -952,6 +2627,7 @@ func parseTCP(b []byte) (Layer, layerParser) {
 		UrgentPointer: Uint16(h.UrgentPointer()),
 		Options:       b[header.TCPMinimumSize:h.DataOffset()],
 	}
+	tcp.TCPOptions = parseTCPOptions(tcp.Options)
 	return &tcp, parsePayload
 }
 
@@ -965,7 +2641,11 @@ func (l *TCP) length() int {
 		// boundary; the user could potentially give us a slice
 		// whose length is not a multiple of 4 bytes, so we have
 		// to do the alignment here.
-		optlen := (len(l.Options) + 3) & ^3
+		optlen := len(l.Options)
+		if l.Options == nil && l.TCPOptions != nil {
+			optlen = l.TCPOptions.length()
+		}
+		optlen = (optlen + 3) & ^3
 		return header.TCPMinimumSize + optlen
 	}
 	return int(*l.DataOffset)
@@ -976,6 +2656,145 @@ func (l *TCP) merge(other Layer) error {
 	return mergeLayer(l, other)
 }
 
+// TCPOptions can construct and match the options of a TCP segment. Options that
+// are not set are neither serialized nor matched, and other options are
+// ignored when parsing.
+//
+// Options are serialized in the order of the fields below, each aligned to 4
+// bytes with NOP options.
+type TCPOptions struct {
+	MSS           *uint16
+	WindowScale   *uint8
+	SACKPermitted *bool
+	Timestamp     *TCPTimestamp
+	SACKBlocks    []header.SACKBlock
+}
+
+func (o TCPOptions) String() string {
+	return stringOption(o)
+}
+
+// TCPTimestamp can construct and match a TCP Timestamps option, RFC 7323
+// section 3.
+type TCPTimestamp struct {
+	TSVal *uint32
+	TSEcr *uint32
+}
+
+func (o TCPTimestamp) String() string {
+	return stringOption(o)
+}
+
+// length returns the length of the serialized options, which may be more than
+// header.TCPOptionsMaximumSize.
+func (o *TCPOptions) length() int {
+	var length int
+	if o.MSS != nil {
+		length += header.TCPOptionMSSLength
+	}
+	if o.WindowScale != nil {
+		length += 1 + header.TCPOptionWSLength
+	}
+	if o.SACKPermitted != nil && *o.SACKPermitted {
+		length += 2 + header.TCPOptionSackPermittedLength
+	}
+	if o.Timestamp != nil {
+		length += 2 + header.TCPOptionTSLength
+	}
+	if len(o.SACKBlocks) != 0 {
+		length += 4 + 8*len(o.SACKBlocks)
+	}
+	return length
+}
+
+// toBytes serializes the options.
+func (o *TCPOptions) toBytes() ([]byte, error) {
+	length := o.length()
+	if length > header.TCPOptionsMaximumSize {
+		return nil, fmt.Errorf("TCP options %s take %d bytes, more than the maximum of %d", o, length, header.TCPOptionsMaximumSize)
+	}
+	b := make([]byte, length)
+	off := 0
+	nop := func(n int) {
+		for i := 0; i < n; i++ {
+			off += header.EncodeNOP(b[off:])
+		}
+	}
+	if o.MSS != nil {
+		off += header.EncodeMSSOption(uint32(*o.MSS), b[off:])
+	}
+	if o.WindowScale != nil {
+		nop(1)
+		off += header.EncodeWSOption(int(*o.WindowScale), b[off:])
+	}
+	if o.SACKPermitted != nil && *o.SACKPermitted {
+		nop(2)
+		off += header.EncodeSACKPermittedOption(b[off:])
+	}
+	if o.Timestamp != nil {
+		var tsVal, tsEcr uint32
+		if o.Timestamp.TSVal != nil {
+			tsVal = *o.Timestamp.TSVal
+		}
+		if o.Timestamp.TSEcr != nil {
+			tsEcr = *o.Timestamp.TSEcr
+		}
+		nop(2)
+		off += header.EncodeTSOption(tsVal, tsEcr, b[off:])
+	}
+	if len(o.SACKBlocks) != 0 {
+		nop(2)
+		off += header.EncodeSACKBlocks(o.SACKBlocks, b[off:])
+	}
+	return b, nil
+}
+
+// parseTCPOptions parses TCP options up to the End of Option List option or
+// the first option that is truncated. Unknown options, and known options with
+// an unexpected length, are skipped.
+func parseTCPOptions(b []byte) *TCPOptions {
+	o := TCPOptions{SACKPermitted: Bool(false)}
+	for len(b) > 0 {
+		switch b[0] {
+		case header.TCPOptionEOL:
+			return &o
+		case header.TCPOptionNOP:
+			b = b[1:]
+			continue
+		}
+		if len(b) < 2 {
+			break
+		}
+		length := int(b[1])
+		if length < 2 || length > len(b) {
+			break
+		}
+		opt := b[:length]
+		b = b[length:]
+		switch {
+		case opt[0] == header.TCPOptionMSS && length == header.TCPOptionMSSLength:
+			o.MSS = Uint16(binary.BigEndian.Uint16(opt[2:]))
+		case opt[0] == header.TCPOptionWS && length == header.TCPOptionWSLength:
+			o.WindowScale = Uint8(opt[2])
+		case opt[0] == header.TCPOptionSACKPermitted && length == header.TCPOptionSackPermittedLength:
+			o.SACKPermitted = Bool(true)
+		case opt[0] == header.TCPOptionTS && length == header.TCPOptionTSLength:
+			o.Timestamp = &TCPTimestamp{
+				TSVal: Uint32(binary.BigEndian.Uint32(opt[2:])),
+				TSEcr: Uint32(binary.BigEndian.Uint32(opt[6:])),
+			}
+		case opt[0] == header.TCPOptionSACK && length > 2 && (length-2)%8 == 0:
+			for blocks := opt[2:]; len(blocks) > 0; blocks = blocks[8:] {
+				o.SACKBlocks = append(o.SACKBlocks, header.SACKBlock{
+					Start: seqnum.Value(binary.BigEndian.Uint32(blocks)),
+					End:   seqnum.Value(binary.BigEndian.Uint32(blocks[4:])),
+				})
+			}
+		}
+	}
+	return &o
+}
+
 // UDP can construct and match a UDP encapsulation.
 type UDP struct {
 	LayerBase
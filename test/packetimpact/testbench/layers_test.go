@@ -18,9 +18,12 @@ import (
 	"bytes"
 	"net"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/mohae/deepcopy"
 	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 )
 
@@ -616,3 +619,1389 @@ func TestIPv6ExtHdrOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestIPv6ExtHdrOptionList(t *testing.T) {
+	src := tcpip.Address(net.ParseIP("::1"))
+	dst := tcpip.Address(net.ParseIP("fe80::dead:beef"))
+	for _, tt := range []struct {
+		description string
+		options     []IPv6ExtHdrOption
+		wantOptions []byte
+	}{
+		{
+			description: "empty",
+			options:     []IPv6ExtHdrOption{},
+			wantOptions: []byte{0x01, 0x04, 0x00, 0x00, 0x00, 0x00},
+		},
+		{
+			description: "aligned",
+			options: []IPv6ExtHdrOption{
+				{Type: IPv6ExtHdrOptionType(0x1e), Data: []byte{1, 2, 3, 4}},
+			},
+			wantOptions: []byte{0x1e, 0x04, 0x01, 0x02, 0x03, 0x04},
+		},
+		{
+			description: "Pad1",
+			options: []IPv6ExtHdrOption{
+				{Type: IPv6ExtHdrOptionType(0x1e), Data: []byte{1, 2, 3}},
+			},
+			wantOptions: []byte{0x1e, 0x03, 0x01, 0x02, 0x03, 0x00},
+		},
+		{
+			description: "PadN",
+			options: []IPv6ExtHdrOption{
+				{Type: IPv6ExtHdrOptionType(0x05), Data: []byte{0, 0}},
+			},
+			wantOptions: IPv6RouterAlertMLDOptions(),
+		},
+		{
+			description: "multiple",
+			options: []IPv6ExtHdrOption{
+				{Type: IPv6ExtHdrOptionType(0x05), Data: []byte{0, 0}},
+				{Type: IPv6ExtHdrOptionType(0x9e), Data: []byte{1, 2, 3, 4, 5}},
+			},
+			wantOptions: []byte{
+				0x05, 0x02, 0x00, 0x00,
+				0x9e, 0x05, 0x01, 0x02, 0x03, 0x04, 0x05,
+				0x01, 0x01, 0x00,
+			},
+		},
+	} {
+		t.Run(tt.description, func(t *testing.T) {
+			payload := []byte("Sample Data")
+			layers := Layers{
+				&IPv6{SrcAddr: &src, DstAddr: &dst},
+				&IPv6HopByHopOptionsExtHdr{OptionList: tt.options},
+				&UDP{SrcPort: Uint16(1), DstPort: Uint16(2)},
+				&Payload{Bytes: payload},
+			}
+			b, err := layers.ToBytes()
+			if err != nil {
+				t.Fatalf("ToBytes() failed on %s: %s", &layers, err)
+			}
+			hdrLen := len(tt.wantOptions) + 2
+			if hdrLen%8 != 0 {
+				t.Fatalf("bad test case: header length %d is not a multiple of 8", hdrLen)
+			}
+			wantHdr := append([]byte{uint8(header.UDPProtocolNumber), uint8(hdrLen/8 - 1)}, tt.wantOptions...)
+			if got := b[header.IPv6MinimumSize:][:hdrLen]; !bytes.Equal(got, wantHdr) {
+				t.Errorf("got Hop-by-Hop header %x, want %x", got, wantHdr)
+			}
+			udp := header.UDP(b[header.IPv6MinimumSize+hdrLen:])
+			xsum := header.PseudoHeaderChecksum(header.UDPProtocolNumber, src, dst, uint16(len(udp)))
+			if got := udp.CalculateChecksum(header.Checksum(payload, xsum)); got != 0xffff {
+				t.Errorf("got UDP checksum 0x%04x, want it to be valid", udp.Checksum())
+			}
+
+			got := parse(parseIPv6, b)
+			if !got.match(layers) {
+				t.Fatalf("match failed with diff: %s", got.diff(layers))
+			}
+			gotBytes, err := got.ToBytes()
+			if err != nil {
+				t.Fatalf("ToBytes() failed on %s: %s", &got, err)
+			}
+			if !bytes.Equal(b, gotBytes) {
+				t.Fatalf("mismatching bytes, gotBytes: %x, wantBytes: %x", gotBytes, b)
+			}
+		})
+	}
+}
+
+func TestParseIPv6ExtHdrOptions(t *testing.T) {
+	for _, tt := range []struct {
+		description string
+		b           []byte
+		want        []IPv6ExtHdrOption
+	}{
+		{
+			description: "empty",
+			b:           nil,
+			want:        []IPv6ExtHdrOption{},
+		},
+		{
+			description: "padding",
+			b:           []byte{0x00, 0x01, 0x02, 0x00, 0x00, 0x00},
+			want:        []IPv6ExtHdrOption{},
+		},
+		{
+			description: "options between padding",
+			b:           []byte{0x00, 0x05, 0x02, 0x00, 0x00, 0x01, 0x00, 0x1e, 0x01, 0x07},
+			want: []IPv6ExtHdrOption{
+				{Type: IPv6ExtHdrOptionType(0x05), Data: []byte{0, 0}},
+				{Type: IPv6ExtHdrOptionType(0x1e), Data: []byte{7}},
+			},
+		},
+		{
+			description: "truncated",
+			b:           []byte{0x1e, 0x01, 0x07, 0x9e, 0x04, 0x01},
+			want: []IPv6ExtHdrOption{
+				{Type: IPv6ExtHdrOptionType(0x1e), Data: []byte{7}},
+			},
+		},
+	} {
+		t.Run(tt.description, func(t *testing.T) {
+			if got := parseIPv6ExtHdrOptions(tt.b); !cmp.Equal(got, tt.want) {
+				t.Errorf("got parseIPv6ExtHdrOptions(%x) = %s, want %s", tt.b, got, tt.want)
+			}
+		})
+	}
+
+	tooLong := Layers{&IPv6{}, &IPv6DestinationOptionsExtHdr{OptionList: []IPv6ExtHdrOption{
+		{Data: make([]byte, 256)},
+	}}}
+	if _, err := tooLong.ToBytes(); err == nil {
+		t.Errorf("got ToBytes() = nil error on %s, want an error", &tooLong)
+	}
+}
+
+func TestIPv6Fragments(t *testing.T) {
+	for _, tt := range []struct {
+		description string
+		wantBytes   []byte
+		wantLayers  Layers
+	}{
+		{
+			description: "first fragment",
+			wantBytes: []byte{
+				// IPv6 Header
+				0x60, 0x00, 0x00, 0x00, 0x00, 0x10, 0x2c, 0x40, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x01, 0xfe, 0x80, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xde, 0xad, 0xbe, 0xef,
+				// Fragment Header
+				0x3a, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x2a,
+				// ICMPv6 Header
+				0x80, 0x00, 0x12, 0x34, 0x00, 0x01, 0x00, 0x02,
+			},
+			wantLayers: []Layer{
+				&IPv6{
+					SrcAddr: Address(tcpip.Address(net.ParseIP("::1"))),
+					DstAddr: Address(tcpip.Address(net.ParseIP("fe80::dead:beef"))),
+				},
+				&IPv6FragmentExtHdr{
+					NextHeader:     IPv6ExtHdrIdent(header.IPv6ExtensionHeaderIdentifier(header.ICMPv6ProtocolNumber)),
+					FragmentOffset: Uint16(0),
+					MoreFragments:  Bool(true),
+					Identification: Uint32(42),
+				},
+				&ICMPv6{
+					Type:       ICMPv6Type(header.ICMPv6EchoRequest),
+					Code:       Byte(0),
+					Checksum:   Uint16(0x1234),
+					NDPPayload: []byte{0x00, 0x01, 0x00, 0x02},
+				},
+			},
+		},
+		{
+			description: "middle fragment",
+			wantBytes: []byte{
+				// IPv6 Header
+				0x60, 0x00, 0x00, 0x00, 0x00, 0x10, 0x2c, 0x40, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x01, 0xfe, 0x80, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xde, 0xad, 0xbe, 0xef,
+				// Fragment Header
+				0x3a, 0x00, 0x00, 0x09, 0x00, 0x00, 0x00, 0x2a,
+				// Payload, which could be mistaken for an ICMPv6 header.
+				0x80, 0x00, 0x12, 0x34, 0x00, 0x01, 0x00, 0x02,
+			},
+			wantLayers: []Layer{
+				&IPv6{
+					SrcAddr: Address(tcpip.Address(net.ParseIP("::1"))),
+					DstAddr: Address(tcpip.Address(net.ParseIP("fe80::dead:beef"))),
+				},
+				&IPv6FragmentExtHdr{
+					NextHeader:     IPv6ExtHdrIdent(header.IPv6ExtensionHeaderIdentifier(header.ICMPv6ProtocolNumber)),
+					FragmentOffset: Uint16(1),
+					MoreFragments:  Bool(true),
+					Identification: Uint32(42),
+				},
+				&Payload{
+					Bytes: []byte{0x80, 0x00, 0x12, 0x34, 0x00, 0x01, 0x00, 0x02},
+				},
+			},
+		},
+		{
+			description: "last fragment",
+			wantBytes: []byte{
+				// IPv6 Header
+				0x60, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x2c, 0x40, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x01, 0xfe, 0x80, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xde, 0xad, 0xbe, 0xef,
+				// Fragment Header
+				0x3a, 0x00, 0x00, 0x10, 0x00, 0x00, 0x00, 0x2a,
+				// Payload
+				0x00, 0x03, 0x00, 0x04,
+			},
+			wantLayers: []Layer{
+				&IPv6{
+					SrcAddr: Address(tcpip.Address(net.ParseIP("::1"))),
+					DstAddr: Address(tcpip.Address(net.ParseIP("fe80::dead:beef"))),
+				},
+				&IPv6FragmentExtHdr{
+					NextHeader:     IPv6ExtHdrIdent(header.IPv6ExtensionHeaderIdentifier(header.ICMPv6ProtocolNumber)),
+					FragmentOffset: Uint16(2),
+					MoreFragments:  Bool(false),
+					Identification: Uint32(42),
+				},
+				&Payload{
+					Bytes: []byte{0x00, 0x03, 0x00, 0x04},
+				},
+			},
+		},
+	} {
+		t.Run(tt.description, func(t *testing.T) {
+			layers := parseIPv6Fragments(parse(parseIPv6, tt.wantBytes))
+			if !layers.match(tt.wantLayers) {
+				t.Fatalf("match failed with diff: %s", layers.diff(tt.wantLayers))
+			}
+			gotBytes, err := layers.ToBytes()
+			if err != nil {
+				t.Fatalf("ToBytes() failed on %s: %s", &layers, err)
+			}
+			if !bytes.Equal(tt.wantBytes, gotBytes) {
+				t.Fatalf("mismatching bytes, gotBytes: %x, wantBytes: %x", gotBytes, tt.wantBytes)
+			}
+
+			// Without parseIPv6Fragments, everything after the IPv6 header is
+			// left in the payload.
+			unparsed := parse(parseIPv6, tt.wantBytes)
+			if want := (Layers{&IPv6{}, &Payload{Bytes: tt.wantBytes[header.IPv6MinimumSize:]}}); !unparsed.match(want) {
+				t.Fatalf("match failed with diff: %s", unparsed.diff(want))
+			}
+		})
+	}
+}
+
+// fragmentICMPv6 returns the parsed IPv6 fragments of an ICMPv6 echo request
+// with payload, where each fragment holds fragmentLength bytes of the message
+// except the last one, which holds the rest.
+func fragmentICMPv6(t *testing.T, payload []byte, fragmentLength int) []Layers {
+	t.Helper()
+	message := append(make([]byte, header.ICMPv6HeaderSize), payload...)
+	var fragments []Layers
+	for offset := 0; offset < len(message); offset += fragmentLength {
+		end := offset + fragmentLength
+		if end > len(message) {
+			end = len(message)
+		}
+		var data Layer = &Payload{Bytes: message[offset:end]}
+		if offset == 0 {
+			data = &ICMPv6{
+				Type:        ICMPv6Type(header.ICMPv6EchoRequest),
+				Code:        Byte(0),
+				NDPPayload:  message[header.ICMPv6HeaderSize:end],
+				FullPayload: payload,
+			}
+		}
+		layers := Layers{
+			&IPv6{
+				SrcAddr: Address(tcpip.Address(net.ParseIP("::1"))),
+				DstAddr: Address(tcpip.Address(net.ParseIP("fe80::dead:beef"))),
+			},
+			&IPv6FragmentExtHdr{
+				NextHeader:     IPv6ExtHdrIdent(header.IPv6ExtensionHeaderIdentifier(header.ICMPv6ProtocolNumber)),
+				FragmentOffset: Uint16(uint16(offset / 8)),
+				MoreFragments:  Bool(end < len(message)),
+				Identification: Uint32(42),
+			},
+			data,
+		}
+		b, err := layers.ToBytes()
+		if err != nil {
+			t.Fatalf("ToBytes() failed on %s: %s", &layers, err)
+		}
+		fragments = append(fragments, parseIPv6Fragments(parse(parseIPv6, b)))
+	}
+	return fragments
+}
+
+func TestICMPv6FragmentedChecksum(t *testing.T) {
+	for _, tt := range []struct {
+		description   string
+		payloadLength int
+	}{
+		{"multiple of 8", 20},
+		{"not a multiple of 8", 13},
+		{"one byte past a multiple of 8", 21},
+		{"one byte short of a multiple of 8", 19},
+	} {
+		t.Run(tt.description, func(t *testing.T) {
+			payload := make([]byte, tt.payloadLength)
+			for i := range payload {
+				payload[i] = byte(i + 1)
+			}
+			unfragmented := Layers{
+				&IPv6{
+					SrcAddr: Address(tcpip.Address(net.ParseIP("::1"))),
+					DstAddr: Address(tcpip.Address(net.ParseIP("fe80::dead:beef"))),
+				},
+				&ICMPv6{
+					Type:       ICMPv6Type(header.ICMPv6EchoRequest),
+					Code:       Byte(0),
+					NDPPayload: payload,
+				},
+			}
+			b, err := unfragmented.ToBytes()
+			if err != nil {
+				t.Fatalf("ToBytes() failed on %s: %s", &unfragmented, err)
+			}
+			want := *parse(parseIPv6, b)[1].(*ICMPv6).Checksum
+
+			fragments := fragmentICMPv6(t, payload, 8)
+			if got := *fragments[0][2].(*ICMPv6).Checksum; got != want {
+				t.Errorf("got checksum 0x%04x, want 0x%04x", got, want)
+			}
+			if err := VerifyICMPv6Checksum(fragments...); err != nil {
+				t.Errorf("VerifyICMPv6Checksum failed: %s", err)
+			}
+
+			last := fragments[len(fragments)-1][2].(*Payload)
+			last.Bytes[len(last.Bytes)-1]++
+			if err := VerifyICMPv6Checksum(fragments...); err == nil {
+				t.Errorf("VerifyICMPv6Checksum succeeded with a corrupted last fragment")
+			}
+			last.Bytes[len(last.Bytes)-1]--
+			if err := VerifyICMPv6Checksum(fragments[:len(fragments)-1]...); err == nil {
+				t.Errorf("VerifyICMPv6Checksum succeeded without the last fragment")
+			}
+		})
+	}
+}
+
+func TestVerifyICMPv6ChecksumUnalignedFragment(t *testing.T) {
+	payload := make([]byte, 13)
+	// Fragments of 7 bytes can't be reassembled: the second fragment would
+	// have to start at offset 7, which is rounded down to 0 in 8-octet units.
+	fragments := fragmentICMPv6(t, payload, 7)
+	if err := VerifyICMPv6Checksum(fragments...); err == nil {
+		t.Errorf("VerifyICMPv6Checksum succeeded with fragments of 7 bytes")
+	}
+	if err := VerifyICMPv6Checksum(fragmentICMPv6(t, payload, 8)...); err != nil {
+		t.Errorf("VerifyICMPv6Checksum failed: %s", err)
+	}
+}
+
+func TestARP(t *testing.T) {
+	wantBytes := []byte{
+		// Ethernet Header
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02, 0x42, 0xc0, 0xa8,
+		0x00, 0x14, 0x08, 0x06,
+		// ARP Request
+		0x00, 0x01, 0x08, 0x00, 0x06, 0x04, 0x00, 0x01, 0x02, 0x42,
+		0xc0, 0xa8, 0x00, 0x14, 0xc0, 0xa8, 0x00, 0x14, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0xc0, 0xa8, 0x00, 0x0a,
+		// Padding
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	wantLayers := Layers{
+		&Ether{
+			SrcAddr: LinkAddress(tcpip.LinkAddress("\x02\x42\xc0\xa8\x00\x14")),
+			DstAddr: LinkAddress(tcpip.LinkAddress("\xff\xff\xff\xff\xff\xff")),
+			Type:    NetworkProtocolNumber(header.ARPProtocolNumber),
+		},
+		&ARP{
+			HardwareType:       Uint16(1),
+			ProtocolType:       NetworkProtocolNumber(header.IPv4ProtocolNumber),
+			Op:                 ARPOp(header.ARPRequest),
+			SenderHardwareAddr: LinkAddress(tcpip.LinkAddress("\x02\x42\xc0\xa8\x00\x14")),
+			SenderProtocolAddr: Address(tcpip.Address(net.ParseIP("192.168.0.20").To4())),
+			TargetHardwareAddr: LinkAddress(tcpip.LinkAddress("\x00\x00\x00\x00\x00\x00")),
+			TargetProtocolAddr: Address(tcpip.Address(net.ParseIP("192.168.0.10").To4())),
+		},
+		&Payload{
+			Bytes: make([]byte, 18),
+		},
+	}
+	layers := parse(parseEther, wantBytes)
+	if !layers.match(wantLayers) {
+		t.Fatalf("match failed with diff: %s", layers.diff(wantLayers))
+	}
+	gotBytes, err := layers.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes() failed on %s: %s", &layers, err)
+	}
+	if !bytes.Equal(wantBytes, gotBytes) {
+		t.Fatalf("mismatching bytes, gotBytes: %x, wantBytes: %x", gotBytes, wantBytes)
+	}
+
+	// The Ethernet type and the ARP hardware and protocol types are filled in
+	// when they are not set.
+	built := Layers{
+		&Ether{
+			SrcAddr: LinkAddress(tcpip.LinkAddress("\x02\x42\xc0\xa8\x00\x14")),
+			DstAddr: LinkAddress(tcpip.LinkAddress("\xff\xff\xff\xff\xff\xff")),
+		},
+		&ARP{
+			Op:                 ARPOp(header.ARPRequest),
+			SenderHardwareAddr: LinkAddress(tcpip.LinkAddress("\x02\x42\xc0\xa8\x00\x14")),
+			SenderProtocolAddr: Address(tcpip.Address(net.ParseIP("192.168.0.20").To4())),
+			TargetProtocolAddr: Address(tcpip.Address(net.ParseIP("192.168.0.10").To4())),
+		},
+	}
+	gotBytes, err = built.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes() failed on %s: %s", &built, err)
+	}
+	if want := wantBytes[:header.EthernetMinimumSize+header.ARPSize]; !bytes.Equal(want, gotBytes) {
+		t.Fatalf("mismatching bytes, gotBytes: %x, wantBytes: %x", gotBytes, want)
+	}
+}
+
+func TestICMPv4(t *testing.T) {
+	src := Address(tcpip.Address(net.ParseIP("192.168.0.20").To4()))
+	dst := Address(tcpip.Address(net.ParseIP("192.168.0.10").To4()))
+	for _, tt := range []struct {
+		description string
+		layers      Layers
+		wantLayers  Layers
+	}{
+		{
+			description: "echo reply",
+			layers: Layers{
+				&IPv4{SrcAddr: dst, DstAddr: src},
+				&ICMPv4{
+					Type:     ICMPv4Type(header.ICMPv4EchoReply),
+					Code:     Uint8(0),
+					Ident:    Uint16(0x1234),
+					Sequence: Uint16(7),
+				},
+				&Payload{Bytes: []byte("ping")},
+			},
+			wantLayers: Layers{
+				&IPv4{Protocol: Uint8(uint8(header.ICMPv4ProtocolNumber))},
+				&ICMPv4{
+					Type:     ICMPv4Type(header.ICMPv4EchoReply),
+					Code:     Uint8(0),
+					Ident:    Uint16(0x1234),
+					Sequence: Uint16(7),
+				},
+				&Payload{Bytes: []byte("ping")},
+			},
+		},
+		{
+			description: "fragmentation needed",
+			layers: Layers{
+				&IPv4{SrcAddr: dst, DstAddr: src},
+				&ICMPv4{
+					Type: ICMPv4Type(header.ICMPv4DstUnreachable),
+					Code: Uint8(header.ICMPv4FragmentationNeeded),
+					MTU:  Uint16(1280),
+				},
+				&IPv4{SrcAddr: src, DstAddr: dst},
+				&TCP{SrcPort: Uint16(1234), DstPort: Uint16(80)},
+			},
+			wantLayers: Layers{
+				&IPv4{},
+				&ICMPv4{
+					Type: ICMPv4Type(header.ICMPv4DstUnreachable),
+					Code: Uint8(header.ICMPv4FragmentationNeeded),
+					MTU:  Uint16(1280),
+				},
+				&IPv4{
+					SrcAddr:  src,
+					DstAddr:  dst,
+					Protocol: Uint8(uint8(header.TCPProtocolNumber)),
+				},
+				// Only the first 8 bytes of a TCP header may be quoted, so it
+				// is not parsed.
+				&Payload{},
+			},
+		},
+		{
+			description: "port unreachable",
+			layers: Layers{
+				&IPv4{SrcAddr: dst, DstAddr: src},
+				&ICMPv4{
+					Type: ICMPv4Type(header.ICMPv4DstUnreachable),
+					Code: Uint8(header.ICMPv4PortUnreachable),
+				},
+				&IPv4{SrcAddr: src, DstAddr: dst},
+				&UDP{SrcPort: Uint16(1234), DstPort: Uint16(4242)},
+				&Payload{Bytes: []byte("data")},
+			},
+			wantLayers: Layers{
+				&IPv4{},
+				&ICMPv4{
+					Type: ICMPv4Type(header.ICMPv4DstUnreachable),
+					Code: Uint8(header.ICMPv4PortUnreachable),
+				},
+				&IPv4{
+					SrcAddr:  src,
+					DstAddr:  dst,
+					Protocol: Uint8(uint8(header.UDPProtocolNumber)),
+				},
+				&UDP{SrcPort: Uint16(1234), DstPort: Uint16(4242)},
+				&Payload{Bytes: []byte("data")},
+			},
+		},
+	} {
+		t.Run(tt.description, func(t *testing.T) {
+			wantBytes, err := tt.layers.ToBytes()
+			if err != nil {
+				t.Fatalf("ToBytes() failed on %s: %s", &tt.layers, err)
+			}
+			layers := parse(parseIPv4, wantBytes)
+			if !layers.match(tt.wantLayers) {
+				t.Fatalf("match failed with diff: %s", layers.diff(tt.wantLayers))
+			}
+			icmpv4 := layers[1].(*ICMPv4)
+			if want := header.ICMPv4Checksum(header.ICMPv4(wantBytes[header.IPv4MinimumSize:header.IPv4MinimumSize+header.ICMPv4MinimumSize]), buffer.View(wantBytes[header.IPv4MinimumSize+header.ICMPv4MinimumSize:]).ToVectorisedView()); *icmpv4.Checksum != want {
+				t.Errorf("got checksum 0x%04x, want 0x%04x", *icmpv4.Checksum, want)
+			}
+			gotBytes, err := layers.ToBytes()
+			if err != nil {
+				t.Fatalf("ToBytes() failed on %s: %s", &layers, err)
+			}
+			if !bytes.Equal(wantBytes, gotBytes) {
+				t.Fatalf("mismatching bytes, gotBytes: %x, wantBytes: %x", gotBytes, wantBytes)
+			}
+		})
+	}
+}
+
+func TestNDP(t *testing.T) {
+	src := tcpip.Address(net.ParseIP("fe80::1"))
+	dst := tcpip.Address(net.ParseIP("fe80::2"))
+	mac := tcpip.LinkAddress("\x02\x42\xc0\xa8\x00\x14")
+	for _, tt := range []struct {
+		description string
+		layers      Layers
+		wantLayers  Layers
+	}{
+		{
+			description: "neighbor solicitation",
+			layers: Layers{
+				&IPv6{SrcAddr: &src, DstAddr: &dst, HopLimit: Uint8(255)},
+				&ICMPv6{Code: Byte(0)},
+				&ICMPv6NeighborSolicitation{
+					TargetAddress: &dst,
+					Options:       &NDPOptions{SourceLinkLayerAddress: &mac},
+				},
+			},
+			wantLayers: Layers{
+				&IPv6{NextHeader: Uint8(uint8(header.ICMPv6ProtocolNumber))},
+				&ICMPv6{Type: ICMPv6Type(header.ICMPv6NeighborSolicit)},
+				&ICMPv6NeighborSolicitation{
+					TargetAddress: &dst,
+					Options:       &NDPOptions{SourceLinkLayerAddress: &mac},
+				},
+			},
+		},
+		{
+			description: "neighbor advertisement",
+			layers: Layers{
+				&IPv6{SrcAddr: &dst, DstAddr: &src, HopLimit: Uint8(255)},
+				&ICMPv6{Code: Byte(0)},
+				&ICMPv6NeighborAdvertisement{
+					SolicitedFlag: Bool(true),
+					OverrideFlag:  Bool(true),
+					TargetAddress: &dst,
+					Options:       &NDPOptions{TargetLinkLayerAddress: &mac},
+				},
+			},
+			wantLayers: Layers{
+				&IPv6{},
+				&ICMPv6{Type: ICMPv6Type(header.ICMPv6NeighborAdvert)},
+				&ICMPv6NeighborAdvertisement{
+					RouterFlag:    Bool(false),
+					SolicitedFlag: Bool(true),
+					OverrideFlag:  Bool(true),
+					TargetAddress: &dst,
+					Options:       &NDPOptions{TargetLinkLayerAddress: &mac},
+				},
+			},
+		},
+		{
+			description: "neighbor advertisement without options",
+			layers: Layers{
+				&IPv6{SrcAddr: &dst, DstAddr: &src, HopLimit: Uint8(255)},
+				&ICMPv6{Code: Byte(0)},
+				&ICMPv6NeighborAdvertisement{
+					TargetAddress: &dst,
+				},
+			},
+			wantLayers: Layers{
+				&IPv6{},
+				&ICMPv6{Type: ICMPv6Type(header.ICMPv6NeighborAdvert)},
+				&ICMPv6NeighborAdvertisement{
+					SolicitedFlag: Bool(false),
+					TargetAddress: &dst,
+					Options:       &NDPOptions{},
+				},
+			},
+		},
+	} {
+		t.Run(tt.description, func(t *testing.T) {
+			wantBytes, err := tt.layers.ToBytes()
+			if err != nil {
+				t.Fatalf("ToBytes() failed on %s: %s", &tt.layers, err)
+			}
+			layers := parse(parseIPv6, wantBytes)
+			if !layers.match(tt.wantLayers) {
+				t.Fatalf("match failed with diff: %s", layers.diff(tt.wantLayers))
+			}
+			icmpv6 := header.ICMPv6(wantBytes[header.IPv6MinimumSize:])
+			if got, want := icmpv6.Checksum(), header.ICMPv6Checksum(icmpv6, *tt.layers[0].(*IPv6).SrcAddr, *tt.layers[0].(*IPv6).DstAddr, buffer.VectorisedView{}); got != want {
+				t.Errorf("got checksum 0x%04x, want 0x%04x", got, want)
+			}
+			gotBytes, err := layers.ToBytes()
+			if err != nil {
+				t.Fatalf("ToBytes() failed on %s: %s", &layers, err)
+			}
+			if !bytes.Equal(wantBytes, gotBytes) {
+				t.Fatalf("mismatching bytes, gotBytes: %x, wantBytes: %x", gotBytes, wantBytes)
+			}
+		})
+	}
+}
+
+func TestNDPRouterAdvertisement(t *testing.T) {
+	src := tcpip.Address(net.ParseIP("fe80::1"))
+	dst := tcpip.Address(net.ParseIP("ff02::1"))
+	mac := tcpip.LinkAddress("\x02\x42\xc0\xa8\x00\x14")
+	prefix := tcpip.Address(net.ParseIP("2001:db8:1::"))
+	route := tcpip.Address(net.ParseIP("2001:db8:2::"))
+	layers := Layers{
+		&IPv6{SrcAddr: &src, DstAddr: &dst, HopLimit: Uint8(255)},
+		&ICMPv6{Code: Byte(0)},
+		&ICMPv6RouterAdvertisement{
+			CurrHopLimit:        Uint8(64),
+			ManagedAddrConfFlag: Bool(false),
+			OtherConfFlag:       Bool(true),
+			RouterLifetime:      Uint16(1800),
+			ReachableTime:       Uint32(30000),
+			RetransTimer:        Uint32(1000),
+			Options: &NDPOptions{
+				SourceLinkLayerAddress: &mac,
+				MTU:                    Uint32(1500),
+				PrefixInformation: []NDPPrefixInformation{{
+					PrefixLength:      Uint8(64),
+					OnLinkFlag:        Bool(true),
+					AutonomousFlag:    Bool(true),
+					ValidLifetime:     Uint32(86400),
+					PreferredLifetime: Uint32(14400),
+					Prefix:            &prefix,
+				}},
+				RouteInformation: []NDPRouteInformation{{
+					PrefixLength:  Uint8(48),
+					Preference:    Uint8(1),
+					RouteLifetime: Uint32(600),
+					Prefix:        &route,
+				}},
+			},
+		},
+	}
+	wantBytes, err := layers.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes() failed on %s: %s", &layers, err)
+	}
+	icmpv6 := header.ICMPv6(wantBytes[header.IPv6MinimumSize:])
+	if got, want := icmpv6.Checksum(), header.ICMPv6Checksum(icmpv6, src, dst, buffer.VectorisedView{}); got != want {
+		t.Errorf("got checksum 0x%04x, want 0x%04x", got, want)
+	}
+
+	// Check the encoding against the header package.
+	ra := header.NDPRouterAdvert(icmpv6.NDPPayload())
+	if got, want := ra.RouterLifetime(), 1800*time.Second; got != want {
+		t.Errorf("got router lifetime %s, want %s", got, want)
+	}
+	if !ra.OtherConfFlag() || ra.ManagedAddrConfFlag() {
+		t.Errorf("got flags M=%t O=%t, want M=false O=true", ra.ManagedAddrConfFlag(), ra.OtherConfFlag())
+	}
+	it, err := ra.Options().Iter(true /* check */)
+	if err != nil {
+		t.Fatalf("ra.Options().Iter(true) failed: %s", err)
+	}
+	var gotPrefix header.NDPPrefixInformation
+	for {
+		opt, done, err := it.Next()
+		if err != nil {
+			t.Fatalf("it.Next() failed: %s", err)
+		}
+		if done {
+			break
+		}
+		if p, ok := opt.(header.NDPPrefixInformation); ok {
+			gotPrefix = p
+		}
+	}
+	if gotPrefix == nil {
+		t.Fatalf("no prefix information option in %x", []byte(ra.Options()))
+	}
+	if got, want := gotPrefix.Prefix(), prefix; got != want || gotPrefix.PrefixLength() != 64 || !gotPrefix.OnLinkFlag() || !gotPrefix.AutonomousAddressConfigurationFlag() || gotPrefix.ValidLifetime() != 86400*time.Second || gotPrefix.PreferredLifetime() != 14400*time.Second {
+		t.Errorf("got prefix information %s, want %s/64 with L and A flags set", gotPrefix, want)
+	}
+
+	got := parse(parseIPv6, wantBytes)
+	if !got.match(layers) {
+		t.Fatalf("match failed with diff: %s", got.diff(layers))
+	}
+	gotBytes, err := got.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes() failed on %s: %s", &got, err)
+	}
+	if !bytes.Equal(wantBytes, gotBytes) {
+		t.Fatalf("mismatching bytes, gotBytes: %x, wantBytes: %x", gotBytes, wantBytes)
+	}
+}
+
+func TestNDPRouterSolicitation(t *testing.T) {
+	src := tcpip.Address(net.ParseIP("fe80::1"))
+	dst := tcpip.Address(net.ParseIP("ff02::2"))
+	mac := tcpip.LinkAddress("\x02\x42\xc0\xa8\x00\x14")
+	layers := Layers{
+		&IPv6{SrcAddr: &src, DstAddr: &dst, HopLimit: Uint8(255)},
+		&ICMPv6{Code: Byte(0)},
+		&ICMPv6RouterSolicitation{
+			Options: &NDPOptions{SourceLinkLayerAddress: &mac},
+		},
+	}
+	wantBytes, err := layers.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes() failed on %s: %s", &layers, err)
+	}
+	got := parse(parseIPv6, wantBytes)
+	want := Layers{
+		&IPv6{},
+		&ICMPv6{Type: ICMPv6Type(header.ICMPv6RouterSolicit)},
+		&ICMPv6RouterSolicitation{
+			Options: &NDPOptions{SourceLinkLayerAddress: &mac},
+		},
+	}
+	if !got.match(want) {
+		t.Fatalf("match failed with diff: %s", got.diff(want))
+	}
+}
+
+func TestNDPUnknownOptions(t *testing.T) {
+	src := tcpip.Address(net.ParseIP("fe80::1"))
+	dst := tcpip.Address(net.ParseIP("ff02::1:ff00:2"))
+	target := tcpip.Address(net.ParseIP("fe80::2"))
+	mac := tcpip.LinkAddress("\x02\x42\xc0\xa8\x00\x14")
+	// A Nonce option, RFC 3971 section 5.3.2, and an MTU option with a bad
+	// length, which are both kept as they are.
+	nonce := []byte{14, 1, 1, 2, 3, 4, 5, 6}
+	badMTU := []byte{ndpMTUType, 2, 0, 0, 0, 0, 5, 0xdc, 0, 0, 0, 0, 0, 0, 0, 0}
+	layers := Layers{
+		&IPv6{SrcAddr: &src, DstAddr: &dst, HopLimit: Uint8(255)},
+		&ICMPv6{Code: Byte(0)},
+		&ICMPv6NeighborSolicitation{
+			TargetAddress: &target,
+			Options: &NDPOptions{
+				SourceLinkLayerAddress: &mac,
+				Unknown:                [][]byte{nonce, badMTU},
+			},
+		},
+	}
+	wantBytes, err := layers.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes() failed on %s: %s", &layers, err)
+	}
+	got := parse(parseIPv6, wantBytes)
+	if !got.match(layers) {
+		t.Fatalf("match failed with diff: %s", got.diff(layers))
+	}
+	ns, ok := got[2].(*ICMPv6NeighborSolicitation)
+	if !ok {
+		t.Fatalf("got %s, want an ICMPv6NeighborSolicitation", got[2])
+	}
+	if want := [][]byte{nonce, badMTU}; !cmp.Equal(ns.Options.Unknown, want) {
+		t.Errorf("got unknown options %x, want %x", ns.Options.Unknown, want)
+	}
+	if ns.Options.MTU != nil {
+		t.Errorf("got MTU %d from an option with a bad length, want none", *ns.Options.MTU)
+	}
+	gotBytes, err := got.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes() failed on %s: %s", &got, err)
+	}
+	if !bytes.Equal(wantBytes, gotBytes) {
+		t.Fatalf("mismatching bytes, gotBytes: %x, wantBytes: %x", gotBytes, wantBytes)
+	}
+}
+
+func TestNDPOptionsMatch(t *testing.T) {
+	a := tcpip.Address(net.ParseIP("2001:db8:1::"))
+	b := tcpip.Address(net.ParseIP("2001:db8:2::"))
+	prefixA := NDPPrefixInformation{PrefixLength: Uint8(64), AutonomousFlag: Bool(true), Prefix: &a}
+	prefixB := NDPPrefixInformation{PrefixLength: Uint8(64), AutonomousFlag: Bool(false), Prefix: &b}
+	for _, tt := range []struct {
+		description string
+		x, y        *NDPOptions
+		want        bool
+	}{
+		{
+			description: "same order",
+			x:           &NDPOptions{PrefixInformation: []NDPPrefixInformation{prefixA, prefixB}},
+			y:           &NDPOptions{PrefixInformation: []NDPPrefixInformation{prefixA, prefixB}},
+			want:        true,
+		},
+		{
+			description: "different order",
+			x:           &NDPOptions{PrefixInformation: []NDPPrefixInformation{prefixA, prefixB}},
+			y:           &NDPOptions{PrefixInformation: []NDPPrefixInformation{prefixB, prefixA}},
+			want:        true,
+		},
+		{
+			description: "unset list",
+			x:           &NDPOptions{MTU: Uint32(1500)},
+			y:           &NDPOptions{MTU: Uint32(1500), PrefixInformation: []NDPPrefixInformation{prefixA}},
+			want:        true,
+		},
+		{
+			description: "unset fields",
+			x:           &NDPOptions{PrefixInformation: []NDPPrefixInformation{{Prefix: &b}, {Prefix: &a}}},
+			y:           &NDPOptions{PrefixInformation: []NDPPrefixInformation{prefixA, prefixB}},
+			want:        true,
+		},
+		{
+			description: "missing option",
+			x:           &NDPOptions{PrefixInformation: []NDPPrefixInformation{prefixA}},
+			y:           &NDPOptions{PrefixInformation: []NDPPrefixInformation{prefixA, prefixB}},
+			want:        false,
+		},
+		{
+			description: "mismatched field",
+			x:           &NDPOptions{PrefixInformation: []NDPPrefixInformation{{Prefix: &a, AutonomousFlag: Bool(false)}}},
+			y:           &NDPOptions{PrefixInformation: []NDPPrefixInformation{prefixA}},
+			want:        false,
+		},
+		{
+			description: "mismatched MTU",
+			x:           &NDPOptions{MTU: Uint32(1280)},
+			y:           &NDPOptions{MTU: Uint32(1500)},
+			want:        false,
+		},
+		{
+			description: "unknown options in different order",
+			x:           &NDPOptions{Unknown: [][]byte{{14, 1, 1, 2, 3, 4, 5, 6}, {200, 1, 0, 0, 0, 0, 0, 0}}},
+			y:           &NDPOptions{Unknown: [][]byte{{200, 1, 0, 0, 0, 0, 0, 0}, {14, 1, 1, 2, 3, 4, 5, 6}}},
+			want:        true,
+		},
+		{
+			description: "mismatched unknown option",
+			x:           &NDPOptions{Unknown: [][]byte{{14, 1, 1, 2, 3, 4, 5, 6}}},
+			y:           &NDPOptions{Unknown: [][]byte{{14, 1, 6, 5, 4, 3, 2, 1}}},
+			want:        false,
+		},
+	} {
+		t.Run(tt.description, func(t *testing.T) {
+			x := &ICMPv6RouterAdvertisement{Options: tt.x}
+			y := &ICMPv6RouterAdvertisement{Options: tt.y}
+			if got := equalLayer(x, y); got != tt.want {
+				t.Errorf("equalLayer(%s, %s) = %t, want %t", x, y, got, tt.want)
+			}
+			if got := equalLayer(y, x); got != tt.want {
+				t.Errorf("equalLayer(%s, %s) = %t, want %t", y, x, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMLD(t *testing.T) {
+	src := tcpip.Address(net.ParseIP("fe80::1"))
+	group := tcpip.Address(net.ParseIP("ff02::1:3"))
+	source := tcpip.Address(net.ParseIP("2001:db8::1"))
+	for _, tt := range []struct {
+		description string
+		typ         header.ICMPv6Type
+		layer       Layer
+	}{
+		{
+			description: "v1 query",
+			typ:         header.ICMPv6MulticastListenerQuery,
+			layer: &MLDListenerQuery{
+				MaxResponseDelay: Uint16(10000),
+				MulticastAddress: Address(header.IPv6Any),
+			},
+		},
+		{
+			description: "v2 query",
+			typ:         header.ICMPv6MulticastListenerQuery,
+			layer: &MLDListenerQuery{
+				MaxResponseDelay: Uint16(1000),
+				MulticastAddress: &group,
+				SuppressFlag:     Bool(true),
+				QRV:              Uint8(2),
+				QQIC:             Uint8(125),
+				Sources:          []tcpip.Address{source},
+			},
+		},
+		{
+			description: "v1 report",
+			typ:         header.ICMPv6MulticastListenerReport,
+			layer: &MLDListenerReport{
+				MaxResponseDelay: Uint16(0),
+				MulticastAddress: &group,
+			},
+		},
+		{
+			description: "v1 done",
+			typ:         header.ICMPv6MulticastListenerDone,
+			layer: &MLDListenerDone{
+				MaxResponseDelay: Uint16(0),
+				MulticastAddress: &group,
+			},
+		},
+		{
+			description: "v2 report",
+			typ:         header.ICMPv6MulticastListenerV2Report,
+			layer: &MLDv2ListenerReport{
+				Records: MLDv2AddressRecords{
+					{
+						Type:             MLDv2RecordType(MLDv2ChangeToExclude),
+						MulticastAddress: &group,
+						Sources:          []tcpip.Address{},
+					},
+					{
+						Type:             MLDv2RecordType(MLDv2AllowNewSources),
+						MulticastAddress: &group,
+						Sources:          []tcpip.Address{source},
+						AuxData:          []byte{1, 2, 3, 4},
+					},
+				},
+			},
+		},
+	} {
+		t.Run(tt.description, func(t *testing.T) {
+			dst := group
+			if tt.typ == header.ICMPv6MulticastListenerV2Report {
+				dst = tcpip.Address(net.ParseIP("ff02::16"))
+			}
+			layers := Layers{
+				&IPv6{SrcAddr: &src, DstAddr: &dst, HopLimit: Uint8(1)},
+				&IPv6HopByHopOptionsExtHdr{
+					NextHeader: IPv6ExtHdrIdent(header.IPv6ExtensionHeaderIdentifier(header.ICMPv6ProtocolNumber)),
+					Options:    IPv6RouterAlertMLDOptions(),
+				},
+				&ICMPv6{Code: Byte(0)},
+				tt.layer,
+			}
+			wantBytes, err := layers.ToBytes()
+			if err != nil {
+				t.Fatalf("ToBytes() failed on %s: %s", &layers, err)
+			}
+			icmpv6 := header.ICMPv6(wantBytes[header.IPv6MinimumSize+8:])
+			if got := icmpv6.Type(); got != tt.typ {
+				t.Errorf("got type %d, want %d", got, tt.typ)
+			}
+			if got, want := icmpv6.Checksum(), header.ICMPv6Checksum(icmpv6, src, dst, buffer.VectorisedView{}); got != want {
+				t.Errorf("got checksum 0x%04x, want 0x%04x", got, want)
+			}
+
+			got := parse(parseIPv6, wantBytes)
+			if !got.match(layers) {
+				t.Fatalf("match failed with diff: %s", got.diff(layers))
+			}
+			gotBytes, err := got.ToBytes()
+			if err != nil {
+				t.Fatalf("ToBytes() failed on %s: %s", &got, err)
+			}
+			if !bytes.Equal(wantBytes, gotBytes) {
+				t.Fatalf("mismatching bytes, gotBytes: %x, wantBytes: %x", gotBytes, wantBytes)
+			}
+		})
+	}
+}
+
+func TestMLDv2AddressRecordsMatch(t *testing.T) {
+	a := tcpip.Address(net.ParseIP("ff02::1:3"))
+	b := tcpip.Address(net.ParseIP("ff0e::1234"))
+	s1 := tcpip.Address(net.ParseIP("2001:db8::1"))
+	s2 := tcpip.Address(net.ParseIP("2001:db8::2"))
+	recordA := MLDv2AddressRecord{Type: MLDv2RecordType(MLDv2ModeIsExclude), MulticastAddress: &a, Sources: []tcpip.Address{}}
+	recordB := MLDv2AddressRecord{Type: MLDv2RecordType(MLDv2ModeIsInclude), MulticastAddress: &b, Sources: []tcpip.Address{s1, s2}}
+	for _, tt := range []struct {
+		description string
+		x, y        MLDv2AddressRecords
+		want        bool
+	}{
+		{
+			description: "different order",
+			x:           MLDv2AddressRecords{recordA, recordB},
+			y:           MLDv2AddressRecords{recordB, recordA},
+			want:        true,
+		},
+		{
+			description: "unset records",
+			x:           nil,
+			y:           MLDv2AddressRecords{recordA, recordB},
+			want:        true,
+		},
+		{
+			description: "unset fields",
+			x:           MLDv2AddressRecords{{MulticastAddress: &b}, {MulticastAddress: &a}},
+			y:           MLDv2AddressRecords{recordA, recordB},
+			want:        true,
+		},
+		{
+			description: "sources in different order",
+			x:           MLDv2AddressRecords{{MulticastAddress: &b, Sources: []tcpip.Address{s2, s1}}},
+			y:           MLDv2AddressRecords{recordB},
+			want:        true,
+		},
+		{
+			description: "missing source",
+			x:           MLDv2AddressRecords{{MulticastAddress: &b, Sources: []tcpip.Address{s1}}},
+			y:           MLDv2AddressRecords{recordB},
+			want:        false,
+		},
+		{
+			description: "missing record",
+			x:           MLDv2AddressRecords{recordA},
+			y:           MLDv2AddressRecords{recordA, recordB},
+			want:        false,
+		},
+		{
+			description: "mismatched type",
+			x:           MLDv2AddressRecords{{Type: MLDv2RecordType(MLDv2ChangeToExclude), MulticastAddress: &a}},
+			y:           MLDv2AddressRecords{recordA},
+			want:        false,
+		},
+	} {
+		t.Run(tt.description, func(t *testing.T) {
+			x := &MLDv2ListenerReport{Records: tt.x}
+			y := &MLDv2ListenerReport{Records: tt.y}
+			if got := equalLayer(x, y); got != tt.want {
+				t.Errorf("equalLayer(%s, %s) = %t, want %t", x, y, got, tt.want)
+			}
+			if got := equalLayer(y, x); got != tt.want {
+				t.Errorf("equalLayer(%s, %s) = %t, want %t", y, x, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPv4Options(t *testing.T) {
+	for _, tt := range []struct {
+		description string
+		options     []byte
+		wantOptions []byte
+	}{
+		{
+			description: "router alert",
+			options:     IPv4RouterAlertOptions(),
+			wantOptions: []byte{148, 4, 0, 0},
+		},
+		{
+			description: "padded",
+			options:     []byte{1, 1, 1},
+			wantOptions: []byte{1, 1, 1, 0},
+		},
+	} {
+		t.Run(tt.description, func(t *testing.T) {
+			layers := Layers{
+				&IPv4{
+					SrcAddr: Address(tcpip.Address(net.ParseIP("192.168.0.2").To4())),
+					DstAddr: Address(tcpip.Address(net.ParseIP("224.0.0.22").To4())),
+					Options: tt.options,
+				},
+				&UDP{SrcPort: Uint16(1), DstPort: Uint16(2)},
+			}
+			b, err := layers.ToBytes()
+			if err != nil {
+				t.Fatalf("ToBytes() failed on %s: %s", &layers, err)
+			}
+			h := header.IPv4(b)
+			if got, want := int(h.HeaderLength()), header.IPv4MinimumSize+len(tt.wantOptions); got != want {
+				t.Errorf("got header length %d, want %d", got, want)
+			}
+			if got, want := int(h.TotalLength()), len(b); got != want {
+				t.Errorf("got total length %d, want %d", got, want)
+			}
+			if got := h.CalculateChecksum(); got != 0xffff {
+				t.Errorf("got checksum over the header 0x%04x, want 0xffff", got)
+			}
+			got := parse(parseIPv4, b)
+			want := Layers{
+				&IPv4{Options: tt.wantOptions},
+				&UDP{SrcPort: Uint16(1), DstPort: Uint16(2)},
+				&Payload{},
+			}
+			if !got.match(want) {
+				t.Fatalf("match failed with diff: %s", got.diff(want))
+			}
+		})
+	}
+}
+
+func TestIGMP(t *testing.T) {
+	group := tcpip.Address(net.ParseIP("239.255.1.1").To4())
+	source := tcpip.Address(net.ParseIP("192.168.0.1").To4())
+	for _, tt := range []struct {
+		description string
+		igmp        *IGMP
+		wantLength  int
+	}{
+		{
+			description: "v2 query",
+			igmp: &IGMP{
+				Type:         IGMPType(header.IGMPMembershipQuery),
+				MaxRespTime:  Uint8(100),
+				GroupAddress: Address(header.IPv4Any),
+			},
+			wantLength: 8,
+		},
+		{
+			description: "v2 report",
+			igmp: &IGMP{
+				Type:         IGMPType(header.IGMPv2MembershipReport),
+				MaxRespTime:  Uint8(0),
+				GroupAddress: &group,
+			},
+			wantLength: 8,
+		},
+		{
+			description: "v3 query",
+			igmp: &IGMP{
+				Type:         IGMPType(header.IGMPMembershipQuery),
+				MaxRespTime:  Uint8(10),
+				GroupAddress: &group,
+				SuppressFlag: Bool(true),
+				QRV:          Uint8(2),
+				QQIC:         Uint8(125),
+				Sources:      []tcpip.Address{source},
+			},
+			wantLength: 16,
+		},
+		{
+			description: "v3 report",
+			igmp: &IGMP{
+				Type:        IGMPType(header.IGMPv3MembershipReport),
+				MaxRespTime: Uint8(0),
+				GroupRecords: IGMPv3GroupRecords{
+					{
+						Type:         IGMPv3RecordType(IGMPv3ChangeToExclude),
+						GroupAddress: &group,
+						Sources:      []tcpip.Address{},
+					},
+					{
+						Type:         IGMPv3RecordType(IGMPv3ModeIsInclude),
+						GroupAddress: &group,
+						Sources:      []tcpip.Address{source},
+						AuxData:      []byte{1, 2, 3, 4},
+					},
+				},
+			},
+			wantLength: 32,
+		},
+	} {
+		t.Run(tt.description, func(t *testing.T) {
+			layers := Layers{
+				&IPv4{
+					SrcAddr: Address(tcpip.Address(net.ParseIP("192.168.0.2").To4())),
+					DstAddr: Address(tcpip.Address(net.ParseIP("224.0.0.1").To4())),
+					TTL:     Uint8(1),
+					Options: IPv4RouterAlertOptions(),
+				},
+				tt.igmp,
+			}
+			wantBytes, err := layers.ToBytes()
+			if err != nil {
+				t.Fatalf("ToBytes() failed on %s: %s", &layers, err)
+			}
+			if got, want := header.IPv4(wantBytes).Protocol(), uint8(header.IGMPProtocolNumber); got != want {
+				t.Errorf("got protocol %d, want %d", got, want)
+			}
+			igmp := wantBytes[header.IPv4MinimumSize+4:]
+			if got := len(igmp); got != tt.wantLength {
+				t.Errorf("got IGMP length %d, want %d", got, tt.wantLength)
+			}
+			if got := header.Checksum(igmp, 0); got != 0xffff {
+				t.Errorf("got checksum over the message 0x%04x, want 0xffff", got)
+			}
+
+			got := parse(parseIPv4, wantBytes)
+			if !got.match(layers) {
+				t.Fatalf("match failed with diff: %s", got.diff(layers))
+			}
+			gotBytes, err := got.ToBytes()
+			if err != nil {
+				t.Fatalf("ToBytes() failed on %s: %s", &got, err)
+			}
+			if !bytes.Equal(wantBytes, gotBytes) {
+				t.Fatalf("mismatching bytes, gotBytes: %x, wantBytes: %x", gotBytes, wantBytes)
+			}
+		})
+	}
+}
+
+func TestIGMPv3GroupRecordsMatch(t *testing.T) {
+	a := tcpip.Address(net.ParseIP("239.255.1.1").To4())
+	b := tcpip.Address(net.ParseIP("239.255.1.2").To4())
+	recordA := IGMPv3GroupRecord{Type: IGMPv3RecordType(IGMPv3ModeIsExclude), GroupAddress: &a, Sources: []tcpip.Address{}}
+	recordB := IGMPv3GroupRecord{Type: IGMPv3RecordType(IGMPv3ModeIsExclude), GroupAddress: &b, Sources: []tcpip.Address{}}
+	for _, tt := range []struct {
+		description string
+		x, y        IGMPv3GroupRecords
+		want        bool
+	}{
+		{
+			description: "different order",
+			x:           IGMPv3GroupRecords{recordA, recordB},
+			y:           IGMPv3GroupRecords{recordB, recordA},
+			want:        true,
+		},
+		{
+			description: "unset records",
+			x:           nil,
+			y:           IGMPv3GroupRecords{recordA},
+			want:        true,
+		},
+		{
+			description: "missing record",
+			x:           IGMPv3GroupRecords{recordB},
+			y:           IGMPv3GroupRecords{recordA, recordB},
+			want:        false,
+		},
+		{
+			description: "mismatched type",
+			x:           IGMPv3GroupRecords{{Type: IGMPv3RecordType(IGMPv3ChangeToExclude), GroupAddress: &a}},
+			y:           IGMPv3GroupRecords{recordA},
+			want:        false,
+		},
+	} {
+		t.Run(tt.description, func(t *testing.T) {
+			x := &IGMP{GroupRecords: tt.x}
+			y := &IGMP{GroupRecords: tt.y}
+			if got := equalLayer(x, y); got != tt.want {
+				t.Errorf("equalLayer(%s, %s) = %t, want %t", x, y, got, tt.want)
+			}
+			if got := equalLayer(y, x); got != tt.want {
+				t.Errorf("equalLayer(%s, %s) = %t, want %t", y, x, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructuredTCPOptions(t *testing.T) {
+	options := &TCPOptions{
+		MSS:           Uint16(1460),
+		WindowScale:   Uint8(7),
+		SACKPermitted: Bool(true),
+		Timestamp:     &TCPTimestamp{TSVal: Uint32(1), TSEcr: Uint32(2)},
+		SACKBlocks:    []header.SACKBlock{{Start: 100, End: 200}},
+	}
+	layers := Layers{
+		&IPv4{
+			SrcAddr: Address(tcpip.Address(net.ParseIP("192.168.0.2").To4())),
+			DstAddr: Address(tcpip.Address(net.ParseIP("192.168.0.1").To4())),
+		},
+		&TCP{SrcPort: Uint16(1), DstPort: Uint16(2), TCPOptions: options},
+		&Payload{},
+	}
+	b, err := layers.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes() failed on %s: %s", &layers, err)
+	}
+	h := header.TCP(b[header.IPv4MinimumSize:])
+	if got, want := int(h.DataOffset()), header.TCPMinimumSize+options.length(); got != want || got%4 != 0 {
+		t.Errorf("got data offset %d, want %d", got, want)
+	}
+	synOpts := header.ParseSynOptions(h.Options(), true /* isAck */)
+	if synOpts.MSS != 1460 || synOpts.WS != 7 || !synOpts.SACKPermitted || !synOpts.TS || synOpts.TSVal != 1 || synOpts.TSEcr != 2 {
+		t.Errorf("got SYN options %+v, want MSS 1460, WS 7, SACK permitted and timestamps 1 and 2", synOpts)
+	}
+	if got := header.ParseTCPOptions(h.Options()).SACKBlocks; len(got) != 1 || got[0] != options.SACKBlocks[0] {
+		t.Errorf("got SACK blocks %v, want %v", got, options.SACKBlocks)
+	}
+
+	got := parse(parseIPv4, b)
+	if !got.match(layers) {
+		t.Fatalf("match failed with diff: %s", got.diff(layers))
+	}
+	// Only the options that are set are matched.
+	for _, want := range []*TCPOptions{
+		{MSS: Uint16(1460)},
+		{Timestamp: &TCPTimestamp{TSEcr: Uint32(2)}},
+	} {
+		if want := (Layers{&IPv4{}, &TCP{TCPOptions: want}, &Payload{}}); !got.match(want) {
+			t.Errorf("match failed with diff: %s", got.diff(want))
+		}
+	}
+	for _, want := range []*TCPOptions{
+		{MSS: Uint16(536)},
+		{Timestamp: &TCPTimestamp{TSVal: Uint32(2)}},
+		{SACKBlocks: []header.SACKBlock{{Start: 100, End: 300}}},
+	} {
+		if want := (Layers{&IPv4{}, &TCP{TCPOptions: want}, &Payload{}}); got.match(want) {
+			t.Errorf("got %s, which unexpectedly matches %s", &got, &want)
+		}
+	}
+
+	tooLong := Layers{&IPv4{}, &TCP{TCPOptions: &TCPOptions{
+		Timestamp:  &TCPTimestamp{},
+		SACKBlocks: make([]header.SACKBlock, header.TCPMaxSACKBlocks),
+	}}}
+	if _, err := tooLong.ToBytes(); err == nil {
+		t.Errorf("got ToBytes() = nil error on %s, want an error", &tooLong)
+	}
+}
+
+func TestParseTCPOptions(t *testing.T) {
+	for _, tt := range []struct {
+		description string
+		b           []byte
+		want        TCPOptions
+	}{
+		{
+			description: "empty",
+			b:           nil,
+			want:        TCPOptions{SACKPermitted: Bool(false)},
+		},
+		{
+			description: "unknown option",
+			b:           []byte{254, 4, 0, 0, 2, 4, 0x05, 0xb4},
+			want:        TCPOptions{MSS: Uint16(1460), SACKPermitted: Bool(false)},
+		},
+		{
+			description: "end of option list",
+			b:           []byte{1, 3, 3, 7, 0, 2, 4, 0x05, 0xb4},
+			want:        TCPOptions{WindowScale: Uint8(7), SACKPermitted: Bool(false)},
+		},
+		{
+			description: "truncated length",
+			b:           []byte{1, 3, 3, 7, 2},
+			want:        TCPOptions{WindowScale: Uint8(7), SACKPermitted: Bool(false)},
+		},
+		{
+			description: "truncated option",
+			b:           []byte{4, 2, 8, 10, 0, 0, 0, 1},
+			want:        TCPOptions{SACKPermitted: Bool(true)},
+		},
+		{
+			description: "zero length",
+			b:           []byte{2, 0, 2, 4, 0x05, 0xb4},
+			want:        TCPOptions{SACKPermitted: Bool(false)},
+		},
+		{
+			description: "wrong length",
+			b:           []byte{2, 3, 0, 3, 4, 7, 0, 4, 2},
+			want:        TCPOptions{SACKPermitted: Bool(true)},
+		},
+		{
+			description: "malformed SACK blocks",
+			b:           []byte{5, 6, 0, 0, 0, 1, 1, 1},
+			want:        TCPOptions{SACKPermitted: Bool(false)},
+		},
+		{
+			description: "SACK blocks",
+			b:           []byte{1, 1, 5, 18, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0, 4},
+			want: TCPOptions{
+				SACKPermitted: Bool(false),
+				SACKBlocks:    []header.SACKBlock{{Start: 1, End: 2}, {Start: 3, End: 4}},
+			},
+		},
+	} {
+		t.Run(tt.description, func(t *testing.T) {
+			got := parseTCPOptions(tt.b)
+			if !cmp.Equal(*got, tt.want) {
+				t.Errorf("parseTCPOptions(%x) = %s, want %s", tt.b, got, tt.want)
+			}
+		})
+	}
+}
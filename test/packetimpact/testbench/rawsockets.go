@@ -50,6 +50,9 @@ func NewSniffer(t *testing.T) (Sniffer, error) {
 	if err := unix.SetsockoptInt(snifferFd, unix.SOL_SOCKET, unix.SO_RCVBUF, 1e7); err != nil {
 		t.Fatalf("can't setsockopt SO_RCVBUF to 10M: %s", err)
 	}
+	if err := unix.SetsockoptInt(snifferFd, unix.SOL_SOCKET, unix.SO_TIMESTAMPNS, 1); err != nil {
+		t.Fatalf("can't setsockopt SO_TIMESTAMPNS: %s", err)
+	}
 	return Sniffer{
 		t:  t,
 		fd: snifferFd,
@@ -62,11 +65,19 @@ const maxReadSize int = 65536
 
 // Recv tries to read one frame until the timeout is up.
 func (s *Sniffer) Recv(timeout time.Duration) []byte {
+	b, _ := s.RecvTimestamped(timeout)
+	return b
+}
+
+// RecvTimestamped is like Recv, but also returns the time at which the kernel
+// captured the frame. Unlike the time at which it is read, this isn't delayed
+// by frames queued before it in the socket receive buffer.
+func (s *Sniffer) RecvTimestamped(timeout time.Duration) ([]byte, time.Time) {
 	deadline := time.Now().Add(timeout)
 	for {
 		timeout = deadline.Sub(time.Now())
 		if timeout <= 0 {
-			return nil
+			return nil, time.Time{}
 		}
 		whole, frac := math.Modf(timeout.Seconds())
 		tv := unix.Timeval{
@@ -79,7 +90,8 @@ func (s *Sniffer) Recv(timeout time.Duration) []byte {
 		}
 
 		buf := make([]byte, maxReadSize)
-		nread, _, err := unix.Recvfrom(s.fd, buf, unix.MSG_TRUNC)
+		oob := make([]byte, unix.CmsgSpace(timespecSize))
+		nread, oobn, _, _, err := unix.Recvmsg(s.fd, buf, oob, unix.MSG_TRUNC)
 		if err == unix.EINTR || err == unix.EAGAIN {
 			// There was a timeout.
 			continue
@@ -90,10 +102,32 @@ func (s *Sniffer) Recv(timeout time.Duration) []byte {
 		if nread > maxReadSize {
 			s.t.Fatalf("received a truncated frame of %d bytes", nread)
 		}
-		return buf[:nread]
+		return buf[:nread], s.timestamp(oob[:oobn])
 	}
 }
 
+// timespecSize is the size of a unix.Timespec.
+const timespecSize = 16
+
+// timestamp returns the capture time carried by the control messages oob of a
+// received frame.
+func (s *Sniffer) timestamp(oob []byte) time.Time {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		s.t.Fatalf("can't parse control messages: %s", err)
+	}
+	for _, msg := range msgs {
+		if msg.Header.Level != unix.SOL_SOCKET || msg.Header.Type != unix.SCM_TIMESTAMPNS || len(msg.Data) < timespecSize {
+			continue
+		}
+		sec := int64(usermem.ByteOrder.Uint64(msg.Data))
+		nsec := int64(usermem.ByteOrder.Uint64(msg.Data[8:]))
+		return time.Unix(sec, nsec)
+	}
+	s.t.Fatal("received a frame without a timestamp")
+	panic("unreachable")
+}
+
 // Drain drains the Sniffer's socket receive buffer by receiving until there's
 // nothing else to receive.
 func (s *Sniffer) Drain() {
@@ -163,9 +197,18 @@ func NewInjector(t *testing.T) (Injector, error) {
 
 // Send a raw frame.
 func (i *Injector) Send(b []byte) {
+	if err := i.write(b); err != nil {
+		i.t.Fatal(err)
+	}
+}
+
+// write writes a raw frame. Unlike Send, it is safe to call from goroutines
+// other than the test's.
+func (i *Injector) write(b []byte) error {
 	if _, err := unix.Write(i.fd, b); err != nil {
-		i.t.Fatalf("can't write: %s of len %d", err, len(b))
+		return fmt.Errorf("can't write: %s of len %d", err, len(b))
 	}
+	return nil
 }
 
 // close the underlying socket.
@@ -44,6 +44,9 @@ var (
 	POSIXServerPort = 40000
 	// RemoteIPv4 is the DUT's IPv4 address on the test network.
 	RemoteIPv4 = ""
+	// RemoteInterfaceID is the index of the DUT's interface on the test
+	// network.
+	RemoteInterfaceID uint = 0
 	// RemoteIPv6 is the DUT's IPv6 address on the test network.
 	RemoteIPv6 = ""
 	// RemoteMAC is the DUT's MAC address on the test network.
@@ -65,6 +68,7 @@ func RegisterFlags(fs *flag.FlagSet) {
 	fs.StringVar(&LocalIPv4, "local_ipv4", LocalIPv4, "local IPv4 address for test packets")
 	fs.StringVar(&RemoteIPv4, "remote_ipv4", RemoteIPv4, "remote IPv4 address for test packets")
 	fs.StringVar(&RemoteIPv6, "remote_ipv6", RemoteIPv6, "remote IPv6 address for test packets")
+	fs.UintVar(&RemoteInterfaceID, "remote_interface_id", RemoteInterfaceID, "remote interface index on the test network")
 	fs.StringVar(&RemoteMAC, "remote_mac", RemoteMAC, "remote mac address for test packets")
 	fs.StringVar(&Device, "device", Device, "local device for test packets")
 	fs.StringVar(&DUTType, "dut_type", DUTType, "type of device under test")
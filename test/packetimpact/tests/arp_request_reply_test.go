@@ -0,0 +1,73 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arp_request_reply_test
+
+import (
+	"flag"
+	"net"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	tb "gvisor.dev/gvisor/test/packetimpact/testbench"
+)
+
+func init() {
+	tb.RegisterFlags(flag.CommandLine)
+}
+
+// TestARPRequestReply sends a broadcast ARP request for the DUT's address on
+// the test network and expects a unicast ARP reply with the DUT's MAC address.
+func TestARPRequestReply(t *testing.T) {
+	dut := tb.NewDUT(t)
+	defer dut.TearDown()
+
+	broadcast := tcpip.LinkAddress("\xff\xff\xff\xff\xff\xff")
+	conn := tb.NewEtherConn(t, tb.Ether{DstAddr: &broadcast}, tb.Ether{})
+	defer conn.Close()
+
+	lMAC, err := tcpip.ParseMACAddress(tb.LocalMAC)
+	if err != nil {
+		t.Fatalf("can't parse local MAC %q: %s", tb.LocalMAC, err)
+	}
+	rMAC, err := tcpip.ParseMACAddress(tb.RemoteMAC)
+	if err != nil {
+		t.Fatalf("can't parse remote MAC %q: %s", tb.RemoteMAC, err)
+	}
+	lIP := tcpip.Address(net.ParseIP(tb.LocalIPv4).To4())
+	rIP := tcpip.Address(net.ParseIP(tb.RemoteIPv4).To4())
+
+	conn.Send(tb.Ether{}, &tb.ARP{
+		Op:                 tb.ARPOp(header.ARPRequest),
+		SenderHardwareAddr: &lMAC,
+		SenderProtocolAddr: &lIP,
+		TargetProtocolAddr: &rIP,
+	})
+	if _, err := conn.ExpectFrame(tb.Layers{
+		&tb.Ether{Type: tb.NetworkProtocolNumber(header.ARPProtocolNumber)},
+		&tb.ARP{
+			HardwareType:       tb.Uint16(1),
+			ProtocolType:       tb.NetworkProtocolNumber(header.IPv4ProtocolNumber),
+			Op:                 tb.ARPOp(header.ARPReply),
+			SenderHardwareAddr: &rMAC,
+			SenderProtocolAddr: &rIP,
+			TargetHardwareAddr: &lMAC,
+			TargetProtocolAddr: &lIP,
+		},
+	}, time.Second); err != nil {
+		t.Fatalf("expected an ARP reply from the DUT but got none: %s", err)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arp_unsolicited_reply_test
+
+import (
+	"flag"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	tb "gvisor.dev/gvisor/test/packetimpact/testbench"
+)
+
+func init() {
+	tb.RegisterFlags(flag.CommandLine)
+}
+
+// TestARPUnsolicitedReply sends the DUT an ARP reply it did not ask for,
+// mapping an unused address on the test network to a made-up MAC address.
+// RFC 826 has the receiver add the mapping to its table because the DUT is the
+// target of the reply, so a datagram the DUT then sends to that address must
+// go to the made-up MAC address without an ARP request being sent first.
+func TestARPUnsolicitedReply(t *testing.T) {
+	dut := tb.NewDUT(t)
+	defer dut.TearDown()
+
+	// The DUT and the testbench use .10 and .20 on the test network, .30 is
+	// unused.
+	peerIP := net.ParseIP(tb.LocalIPv4).To4()
+	peerIP[3] = 30
+	peerAddr := tcpip.Address(peerIP)
+	peerMAC := tcpip.LinkAddress("\x02\x00\x00\x00\x00\x1e")
+
+	rMAC, err := tcpip.ParseMACAddress(tb.RemoteMAC)
+	if err != nil {
+		t.Fatalf("can't parse remote MAC %q: %s", tb.RemoteMAC, err)
+	}
+	rIP := tcpip.Address(net.ParseIP(tb.RemoteIPv4).To4())
+
+	conn := tb.NewEtherConn(t, tb.Ether{SrcAddr: &peerMAC}, tb.Ether{DstAddr: &peerMAC})
+	defer conn.Close()
+	conn.Send(tb.Ether{}, &tb.ARP{
+		Op:                 tb.ARPOp(header.ARPReply),
+		SenderHardwareAddr: &peerMAC,
+		SenderProtocolAddr: &peerAddr,
+		TargetHardwareAddr: &rMAC,
+		TargetProtocolAddr: &rIP,
+	})
+
+	fd, _ := dut.CreateBoundSocket(unix.SOCK_DGRAM, unix.IPPROTO_UDP, net.ParseIP(tb.RemoteIPv4))
+	defer dut.Close(fd)
+	const port = 4242
+	sa := unix.SockaddrInet4{Port: port}
+	copy(sa.Addr[:], peerIP)
+	dut.SendTo(fd, []byte("hello"), 0, &sa)
+
+	if _, err := conn.ExpectFrame(tb.Layers{
+		&tb.Ether{Type: tb.NetworkProtocolNumber(header.IPv4ProtocolNumber)},
+		&tb.IPv4{DstAddr: &peerAddr},
+		&tb.UDP{DstPort: tb.Uint16(port)},
+	}, time.Second); err != nil {
+		t.Fatalf("expected a datagram sent to the MAC address from the unsolicited ARP reply but got none: %s", err)
+	}
+}
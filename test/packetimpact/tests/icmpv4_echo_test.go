@@ -0,0 +1,70 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icmpv4_echo_test
+
+import (
+	"bytes"
+	"flag"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	tb "gvisor.dev/gvisor/test/packetimpact/testbench"
+)
+
+func init() {
+	tb.RegisterFlags(flag.CommandLine)
+}
+
+// TestICMPv4Echo sends an echo request to the DUT and expects an echo reply
+// with the same identifier, sequence number and data.
+func TestICMPv4Echo(t *testing.T) {
+	dut := tb.NewDUT(t)
+	defer dut.TearDown()
+	conn := tb.NewIPv4Conn(t, tb.IPv4{}, tb.IPv4{})
+	defer conn.Close()
+
+	const (
+		ident    = 0x1234
+		sequence = 1
+	)
+	data := []byte("hello, DUT")
+	conn.Send(tb.IPv4{},
+		&tb.ICMPv4{
+			Type:     tb.ICMPv4Type(header.ICMPv4Echo),
+			Code:     tb.Uint8(0),
+			Ident:    tb.Uint16(ident),
+			Sequence: tb.Uint16(sequence),
+		},
+		&tb.Payload{Bytes: data},
+	)
+	got, err := conn.ExpectFrame(tb.Layers{
+		&tb.Ether{},
+		&tb.IPv4{},
+		&tb.ICMPv4{
+			Type:     tb.ICMPv4Type(header.ICMPv4EchoReply),
+			Code:     tb.Uint8(0),
+			Ident:    tb.Uint16(ident),
+			Sequence: tb.Uint16(sequence),
+		},
+	}, time.Second)
+	if err != nil {
+		t.Fatalf("expected an ICMPv4 Echo Reply but got none: %s", err)
+	}
+	payload, ok := got[len(got)-1].(*tb.Payload)
+	if !ok || !bytes.Equal(payload.Bytes, data) {
+		t.Fatalf("got echo reply %s, want data %q", &got, data)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icmpv4_port_unreachable_test
+
+import (
+	"flag"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	tb "gvisor.dev/gvisor/test/packetimpact/testbench"
+)
+
+func init() {
+	tb.RegisterFlags(flag.CommandLine)
+}
+
+// TestICMPv4PortUnreachable sends a UDP datagram to a closed port on the DUT
+// and expects an ICMPv4 Port Unreachable error quoting the datagram.
+func TestICMPv4PortUnreachable(t *testing.T) {
+	dut := tb.NewDUT(t)
+	defer dut.TearDown()
+	// Find a closed port by binding a socket and then closing it.
+	fd, closedPort := dut.CreateBoundSocket(unix.SOCK_DGRAM, unix.IPPROTO_UDP, net.ParseIP(tb.RemoteIPv4))
+	dut.Close(fd)
+
+	conn := tb.NewIPv4Conn(t, tb.IPv4{}, tb.IPv4{})
+	defer conn.Close()
+
+	const srcPort = 4242
+	conn.Send(tb.IPv4{},
+		&tb.UDP{SrcPort: tb.Uint16(srcPort), DstPort: tb.Uint16(closedPort)},
+		&tb.Payload{Bytes: []byte("hello")},
+	)
+	lIP := tcpip.Address(net.ParseIP(tb.LocalIPv4).To4())
+	rIP := tcpip.Address(net.ParseIP(tb.RemoteIPv4).To4())
+	if _, err := conn.ExpectFrame(tb.Layers{
+		&tb.Ether{},
+		&tb.IPv4{},
+		&tb.ICMPv4{
+			Type: tb.ICMPv4Type(header.ICMPv4DstUnreachable),
+			Code: tb.Uint8(header.ICMPv4PortUnreachable),
+		},
+		&tb.IPv4{
+			SrcAddr:  &lIP,
+			DstAddr:  &rIP,
+			Protocol: tb.Uint8(uint8(header.UDPProtocolNumber)),
+		},
+		&tb.UDP{SrcPort: tb.Uint16(srcPort), DstPort: tb.Uint16(closedPort)},
+	}, time.Second); err != nil {
+		t.Fatalf("expected an ICMPv4 Port Unreachable quoting the datagram but got none: %s", err)
+	}
+}
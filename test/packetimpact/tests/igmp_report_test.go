@@ -0,0 +1,125 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package igmp_report_test
+
+import (
+	"flag"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	tb "gvisor.dev/gvisor/test/packetimpact/testbench"
+)
+
+func init() {
+	tb.RegisterFlags(flag.CommandLine)
+}
+
+// igmpv3Routers is the address IGMPv3 reports are sent to, RFC 3376 section
+// 4.2.14.
+var igmpv3Routers = tcpip.Address(net.ParseIP("224.0.0.22").To4())
+
+// joinGroup joins group on the DUT's test interface with a new UDP socket and
+// returns the socket.
+func joinGroup(t *testing.T, dut *tb.DUT, group tcpip.Address) int32 {
+	t.Helper()
+
+	fd := dut.Socket(unix.AF_INET, unix.SOCK_DGRAM, unix.IPPROTO_UDP)
+	// struct ip_mreq is the group address followed by the address of the
+	// interface.
+	mreq := make([]byte, 2*header.IPv4AddressSize)
+	copy(mreq, group)
+	copy(mreq[header.IPv4AddressSize:], net.ParseIP(tb.RemoteIPv4).To4())
+	dut.SetSockOpt(fd, unix.IPPROTO_IP, unix.IP_ADD_MEMBERSHIP, mreq)
+	return fd
+}
+
+// expectReport waits for an IGMPv3 report from the DUT holding a record of type
+// typ for group. Other reports are skipped.
+func expectReport(t *testing.T, conn *tb.IPv4Conn, group tcpip.Address, typ tb.IGMPv3GroupRecordType, timeout time.Duration) {
+	t.Helper()
+
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); {
+		got, err := conn.ExpectFrame(tb.Layers{
+			&tb.Ether{DstAddr: tb.LinkAddress(header.EthernetAddressFromMulticastIPv4Address(igmpv3Routers))},
+			// IGMP messages have a TTL of 1 and a Router Alert option, RFC 3376
+			// section 4.
+			&tb.IPv4{DstAddr: &igmpv3Routers, TTL: tb.Uint8(1), Options: tb.IPv4RouterAlertOptions()},
+			&tb.IGMP{Type: tb.IGMPType(header.IGMPv3MembershipReport)},
+		}, time.Until(deadline))
+		if err != nil {
+			break
+		}
+		for _, r := range got[2].(*tb.IGMP).GroupRecords {
+			if *r.Type == typ && *r.GroupAddress == group {
+				return
+			}
+		}
+	}
+	t.Fatalf("expected an IGMPv3 report with a record of type %d for %s but got none", typ, group)
+}
+
+// TestIGMPReportOnJoin joins a multicast group on the DUT and expects it to
+// report the change of its membership, RFC 3376 section 5.1.
+func TestIGMPReportOnJoin(t *testing.T) {
+	dut := tb.NewDUT(t)
+	defer dut.TearDown()
+	ipv4Conn := tb.NewIPv4Conn(t, tb.IPv4{}, tb.IPv4{})
+	defer ipv4Conn.Close()
+
+	group := tcpip.Address(net.ParseIP("239.255.1.1").To4())
+	fd := joinGroup(t, &dut, group)
+	defer dut.Close(fd)
+
+	expectReport(t, &ipv4Conn, group, tb.IGMPv3ChangeToExclude, 5*time.Second)
+}
+
+// TestIGMPGeneralQuery joins a multicast group on the DUT, sends a General
+// Query and expects the DUT to report its membership of the group within the
+// Max Resp Time of the query, RFC 3376 section 5.2.
+func TestIGMPGeneralQuery(t *testing.T) {
+	dut := tb.NewDUT(t)
+	defer dut.TearDown()
+	ipv4Conn := tb.NewIPv4Conn(t, tb.IPv4{}, tb.IPv4{})
+	conn := (*tb.Connection)(&ipv4Conn)
+	defer ipv4Conn.Close()
+
+	group := tcpip.Address(net.ParseIP("239.255.1.2").To4())
+	fd := joinGroup(t, &dut, group)
+	defer dut.Close(fd)
+
+	// Max Resp Time is in units of 1/10 second.
+	const maxRespTime = 20
+	allSystems := tcpip.Address(net.ParseIP("224.0.0.1").To4())
+	conn.SendFrame(conn.CreateFrame(tb.Layers{
+		&tb.Ether{DstAddr: tb.LinkAddress(header.EthernetAddressFromMulticastIPv4Address(allSystems))},
+		&tb.IPv4{DstAddr: &allSystems, TTL: tb.Uint8(1), Options: tb.IPv4RouterAlertOptions()},
+	},
+		// An IGMPv3 General Query, so that the DUT keeps using IGMPv3.
+		&tb.IGMP{
+			Type:         tb.IGMPType(header.IGMPMembershipQuery),
+			MaxRespTime:  tb.Uint8(maxRespTime),
+			GroupAddress: tb.Address(header.IPv4Any),
+			QRV:          tb.Uint8(2),
+			QQIC:         tb.Uint8(125),
+			Sources:      []tcpip.Address{},
+		},
+	))
+
+	expectReport(t, &ipv4Conn, group, tb.IGMPv3ModeIsExclude, maxRespTime*time.Second/10)
+}
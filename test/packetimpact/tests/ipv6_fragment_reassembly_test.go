@@ -0,0 +1,126 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipv6_fragment_reassembly_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	tb "gvisor.dev/gvisor/test/packetimpact/testbench"
+)
+
+func init() {
+	tb.RegisterFlags(flag.CommandLine)
+}
+
+const (
+	// The payload of the echo request is larger than the MTU of the test
+	// network, so the echo reply is fragmented as well.
+	payloadLength = 2000
+	// firstFragmentLength is the length of the fragmentable part of the first
+	// fragment of the echo request. It must be a multiple of 8.
+	firstFragmentLength = 1232
+	fragmentID          = 42
+)
+
+func TestIPv6FragmentReassembly(t *testing.T) {
+	dut := tb.NewDUT(t)
+	defer dut.TearDown()
+	ipv6Conn := tb.NewIPv6Conn(t, tb.IPv6{}, tb.IPv6{})
+	conn := (*tb.Connection)(&ipv6Conn)
+	defer ipv6Conn.Close()
+	conn.SetIPv6FragmentParsing(true)
+
+	// The payload of the echo request is the identifier, the sequence number
+	// and the data.
+	icmpv6Payload := make([]byte, header.ICMPv6EchoMinimumSize-header.ICMPv6HeaderSize+payloadLength)
+	binary.BigEndian.PutUint16(icmpv6Payload, 1)
+	binary.BigEndian.PutUint16(icmpv6Payload[2:], 1)
+	for i := 4; i < len(icmpv6Payload); i++ {
+		icmpv6Payload[i] = byte(i)
+	}
+	// The ICMPv6 header is part of the first fragment.
+	firstPayloadLength := firstFragmentLength - header.ICMPv6HeaderSize
+
+	conn.SendFrame(conn.CreateFrame(tb.Layers{&tb.IPv6{}},
+		&tb.IPv6FragmentExtHdr{
+			NextHeader:     tb.IPv6ExtHdrIdent(header.IPv6ExtensionHeaderIdentifier(header.ICMPv6ProtocolNumber)),
+			FragmentOffset: tb.Uint16(0),
+			MoreFragments:  tb.Bool(true),
+			Identification: tb.Uint32(fragmentID),
+		},
+		&tb.ICMPv6{
+			Type:        tb.ICMPv6Type(header.ICMPv6EchoRequest),
+			Code:        tb.Byte(0),
+			NDPPayload:  icmpv6Payload[:firstPayloadLength],
+			FullPayload: icmpv6Payload,
+		},
+	))
+	conn.SendFrame(conn.CreateFrame(tb.Layers{&tb.IPv6{}},
+		&tb.IPv6FragmentExtHdr{
+			NextHeader:     tb.IPv6ExtHdrIdent(header.IPv6ExtensionHeaderIdentifier(header.ICMPv6ProtocolNumber)),
+			FragmentOffset: tb.Uint16(firstFragmentLength / 8),
+			MoreFragments:  tb.Bool(false),
+			Identification: tb.Uint32(fragmentID),
+		},
+		&tb.Payload{Bytes: icmpv6Payload[firstPayloadLength:]},
+	))
+
+	// The first fragment of the echo reply carries the ICMPv6 header and the
+	// second fragment carries the rest of the echo data.
+	gotFirst, err := ipv6Conn.ExpectFrame(tb.Layers{
+		&tb.Ether{},
+		&tb.IPv6{},
+		&tb.IPv6FragmentExtHdr{
+			NextHeader:     tb.IPv6ExtHdrIdent(header.IPv6ExtensionHeaderIdentifier(header.ICMPv6ProtocolNumber)),
+			FragmentOffset: tb.Uint16(0),
+			MoreFragments:  tb.Bool(true),
+		},
+		&tb.ICMPv6{
+			Type: tb.ICMPv6Type(header.ICMPv6EchoReply),
+			Code: tb.Byte(0),
+		},
+	}, time.Second)
+	if err != nil {
+		t.Fatalf("expected the first fragment of an ICMPv6 Echo Reply, but got none: %s", err)
+	}
+	id := *gotFirst[2].(*tb.IPv6FragmentExtHdr).Identification
+	gotSecond, err := ipv6Conn.ExpectFrame(tb.Layers{
+		&tb.Ether{},
+		&tb.IPv6{},
+		&tb.IPv6FragmentExtHdr{
+			NextHeader:     tb.IPv6ExtHdrIdent(header.IPv6ExtensionHeaderIdentifier(header.ICMPv6ProtocolNumber)),
+			MoreFragments:  tb.Bool(false),
+			Identification: tb.Uint32(id),
+		},
+		&tb.Payload{},
+	}, time.Second)
+	if err != nil {
+		t.Fatalf("expected the last fragment of an ICMPv6 Echo Reply, but got none: %s", err)
+	}
+
+	if err := tb.VerifyICMPv6Checksum(gotFirst, gotSecond); err != nil {
+		t.Errorf("bad checksum in the ICMPv6 Echo Reply: %s", err)
+	}
+	got := append([]byte(nil), gotFirst[3].(*tb.ICMPv6).NDPPayload...)
+	got = append(got, gotSecond[3].(*tb.Payload).Bytes...)
+	if !bytes.Equal(got, icmpv6Payload) {
+		t.Fatalf("reassembled echo reply data mismatch, got: %x, want: %x", got, icmpv6Payload)
+	}
+}
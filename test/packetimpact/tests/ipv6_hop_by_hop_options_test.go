@@ -0,0 +1,109 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipv6_hop_by_hop_options_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	tb "gvisor.dev/gvisor/test/packetimpact/testbench"
+)
+
+func init() {
+	tb.RegisterFlags(flag.CommandLine)
+}
+
+// unknownOption returns an option whose type is not known to the DUT, with the
+// action to take on it encoded in the two high-order bits of its type.
+func unknownOption(action header.IPv6OptionUnknownAction) tb.IPv6ExtHdrOption {
+	return tb.IPv6ExtHdrOption{
+		Type: tb.IPv6ExtHdrOptionType(header.IPv6ExtHdrOptionIndentifier(action<<6 | 0x1e)),
+		Data: []byte{0x01, 0x02, 0x03},
+	}
+}
+
+// sendUDP sends payload to port on the DUT in an IPv6 packet carrying a
+// Hop-by-Hop Options header with options, and returns the sent packet.
+func sendUDP(t *testing.T, conn *tb.Connection, port uint16, options []tb.IPv6ExtHdrOption, payload []byte) []byte {
+	t.Helper()
+	frame := conn.CreateFrame(tb.Layers{&tb.IPv6{}},
+		&tb.IPv6HopByHopOptionsExtHdr{OptionList: options},
+		&tb.UDP{SrcPort: tb.Uint16(0xbeef), DstPort: &port},
+		&tb.Payload{Bytes: payload},
+	)
+	conn.SendFrame(frame)
+	ipv6Sent := frame[1:]
+	packet, err := ipv6Sent.ToBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize the outgoing packet: %s", err)
+	}
+	return packet
+}
+
+func TestIPv6HopByHopUnknownOptionDiscardSendICMP(t *testing.T) {
+	dut := tb.NewDUT(t)
+	defer dut.TearDown()
+	fd, port := dut.CreateBoundSocket(unix.SOCK_DGRAM, unix.IPPROTO_UDP, net.IPv6zero)
+	defer dut.Close(fd)
+	ipv6Conn := tb.NewIPv6Conn(t, tb.IPv6{}, tb.IPv6{})
+	conn := (*tb.Connection)(&ipv6Conn)
+	defer ipv6Conn.Close()
+
+	invokingPacket := sendUDP(t, conn, port, []tb.IPv6ExtHdrOption{
+		unknownOption(header.IPv6OptionUnknownActionDiscardSendICMP),
+	}, []byte("Sample Data"))
+
+	icmpv6Payload := make([]byte, 4)
+	// The pointer points to the type of the unknown option, which follows the
+	// Next Header and Hdr Ext Len fields of the Hop-by-Hop Options header.
+	binary.BigEndian.PutUint32(icmpv6Payload, header.IPv6MinimumSize+2)
+	icmpv6Payload = append(icmpv6Payload, invokingPacket...)
+	if _, err := ipv6Conn.ExpectFrame(tb.Layers{
+		&tb.Ether{},
+		&tb.IPv6{},
+		&tb.ICMPv6{
+			Type:       tb.ICMPv6Type(header.ICMPv6ParamProblem),
+			Code:       tb.Byte(2),
+			NDPPayload: icmpv6Payload,
+		},
+	}, time.Second); err != nil {
+		t.Fatalf("expected ICMPv6 Parameter Problem but got none: %s", err)
+	}
+}
+
+func TestIPv6HopByHopUnknownOptionSkip(t *testing.T) {
+	dut := tb.NewDUT(t)
+	defer dut.TearDown()
+	fd, port := dut.CreateBoundSocket(unix.SOCK_DGRAM, unix.IPPROTO_UDP, net.IPv6zero)
+	defer dut.Close(fd)
+	ipv6Conn := tb.NewIPv6Conn(t, tb.IPv6{}, tb.IPv6{})
+	conn := (*tb.Connection)(&ipv6Conn)
+	defer ipv6Conn.Close()
+
+	payload := []byte("Sample Data")
+	sendUDP(t, conn, port, []tb.IPv6ExtHdrOption{
+		unknownOption(header.IPv6OptionUnknownActionSkip),
+	}, payload)
+
+	if got := dut.Recv(fd, int32(len(payload)+1), 0); !bytes.Equal(got, payload) {
+		t.Fatalf("got Recv = %q, want %q", got, payload)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mld_report_test
+
+import (
+	"flag"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/usermem"
+	tb "gvisor.dev/gvisor/test/packetimpact/testbench"
+)
+
+func init() {
+	tb.RegisterFlags(flag.CommandLine)
+}
+
+// mldv2Routers is the address MLDv2 reports are sent to, RFC 3810 section
+// 5.2.14.
+var mldv2Routers = tcpip.Address(net.ParseIP("ff02::16").To16())
+
+// joinGroup joins group on the DUT's test interface with a new UDP socket and
+// returns the socket.
+func joinGroup(t *testing.T, dut *tb.DUT, group tcpip.Address) int32 {
+	t.Helper()
+
+	fd := dut.Socket(unix.AF_INET6, unix.SOCK_DGRAM, unix.IPPROTO_UDP)
+	// struct ipv6_mreq is the group address followed by the interface index.
+	mreq := make([]byte, header.IPv6AddressSize+4)
+	copy(mreq, group)
+	usermem.ByteOrder.PutUint32(mreq[header.IPv6AddressSize:], uint32(tb.RemoteInterfaceID))
+	dut.SetSockOpt(fd, unix.IPPROTO_IPV6, unix.IPV6_JOIN_GROUP, mreq)
+	return fd
+}
+
+// expectReport waits for an MLDv2 report from the DUT holding a record of type
+// typ for group. Other reports are skipped.
+func expectReport(t *testing.T, conn *tb.IPv6Conn, group tcpip.Address, typ tb.MLDv2AddressRecordType, timeout time.Duration) {
+	t.Helper()
+
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); {
+		got, err := conn.ExpectFrame(tb.Layers{
+			&tb.Ether{DstAddr: tb.LinkAddress(header.EthernetAddressFromMulticastIPv6Address(mldv2Routers))},
+			// MLD messages have a hop limit of 1 and a Router Alert option, RFC
+			// 3810 section 5.
+			&tb.IPv6{DstAddr: &mldv2Routers, HopLimit: tb.Uint8(1)},
+			&tb.IPv6HopByHopOptionsExtHdr{Options: tb.IPv6RouterAlertMLDOptions()},
+			&tb.ICMPv6{Type: tb.ICMPv6Type(header.ICMPv6MulticastListenerV2Report)},
+			&tb.MLDv2ListenerReport{},
+		}, time.Until(deadline))
+		if err != nil {
+			break
+		}
+		for _, r := range got[len(got)-1].(*tb.MLDv2ListenerReport).Records {
+			if *r.Type == typ && *r.MulticastAddress == group {
+				return
+			}
+		}
+	}
+	t.Fatalf("expected an MLDv2 report with a record of type %d for %s but got none", typ, group)
+}
+
+// TestMLDReportOnJoin joins a multicast group on the DUT and expects it to
+// report the change of its membership, RFC 3810 section 6.1.
+func TestMLDReportOnJoin(t *testing.T) {
+	dut := tb.NewDUT(t)
+	defer dut.TearDown()
+	ipv6Conn := tb.NewIPv6Conn(t, tb.IPv6{}, tb.IPv6{})
+	defer ipv6Conn.Close()
+
+	group := tcpip.Address(net.ParseIP("ff02::1234:1").To16())
+	fd := joinGroup(t, &dut, group)
+	defer dut.Close(fd)
+
+	expectReport(t, &ipv6Conn, group, tb.MLDv2ChangeToExclude, 5*time.Second)
+}
+
+// TestMLDGeneralQuery joins a multicast group on the DUT, sends a General
+// Query and expects the DUT to report its membership of the group, RFC 3810
+// section 6.2.
+func TestMLDGeneralQuery(t *testing.T) {
+	dut := tb.NewDUT(t)
+	defer dut.TearDown()
+	ipv6Conn := tb.NewIPv6Conn(t, tb.IPv6{}, tb.IPv6{})
+	conn := (*tb.Connection)(&ipv6Conn)
+	defer ipv6Conn.Close()
+
+	group := tcpip.Address(net.ParseIP("ff02::1234:2").To16())
+	fd := joinGroup(t, &dut, group)
+	defer dut.Close(fd)
+
+	allNodes := header.IPv6AllNodesMulticastAddress
+	conn.SendFrame(conn.CreateFrame(tb.Layers{
+		&tb.Ether{DstAddr: tb.LinkAddress(header.EthernetAddressFromMulticastIPv6Address(allNodes))},
+		&tb.IPv6{DstAddr: &allNodes, HopLimit: tb.Uint8(1)},
+	},
+		&tb.IPv6HopByHopOptionsExtHdr{
+			NextHeader: tb.IPv6ExtHdrIdent(header.IPv6ExtensionHeaderIdentifier(header.ICMPv6ProtocolNumber)),
+			Options:    tb.IPv6RouterAlertMLDOptions(),
+		},
+		&tb.ICMPv6{Code: tb.Byte(0)},
+		// An MLDv2 General Query, so that the DUT keeps using MLDv2.
+		&tb.MLDListenerQuery{
+			MaxResponseDelay: tb.Uint16(1000),
+			MulticastAddress: tb.Address(header.IPv6Any),
+			QRV:              tb.Uint8(2),
+			QQIC:             tb.Uint8(125),
+			Sources:          []tcpip.Address{},
+		},
+	))
+
+	expectReport(t, &ipv6Conn, group, tb.MLDv2ModeIsExclude, 5*time.Second)
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ndp_neighbor_solicitation_test
+
+import (
+	"flag"
+	"net"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	tb "gvisor.dev/gvisor/test/packetimpact/testbench"
+)
+
+func init() {
+	tb.RegisterFlags(flag.CommandLine)
+}
+
+// TestNDPNeighborSolicitation sends a Neighbor Solicitation for the DUT's
+// address to its solicited-node multicast address and expects a solicited
+// Neighbor Advertisement carrying the DUT's MAC address.
+func TestNDPNeighborSolicitation(t *testing.T) {
+	dut := tb.NewDUT(t)
+	defer dut.TearDown()
+	ipv6Conn := tb.NewIPv6Conn(t, tb.IPv6{}, tb.IPv6{})
+	conn := (*tb.Connection)(&ipv6Conn)
+	defer ipv6Conn.Close()
+
+	lMAC, err := tcpip.ParseMACAddress(tb.LocalMAC)
+	if err != nil {
+		t.Fatalf("can't parse local MAC %q: %s", tb.LocalMAC, err)
+	}
+	rMAC, err := tcpip.ParseMACAddress(tb.RemoteMAC)
+	if err != nil {
+		t.Fatalf("can't parse remote MAC %q: %s", tb.RemoteMAC, err)
+	}
+	rIP := tcpip.Address(net.ParseIP(tb.RemoteIPv6).To16())
+	snmc := header.SolicitedNodeAddr(rIP)
+
+	conn.SendFrame(conn.CreateFrame(tb.Layers{
+		&tb.Ether{DstAddr: tb.LinkAddress(header.EthernetAddressFromMulticastIPv6Address(snmc))},
+		// Neighbor Discovery messages must have a hop limit of 255, RFC 4861
+		// section 7.1.1.
+		&tb.IPv6{DstAddr: &snmc, HopLimit: tb.Uint8(255)},
+	},
+		&tb.ICMPv6{Code: tb.Byte(0)},
+		&tb.ICMPv6NeighborSolicitation{
+			TargetAddress: &rIP,
+			Options:       &tb.NDPOptions{SourceLinkLayerAddress: &lMAC},
+		},
+	))
+
+	if _, err := ipv6Conn.ExpectFrame(tb.Layers{
+		&tb.Ether{},
+		&tb.IPv6{HopLimit: tb.Uint8(255)},
+		&tb.ICMPv6{
+			Type: tb.ICMPv6Type(header.ICMPv6NeighborAdvert),
+			Code: tb.Byte(0),
+		},
+		&tb.ICMPv6NeighborAdvertisement{
+			SolicitedFlag: tb.Bool(true),
+			TargetAddress: &rIP,
+			Options:       &tb.NDPOptions{TargetLinkLayerAddress: &rMAC},
+		},
+	}, time.Second); err != nil {
+		t.Fatalf("expected a solicited Neighbor Advertisement but got none: %s", err)
+	}
+}
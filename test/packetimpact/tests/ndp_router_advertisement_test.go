@@ -0,0 +1,124 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ndp_router_advertisement_test
+
+import (
+	"flag"
+	"net"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	tb "gvisor.dev/gvisor/test/packetimpact/testbench"
+)
+
+func init() {
+	tb.RegisterFlags(flag.CommandLine)
+}
+
+// dadTimeout is how long to wait for the DUT to start Duplicate Address
+// Detection for an address it autoconfigured. It covers the random delay
+// before the first probe, RFC 4862 section 5.4.2.
+const dadTimeout = 5 * time.Second
+
+// sendRouterAdvertisement sends a Router Advertisement to the all-nodes
+// multicast address with the given hop limit, advertising prefix as on-link
+// and usable for stateless address autoconfiguration.
+func sendRouterAdvertisement(t *testing.T, conn *tb.Connection, hopLimit uint8, prefix tcpip.Address) {
+	t.Helper()
+
+	lMAC, err := tcpip.ParseMACAddress(tb.LocalMAC)
+	if err != nil {
+		t.Fatalf("can't parse local MAC %q: %s", tb.LocalMAC, err)
+	}
+	allNodes := header.IPv6AllNodesMulticastAddress
+	conn.SendFrame(conn.CreateFrame(tb.Layers{
+		&tb.Ether{DstAddr: tb.LinkAddress(header.EthernetAddressFromMulticastIPv6Address(allNodes))},
+		&tb.IPv6{DstAddr: &allNodes, HopLimit: tb.Uint8(hopLimit)},
+	},
+		&tb.ICMPv6{Code: tb.Byte(0)},
+		&tb.ICMPv6RouterAdvertisement{
+			CurrHopLimit:   tb.Uint8(64),
+			RouterLifetime: tb.Uint16(1800),
+			Options: &tb.NDPOptions{
+				SourceLinkLayerAddress: &lMAC,
+				PrefixInformation: []tb.NDPPrefixInformation{{
+					PrefixLength:      tb.Uint8(64),
+					OnLinkFlag:        tb.Bool(true),
+					AutonomousFlag:    tb.Bool(true),
+					ValidLifetime:     tb.Uint32(86400),
+					PreferredLifetime: tb.Uint32(14400),
+					Prefix:            &prefix,
+				}},
+			},
+		},
+	))
+}
+
+// expectDAD waits for the Neighbor Solicitation the DUT sends to perform
+// Duplicate Address Detection on the address it derives from prefix and its
+// MAC address.
+func expectDAD(t *testing.T, conn *tb.IPv6Conn, prefix tcpip.Address) error {
+	t.Helper()
+
+	rMAC, err := tcpip.ParseMACAddress(tb.RemoteMAC)
+	if err != nil {
+		t.Fatalf("can't parse remote MAC %q: %s", tb.RemoteMAC, err)
+	}
+	iid := header.EthernetAddressToModifiedEUI64(rMAC)
+	addr := prefix[:header.IIDOffsetInIPv6Address] + tcpip.Address(iid[:])
+	snmc := header.SolicitedNodeAddr(addr)
+	unspecified := header.IPv6Any
+	_, err = conn.ExpectFrame(tb.Layers{
+		&tb.Ether{DstAddr: tb.LinkAddress(header.EthernetAddressFromMulticastIPv6Address(snmc))},
+		&tb.IPv6{SrcAddr: &unspecified, DstAddr: &snmc, HopLimit: tb.Uint8(255)},
+		&tb.ICMPv6{Type: tb.ICMPv6Type(header.ICMPv6NeighborSolicit)},
+		&tb.ICMPv6NeighborSolicitation{TargetAddress: &addr},
+	}, dadTimeout)
+	return err
+}
+
+// TestNDPRouterAdvertisementSLAAC sends a Router Advertisement with an
+// autonomous prefix and expects the DUT to autoconfigure an address in it,
+// which it announces by performing Duplicate Address Detection.
+func TestNDPRouterAdvertisementSLAAC(t *testing.T) {
+	dut := tb.NewDUT(t)
+	defer dut.TearDown()
+	ipv6Conn := tb.NewIPv6Conn(t, tb.IPv6{}, tb.IPv6{})
+	defer ipv6Conn.Close()
+
+	prefix := tcpip.Address(net.ParseIP("2001:db8:1::").To16())
+	sendRouterAdvertisement(t, (*tb.Connection)(&ipv6Conn), 255, prefix)
+	if err := expectDAD(t, &ipv6Conn, prefix); err != nil {
+		t.Fatalf("expected DAD for an address in %s/64 but got none: %s", prefix, err)
+	}
+}
+
+// TestNDPRouterAdvertisementInvalidHopLimit sends a Router Advertisement with
+// a hop limit other than 255 and expects the DUT to ignore it, RFC 4861
+// section 6.1.2.
+func TestNDPRouterAdvertisementInvalidHopLimit(t *testing.T) {
+	dut := tb.NewDUT(t)
+	defer dut.TearDown()
+	ipv6Conn := tb.NewIPv6Conn(t, tb.IPv6{}, tb.IPv6{})
+	defer ipv6Conn.Close()
+
+	prefix := tcpip.Address(net.ParseIP("2001:db8:2::").To16())
+	sendRouterAdvertisement(t, (*tb.Connection)(&ipv6Conn), 64, prefix)
+	if err := expectDAD(t, &ipv6Conn, prefix); err == nil {
+		t.Fatalf("got DAD for an address in %s/64 from a Router Advertisement with hop limit 64, want it ignored", prefix)
+	}
+}
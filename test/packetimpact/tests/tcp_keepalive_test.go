@@ -0,0 +1,114 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp_keepalive_test
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/test/packetimpact/testbench"
+)
+
+func init() {
+	testbench.RegisterFlags(flag.CommandLine)
+}
+
+// TestKeepalive tests that the DUT sends keepalive probes on an idle
+// connection at the configured spacing, and that it aborts the connection
+// once TCP_KEEPCNT probes go unanswered.
+func TestKeepalive(t *testing.T) {
+	for _, tt := range []struct {
+		idle, interval time.Duration
+		count          int32
+	}{
+		{idle: 1 * time.Second, interval: 1 * time.Second, count: 2},
+		{idle: 2 * time.Second, interval: 1 * time.Second, count: 3},
+		{idle: 1 * time.Second, interval: 2 * time.Second, count: 2},
+	} {
+		t.Run(fmt.Sprintf("Idle=%s,Interval=%s,Count=%d", tt.idle, tt.interval, tt.count), func(t *testing.T) {
+			dut := testbench.NewDUT(t)
+			defer dut.TearDown()
+			listenFD, remotePort := dut.CreateListener(unix.SOCK_STREAM, unix.IPPROTO_TCP, 1)
+			defer dut.Close(listenFD)
+			conn := testbench.NewTCPIPv4(t, testbench.TCP{DstPort: &remotePort}, testbench.TCP{SrcPort: &remotePort})
+			defer conn.Close()
+			conn.Connect()
+			acceptFD, _ := dut.Accept(listenFD)
+			defer dut.Close(acceptFD)
+
+			for _, opt := range []struct {
+				level, name, val int32
+			}{
+				{unix.SOL_TCP, unix.TCP_KEEPIDLE, int32(tt.idle.Seconds())},
+				{unix.SOL_TCP, unix.TCP_KEEPINTVL, int32(tt.interval.Seconds())},
+				{unix.SOL_TCP, unix.TCP_KEEPCNT, tt.count},
+				{unix.SOL_SOCKET, unix.SO_KEEPALIVE, 1},
+			} {
+				dut.SetSockOptInt(acceptFD, opt.level, opt.name, opt.val)
+				if got := dut.GetSockOptInt(acceptFD, opt.level, opt.name); got != opt.val {
+					t.Fatalf("got sockopt(%d, %d) = %d, want %d", opt.level, opt.name, got, opt.val)
+				}
+			}
+			// The idle time counts from the last segment the DUT received,
+			// which completed the handshake just before now. The following
+			// probes are timed from the frames themselves.
+			start := time.Now()
+
+			// Keepalive probes carry the sequence number just before the next
+			// one expected from the DUT so that they elicit an ACK.
+			seq := uint32(*conn.RemoteSeqNum())
+			probe := testbench.TCP{
+				Flags:  testbench.Uint8(header.TCPFlagAck),
+				SeqNum: testbench.Uint32(seq - 1),
+			}
+			// Timers may fire up to half an interval late.
+			tolerance := tt.interval / 2
+			last := start
+			for i := int32(0); i < tt.count; i++ {
+				want := tt.interval
+				if i == 0 {
+					want = tt.idle
+				}
+				if _, err := conn.Expect(probe, want+tolerance); err != nil {
+					t.Fatalf("expected keepalive probe %d: %s", i, err)
+				}
+				now := conn.LastFrameTime()
+				if got := now.Sub(last); got < want-tolerance || got > want+tolerance {
+					t.Errorf("got keepalive probe %d after %s, want %s +/- %s", i, got, want, tolerance)
+				}
+				last = now
+			}
+
+			// With the last probe unanswered, the DUT gives up on the
+			// connection one interval later.
+			if _, err := conn.Expect(testbench.TCP{Flags: testbench.Uint8(header.TCPFlagRst | header.TCPFlagAck), SeqNum: testbench.Uint32(seq)}, tt.interval+tolerance); err != nil {
+				t.Fatalf("expected RST after %d unanswered keepalive probes: %s", tt.count, err)
+			}
+			if got := conn.LastFrameTime().Sub(last); got < tt.interval-tolerance || got > tt.interval+tolerance {
+				t.Errorf("got RST %s after the last keepalive probe, want %s +/- %s", got, tt.interval, tolerance)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), testbench.RPCTimeout)
+			defer cancel()
+			if ret, _, err := dut.RecvWithErrno(ctx, acceptFD, 100, 0); ret != -1 || err != unix.ETIMEDOUT {
+				t.Errorf("got recv = (%d, %s), want (-1, %s)", ret, err, unix.ETIMEDOUT)
+			}
+		})
+	}
+}
@@ -15,7 +15,6 @@
 package tcp_paws_mechanism_test
 
 import (
-	"encoding/hex"
 	"flag"
 	"testing"
 	"time"
@@ -37,70 +36,79 @@ func TestPAWSMechanism(t *testing.T) {
 	conn := testbench.NewTCPIPv4(t, testbench.TCP{DstPort: &remotePort}, testbench.TCP{SrcPort: &remotePort})
 	defer conn.Close()
 
-	options := make([]byte, header.TCPOptionTSLength)
-	header.EncodeTSOption(currentTS(), 0, options)
-	conn.Send(testbench.TCP{Flags: testbench.Uint8(header.TCPFlagSyn), Options: options})
-	synAck, err := conn.Expect(testbench.TCP{Flags: testbench.Uint8(header.TCPFlagSyn | header.TCPFlagAck)}, time.Second)
+	conn.Send(testbench.TCP{
+		Flags:      testbench.Uint8(header.TCPFlagSyn),
+		TCPOptions: timestamp(currentTS(), 0),
+	})
+	synAck, err := conn.Expect(testbench.TCP{
+		Flags:      testbench.Uint8(header.TCPFlagSyn | header.TCPFlagAck),
+		TCPOptions: &testbench.TCPOptions{Timestamp: &testbench.TCPTimestamp{}},
+	}, time.Second)
 	if err != nil {
-		t.Fatalf("didn't get synack during handshake: %s", err)
+		t.Fatalf("didn't get synack with TSOpt during handshake: %s", err)
 	}
-	parsedSynOpts := header.ParseSynOptions(synAck.Options, true)
-	if !parsedSynOpts.TS {
-		t.Fatalf("expected TSOpt from DUT, options we got:\n%s", hex.Dump(synAck.Options))
-	}
-	tsecr := parsedSynOpts.TSVal
-	header.EncodeTSOption(currentTS(), tsecr, options)
-	conn.Send(testbench.TCP{Flags: testbench.Uint8(header.TCPFlagAck), Options: options})
+	tsecr := *synAck.TCPOptions.Timestamp.TSVal
+	conn.Send(testbench.TCP{
+		Flags:      testbench.Uint8(header.TCPFlagAck),
+		TCPOptions: timestamp(currentTS(), tsecr),
+	})
 	acceptFD, _ := dut.Accept(listenFD)
 	defer dut.Close(acceptFD)
 
 	sampleData := []byte("Sample Data")
 	sentTSVal := currentTS()
-	header.EncodeTSOption(sentTSVal, tsecr, options)
 	// 3ms here is chosen arbitrarily to make sure we have increasing timestamps
 	// every time we send one, it should not cause any flakiness because timestamps
 	// only need to be non-decreasing.
 	time.Sleep(3 * time.Millisecond)
-	conn.Send(testbench.TCP{Flags: testbench.Uint8(header.TCPFlagAck), Options: options}, &testbench.Payload{Bytes: sampleData})
+	conn.Send(testbench.TCP{
+		Flags:      testbench.Uint8(header.TCPFlagAck),
+		TCPOptions: timestamp(sentTSVal, tsecr),
+	}, &testbench.Payload{Bytes: sampleData})
 
-	gotTCP, err := conn.Expect(testbench.TCP{Flags: testbench.Uint8(header.TCPFlagAck)}, time.Second)
+	// TSEcr should match our sent TSVal.
+	gotTCP, err := conn.Expect(testbench.TCP{
+		Flags:      testbench.Uint8(header.TCPFlagAck),
+		TCPOptions: &testbench.TCPOptions{Timestamp: &testbench.TCPTimestamp{TSEcr: testbench.Uint32(sentTSVal)}},
+	}, time.Second)
 	if err != nil {
-		t.Fatalf("expected an ACK but got none: %s", err)
-	}
-
-	parsedOpts := header.ParseTCPOptions(gotTCP.Options)
-	if !parsedOpts.TS {
-		t.Fatalf("expected TS option in response, options we got:\n%s", hex.Dump(gotTCP.Options))
-	}
-	if parsedOpts.TSVal < tsecr {
-		t.Fatalf("TSVal should be non-decreasing, but %d < %d", parsedOpts.TSVal, tsecr)
+		t.Fatalf("expected an ACK with TSEcr %d but got none: %s", sentTSVal, err)
 	}
-	if parsedOpts.TSEcr != sentTSVal {
-		t.Fatalf("TSEcr should match our sent TSVal, %d != %d", parsedOpts.TSEcr, sentTSVal)
+	if got := *gotTCP.TCPOptions.Timestamp.TSVal; got < tsecr {
+		t.Fatalf("TSVal should be non-decreasing, but %d < %d", got, tsecr)
 	}
-	tsecr = parsedOpts.TSVal
+	tsecr = *gotTCP.TCPOptions.Timestamp.TSVal
 	lastAckNum := gotTCP.AckNum
 
 	badTSVal := sentTSVal - 100
-	header.EncodeTSOption(badTSVal, tsecr, options)
 	// 3ms here is chosen arbitrarily and this time.Sleep() should not cause flakiness
 	// due to the exact same reasoning discussed above.
 	time.Sleep(3 * time.Millisecond)
-	conn.Send(testbench.TCP{Flags: testbench.Uint8(header.TCPFlagAck), Options: options}, &testbench.Payload{Bytes: sampleData})
+	conn.Send(testbench.TCP{
+		Flags:      testbench.Uint8(header.TCPFlagAck),
+		TCPOptions: timestamp(badTSVal, tsecr),
+	}, &testbench.Payload{Bytes: sampleData})
 
-	gotTCP, err = conn.Expect(testbench.TCP{AckNum: lastAckNum, Flags: testbench.Uint8(header.TCPFlagAck)}, time.Second)
+	gotTCP, err = conn.Expect(testbench.TCP{
+		AckNum:     lastAckNum,
+		Flags:      testbench.Uint8(header.TCPFlagAck),
+		TCPOptions: &testbench.TCPOptions{Timestamp: &testbench.TCPTimestamp{TSEcr: testbench.Uint32(sentTSVal)}},
+	}, time.Second)
 	if err != nil {
-		t.Fatalf("expected segment with AckNum %d but got none: %s", lastAckNum, err)
+		t.Fatalf("expected segment with AckNum %d and TSEcr %d but got none: %s", lastAckNum, sentTSVal, err)
 	}
-	parsedOpts = header.ParseTCPOptions(gotTCP.Options)
-	if !parsedOpts.TS {
-		t.Fatalf("expected TS option in response, options we got:\n%s", hex.Dump(gotTCP.Options))
+	if got := *gotTCP.TCPOptions.Timestamp.TSVal; got < tsecr {
+		t.Fatalf("TSVal should be non-decreasing, but %d < %d", got, tsecr)
 	}
-	if parsedOpts.TSVal < tsecr {
-		t.Fatalf("TSVal should be non-decreasing, but %d < %d", parsedOpts.TSVal, tsecr)
-	}
-	if parsedOpts.TSEcr != sentTSVal {
-		t.Fatalf("TSEcr should match our sent TSVal, %d != %d", parsedOpts.TSEcr, sentTSVal)
+}
+
+// timestamp returns TCP options holding only a Timestamps option.
+func timestamp(tsVal, tsEcr uint32) *testbench.TCPOptions {
+	return &testbench.TCPOptions{
+		Timestamp: &testbench.TCPTimestamp{
+			TSVal: testbench.Uint32(tsVal),
+			TSEcr: testbench.Uint32(tsEcr),
+		},
 	}
 }
 
@@ -16,6 +16,7 @@ package tcp_retransmits_test
 
 import (
 	"flag"
+	"fmt"
 	"testing"
 	"time"
 
@@ -28,57 +29,80 @@ func init() {
 	testbench.RegisterFlags(flag.CommandLine)
 }
 
+// minRTO is the lower bound on the retransmission timeout. RFC 6298 section
+// 2.4 recommends rounding the RTO up to 1 second, but both Linux and netstack
+// use a 200ms floor instead.
+const minRTO = 200 * time.Millisecond
+
 // TestRetransmits tests retransmits occur at exponentially increasing
-// time intervals.
+// time intervals for a range of simulated round-trip times.
 func TestRetransmits(t *testing.T) {
-	dut := testbench.NewDUT(t)
-	defer dut.TearDown()
-	listenFd, remotePort := dut.CreateListener(unix.SOCK_STREAM, unix.IPPROTO_TCP, 1)
-	defer dut.Close(listenFd)
-	conn := testbench.NewTCPIPv4(t, testbench.TCP{DstPort: &remotePort}, testbench.TCP{SrcPort: &remotePort})
-	defer conn.Close()
+	for _, rtt := range []time.Duration{
+		0,
+		50 * time.Millisecond,
+		250 * time.Millisecond,
+	} {
+		t.Run(fmt.Sprintf("RTT=%s", rtt), func(t *testing.T) {
+			dut := testbench.NewDUT(t)
+			defer dut.TearDown()
+			listenFd, remotePort := dut.CreateListener(unix.SOCK_STREAM, unix.IPPROTO_TCP, 1)
+			defer dut.Close(listenFd)
+			conn := testbench.NewTCPIPv4(t, testbench.TCP{DstPort: &remotePort}, testbench.TCP{SrcPort: &remotePort})
+			defer conn.Close()
+			conn.SetACKDelay(rtt)
 
-	conn.Connect()
-	acceptFd, _ := dut.Accept(listenFd)
-	defer dut.Close(acceptFd)
+			conn.Connect()
+			acceptFd, _ := dut.Accept(listenFd)
+			defer dut.Close(acceptFd)
 
-	dut.SetSockOptInt(acceptFd, unix.IPPROTO_TCP, unix.TCP_NODELAY, 1)
+			dut.SetSockOptInt(acceptFd, unix.IPPROTO_TCP, unix.TCP_NODELAY, 1)
 
-	sampleData := []byte("Sample Data")
-	samplePayload := &testbench.Payload{Bytes: sampleData}
+			sampleData := []byte("Sample Data")
+			samplePayload := &testbench.Payload{Bytes: sampleData}
 
-	dut.Send(acceptFd, sampleData, 0)
-	if _, err := conn.ExpectData(&testbench.TCP{}, samplePayload, time.Second); err != nil {
-		t.Fatalf("expected payload was not received: %s", err)
-	}
-	// Give a chance for the dut to estimate RTO with RTT from the DATA-ACK.
-	// TODO(gvisor.dev/issue/2685) Estimate RTO during handshake, after which
-	// we can skip sending this ACK.
-	conn.Send(testbench.TCP{Flags: testbench.Uint8(header.TCPFlagAck)})
+			dut.Send(acceptFd, sampleData, 0)
+			if _, err := conn.ExpectData(&testbench.TCP{}, samplePayload, time.Second); err != nil {
+				t.Fatalf("expected payload was not received: %s", err)
+			}
+			// Give a chance for the dut to estimate RTO with RTT from the DATA-ACK.
+			// TODO(gvisor.dev/issue/2685) Estimate RTO during handshake, after which
+			// we can skip sending this ACK.
+			conn.Send(testbench.TCP{Flags: testbench.Uint8(header.TCPFlagAck)})
 
-	startRTO := time.Second
-	current := startRTO
-	first := time.Now()
-	dut.Send(acceptFd, sampleData, 0)
-	seq := testbench.Uint32(uint32(*conn.RemoteSeqNum()))
-	if _, err := conn.ExpectData(&testbench.TCP{SeqNum: seq}, samplePayload, startRTO); err != nil {
-		t.Fatalf("expected payload was not received: %s", err)
-	}
-	// Expect retransmits of the same segment.
-	for i := 0; i < 5; i++ {
-		start := time.Now()
-		if _, err := conn.ExpectData(&testbench.TCP{SeqNum: seq}, samplePayload, 2*current); err != nil {
-			t.Fatalf("expected payload was not received: %s loop %d", err, i)
-		}
-		if i == 0 {
-			startRTO = time.Now().Sub(first)
-			current = 2 * startRTO
-			continue
-		}
-		// Check if the probes came at exponentially increasing intervals.
-		if p := time.Since(start); p < current-startRTO {
-			t.Fatalf("retransmit came sooner interval %d probe %d", p, i)
-		}
-		current *= 2
+			// The RTO backs off up to 2^4 times its initial value, which is
+			// itself bounded by a few RTTs after the samples taken above.
+			const retransmits = 4
+			timeout := (1 << retransmits) * (minRTO + 4*rtt)
+			dut.Send(acceptFd, sampleData, 0)
+			intervals, err := conn.ExpectRetransmits(samplePayload, retransmits, timeout)
+			if err != nil {
+				t.Fatalf("failed to observe retransmits: %s", err)
+			}
+
+			// RFC 6298 section 2: the RTO is SRTT plus a non-negative variance
+			// term, so it can't be smaller than the measured RTT, nor smaller
+			// than the minimum RTO.
+			lowerBound := minRTO
+			if rtt > lowerBound {
+				lowerBound = rtt
+			}
+			if got := intervals[0]; got < lowerBound {
+				t.Errorf("got initial RTO = %s, want >= %s", got, lowerBound)
+			}
+
+			// RFC 6298 section 5.5: the timer backs off by doubling. The
+			// intervals are measured by the testbench, so allow them to be off
+			// by up to one RTT in either direction.
+			tolerance := rtt
+			if tolerance < minRTO/2 {
+				tolerance = minRTO / 2
+			}
+			for i := 1; i < len(intervals); i++ {
+				want := 2 * intervals[i-1]
+				if got := intervals[i]; got < want-tolerance || got > want+tolerance {
+					t.Errorf("got retransmit interval %d = %s, want %s +/- %s (intervals: %s)", i, got, want, tolerance, intervals)
+				}
+			}
+		})
 	}
 }
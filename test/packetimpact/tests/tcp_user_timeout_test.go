@@ -15,6 +15,7 @@
 package tcp_user_timeout_test
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"testing"
@@ -103,3 +104,71 @@ func TestTCPUserTimeout(t *testing.T) {
 		}
 	}
 }
+
+// TestTCPUserTimeoutAbort tests that the DUT aborts a connection with
+// unacknowledged data in flight once TCP_USER_TIMEOUT expires, and that a
+// blocking recv on it then fails with ETIMEDOUT.
+func TestTCPUserTimeoutAbort(t *testing.T) {
+	for _, userTimeout := range []time.Duration{
+		1 * time.Second,
+		3 * time.Second,
+	} {
+		t.Run(fmt.Sprintf("UserTimeout=%s", userTimeout), func(t *testing.T) {
+			dut := testbench.NewDUT(t)
+			defer dut.TearDown()
+			listenFD, remotePort := dut.CreateListener(unix.SOCK_STREAM, unix.IPPROTO_TCP, 1)
+			defer dut.Close(listenFD)
+			conn := testbench.NewTCPIPv4(t, testbench.TCP{DstPort: &remotePort}, testbench.TCP{SrcPort: &remotePort})
+			defer conn.Close()
+			conn.Connect()
+			acceptFD, _ := dut.Accept(listenFD)
+			defer dut.Close(acceptFD)
+
+			want := int32(userTimeout.Milliseconds())
+			dut.SetSockOptInt(acceptFD, unix.SOL_TCP, unix.TCP_USER_TIMEOUT, want)
+			if got := dut.GetSockOptInt(acceptFD, unix.SOL_TCP, unix.TCP_USER_TIMEOUT); got != want {
+				t.Fatalf("got TCP_USER_TIMEOUT = %d, want %d", got, want)
+			}
+
+			// The user timeout starts with the first unacknowledged
+			// transmission. The testbench never acknowledges it.
+			sampleData := []byte("Sample Data")
+			samplePayload := &testbench.Payload{Bytes: sampleData}
+			seq := testbench.Uint32(uint32(*conn.RemoteSeqNum()))
+			dut.Send(acceptFD, sampleData, 0)
+			if _, err := conn.ExpectData(&testbench.TCP{SeqNum: seq}, samplePayload, time.Second); err != nil {
+				t.Fatalf("expected payload was not received: %s", err)
+			}
+			start := conn.LastFrameTime()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 3*userTimeout)
+			defer cancel()
+			ret, _, err := dut.RecvWithErrno(ctx, acceptFD, 100, 0)
+			aborted := time.Now()
+			if ret != -1 || err != unix.ETIMEDOUT {
+				t.Fatalf("got recv = (%d, %s), want (-1, %s)", ret, err, unix.ETIMEDOUT)
+			}
+			if elapsed := aborted.Sub(start); elapsed < userTimeout {
+				t.Errorf("connection aborted after %s, want >= %s", elapsed, userTimeout)
+			}
+
+			// The retransmissions sent until the abort are still queued in
+			// the sniffer with the times they were captured. The DUT must
+			// not retransmit once the user timeout has expired, and it
+			// notices the expiry when the retransmission timer next fires.
+			last := start
+			for {
+				if _, err := conn.ExpectData(&testbench.TCP{SeqNum: seq}, samplePayload, 100*time.Millisecond); err != nil {
+					break
+				}
+				last = conn.LastFrameTime()
+				if elapsed := last.Sub(start); elapsed > userTimeout {
+					t.Errorf("got retransmit %s after the first transmission, want <= %s", elapsed, userTimeout)
+				}
+			}
+			if limit := last.Add(userTimeout); aborted.After(limit) {
+				t.Errorf("connection aborted %s after the last retransmit, want <= %s", aborted.Sub(last), userTimeout)
+			}
+		})
+	}
+}
@@ -357,3 +357,61 @@ func TestCgroupParent(t *testing.T) {
 		t.Errorf("cgroup control %q processes: %v", "memory", err)
 	}
 }
+
+// TestCgroupPath checks that CgroupPath finds the cgroup of a container with
+// a custom cgroup parent.
+func TestCgroupPath(t *testing.T) {
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+
+	// The form of the cgroup parent, and where the container's cgroup ends
+	// up, depend on the daemon's cgroup driver.
+	driver, err := dockerutil.CgroupDriver(ctx)
+	if err != nil {
+		t.Fatalf("CgroupDriver() failed: %v", err)
+	}
+	name := testutil.RandomID("runsc")
+	var parent string
+	var wantPath func() string
+	switch driver {
+	case "cgroupfs":
+		parent = "/" + name
+		wantPath = func() string { return filepath.Join(parent, d.ID()) }
+	case "systemd":
+		// The slice "runsc-<ID>.slice" is nested in "runsc.slice".
+		parent = name + ".slice"
+		wantPath = func() string { return filepath.Join("/runsc.slice", parent, "docker-"+d.ID()+".scope") }
+	default:
+		t.Skipf("unsupported cgroup driver %q", driver)
+	}
+
+	const limit = 256 << 20
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image:        "basic/alpine",
+		Memory:       limit,
+		CgroupParent: parent,
+	}, "sleep", "10000"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+
+	path, err := d.CgroupPath(ctx)
+	if err != nil {
+		t.Fatalf("CgroupPath() failed: %v", err)
+	}
+	if want := wantPath(); path != want {
+		t.Errorf("got CgroupPath() = %q, want %q", path, want)
+	}
+	// The hierarchy is unified with cgroup v2.
+	file := filepath.Join("/sys/fs/cgroup", path, "memory.max")
+	if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); err != nil {
+		file = filepath.Join("/sys/fs/cgroup/memory", path, "memory.limit_in_bytes")
+	}
+	out, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to read memory limit: %v", err)
+	}
+	if got, want := strings.TrimSpace(string(out)), strconv.Itoa(limit); got != want {
+		t.Errorf("got memory limit %s in %s, want %s", got, file, want)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2020 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package root
+
+import (
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+// TestProfile checks that profiles of the sandbox are collected while a
+// container runs.
+func TestProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+	p := dockerutil.NewProfile(d, []string{"cpu", "heap"}, time.Second, dir)
+
+	if err := d.Spawn(ctx, dockerutil.RunOpts{
+		Image: "basic/alpine",
+	}, "sh", "-c", "while true; do :; done"); err != nil {
+		t.Fatalf("docker run failed: %v", err)
+	}
+	if err := p.Wait(); err != nil {
+		t.Fatalf("collecting profiles failed: %v", err)
+	}
+
+	for _, typ := range []string{"cpu", "heap"} {
+		path := filepath.Join(dir, d.Name+"."+typ+".pprof")
+		if err := verifyProfile(path); err != nil {
+			t.Errorf("%s profile %q is invalid: %v", typ, path, err)
+		}
+	}
+}
+
+// TestBenchmarkProfile checks that the benchmark harness collects a CPU
+// profile of a server with --pprof-cpu.
+func TestBenchmarkProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for name, value := range map[string]string{
+		"pprof-cpu":   "true",
+		"profile-dir": dir,
+	} {
+		old := flag.Lookup(name).Value.String()
+		if err := flag.Set(name, value); err != nil {
+			t.Fatalf("flag.Set(%q, %q) failed: %v", name, value, err)
+		}
+		defer flag.Set(name, old)
+	}
+
+	ctx := context.Background()
+	var h harness.Harness
+	var name string
+	var benchErr error
+	testing.Benchmark(func(b *testing.B) {
+		d := dockerutil.MakeContainer(ctx, b)
+		defer d.CleanUp(ctx)
+		if err := d.Spawn(ctx, dockerutil.RunOpts{
+			Image: "basic/alpine",
+		}, "sh", "-c", "while true; do :; done"); err != nil {
+			benchErr = fmt.Errorf("docker run failed: %v", err)
+			return
+		}
+		name = d.Name
+
+		stop := h.StartProfile(ctx, b, d)
+		for i := 0; i < b.N; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		stop()
+	})
+	if benchErr != nil {
+		t.Fatal(benchErr)
+	}
+
+	// The profile is in a directory named after the benchmark.
+	var paths []string
+	if err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Name() == name+".cpu.pprof" {
+			paths = append(paths, path)
+		}
+		return err
+	}); err != nil {
+		t.Fatalf("filepath.Walk failed: %v", err)
+	}
+	if len(paths) != 1 {
+		t.Fatalf("got CPU profiles %v, want one of %s", paths, name)
+	}
+	if err := verifyProfile(paths[0]); err != nil {
+		t.Errorf("CPU profile %q is invalid: %v", paths[0], err)
+	}
+}
+
+// verifyProfile checks that the file at path looks like a pprof profile: a
+// gzipped protocol buffer starting with the profile's sample types (field 1,
+// length-delimited).
+func verifyProfile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("empty profile")
+	}
+	if data[0] != 0x0a {
+		return fmt.Errorf("not a profile proto, starts with %#x", data[0])
+	}
+	return nil
+}